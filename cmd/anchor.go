@@ -0,0 +1,126 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dpmcgarry/marine-sensorhub-mqtt/internal"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var anchorRadius float64
+var anchorLat float64
+var anchorLon float64
+
+var anchorCmd = &cobra.Command{
+	Use:   "anchor",
+	Short: "Sets and Clears the Anchor Watch",
+	Long: `Sends anchor watch commands to the sub daemon over its MQTT
+command topic and shows the last saved anchor state.`,
+}
+
+var anchorDropCmd = &cobra.Command{
+	Use:   "drop",
+	Short: "Drops the Anchor",
+	Long: `Starts the anchor watch at the current position, or at
+--lat and --lon when both are given.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		anchorCommand := internal.AnchorCommand{
+			Action: internal.AnchorDrop,
+			Radius: anchorRadius,
+		}
+		if cmd.Flags().Changed("lat") != cmd.Flags().Changed("lon") {
+			log.Fatal().Msg("--lat and --lon must be given together")
+			os.Exit(2)
+		}
+		if cmd.Flags().Changed("lat") {
+			anchorCommand.Lat = &anchorLat
+			anchorCommand.Lon = &anchorLon
+		}
+		sendAnchorCommand(anchorCommand)
+	},
+}
+
+var anchorRaiseCmd = &cobra.Command{
+	Use:   "raise",
+	Short: "Raises the Anchor",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sendAnchorCommand(internal.AnchorCommand{Action: internal.AnchorRaise})
+	},
+}
+
+var anchorStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Shows the Last Saved Anchor State",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		state := internal.NewAnchorWatch(internal.LoadAnchorConfig(), internal.LoadDataDir()).State()
+		if !state.Set {
+			fmt.Println("Anchor is not set")
+			return
+		}
+		fmt.Printf("Anchor set at %.6f, %.6f since %v with a %.0f m radius\n", state.Lat, state.Lon,
+			state.DroppedAt.Local().Format("2006-01-02 15:04"), state.RadiusMeters)
+		fmt.Printf("Max distance %.0f m, alarm %v\n", state.MaxDistanceMeters, state.Alarm)
+	},
+}
+
+func sendAnchorCommand(anchorCommand internal.AnchorCommand) {
+	subConf, err := internal.LoadSubscribeServerConfig()
+	if err != nil {
+		log.Fatal().Msgf("Error reading subscription config: %v", err.Error())
+		os.Exit(2)
+	}
+	jsonData, err := json.Marshal(anchorCommand)
+	if err != nil {
+		log.Fatal().Msgf("Error Serializing JSON: %v", err.Error())
+		os.Exit(2)
+	}
+	// A one-off connection must not take over the daemon's client ID or persistent session
+	brokerConf := subConf.RepostBrokerConfig()
+	brokerConf.ClientID = ""
+	brokerConf.CleanSession = true
+	mqttClient := internal.NewBrokerClient(brokerConf)
+	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+		log.Fatal().Msgf("Error Connecting to host: %v", token.Error())
+		os.Exit(2)
+	}
+	defer mqttClient.Disconnect(250)
+	token := mqttClient.Publish(subConf.Anchor.CommandTopic, byte(1), false, string(jsonData))
+	if !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		log.Fatal().Msgf("Error sending anchor command: %v", token.Error())
+		os.Exit(2)
+	}
+	log.Info().Msgf("Sent anchor %v to %v", anchorCommand.Action, subConf.Anchor.CommandTopic)
+}
+
+func init() {
+	rootCmd.AddCommand(anchorCmd)
+	anchorCmd.AddCommand(anchorDropCmd)
+	anchorCmd.AddCommand(anchorRaiseCmd)
+	anchorCmd.AddCommand(anchorStatusCmd)
+	anchorDropCmd.Flags().Float64VarP(&anchorRadius, "radius", "r", 0, "Swing radius in meters (defaults to the configured radius)")
+	anchorDropCmd.Flags().Float64Var(&anchorLat, "lat", 0, "Anchor latitude")
+	anchorDropCmd.Flags().Float64Var(&anchorLon, "lon", 0, "Anchor longitude")
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/dpmcgarry/marine-sensorhub-mqtt/internal"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Validates and Prints the Config",
+	Long:  `Checks the config file and shows the settings the daemon will use.`,
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the Config File",
+	Long: `Checks every key of the config file against the schema and
+reports each problem with its key path. Exits non-zero when there
+are problems.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		problems := internal.ValidateConfig()
+		for _, problem := range problems {
+			fmt.Println(problem.String())
+		}
+		if len(problems) > 0 {
+			fmt.Printf("%v: %v problems found\n", viper.ConfigFileUsed(), len(problems))
+			os.Exit(1)
+		}
+		fmt.Printf("%v: OK\n", viper.ConfigFileUsed())
+	},
+}
+
+var configPrintCmd = &cobra.Command{
+	Use:   "print",
+	Short: "Prints the Effective Config",
+	Long: `Prints the config with every default applied as JSON.
+Passwords and tokens are redacted.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		conf, err := internal.LoadEffectiveConfig()
+		if err != nil {
+			log.Fatal().Msgf("Error loading config: %v", err.Error())
+			os.Exit(2)
+		}
+		jsonData, err := json.MarshalIndent(conf, "", "  ")
+		if err != nil {
+			log.Fatal().Msgf("Error Serializing JSON: %v", err.Error())
+			os.Exit(2)
+		}
+		fmt.Println(string(jsonData))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPrintCmd)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/dpmcgarry/marine-sensorhub-mqtt/internal"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var listPassages bool
+var exportFormat string
+var exportOutput string
+
+var exportCmd = &cobra.Command{
+	Use:   "export [passage-id|latest]",
+	Short: "Exports Recorded Passages",
+	Long: `Exports a passage recorded by the sub daemon as GPX or KML.
+Use --list to show the recorded passage IDs.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dataDir := internal.LoadDataDir()
+		ids, err := internal.ListPassages(dataDir)
+		if err != nil {
+			log.Fatal().Msgf("Error listing passages: %v", err.Error())
+			os.Exit(2)
+		}
+		if listPassages {
+			for _, id := range ids {
+				passage, err := internal.LoadPassage(dataDir, id)
+				if err != nil {
+					log.Warn().Msgf("Error loading passage %v: %v", id, err.Error())
+					continue
+				}
+				end := "underway"
+				if passage.End != nil {
+					end = passage.End.Local().Format("2006-01-02 15:04")
+				}
+				fmt.Printf("%v  %v -> %v  %.1f nm  %v points\n", passage.ID,
+					passage.Start.Local().Format("2006-01-02 15:04"), end, passage.DistanceNM, len(passage.Track))
+			}
+			return
+		}
+		if exportFormat != "gpx" && exportFormat != "kml" {
+			log.Fatal().Msgf("Unknown export format %v. Use gpx or kml", exportFormat)
+			os.Exit(2)
+		}
+		if len(args) != 1 {
+			log.Fatal().Msg("A passage ID is required unless --list is set")
+			os.Exit(2)
+		}
+		id := args[0]
+		if id == "latest" {
+			if len(ids) == 0 {
+				log.Fatal().Msgf("No passages recorded in %v", dataDir)
+				os.Exit(2)
+			}
+			id = ids[len(ids)-1]
+		}
+		passage, err := internal.LoadPassage(dataDir, id)
+		if err != nil {
+			log.Fatal().Msgf("Error loading passage %v: %v", id, err.Error())
+			os.Exit(2)
+		}
+		if exportOutput == "" {
+			exportOutput = passage.ID + "." + exportFormat
+		}
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			log.Fatal().Msgf("Error creating output file: %v", err.Error())
+			os.Exit(2)
+		}
+		defer f.Close()
+		switch exportFormat {
+		case "gpx":
+			err = internal.ExportPassageGPX(f, passage)
+		case "kml":
+			err = internal.ExportPassageKML(f, passage)
+		}
+		if err != nil {
+			log.Fatal().Msgf("Error exporting passage %v: %v", passage.ID, err.Error())
+			os.Exit(2)
+		}
+		log.Info().Msgf("Exported passage %v to %v", passage.ID, exportOutput)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().BoolVarP(&listPassages, "list", "l", false, "List recorded passages")
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "gpx", "Export format (gpx or kml)")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file (defaults to <passage-id>.<format>)")
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dpmcgarry/marine-sensorhub-mqtt/internal"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var doneHours float64
+var doneDate string
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Shows and Updates Maintenance Items",
+	Long: `Shows the status of the maintenance items in the config file
+and records when an item was done.`,
+}
+
+var maintenanceListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists Maintenance Items and Their Status",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		scheduler := internal.NewMaintenanceScheduler(internal.LoadMaintenanceConfig(), internal.LoadDataDir())
+		for _, status := range scheduler.Statuses(time.Now()) {
+			due := ""
+			if status.HoursRemaining != nil {
+				due += fmt.Sprintf("  %.1f h left", *status.HoursRemaining)
+			}
+			if status.DaysRemaining != nil {
+				due += fmt.Sprintf("  %.0f days left (%v)", *status.DaysRemaining, status.DueDate.Local().Format("2006-01-02"))
+			}
+			fmt.Printf("%-20v %-9v%v\n", status.Name, status.State, due)
+		}
+	},
+}
+
+var maintenanceDoneCmd = &cobra.Command{
+	Use:   "done <item>",
+	Short: "Marks a Maintenance Item Done",
+	Long: `Records a maintenance item as done. Defaults to now and the
+last engine hours recorded by the sub daemon.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		when := time.Now()
+		if doneDate != "" {
+			var err error
+			when, err = time.ParseInLocation("2006-01-02", doneDate, time.Local)
+			if err != nil {
+				log.Fatal().Msgf("Error parsing date %v: %v", doneDate, err.Error())
+				os.Exit(2)
+			}
+		}
+		hours := -1.0
+		if cmd.Flags().Changed("hours") {
+			hours = doneHours
+		}
+		scheduler := internal.NewMaintenanceScheduler(internal.LoadMaintenanceConfig(), internal.LoadDataDir())
+		if err := scheduler.MarkDone(args[0], when, hours); err != nil {
+			log.Fatal().Msgf("Error marking %v done: %v", args[0], err.Error())
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(maintenanceCmd)
+	maintenanceCmd.AddCommand(maintenanceListCmd)
+	maintenanceCmd.AddCommand(maintenanceDoneCmd)
+	maintenanceDoneCmd.Flags().Float64Var(&doneHours, "hours", 0, "Engine hours when the item was done")
+	maintenanceDoneCmd.Flags().StringVar(&doneDate, "date", "", "Date the item was done (YYYY-MM-DD)")
+}
@@ -46,6 +46,7 @@ When messages are received, processes them.`,
 			log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 		}
 		log.Debug().Msgf("%v", string(jsonData))
+		internal.DaemonVersion = version
 		internal.HandleSubscriptions(subConf)
 		log.Info().Msg("Running in daemon mode")
 		sigs := make(chan os.Signal, 1)
@@ -62,6 +63,7 @@ When messages are received, processes them.`,
 
 		log.Info().Msg("Awaiting Signal")
 		<-done
+		internal.StopSubscriptions()
 		log.Info().Msg("Exiting")
 	},
 }
@@ -0,0 +1,212 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"strings"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/rs/zerolog/log"
+)
+
+const aisVesselPrefix = "/vessels/urn:mrn:imo:mmsi:"
+
+// AISTarget represents data about another vessel received over AIS
+// CPANM, TCPAMinutes and Warning are filled in by the AIS tracker
+type AISTarget struct {
+	BaseSensorData
+	MMSI        string  `json:"MMSI,omitempty"`
+	Name        string  `json:"Name,omitempty"`
+	Lat         float64 `json:"Lat,omitempty"`
+	Lon         float64 `json:"Lon,omitempty"`
+	SOG         float64 `json:"SOG,omitempty"`
+	COGTrue     float64 `json:"COGTrue,omitempty"`
+	HeadingTrue float64 `json:"HeadingTrue,omitempty"`
+	CPANM       float64 `json:"CPANM,omitempty"`
+	TCPAMinutes float64 `json:"TCPAMinutes,omitempty"`
+	Warning     bool    `json:"Warning,omitempty"`
+}
+
+// aisPathMappings are the SignalK paths the ais handler parses
+var aisPathMappings = []PathMapping{
+	{Path: "navigation.position", Measurement: "ais", Field: "Lat", Key: "latitude"},
+	{Path: "navigation.position", Measurement: "ais", Field: "Lon", Key: "longitude"},
+	{Path: "navigation.speedOverGround", Measurement: "ais", Field: "SOG", Conversion: "mps-to-knots"},
+	{Path: "navigation.courseOverGroundTrue", Measurement: "ais", Field: "COGTrue", Conversion: "radians-to-degrees"},
+	{Path: "navigation.headingTrue", Measurement: "ais", Field: "HeadingTrue", Conversion: "radians-to-degrees"},
+	{Path: "name", Measurement: "ais", Field: "Name"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "ais",
+		TopicsKey:   "aisTopics",
+		Handler:     OnAISMessage,
+		NewData:     func() SensorData { return &AISTarget{} },
+		Mappings:    aisPathMappings,
+		UpdateState: updateAISState,
+	})
+}
+
+func updateAISState(client MQTT.Client, measurement string, data SensorData) {
+	if SharedAISTracker != nil {
+		SharedAISTracker.Update(client, measurement, data.(*AISTarget), SharedVesselState.Snapshot())
+	}
+}
+
+// OnAISMessage is called when an AIS target message is received
+func OnAISMessage(client MQTT.Client, message MQTT.Message) {
+	dispatchMessage(handleAISMessage, client, message)
+}
+
+// handleAISMessage processes AIS target messages
+func handleAISMessage(client MQTT.Client, message MQTT.Message) {
+	target := &AISTarget{}
+	target.MMSI = mmsiFromTopic(message.Topic())
+	if target.MMSI == "" {
+		// A vessels/+ wildcard also matches vessels/self which the other handlers already cover
+		log.Trace().Msgf("No MMSI found in topic %v", message.Topic())
+		return
+	}
+	HandleSensorMessage(client, message, target, processAISData)
+}
+
+// mmsiFromTopic pulls the MMSI out of a topic like .../vessels/urn:mrn:imo:mmsi:366123456/navigation/position
+func mmsiFromTopic(topic string) string {
+	idx := strings.Index(topic, aisVesselPrefix)
+	if idx < 0 {
+		return ""
+	}
+	mmsi := topic[idx+len(aisVesselPrefix):]
+	if end := strings.Index(mmsi, "/"); end >= 0 {
+		mmsi = mmsi[:end]
+	}
+	return mmsi
+}
+
+// processAISData processes specific AIS target data fields
+func processAISData(rawData map[string]any, measurement string, data SensorData) {
+	target, ok := data.(*AISTarget)
+	if !ok {
+		log.Error().Msg("Failed to cast data to AISTarget type")
+		return
+	}
+
+	if !applyPathMappings(rawData, measurement, target) {
+		// AIS targets carry many static fields like design and registrations that are not tracked
+		log.Debug().Msgf("Unhandled AIS measurement %v", measurement)
+	}
+}
+
+// ToJSON serializes the data to JSON
+func (meas *AISTarget) ToJSON() string {
+	jsonData, err := MarshalSensorJSON(meas)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+	}
+	return string(jsonData)
+}
+
+// LogJSON logs the JSON representation of the data
+func (meas *AISTarget) LogJSON() {
+	json := meas.ToJSON()
+	log.Trace().Msgf("AIS: %v", json)
+	if SharedSubscriptionConfig.Categories["ais"].Verbose {
+		log.Info().Msgf("AIS: %v", json)
+	}
+}
+
+// IsEmpty checks if the data has any meaningful values
+func (meas *AISTarget) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
+	if meas.Lat == 0.0 && meas.Lon == 0.0 && meas.SOG == 0.0 && meas.COGTrue == 0.0 &&
+		meas.HeadingTrue == 0.0 && meas.Name == "" {
+		return true
+	}
+	return false
+}
+
+// GetInfluxTags returns tags for InfluxDB
+func (meas *AISTarget) GetInfluxTags() map[string]string {
+	tagTmp := make(map[string]string)
+	if meas.Source != "" {
+		tagTmp["Source"] = meas.Source
+	}
+	if meas.MMSI != "" {
+		tagTmp["MMSI"] = meas.MMSI
+	}
+	if meas.Name != "" {
+		tagTmp["Name"] = meas.Name
+	}
+	return tagTmp
+}
+
+// GetInfluxFields returns fields for InfluxDB
+func (meas *AISTarget) GetInfluxFields() map[string]interface{} {
+	measTmp := make(map[string]interface{})
+	if meas.Lat != 0.0 || meas.Lon != 0.0 || meas.IsPresent("Lat") {
+		measTmp["latitude"] = meas.Lat
+		measTmp["longitude"] = meas.Lon
+	}
+	if meas.SOG != 0.0 || meas.IsPresent("SOG") {
+		measTmp["SOG"] = meas.SOG
+	}
+	if meas.COGTrue != 0.0 || meas.IsPresent("COGTrue") {
+		measTmp["COGTrue"] = meas.COGTrue
+	}
+	if meas.HeadingTrue != 0.0 || meas.IsPresent("HeadingTrue") {
+		measTmp["HeadingTrue"] = meas.HeadingTrue
+	}
+	if meas.CPANM != 0.0 || meas.TCPAMinutes != 0.0 {
+		measTmp["CPANM"] = meas.CPANM
+		measTmp["TCPAMinutes"] = meas.TCPAMinutes
+		measTmp["Warning"] = meas.Warning
+	}
+	return measTmp
+}
+
+// ToInfluxPoint creates an InfluxDB point
+func (meas *AISTarget) ToInfluxPoint() *write.Point {
+	return influxdb2.NewPoint("ais", meas.GetInfluxTags(), meas.GetInfluxFields(), meas.Timestamp)
+}
+
+// GetLogEnabled returns whether logging is enabled for this data type
+func (meas *AISTarget) GetLogEnabled() bool {
+	return SharedSubscriptionConfig.Categories["ais"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *AISTarget) GetCategory() string {
+	return "ais"
+}
+
+// GetMeasurementName returns the measurement name for InfluxDB
+func (meas *AISTarget) GetMeasurementName() string {
+	return "ais"
+}
+
+// GetTopicPrefix returns the topic prefix for MQTT publishing
+func (meas *AISTarget) GetTopicPrefix() string {
+	if meas.MMSI == "" {
+		return "ais"
+	}
+	return "ais/" + meas.MMSI
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAISTargetStruct(t *testing.T) {
+	now := time.Now()
+	target := AISTarget{
+		BaseSensorData: BaseSensorData{
+			Source:    "test-source",
+			Timestamp: now,
+		},
+		MMSI:        "366123456",
+		Name:        "SEA BREEZE",
+		Lat:         37.8,
+		Lon:         -122.4,
+		SOG:         8.5,
+		COGTrue:     270.0,
+		HeadingTrue: 268.0,
+		CPANM:       0.3,
+		TCPAMinutes: 6.0,
+		Warning:     true,
+	}
+
+	// Test ToJSON
+	jsonData := target.ToJSON()
+	var parsedTarget AISTarget
+	err := json.Unmarshal([]byte(jsonData), &parsedTarget)
+	assert.NoError(t, err)
+	assert.Equal(t, target.MMSI, parsedTarget.MMSI)
+	assert.Equal(t, target.Name, parsedTarget.Name)
+	assert.Equal(t, target.Lat, parsedTarget.Lat)
+	assert.Equal(t, target.CPANM, parsedTarget.CPANM)
+
+	// Test IsEmpty
+	assert.False(t, target.IsEmpty())
+	emptyTarget := AISTarget{MMSI: "366123456"}
+	assert.True(t, emptyTarget.IsEmpty())
+
+	// Test GetInfluxTags
+	tags := target.GetInfluxTags()
+	assert.Equal(t, "test-source", tags["Source"])
+	assert.Equal(t, "366123456", tags["MMSI"])
+	assert.Equal(t, "SEA BREEZE", tags["Name"])
+
+	// Test GetInfluxFields
+	fields := target.GetInfluxFields()
+	assert.Equal(t, target.Lat, fields["latitude"])
+	assert.Equal(t, target.Lon, fields["longitude"])
+	assert.Equal(t, target.SOG, fields["SOG"])
+	assert.Equal(t, target.COGTrue, fields["COGTrue"])
+	assert.Equal(t, target.HeadingTrue, fields["HeadingTrue"])
+	assert.Equal(t, target.CPANM, fields["CPANM"])
+	assert.Equal(t, target.TCPAMinutes, fields["TCPAMinutes"])
+	assert.Equal(t, true, fields["Warning"])
+	assert.NotContains(t, (&AISTarget{SOG: 1.0}).GetInfluxFields(), "CPANM")
+
+	assert.Equal(t, "ais", target.GetMeasurementName())
+	assert.Equal(t, "ais/366123456", target.GetTopicPrefix())
+	assert.Equal(t, "ais", (&AISTarget{}).GetTopicPrefix())
+
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	assert.Equal(t, SharedSubscriptionConfig.Categories["ais"].Verbose, target.GetLogEnabled())
+	assert.NotNil(t, target.ToInfluxPoint())
+}
+
+func TestMMSIFromTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    string
+		expected string
+	}{
+		{"position", "signalk/vessels/urn:mrn:imo:mmsi:366123456/navigation/position", "366123456"},
+		{"name", "signalk/vessels/urn:mrn:imo:mmsi:366123456/name", "366123456"},
+		{"bare", "signalk/vessels/urn:mrn:imo:mmsi:366123456", "366123456"},
+		{"self", "signalk/vessels/self/navigation/position", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, mmsiFromTopic(tt.topic))
+		})
+	}
+}
+
+func TestProcessAISData(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	tests := []struct {
+		name        string
+		measurement string
+		rawData     map[string]any
+		expected    *AISTarget
+	}{
+		{
+			name:        "position measurement",
+			measurement: "position",
+			rawData:     map[string]any{"value": map[string]any{"latitude": 37.8, "longitude": -122.4}},
+			expected:    &AISTarget{Lat: 37.8, Lon: -122.4},
+		},
+		{
+			name:        "speedOverGround measurement",
+			measurement: "speedOverGround",
+			rawData:     map[string]any{"value": 5.14444},
+			expected:    &AISTarget{SOG: 10.0},
+		},
+		{
+			name:        "courseOverGroundTrue measurement",
+			measurement: "courseOverGroundTrue",
+			rawData:     map[string]any{"value": 3.14159265},
+			expected:    &AISTarget{COGTrue: 180.0},
+		},
+		{
+			name:        "headingTrue measurement",
+			measurement: "headingTrue",
+			rawData:     map[string]any{"value": 1.57079633},
+			expected:    &AISTarget{HeadingTrue: 90.0},
+		},
+		{
+			name:        "name measurement",
+			measurement: "name",
+			rawData:     map[string]any{"value": "SEA BREEZE  "},
+			expected:    &AISTarget{Name: "SEA BREEZE"},
+		},
+		{
+			name:        "invalid position",
+			measurement: "position",
+			rawData:     map[string]any{"value": "invalid"},
+			expected:    &AISTarget{},
+		},
+		{
+			name:        "unhandled measurement",
+			measurement: "design",
+			rawData:     map[string]any{"value": 1.0},
+			expected:    &AISTarget{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &AISTarget{}
+			processAISData(tt.rawData, tt.measurement, target)
+			assert.InDelta(t, tt.expected.Lat, target.Lat, 0.0001)
+			assert.InDelta(t, tt.expected.Lon, target.Lon, 0.0001)
+			assert.InDelta(t, tt.expected.SOG, target.SOG, 0.001)
+			assert.InDelta(t, tt.expected.COGTrue, target.COGTrue, 0.001)
+			assert.InDelta(t, tt.expected.HeadingTrue, target.HeadingTrue, 0.001)
+			assert.Equal(t, tt.expected.Name, target.Name)
+		})
+	}
+}
+
+func TestHandleAISMessage(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	sogData := map[string]any{
+		"$source":   "test-source",
+		"timestamp": "2025-01-01T12:00:00.000Z",
+		"value":     3.0,
+	}
+	sogPayload, _ := json.Marshal(sogData)
+	handleAISMessage(client, NewMockMessage("vessels/urn:mrn:imo:mmsi:366123456/navigation/speedOverGround", sogPayload))
+
+	// Topics without an MMSI are dropped
+	handleAISMessage(client, NewMockMessage("vessels/self/navigation/speedOverGround", sogPayload))
+
+	invalidMessage := NewMockMessage("vessels/urn:mrn:imo:mmsi:366123456/navigation/speedOverGround", []byte("invalid json"))
+	handleAISMessage(client, invalidMessage)
+}
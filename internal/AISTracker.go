@@ -0,0 +1,206 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// AISTargetState is the latest known state of a single AIS target
+type AISTargetState struct {
+	MMSI        string    `json:"MMSI"`
+	Name        string    `json:"Name,omitempty"`
+	Lat         float64   `json:"Lat"`
+	Lon         float64   `json:"Lon"`
+	SOG         float64   `json:"SOG"`
+	COGTrue     float64   `json:"COGTrue"`
+	HeadingTrue float64   `json:"HeadingTrue,omitempty"`
+	LastSeen    time.Time `json:"LastSeen"`
+	HasCPA      bool      `json:"HasCPA"`
+	CPANM       float64   `json:"CPANM"`
+	TCPAMinutes float64   `json:"TCPAMinutes"`
+	Warning     bool      `json:"Warning"`
+}
+
+// AISTracker keeps the AIS targets in range and warns about close approaches
+type AISTracker struct {
+	mu      sync.Mutex
+	conf    AISConfig
+	targets map[string]*AISTargetState
+	client  MQTT.Client
+}
+
+var SharedAISTracker *AISTracker
+
+func NewAISTracker(conf AISConfig) *AISTracker {
+	return &AISTracker{
+		conf:    conf,
+		targets: make(map[string]*AISTargetState),
+	}
+}
+
+// Update merges a single AIS measurement into the target and fills in its CPA and TCPA
+func (a *AISTracker) Update(client MQTT.Client, measurement string, target *AISTarget, own VesselSnapshot) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.client = client
+	state, ok := a.targets[target.MMSI]
+	if !ok {
+		log.Debug().Msgf("New AIS target %v", target.MMSI)
+		state = &AISTargetState{MMSI: target.MMSI}
+		a.targets[target.MMSI] = state
+	}
+	state.LastSeen = target.Timestamp
+	switch measurement {
+	case "position":
+		if target.Lat == 0.0 && target.Lon == 0.0 {
+			return
+		}
+		state.Lat = target.Lat
+		state.Lon = target.Lon
+	case "speedOverGround":
+		state.SOG = target.SOG
+	case "courseOverGroundTrue":
+		state.COGTrue = target.COGTrue
+	case "headingTrue":
+		state.HeadingTrue = target.HeadingTrue
+	case "name":
+		if target.Name != "" {
+			state.Name = target.Name
+		}
+		return
+	default:
+		return
+	}
+	if target.Name == "" {
+		target.Name = state.Name
+	}
+	if !a.evaluate(client, state, own, target.Timestamp) {
+		return
+	}
+	target.CPANM = state.CPANM
+	target.TCPAMinutes = state.TCPAMinutes
+	target.Warning = state.Warning
+}
+
+// evaluate computes the CPA and TCPA and reports whether they could be computed
+func (a *AISTracker) evaluate(client MQTT.Client, state *AISTargetState, own VesselSnapshot, ts time.Time) bool {
+	if state.Lat == 0.0 && state.Lon == 0.0 {
+		return false
+	}
+	// Our own position, SOG and COG all have to be current or the CPA is computed from where we used to be
+	ownTimeout := time.Duration(a.conf.OwnTimeout) * time.Second
+	for _, seen := range []time.Time{own.PositionTime, own.SOGTime, own.COGTime} {
+		if seen.IsZero() || ts.Sub(seen) > ownTimeout {
+			state.HasCPA = false
+			return false
+		}
+	}
+	state.HasCPA = true
+	state.CPANM, state.TCPAMinutes = ClosestApproach(own.Lat, own.Lon, own.SOG, own.COGTrue,
+		state.Lat, state.Lon, state.SOG, state.COGTrue)
+	warning := state.CPANM <= a.conf.CPAWarnNM && state.TCPAMinutes >= 0 && state.TCPAMinutes <= a.conf.TCPAWarnMinutes
+	if warning != state.Warning {
+		state.Warning = warning
+		if warning {
+			log.Warn().Msgf("AIS target %v %v CPA %.2f nm in %.1f minutes", state.MMSI, state.Name, state.CPANM, state.TCPAMinutes)
+		} else {
+			log.Info().Msgf("AIS target %v %v no longer a collision risk", state.MMSI, state.Name)
+		}
+		a.publishWarning(client, *state)
+	}
+	return true
+}
+
+func (a *AISTracker) publishWarning(client MQTT.Client, state AISTargetState) {
+	jsonData, err := json.Marshal(state)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "ais/"+state.MMSI+"/warning", string(jsonData))
+}
+
+// Targets returns the tracked targets closest approach first
+func (a *AISTracker) Targets() []AISTargetState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	targets := []AISTargetState{}
+	for _, state := range a.targets {
+		targets = append(targets, *state)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		if targets[i].HasCPA != targets[j].HasCPA {
+			return targets[i].HasCPA
+		}
+		if targets[i].CPANM != targets[j].CPANM {
+			return targets[i].CPANM < targets[j].CPANM
+		}
+		return targets[i].MMSI < targets[j].MMSI
+	})
+	return targets
+}
+
+// Expire drops targets that have not been heard from within the target timeout
+func (a *AISTracker) Expire(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for mmsi, state := range a.targets {
+		if now.Sub(state.LastSeen) <= time.Duration(a.conf.TargetTimeout)*time.Second {
+			continue
+		}
+		log.Debug().Msgf("AIS target %v expired", mmsi)
+		if state.Warning {
+			state.Warning = false
+			a.publishWarning(a.client, *state)
+		}
+		delete(a.targets, mmsi)
+	}
+}
+
+// Run expires targets and reposts the target list every publish interval for the life of the daemon
+func (a *AISTracker) Run() {
+	ticker := time.NewTicker(time.Duration(a.conf.PublishInterval) * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		a.Expire(now)
+		jsonData, err := json.Marshal(a.Targets())
+		if err != nil {
+			log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+			continue
+		}
+		a.mu.Lock()
+		client := a.client
+		a.mu.Unlock()
+		PublishDerivedMessage(client, "ais/targets", string(jsonData))
+	}
+}
+
+// RegisterAPI adds the AIS endpoints to the API server
+func (a *AISTracker) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/ais", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, a.Targets())
+	})
+}
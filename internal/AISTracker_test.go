@@ -0,0 +1,124 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAISConfig() AISConfig {
+	return AISConfig{
+		TargetTimeout:   600,
+		OwnTimeout:      30,
+		PublishInterval: 30,
+		CPAWarnNM:       0.5,
+		TCPAWarnMinutes: 15,
+	}
+}
+
+func aisAt(ts time.Time, target AISTarget) *AISTarget {
+	target.MMSI = "366123456"
+	target.Timestamp = ts
+	return &target
+}
+
+// ownAt is our own position with SOG and COG seen at the same time
+func ownAt(ts time.Time) VesselSnapshot {
+	return VesselSnapshot{Lat: 37.8, Lon: -122.4, PositionTime: ts, SOGTime: ts, COGTime: ts}
+}
+
+func TestAISTrackerCPA(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	tracker := NewAISTracker(testAISConfig())
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	own := ownAt(now)
+
+	tracker.Update(client, "name", aisAt(now, AISTarget{Name: "SEA BREEZE"}), own)
+	tracker.Update(client, "speedOverGround", aisAt(now, AISTarget{SOG: 10}), own)
+	tracker.Update(client, "courseOverGroundTrue", aisAt(now, AISTarget{COGTrue: 180}), own)
+
+	// Target 4 nm north heading straight for us at 10 kn closes in 24 minutes
+	target := aisAt(now, AISTarget{Lat: 37.8 + 4.0/60, Lon: -122.4})
+	tracker.Update(client, "position", target, own)
+	assert.Equal(t, "SEA BREEZE", target.Name)
+	assert.InDelta(t, 0.0, target.CPANM, 0.001)
+	assert.InDelta(t, 24.0, target.TCPAMinutes, 0.01)
+	assert.False(t, target.Warning)
+
+	// Inside the TCPA limit
+	own = ownAt(now.Add(10 * time.Minute))
+	target = aisAt(now.Add(10*time.Minute), AISTarget{Lat: 37.8 + 2.0/60, Lon: -122.4})
+	tracker.Update(client, "position", target, own)
+	assert.True(t, target.Warning)
+	targets := tracker.Targets()
+	assert.Len(t, targets, 1)
+	assert.True(t, targets[0].Warning)
+	assert.True(t, targets[0].HasCPA)
+
+	// Passed and opening
+	own = ownAt(now.Add(20 * time.Minute))
+	target = aisAt(now.Add(20*time.Minute), AISTarget{Lat: 37.8 - 1.0/60, Lon: -122.4})
+	tracker.Update(client, "position", target, own)
+	assert.False(t, target.Warning)
+	assert.Less(t, target.TCPAMinutes, 0.0)
+
+	// No CPA from an old position or an old SOG
+	stale := ownAt(now.Add(20 * time.Minute))
+	stale.PositionTime = now.Add(19 * time.Minute)
+	target = aisAt(now.Add(20*time.Minute), AISTarget{Lat: 37.8 - 1.0/60, Lon: -122.4})
+	tracker.Update(client, "position", target, stale)
+	assert.False(t, tracker.Targets()[0].HasCPA)
+	stale = ownAt(now.Add(20 * time.Minute))
+	stale.SOGTime = time.Time{}
+	tracker.Update(client, "position", target, stale)
+	assert.False(t, tracker.Targets()[0].HasCPA)
+
+	// No CPA without our own position
+	target = aisAt(now.Add(20*time.Minute), AISTarget{Lat: 37.8 - 1.0/60, Lon: -122.4})
+	tracker.Update(client, "position", target, VesselSnapshot{})
+	assert.Equal(t, 0.0, target.CPANM)
+	assert.False(t, tracker.Targets()[0].HasCPA)
+}
+
+func TestAISTrackerExpire(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	tracker := NewAISTracker(testAISConfig())
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	own := ownAt(now)
+
+	tracker.Update(client, "position", aisAt(now, AISTarget{Lat: 37.81, Lon: -122.4}), own)
+	other := &AISTarget{MMSI: "338000001", Lat: 37.9, Lon: -122.4}
+	other.Timestamp = now.Add(5 * time.Minute)
+	tracker.Update(client, "position", other, own)
+	assert.Len(t, tracker.Targets(), 2)
+	assert.Equal(t, "366123456", tracker.Targets()[0].MMSI, "Closest approach first")
+
+	tracker.Expire(now.Add(9 * time.Minute))
+	assert.Len(t, tracker.Targets(), 2)
+	tracker.Expire(now.Add(11 * time.Minute))
+	assert.Len(t, tracker.Targets(), 1)
+	assert.Equal(t, "338000001", tracker.Targets()[0].MMSI)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SharedAPIMux is where features register their HTTP API handlers
+var SharedAPIMux = http.NewServeMux()
+
+// StartAPIServer serves the HTTP API in the background
+func StartAPIServer(conf APIConfig) {
+	server := &http.Server{
+		Addr:              conf.Listen,
+		Handler:           apiAuth(conf.Token, SharedAPIMux),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Info().Msgf("Starting API server on %v", conf.Listen)
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Error().Msgf("API server error: %v", err.Error())
+		}
+	}()
+}
+
+// writeAPIJSON writes a JSON response body
+func writeAPIJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Warn().Msgf("Error writing API response: %v", err.Error())
+	}
+}
+
+// writeAPIError writes a JSON error response body
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	writeAPIJSON(w, status, map[string]string{"Error": msg})
+}
+
+// apiAuth lets reads through and checks requests that change state
+// With a token they need an Authorization: Bearer header, without one they must come from the local host
+func apiAuth(token Secret, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if token == "" {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil || !net.ParseIP(host).IsLoopback() {
+				writeAPIError(w, http.StatusForbidden, "set subscription.api.token to allow changes from other hosts")
+				return
+			}
+		} else if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token.Value())) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid API token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackListen reports whether a listen address only accepts connections from the local host
+func isLoopbackListen(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIAuth(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/test", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, "read")
+	})
+	mux.HandleFunc("POST /api/test", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, "changed")
+	})
+	serve := func(handler http.Handler, method string, remote string, auth string) int {
+		req := httptest.NewRequest(method, "/api/test", nil)
+		req.RemoteAddr = remote
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("No token", func(t *testing.T) {
+		handler := apiAuth("", mux)
+		assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "192.0.2.1:1234", ""))
+		assert.Equal(t, http.StatusOK, serve(handler, http.MethodPost, "127.0.0.1:1234", ""))
+		assert.Equal(t, http.StatusOK, serve(handler, http.MethodPost, "[::1]:1234", ""))
+		assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodPost, "192.0.2.1:1234", ""))
+	})
+
+	t.Run("Token", func(t *testing.T) {
+		handler := apiAuth("s3cret", mux)
+		assert.Equal(t, http.StatusOK, serve(handler, http.MethodGet, "192.0.2.1:1234", ""))
+		assert.Equal(t, http.StatusOK, serve(handler, http.MethodPost, "192.0.2.1:1234", "Bearer s3cret"))
+		assert.Equal(t, http.StatusUnauthorized, serve(handler, http.MethodPost, "192.0.2.1:1234", "Bearer wrong"))
+		assert.Equal(t, http.StatusUnauthorized, serve(handler, http.MethodPost, "127.0.0.1:1234", ""))
+	})
+}
+
+func TestIsLoopbackListen(t *testing.T) {
+	assert.True(t, isLoopbackListen("127.0.0.1:8080"))
+	assert.True(t, isLoopbackListen("[::1]:8080"))
+	assert.True(t, isLoopbackListen("localhost:8080"))
+	assert.False(t, isLoopbackListen(":8080"))
+	assert.False(t, isLoopbackListen("0.0.0.0:8080"))
+	assert.False(t, isLoopbackListen("192.168.1.10:8080"))
+}
@@ -0,0 +1,329 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AggregateMean = "mean"
+	AggregateMin  = "min"
+	AggregateMax  = "max"
+	AggregateLast = "last"
+)
+
+// aggregateField accumulates one field of one series over a window
+type aggregateField struct {
+	count    int
+	sum      float64
+	sin      float64
+	cos      float64
+	min      float64
+	max      float64
+	last     any
+	isInt    bool
+	numeric  bool
+	negative bool
+}
+
+// aggregateBucket is one window of one series
+type aggregateBucket struct {
+	measurement string
+	tags        map[string]string
+	start       time.Time
+	fields      map[string]*aggregateField
+}
+
+// seriesClock is the newest message time of a series and when it arrived
+// Sensors do not share a clock with the daemon so quiet windows are timed on the series' own clock
+type seriesClock struct {
+	latest time.Time
+	seen   time.Time
+}
+
+// Aggregator downsamples points into fixed windows before they are written to InfluxDB
+type Aggregator struct {
+	mu       sync.Mutex
+	policies []AggregationPolicy
+	open     map[string]*aggregateBucket
+	flushed  map[string]time.Time
+	clocks   map[string]seriesClock
+}
+
+var SharedAggregator *Aggregator
+
+func NewAggregator(conf AggregationConfig) *Aggregator {
+	return &Aggregator{
+		policies: conf.Policies,
+		open:     make(map[string]*aggregateBucket),
+		flushed:  make(map[string]time.Time),
+		clocks:   make(map[string]seriesClock),
+	}
+}
+
+func (a *Aggregator) policy(measurement string) *AggregationPolicy {
+	for i := range a.policies {
+		if strings.EqualFold(a.policies[i].Measurement, measurement) {
+			return &a.policies[i]
+		}
+	}
+	return nil
+}
+
+// seriesKey identifies a series by its measurement and tags
+func seriesKey(p *write.Point) string {
+	parts := []string{p.Name()}
+	for _, tag := range p.TagList() {
+		parts = append(parts, tag.Key+"="+tag.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Add folds a point into its window and returns whether the raw point should still be written
+// A point arriving for a later window closes the series' open window first
+// A late point for a window already written is written raw so it is not lost
+func (a *Aggregator) Add(p *write.Point) bool {
+	policy := a.policy(p.Name())
+	if policy == nil {
+		return true
+	}
+	interval := time.Duration(policy.Interval) * time.Second
+	start := p.Time().Truncate(interval)
+	key := seriesKey(p)
+
+	a.mu.Lock()
+	if clock := a.clocks[key]; p.Time().After(clock.latest) {
+		a.clocks[key] = seriesClock{latest: p.Time(), seen: time.Now()}
+	}
+	var closed *aggregateBucket
+	bucket, ok := a.open[key]
+	if ok && start.After(bucket.start) {
+		closed = bucket
+		a.flushed[key] = bucket.start
+		ok = false
+	}
+	late := ok && start.Before(bucket.start)
+	if !ok {
+		last, seen := a.flushed[key]
+		late = seen && !start.After(last)
+	}
+	if late {
+		a.mu.Unlock()
+		log.Debug().Msgf("Writing late point for %v raw as its window was already written", key)
+		return true
+	}
+	if !ok {
+		bucket = &aggregateBucket{
+			measurement: p.Name(),
+			tags:        make(map[string]string),
+			start:       start,
+			fields:      make(map[string]*aggregateField),
+		}
+		for _, tag := range p.TagList() {
+			bucket.tags[tag.Key] = tag.Value
+		}
+		a.open[key] = bucket
+	}
+	for _, field := range p.FieldList() {
+		acc, exists := bucket.fields[field.Key]
+		if !exists {
+			acc = &aggregateField{min: math.Inf(1), max: math.Inf(-1)}
+			bucket.fields[field.Key] = acc
+		}
+		acc.add(field.Value)
+	}
+	a.mu.Unlock()
+
+	if closed != nil {
+		a.write(closed, policy)
+	}
+	return policy.KeepRaw
+}
+
+func (f *aggregateField) add(value any) {
+	f.last = value
+	var v float64
+	switch n := value.(type) {
+	case float64:
+		v = n
+		f.isInt = false
+	case int64:
+		v = float64(n)
+		f.isInt = true
+	default:
+		// Strings and booleans only keep their last value
+		f.numeric = false
+		return
+	}
+	f.numeric = true
+	f.count++
+	f.sum += v
+	f.sin += math.Sin(v * math.Pi / 180)
+	f.cos += math.Cos(v * math.Pi / 180)
+	f.min = math.Min(f.min, v)
+	f.max = math.Max(f.max, v)
+	if v < 0 {
+		f.negative = true
+	}
+}
+
+// mean is the arithmetic mean or for angles the direction of the summed unit vectors
+// Angles keep the convention of their readings so -180 to 180 stays signed
+func (f *aggregateField) mean(angle bool) float64 {
+	if !angle {
+		return f.sum / float64(f.count)
+	}
+	deg := math.Atan2(f.sin, f.cos) * 180 / math.Pi
+	if !f.negative && deg < 0 {
+		deg += 360
+	}
+	return deg
+}
+
+// number keeps integer fields as integers so raw and aggregated points share a field type
+func (f *aggregateField) number(v float64) any {
+	if f.isInt {
+		return int64(math.Round(v))
+	}
+	return v
+}
+
+// point turns a closed window into the point written in its place
+// The mean or last value keeps the field name and min and max are written as Field_min and Field_max
+func (b *aggregateBucket) point(policy *AggregationPolicy) *write.Point {
+	fields := make(map[string]interface{})
+	for name, acc := range b.fields {
+		if !acc.numeric {
+			fields[name] = acc.last
+			continue
+		}
+		angle := false
+		for _, a := range policy.Angles {
+			if strings.EqualFold(a, name) {
+				angle = true
+			}
+		}
+		for _, fn := range policy.Functions {
+			switch fn {
+			case AggregateMean:
+				fields[name] = acc.number(acc.mean(angle))
+			case AggregateLast:
+				fields[name] = acc.last
+			case AggregateMin:
+				fields[name+"_min"] = acc.number(acc.min)
+			case AggregateMax:
+				fields[name+"_max"] = acc.number(acc.max)
+			}
+		}
+	}
+	tags := make(map[string]string, len(b.tags)+1)
+	for k, v := range b.tags {
+		tags[k] = v
+	}
+	tags["Window"] = (time.Duration(policy.Interval) * time.Second).String()
+	return influxdb2.NewPoint(b.measurement, tags, fields, b.start)
+}
+
+func (a *Aggregator) write(bucket *aggregateBucket, policy *AggregationPolicy) {
+	if SharedInfluxWriteAPI == nil {
+		return
+	}
+	err := writeInfluxPoint(bucket.point(policy))
+	if err != nil {
+		log.Warn().Msgf("Error writing to influx: %v", err.Error())
+	}
+}
+
+// Pending returns the number of open windows waiting to be written
+func (a *Aggregator) Pending() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.open)
+}
+
+// Flush writes every window that ended before the cutoff
+// The cutoff is a wall clock time and is moved onto each series' own clock before it is compared
+// This closes the windows of series that have gone quiet
+func (a *Aggregator) Flush(cutoff time.Time) {
+	a.flush(func(key string) time.Time {
+		clock := a.clocks[key]
+		return clock.latest.Add(cutoff.Sub(clock.seen))
+	})
+}
+
+// FlushAll writes every open window so nothing is lost on exit
+func (a *Aggregator) FlushAll() {
+	a.flush(nil)
+}
+
+// flush writes the windows that ended before the cutoff returned for their series or every window when there is none
+func (a *Aggregator) flush(cutoff func(key string) time.Time) {
+	type closedBucket struct {
+		bucket *aggregateBucket
+		policy *AggregationPolicy
+	}
+	var closed []closedBucket
+	a.mu.Lock()
+	var keys []string
+	for key := range a.open {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		bucket := a.open[key]
+		policy := a.policy(bucket.measurement)
+		if policy == nil {
+			continue
+		}
+		if cutoff != nil && bucket.start.Add(time.Duration(policy.Interval)*time.Second).After(cutoff(key)) {
+			continue
+		}
+		delete(a.open, key)
+		a.flushed[key] = bucket.start
+		closed = append(closed, closedBucket{bucket, policy})
+	}
+	a.mu.Unlock()
+	for _, c := range closed {
+		a.write(c.bucket, c.policy)
+	}
+}
+
+// Run closes quiet windows a couple of seconds after they end to allow for late messages
+func (a *Aggregator) Run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		a.Flush(now.Add(-2 * time.Second))
+	}
+}
+
+// aggregatePoint hands a point to the shared aggregator and returns whether the raw point should be written
+func aggregatePoint(p *write.Point) bool {
+	if SharedAggregator == nil {
+		return true
+	}
+	return SharedAggregator.Add(p)
+}
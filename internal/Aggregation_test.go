@@ -0,0 +1,178 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pointField(p *write.Point, key string) any {
+	for _, field := range p.FieldList() {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	return nil
+}
+
+func TestAggregatorMeanMinMax(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+
+	agg := NewAggregator(AggregationConfig{Policies: []AggregationPolicy{{
+		Measurement: "wind",
+		Interval:    1,
+		Functions:   []string{AggregateMean, AggregateMin, AggregateMax},
+		Angles:      []string{"AngleApp"},
+	}}})
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tags := map[string]string{"Source": "Mast"}
+
+	// Apparent angles either side of dead ahead average to dead ahead, not abeam
+	assert.False(t, agg.Add(influxdb2.NewPoint("wind", tags, map[string]interface{}{"SpeedApp": 10.0, "AngleApp": 170.0}, start)))
+	assert.False(t, agg.Add(influxdb2.NewPoint("wind", tags, map[string]interface{}{"SpeedApp": 14.0, "AngleApp": -170.0}, start.Add(500*time.Millisecond))))
+	assert.Empty(t, mockWriteAPI.Points)
+
+	// Unconfigured measurements are written raw
+	assert.True(t, agg.Add(influxdb2.NewPoint("water", tags, map[string]interface{}{"TempF": 60.0}, start)))
+
+	// The next window closes the first
+	assert.False(t, agg.Add(influxdb2.NewPoint("wind", tags, map[string]interface{}{"SpeedApp": 12.0, "AngleApp": 20.0}, start.Add(1200*time.Millisecond))))
+	require.Len(t, mockWriteAPI.Points, 1)
+	p := mockWriteAPI.Points[0]
+	assert.Equal(t, start, p.Time())
+	assert.Equal(t, "1s", pointTag(p, "Window"))
+	assert.Equal(t, "Mast", pointTag(p, "Source"))
+	assert.Equal(t, 12.0, pointField(p, "SpeedApp"))
+	assert.Equal(t, 10.0, pointField(p, "SpeedApp_min"))
+	assert.Equal(t, 14.0, pointField(p, "SpeedApp_max"))
+	assert.InDelta(t, 180.0, abs(pointField(p, "AngleApp").(float64)), 0.001)
+
+	// A late point for a written window is written raw
+	assert.True(t, agg.Add(influxdb2.NewPoint("wind", tags, map[string]interface{}{"SpeedApp": 50.0}, start.Add(100*time.Millisecond))))
+	assert.Len(t, mockWriteAPI.Points, 1)
+
+	// Quiet series are closed by Flush once their own clock passes the end of the window
+	now := time.Now()
+	agg.Flush(now)
+	assert.Len(t, mockWriteAPI.Points, 1)
+	agg.Flush(now.Add(time.Second))
+	require.Len(t, mockWriteAPI.Points, 2)
+	assert.Equal(t, 20.0, pointField(mockWriteAPI.Points[1], "AngleApp"))
+}
+
+func TestAggregatorSeriesClock(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+
+	agg := NewAggregator(AggregationConfig{Policies: []AggregationPolicy{{
+		Measurement: "wind",
+		Interval:    10,
+		Functions:   []string{AggregateMean},
+	}}})
+	now := time.Now()
+	// One sensor runs a minute behind the daemon and another a minute ahead
+	behind := now.Add(-time.Minute).Truncate(10 * time.Second)
+	ahead := now.Add(time.Minute).Truncate(10 * time.Second)
+	agg.Add(influxdb2.NewPoint("wind", map[string]string{"Source": "Behind"}, map[string]interface{}{"SpeedApp": 10.0}, behind))
+	agg.Add(influxdb2.NewPoint("wind", map[string]string{"Source": "Ahead"}, map[string]interface{}{"SpeedApp": 12.0}, ahead))
+
+	// Neither window is closed early or held open by the daemon's clock
+	agg.Flush(now)
+	assert.Empty(t, mockWriteAPI.Points)
+	assert.Equal(t, 2, agg.Pending())
+	agg.Flush(now.Add(11 * time.Second))
+	assert.Len(t, mockWriteAPI.Points, 2)
+	assert.Equal(t, 0, agg.Pending())
+
+	// Open windows are all written on exit
+	agg.Add(influxdb2.NewPoint("wind", map[string]string{"Source": "Behind"}, map[string]interface{}{"SpeedApp": 14.0}, behind.Add(10*time.Second)))
+	agg.FlushAll()
+	assert.Len(t, mockWriteAPI.Points, 3)
+	assert.Equal(t, 0, agg.Pending())
+}
+
+func abs(v float64) float64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestAggregatorLastAndTypes(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+
+	agg := NewAggregator(AggregationConfig{Policies: []AggregationPolicy{
+		{Measurement: "gnss", Interval: 10, Functions: []string{AggregateLast}, KeepRaw: true},
+		{Measurement: "navigation", Interval: 10, Functions: []string{AggregateMean}, Angles: []string{"COGTrue"}},
+	}})
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, agg.Add(influxdb2.NewPoint("gnss", nil, map[string]interface{}{"Satellites": int64(8), "Type": "GPS"}, start)))
+	assert.True(t, agg.Add(influxdb2.NewPoint("gnss", nil, map[string]interface{}{"Satellites": int64(9), "Type": "GNSS"}, start.Add(5*time.Second))))
+	agg.Add(influxdb2.NewPoint("navigation", nil, map[string]interface{}{"COGTrue": 350.0}, start))
+	agg.Add(influxdb2.NewPoint("navigation", nil, map[string]interface{}{"COGTrue": 20.0}, start.Add(time.Second)))
+	agg.Flush(time.Now().Add(10 * time.Second))
+
+	gnss := pointsNamed(mockWriteAPI, "gnss")
+	require.Len(t, gnss, 1)
+	assert.Equal(t, int64(9), pointField(gnss[0], "Satellites"))
+	assert.Equal(t, "GNSS", pointField(gnss[0], "Type"))
+	assert.Equal(t, "10s", pointTag(gnss[0], "Window"))
+
+	// Courses either side of north average to 5 degrees and stay positive
+	nav := pointsNamed(mockWriteAPI, "navigation")
+	require.Len(t, nav, 1)
+	assert.InDelta(t, 5.0, pointField(nav[0], "COGTrue").(float64), 0.001)
+
+	// Integer fields stay integers when averaged
+	f := &aggregateField{}
+	f.add(int64(700))
+	f.add(int64(801))
+	assert.Equal(t, int64(751), f.number(f.mean(false)))
+}
+
+func TestAggregatedSensorData(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+	SharedAggregator = NewAggregator(AggregationConfig{Policies: []AggregationPolicy{{Measurement: "wind", Interval: 1, Functions: []string{AggregateMean}}}})
+	defer func() { SharedAggregator = nil }()
+
+	for i, payload := range []string{
+		`{"value": 5.0, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.100Z"}`,
+		`{"value": 7.0, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.600Z"}`,
+		`{"value": 9.0, "$source": "test-source", "timestamp": "2025-01-01T12:00:01.100Z"}`,
+	} {
+		handleWindMessage(&MockMQTTClient{}, NewMockMessage("vessels/self/environment/wind/speedApparent", []byte(payload)))
+		if i < 2 {
+			assert.Empty(t, mockWriteAPI.Points)
+		}
+	}
+	require.Len(t, mockWriteAPI.Points, 1)
+	assert.InDelta(t, MetersPerSecondToKnots(6.0), pointField(mockWriteAPI.Points[0], "SpeedApp").(float64), 0.0001)
+}
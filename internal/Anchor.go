@@ -0,0 +1,265 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	AnchorDrop  = "drop"
+	AnchorRaise = "raise"
+)
+
+// Fix quality readings older than this are not used to judge a position
+const anchorQualityMaxAge = time.Minute
+
+// AnchorCommand sets or clears the anchor watch
+// Lat and Lon are optional and default to the current position
+type AnchorCommand struct {
+	Action string   `json:"Action"`
+	Radius float64  `json:"Radius,omitempty"`
+	Lat    *float64 `json:"Lat,omitempty"`
+	Lon    *float64 `json:"Lon,omitempty"`
+}
+
+// AnchorState is persisted and reposted on every evaluation
+type AnchorState struct {
+	Set               bool      `json:"Set"`
+	Lat               float64   `json:"Lat,omitempty"`
+	Lon               float64   `json:"Lon,omitempty"`
+	RadiusMeters      float64   `json:"RadiusMeters,omitempty"`
+	DroppedAt         time.Time `json:"DroppedAt,omitempty"`
+	DistanceMeters    float64   `json:"DistanceMeters"`
+	BearingDegrees    float64   `json:"BearingDegrees"`
+	MaxDistanceMeters float64   `json:"MaxDistanceMeters"`
+	Alarm             bool      `json:"Alarm"`
+	OutsideSince      time.Time `json:"OutsideSince,omitempty"`
+	Timestamp         time.Time `json:"Timestamp,omitempty"`
+}
+
+// AnchorWatch raises an alarm when the boat stays outside the swing radius of the anchor
+type AnchorWatch struct {
+	mu          sync.Mutex
+	conf        AnchorConfig
+	dataDir     string
+	state       AnchorState
+	lastPublish time.Time
+	client      MQTT.Client
+}
+
+var SharedAnchorWatch *AnchorWatch
+
+func NewAnchorWatch(conf AnchorConfig, dataDir string) *AnchorWatch {
+	watch := &AnchorWatch{
+		conf:    conf,
+		dataDir: dataDir,
+	}
+	err := readJSONFile(watch.statePath(), &watch.state)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msgf("Error loading anchor state: %v", err.Error())
+	}
+	if watch.state.Set {
+		log.Info().Msgf("Resuming anchor watch set at %v", watch.state.DroppedAt)
+	}
+	// The time outside the radius restarts since fixes were missed while down
+	watch.state.OutsideSince = time.Time{}
+	return watch
+}
+
+func (a *AnchorWatch) statePath() string {
+	return filepath.Join(a.dataDir, "anchor.json")
+}
+
+// State returns a copy of the current anchor state
+func (a *AnchorWatch) State() AnchorState {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.state
+}
+
+// HandleCommand drops or raises the anchor
+// A nil client uses the one last seen by Update
+func (a *AnchorWatch) HandleCommand(client MQTT.Client, cmd AnchorCommand, snap VesselSnapshot, now time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if client == nil {
+		client = a.client
+	}
+
+	switch cmd.Action {
+	case AnchorDrop:
+		radius := cmd.Radius
+		if radius <= 0 {
+			radius = a.conf.Radius
+		}
+		lat, lon := snap.Lat, snap.Lon
+		if cmd.Lat != nil && cmd.Lon != nil {
+			lat, lon = *cmd.Lat, *cmd.Lon
+		} else if snap.PositionTime.IsZero() {
+			return errors.New("no position known to drop the anchor at")
+		}
+		a.state = AnchorState{
+			Set:          true,
+			Lat:          lat,
+			Lon:          lon,
+			RadiusMeters: radius,
+			DroppedAt:    now,
+			Timestamp:    now,
+		}
+		log.Info().Msgf("Anchor dropped at %v, %v with a %v m radius", lat, lon, radius)
+	case AnchorRaise:
+		a.state = AnchorState{Timestamp: now}
+		log.Info().Msg("Anchor raised")
+	default:
+		return fmt.Errorf("unknown anchor action %v", cmd.Action)
+	}
+	a.save()
+	a.publish(client, now)
+	return nil
+}
+
+// Update evaluates a position fix against the anchor
+func (a *AnchorWatch) Update(client MQTT.Client, snap VesselSnapshot, ts time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.client = client
+	if !a.state.Set {
+		return
+	}
+	if !a.goodFix(snap, ts) {
+		log.Debug().Msgf("Ignoring anchor fix with HDOP %v and %v satellites", snap.HozDilution, snap.Satellites)
+		return
+	}
+	a.state.DistanceMeters = DistanceMeters(a.state.Lat, a.state.Lon, snap.Lat, snap.Lon)
+	a.state.BearingDegrees = BearingDegrees(a.state.Lat, a.state.Lon, snap.Lat, snap.Lon)
+	if a.state.DistanceMeters > a.state.MaxDistanceMeters {
+		a.state.MaxDistanceMeters = a.state.DistanceMeters
+	}
+	a.state.Timestamp = ts
+
+	changed := false
+	if a.state.DistanceMeters > a.state.RadiusMeters {
+		if a.state.OutsideSince.IsZero() {
+			a.state.OutsideSince = ts
+		}
+		if !a.state.Alarm && ts.Sub(a.state.OutsideSince) >= time.Duration(a.conf.AlarmSeconds)*time.Second {
+			log.Error().Msgf("Anchor alarm! %.0f m from the anchor at bearing %.0f", a.state.DistanceMeters, a.state.BearingDegrees)
+			a.state.Alarm = true
+			changed = true
+		}
+	} else {
+		a.state.OutsideSince = time.Time{}
+		if a.state.Alarm {
+			log.Info().Msg("Anchor alarm cleared")
+			a.state.Alarm = false
+			changed = true
+		}
+	}
+	if changed {
+		a.save()
+	}
+	if changed || ts.Sub(a.lastPublish) >= time.Duration(a.conf.PublishInterval)*time.Second {
+		a.publish(client, ts)
+	}
+}
+
+// goodFix rejects positions reported while the recent fix quality was poor
+func (a *AnchorWatch) goodFix(snap VesselSnapshot, ts time.Time) bool {
+	if a.conf.MaxHDOP > 0 && !snap.HDOPTime.IsZero() && ts.Sub(snap.HDOPTime) <= anchorQualityMaxAge &&
+		snap.HozDilution > a.conf.MaxHDOP {
+		return false
+	}
+	if a.conf.MinSatellites > 0 && !snap.SatellitesTime.IsZero() && ts.Sub(snap.SatellitesTime) <= anchorQualityMaxAge &&
+		snap.Satellites < a.conf.MinSatellites {
+		return false
+	}
+	return true
+}
+
+func (a *AnchorWatch) save() {
+	if err := writeJSONFile(a.statePath(), a.state); err != nil {
+		log.Warn().Msgf("Error saving anchor state: %v", err.Error())
+	}
+}
+
+func (a *AnchorWatch) publish(client MQTT.Client, ts time.Time) {
+	a.lastPublish = ts
+	jsonData, err := json.Marshal(a.state)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "anchor/state", string(jsonData))
+	if !a.state.Set {
+		return
+	}
+	WriteDerivedPoint(influxdb2.NewPoint("anchor", map[string]string{},
+		map[string]interface{}{
+			"DistanceMeters": a.state.DistanceMeters,
+			"BearingDegrees": a.state.BearingDegrees,
+			"RadiusMeters":   a.state.RadiusMeters,
+			"Alarm":          a.state.Alarm,
+		}, ts))
+}
+
+// OnAnchorCommandMessage is called when a command arrives on the anchor command topic
+func OnAnchorCommandMessage(client MQTT.Client, message MQTT.Message) {
+	if SharedAnchorWatch == nil {
+		return
+	}
+	cmd := AnchorCommand{}
+	if err := json.Unmarshal(message.Payload(), &cmd); err != nil {
+		log.Warn().Msgf("Error parsing anchor command: %v", err.Error())
+		return
+	}
+	if err := SharedAnchorWatch.HandleCommand(client, cmd, SharedVesselState.Snapshot(), time.Now()); err != nil {
+		log.Warn().Msgf("Error handling anchor command: %v", err.Error())
+	}
+}
+
+// RegisterAPI adds the anchor endpoints to the API server
+func (a *AnchorWatch) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/anchor", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, a.State())
+	})
+	mux.HandleFunc("POST /api/anchor", func(w http.ResponseWriter, r *http.Request) {
+		cmd := AnchorCommand{}
+		if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := a.HandleCommand(nil, cmd, SharedVesselState.Snapshot(), time.Now()); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, a.State())
+	})
+}
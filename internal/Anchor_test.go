@@ -0,0 +1,169 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testAnchorConfig() AnchorConfig {
+	return AnchorConfig{
+		Enabled:         true,
+		CommandTopic:    "msh/command/anchor",
+		Radius:          50,
+		AlarmSeconds:    30,
+		PublishInterval: 10,
+		MaxHDOP:         5,
+		MinSatellites:   4,
+	}
+}
+
+// anchorFix returns a snapshot the given number of meters north of the anchor
+func anchorFix(meters float64, ts time.Time) VesselSnapshot {
+	return VesselSnapshot{
+		Lat:          37.8 + meters/111195.0,
+		Lon:          -122.4,
+		PositionTime: ts,
+	}
+}
+
+func TestAnchorWatchAlarm(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	dataDir := t.TempDir()
+	watch := NewAnchorWatch(testAnchorConfig(), dataDir)
+	start := time.Date(2025, 6, 1, 20, 0, 0, 0, time.UTC)
+
+	// Nothing to drop at until a position is known
+	assert.Error(t, watch.HandleCommand(client, AnchorCommand{Action: AnchorDrop}, VesselSnapshot{}, start))
+	assert.Error(t, watch.HandleCommand(client, AnchorCommand{Action: "weigh"}, anchorFix(0, start), start))
+
+	// Fixes are ignored until the anchor is down
+	watch.Update(client, anchorFix(100, start), start)
+	assert.False(t, watch.State().Set)
+
+	assert.NoError(t, watch.HandleCommand(client, AnchorCommand{Action: AnchorDrop, Radius: 40}, anchorFix(0, start), start))
+	state := watch.State()
+	assert.True(t, state.Set)
+	assert.Equal(t, 40.0, state.RadiusMeters)
+	assert.InDelta(t, 37.8, state.Lat, 0.000001)
+
+	// Swinging inside the radius
+	watch.Update(client, anchorFix(30, start.Add(time.Minute)), start.Add(time.Minute))
+	state = watch.State()
+	assert.InDelta(t, 30.0, state.DistanceMeters, 0.5)
+	assert.InDelta(t, 0.0, state.BearingDegrees, 0.5)
+	assert.False(t, state.Alarm)
+
+	// A short excursion outside the radius does not alarm
+	watch.Update(client, anchorFix(45, start.Add(2*time.Minute)), start.Add(2*time.Minute))
+	watch.Update(client, anchorFix(35, start.Add(2*time.Minute+10*time.Second)), start.Add(2*time.Minute+10*time.Second))
+	assert.False(t, watch.State().Alarm)
+	assert.True(t, watch.State().OutsideSince.IsZero())
+
+	// Dragging
+	drag := start.Add(3 * time.Minute)
+	for i := 0; i <= 30; i += 10 {
+		ts := drag.Add(time.Duration(i) * time.Second)
+		watch.Update(client, anchorFix(50+float64(i), ts), ts)
+	}
+	state = watch.State()
+	assert.True(t, state.Alarm)
+	assert.InDelta(t, 80.0, state.MaxDistanceMeters, 0.5)
+
+	// The alarm and drop point survive a restart
+	restored := NewAnchorWatch(testAnchorConfig(), dataDir)
+	assert.True(t, restored.State().Set)
+	assert.True(t, restored.State().Alarm)
+
+	// Back inside the radius clears the alarm
+	watch.Update(client, anchorFix(20, drag.Add(time.Minute)), drag.Add(time.Minute))
+	assert.False(t, watch.State().Alarm)
+
+	assert.NoError(t, watch.HandleCommand(client, AnchorCommand{Action: AnchorRaise}, VesselSnapshot{}, drag.Add(time.Hour)))
+	assert.False(t, watch.State().Set)
+	assert.False(t, NewAnchorWatch(testAnchorConfig(), dataDir).State().Set)
+}
+
+func TestAnchorWatchIgnoresPoorFixes(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	watch := NewAnchorWatch(testAnchorConfig(), t.TempDir())
+	start := time.Date(2025, 6, 1, 20, 0, 0, 0, time.UTC)
+	lat, lon := 37.8, -122.4
+	assert.NoError(t, watch.HandleCommand(client, AnchorCommand{Action: AnchorDrop, Lat: &lat, Lon: &lon}, VesselSnapshot{}, start))
+
+	// A jump reported with a high HDOP is a glitch
+	snap := anchorFix(500, start)
+	snap.HozDilution = 12
+	snap.HDOPTime = start
+	watch.Update(client, snap, start)
+	assert.Equal(t, 0.0, watch.State().DistanceMeters)
+
+	// So is one with too few satellites
+	snap = anchorFix(500, start)
+	snap.Satellites = 3
+	snap.SatellitesTime = start
+	watch.Update(client, snap, start)
+	assert.Equal(t, 0.0, watch.State().DistanceMeters)
+
+	// Stale quality readings are not held against the fix
+	ts := start.Add(5 * time.Minute)
+	snap = anchorFix(20, ts)
+	snap.HozDilution = 12
+	snap.HDOPTime = start
+	watch.Update(client, snap, ts)
+	assert.InDelta(t, 20.0, watch.State().DistanceMeters, 0.5)
+}
+
+func TestAnchorAPI(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	watch := NewAnchorWatch(testAnchorConfig(), t.TempDir())
+	mux := http.NewServeMux()
+	watch.RegisterAPI(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/anchor", strings.NewReader(`{"Action": "drop", "Lat": 37.8, "Lon": -122.4, "Radius": 30}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var state AnchorState
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.True(t, state.Set)
+	assert.Equal(t, 30.0, state.RadiusMeters)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/anchor", strings.NewReader(`{"Action": "weigh"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/anchor", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.Equal(t, 37.8, state.Lat)
+}
@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -26,19 +24,44 @@ import (
 )
 
 // BLETemperature represents BLE temperature sensor data
+// The dew point, humidity, heat index and risk fields are filled in by the comfort monitor
 type BLETemperature struct {
 	BaseSensorData
-	MAC            string  `json:"MAC,omitempty"`
-	Location       string  `json:"Location,omitempty"`
-	TempF          float64 `json:"TempF,omitempty"`
-	BatteryPercent float64 `json:"BatteryPct,omitempty"`
-	Humidity       float64 `json:"Humidity,omitempty"`
-	RSSI           int64   `json:"RSSI,omitempty"`
+	MAC              string  `json:"MAC,omitempty"`
+	Location         string  `json:"Location,omitempty"`
+	TempF            float64 `json:"TempF,omitempty"`
+	BatteryPercent   float64 `json:"BatteryPct,omitempty"`
+	Humidity         float64 `json:"Humidity,omitempty"`
+	RSSI             int64   `json:"RSSI,omitempty"`
+	DewPointF        float64 `json:"DewPointF,omitempty"`
+	AbsHumidity      float64 `json:"AbsHumidity,omitempty"`
+	HeatIndexF       float64 `json:"HeatIndexF,omitempty"`
+	CondensationRisk *bool   `json:"CondensationRisk,omitempty"`
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "ble",
+		TopicsKey:   "bleTopics",
+		Handler:     OnBLETemperatureMessage,
+		NewData:     func() SensorData { return &BLETemperature{} },
+		UpdateState: updateBLETemperatureState,
+	})
+}
+
+func updateBLETemperatureState(client MQTT.Client, measurement string, data SensorData) {
+	meas := data.(*BLETemperature)
+	if SharedComfortMonitor != nil {
+		SharedComfortMonitor.Update(client, meas, SharedVesselState.Snapshot())
+	}
+	if SharedRefrigerationMonitor != nil {
+		SharedRefrigerationMonitor.Update(client, meas)
+	}
 }
 
 // OnBLETemperatureMessage is called when a BLE temperature message is received
 func OnBLETemperatureMessage(client MQTT.Client, message MQTT.Message) {
-	go handleBLETemperatureMessage(client, message)
+	dispatchMessage(handleBLETemperatureMessage, client, message)
 }
 
 // handleBLETemperatureMessage processes BLE temperature messages
@@ -59,7 +82,7 @@ func handleBLETemperatureMessage(client MQTT.Client, message MQTT.Message) {
 
 // ToJSON serializes the data to JSON
 func (meas *BLETemperature) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -70,7 +93,7 @@ func (meas *BLETemperature) ToJSON() string {
 func (meas *BLETemperature) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("BLETemp: %v", json)
-	if SharedSubscriptionConfig.BLELogEn {
+	if SharedSubscriptionConfig.Categories["ble"].Verbose {
 		log.Info().Msgf("BLETemp: %v", json)
 	}
 }
@@ -94,18 +117,26 @@ func (meas *BLETemperature) GetInfluxTags() map[string]string {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *BLETemperature) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.TempF != 0.0 {
+	if meas.TempF != 0.0 || meas.IsPresent("TempF") {
 		measTmp["TempF"] = meas.TempF
 	}
-	if meas.BatteryPercent != 0.0 {
+	if meas.BatteryPercent != 0.0 || meas.IsPresent("BatteryPercent") {
 		measTmp["BatteryPercent"] = meas.BatteryPercent
 	}
-	if meas.Humidity != 0.0 {
+	if meas.Humidity != 0.0 || meas.IsPresent("Humidity") {
 		measTmp["Humidity"] = meas.Humidity
 	}
-	if meas.RSSI != 0 {
+	if meas.RSSI != 0 || meas.IsPresent("RSSI") {
 		measTmp["RSSI"] = meas.RSSI
 	}
+	if meas.AbsHumidity != 0.0 || meas.IsPresent("AbsHumidity") {
+		measTmp["DewPointF"] = meas.DewPointF
+		measTmp["AbsHumidity"] = meas.AbsHumidity
+		measTmp["HeatIndexF"] = meas.HeatIndexF
+	}
+	if meas.CondensationRisk != nil {
+		measTmp["CondensationRisk"] = *meas.CondensationRisk
+	}
 	return measTmp
 }
 
@@ -126,7 +157,12 @@ func (meas *BLETemperature) SetSource(source string) {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *BLETemperature) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.BLELogEn
+	return SharedSubscriptionConfig.Categories["ble"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *BLETemperature) GetCategory() string {
+	return "ble"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
@@ -100,7 +100,7 @@ func TestBLETemperatureStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.BLELogEn, bleTemp.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["ble"].Verbose, bleTemp.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := bleTemp.ToInfluxPoint()
@@ -0,0 +1,244 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// Pressure tendency names follow the standard three hour categories used in shipping forecasts
+const (
+	TendencySteady             = "steady"
+	TendencyRisingSlowly       = "rising-slowly"
+	TendencyRising             = "rising"
+	TendencyRisingQuickly      = "rising-quickly"
+	TendencyRisingVeryRapidly  = "rising-very-rapidly"
+	TendencyFallingSlowly      = "falling-slowly"
+	TendencyFalling            = "falling"
+	TendencyFallingQuickly     = "falling-quickly"
+	TendencyFallingVeryRapidly = "falling-very-rapidly"
+)
+
+const (
+	// At most one sample a minute is kept
+	baroSampleInterval = time.Minute
+	// The sample used for a window must be within this of the window start
+	baroWindowTolerance = 15 * time.Minute
+	baroHistory         = 3*time.Hour + baroWindowTolerance
+	baroSaveInterval    = 10 * time.Minute
+)
+
+// BaroSample is a single pressure reading in hPa
+type BaroSample struct {
+	Time     time.Time `json:"Time"`
+	Pressure float64   `json:"Pressure"`
+}
+
+// BaroTendency is the pressure change over the last one and three hours
+// A change is nil until there is enough history to compute it
+type BaroTendency struct {
+	Pressure   float64   `json:"Pressure"`
+	Change1h   *float64  `json:"Change1h,omitempty"`
+	Tendency1h string    `json:"Tendency1h,omitempty"`
+	Change3h   *float64  `json:"Change3h,omitempty"`
+	Tendency3h string    `json:"Tendency3h,omitempty"`
+	Warning    bool      `json:"Warning"`
+	Timestamp  time.Time `json:"Timestamp"`
+}
+
+// Barometer keeps a rolling pressure history and warns when the pressure falls fast
+type Barometer struct {
+	mu          sync.Mutex
+	conf        BaroConfig
+	dataDir     string
+	samples     []BaroSample
+	warning     bool
+	lastPublish time.Time
+	lastSave    time.Time
+}
+
+var SharedBarometer *Barometer
+
+func NewBarometer(conf BaroConfig, dataDir string) *Barometer {
+	baro := &Barometer{
+		conf:    conf,
+		dataDir: dataDir,
+	}
+	// The history is restored so a restart does not lose the three hour tendency
+	err := readJSONFile(baro.historyPath(), &baro.samples)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msgf("Error loading barometer history: %v", err.Error())
+	}
+	return baro
+}
+
+func (b *Barometer) historyPath() string {
+	return filepath.Join(b.dataDir, "barometer.json")
+}
+
+// PressureTendency returns the tendency name for a change in hPa over three hours
+func PressureTendency(change3h float64) string {
+	abs := math.Abs(change3h)
+	rising := change3h > 0
+	switch {
+	case abs < 0.1:
+		return TendencySteady
+	case abs < 1.6:
+		if rising {
+			return TendencyRisingSlowly
+		}
+		return TendencyFallingSlowly
+	case abs < 3.6:
+		if rising {
+			return TendencyRising
+		}
+		return TendencyFalling
+	case abs <= 6.0:
+		if rising {
+			return TendencyRisingQuickly
+		}
+		return TendencyFallingQuickly
+	}
+	if rising {
+		return TendencyRisingVeryRapidly
+	}
+	return TendencyFallingVeryRapidly
+}
+
+// Update records a pressure reading and fills in the tendency on the measurement
+func (b *Barometer) Update(client MQTT.Client, out *Outside) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ts := out.Timestamp
+	if len(b.samples) == 0 || ts.Sub(b.samples[len(b.samples)-1].Time) >= baroSampleInterval {
+		b.samples = append(b.samples, BaroSample{Time: ts, Pressure: out.Pressure})
+	}
+	b.prune(ts)
+
+	tendency := b.tendency(out.Pressure, ts)
+	if tendency.Change1h != nil {
+		out.PressureChange1h = *tendency.Change1h
+		out.PressureTendency1h = tendency.Tendency1h
+	}
+	if tendency.Change3h != nil {
+		out.PressureChange3h = *tendency.Change3h
+		out.PressureTendency3h = tendency.Tendency3h
+	}
+
+	changed := tendency.Warning != b.warning
+	if changed {
+		b.warning = tendency.Warning
+		if tendency.Warning {
+			log.Warn().Msgf("Barometer falling fast: %.1f hPa in 3 h", *tendency.Change3h)
+		} else {
+			log.Info().Msg("Barometer no longer falling fast")
+		}
+		b.publish(client, "barometer/warning", tendency)
+	}
+	if changed || ts.Sub(b.lastPublish) >= time.Duration(b.conf.PublishInterval)*time.Second {
+		b.lastPublish = ts
+		b.publish(client, "barometer/tendency", tendency)
+	}
+	if ts.Sub(b.lastSave) >= baroSaveInterval {
+		b.lastSave = ts
+		if err := writeJSONFile(b.historyPath(), b.samples); err != nil {
+			log.Warn().Msgf("Error saving barometer history: %v", err.Error())
+		}
+	}
+}
+
+// Tendency returns the current tendency based on the latest sample
+func (b *Barometer) Tendency() BaroTendency {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.samples) == 0 {
+		return BaroTendency{}
+	}
+	last := b.samples[len(b.samples)-1]
+	return b.tendency(last.Pressure, last.Time)
+}
+
+func (b *Barometer) tendency(pressure float64, ts time.Time) BaroTendency {
+	tendency := BaroTendency{Pressure: pressure, Timestamp: ts}
+	if change, ok := b.change(pressure, ts, time.Hour); ok {
+		tendency.Change1h = &change
+		// Scaled to three hours so the same categories apply
+		tendency.Tendency1h = PressureTendency(change * 3)
+	}
+	if change, ok := b.change(pressure, ts, 3*time.Hour); ok {
+		tendency.Change3h = &change
+		tendency.Tendency3h = PressureTendency(change)
+		tendency.Warning = -change >= b.conf.FallingFast
+	}
+	return tendency
+}
+
+// change finds the sample closest to the start of the window
+func (b *Barometer) change(pressure float64, ts time.Time, window time.Duration) (float64, bool) {
+	start := ts.Add(-window)
+	best := -1
+	bestDiff := baroWindowTolerance + 1
+	for i, sample := range b.samples {
+		diff := sample.Time.Sub(start)
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff < bestDiff {
+			best = i
+			bestDiff = diff
+		}
+	}
+	if best < 0 || bestDiff > baroWindowTolerance {
+		return 0.0, false
+	}
+	return math.Round((pressure-b.samples[best].Pressure)*10) / 10, true
+}
+
+func (b *Barometer) prune(ts time.Time) {
+	keep := 0
+	for keep < len(b.samples) && ts.Sub(b.samples[keep].Time) > baroHistory {
+		keep++
+	}
+	b.samples = b.samples[keep:]
+}
+
+func (b *Barometer) publish(client MQTT.Client, subtopic string, tendency BaroTendency) {
+	jsonData, err := json.Marshal(tendency)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, subtopic, string(jsonData))
+}
+
+// RegisterAPI adds the barometer endpoint to the API server
+func (b *Barometer) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/barometer", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, b.Tendency())
+	})
+}
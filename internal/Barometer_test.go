@@ -0,0 +1,132 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBaroConfig() BaroConfig {
+	return BaroConfig{
+		Enabled:         true,
+		FallingFast:     3.0,
+		PublishInterval: 300,
+	}
+}
+
+func pressureAt(ts time.Time, hPa float64) *Outside {
+	out := &Outside{Pressure: hPa}
+	out.Timestamp = ts
+	return out
+}
+
+func TestPressureTendency(t *testing.T) {
+	tests := []struct {
+		change   float64
+		expected string
+	}{
+		{0.0, TendencySteady},
+		{0.05, TendencySteady},
+		{1.0, TendencyRisingSlowly},
+		{-1.5, TendencyFallingSlowly},
+		{2.0, TendencyRising},
+		{-3.5, TendencyFalling},
+		{4.0, TendencyRisingQuickly},
+		{-6.0, TendencyFallingQuickly},
+		{6.1, TendencyRisingVeryRapidly},
+		{-8.0, TendencyFallingVeryRapidly},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, PressureTendency(tt.change), "change %v", tt.change)
+	}
+}
+
+func TestBarometerFallingFast(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	dataDir := t.TempDir()
+	baro := NewBarometer(testBaroConfig(), dataDir)
+	start := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// Not enough history for a tendency yet
+	out := pressureAt(start, 1015.0)
+	baro.Update(client, out)
+	assert.Equal(t, "", out.PressureTendency1h)
+	assert.Equal(t, "", out.PressureTendency3h)
+	assert.Nil(t, baro.Tendency().Change1h)
+
+	// Falling 1.2 hPa an hour, sampled every 30 seconds
+	var last *Outside
+	for i := 1; i <= 360; i++ {
+		ts := start.Add(time.Duration(i) * 30 * time.Second)
+		last = pressureAt(ts, 1015.0-1.2*ts.Sub(start).Hours())
+		baro.Update(client, last)
+	}
+	assert.InDelta(t, -1.2, last.PressureChange1h, 0.01)
+	assert.Equal(t, TendencyFalling, last.PressureTendency1h)
+	assert.InDelta(t, -3.6, last.PressureChange3h, 0.01)
+	assert.Equal(t, TendencyFallingQuickly, last.PressureTendency3h)
+	tendency := baro.Tendency()
+	assert.True(t, tendency.Warning)
+	assert.InDelta(t, -3.6, *tendency.Change3h, 0.01)
+
+	// Influx gets the derived fields
+	fields := last.GetInfluxFields()
+	assert.Equal(t, TendencyFallingQuickly, fields["PressureTendency3h"])
+
+	// The history survives a restart
+	restored := NewBarometer(testBaroConfig(), dataDir)
+	assert.NotNil(t, restored.Tendency().Change3h)
+
+	// Leveling off clears the warning once the drop over three hours is small enough
+	level := start.Add(3 * time.Hour)
+	for i := 1; i <= 360; i++ {
+		ts := level.Add(time.Duration(i) * 30 * time.Second)
+		last = pressureAt(ts, 1011.4)
+		baro.Update(client, last)
+	}
+	assert.Equal(t, 0.0, last.PressureChange1h)
+	assert.Equal(t, TendencySteady, last.PressureTendency3h)
+	assert.False(t, baro.Tendency().Warning)
+	assert.Equal(t, TendencySteady, last.GetInfluxFields()["PressureTendency3h"])
+	assert.Equal(t, 0.0, last.GetInfluxFields()["PressureChange3h"])
+}
+
+func TestBarometerAPI(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	baro := NewBarometer(testBaroConfig(), t.TempDir())
+	baro.Update(nil, pressureAt(time.Now(), 1012.0))
+	mux := http.NewServeMux()
+	baro.RegisterAPI(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/barometer", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var tendency BaroTendency
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tendency))
+	assert.Equal(t, 1012.0, tendency.Pressure)
+}
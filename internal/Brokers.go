@@ -0,0 +1,245 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultBrokerName is the name given to the broker configured by subscription.server
+const DefaultBrokerName = "default"
+
+// BrokerStatus is the connection status reported for each broker
+type BrokerStatus struct {
+	Name          string    `json:"Name"`
+	Host          string    `json:"Host"`
+	Connected     bool      `json:"Connected"`
+	LastConnected time.Time `json:"LastConnected,omitempty"`
+	LastLost      time.Time `json:"LastLost,omitempty"`
+	LastError     string    `json:"LastError,omitempty"`
+}
+
+// BrokerConnection is the client and status for one subscription broker
+type BrokerConnection struct {
+	mu     sync.RWMutex
+	conf   BrokerConfig
+	client MQTT.Client
+	status BrokerStatus
+}
+
+// BrokerSet holds every subscription broker
+// Every broker feeds the same handlers while reposts all go out through the repost broker
+type BrokerSet struct {
+	brokers []*BrokerConnection
+	repost  *BrokerConnection
+}
+
+var SharedBrokerSet *BrokerSet
+
+func NewBrokerSet(brokers []BrokerConfig, repostBroker string) *BrokerSet {
+	set := &BrokerSet{}
+	for _, conf := range brokers {
+		conn := &BrokerConnection{
+			conf:   conf,
+			status: BrokerStatus{Name: conf.Name, Host: conf.Host},
+		}
+		conn.client = newBrokerClient(conf, conn.onConnect, conn.onConnectionLost)
+		set.brokers = append(set.brokers, conn)
+		if conf.Name == repostBroker {
+			set.repost = conn
+		}
+	}
+	if set.repost == nil && len(set.brokers) > 0 {
+		set.repost = set.brokers[0]
+	}
+	return set
+}
+
+// newBrokerClient creates a client that keeps reconnecting, using MQTT 5 when the broker is set up for it
+func newBrokerClient(conf BrokerConfig, onConnect MQTT.OnConnectHandler, onLost MQTT.ConnectionLostHandler) MQTT.Client {
+	if conf.ProtocolVersion == 5 {
+		return NewV5Client(conf, true, onConnect, onLost)
+	}
+	mqttOpts := NewSubscriptionClientOptions(conf)
+	mqttOpts.SetAutoReconnect(true)
+	mqttOpts.SetConnectRetry(true)
+	mqttOpts.SetConnectionAttemptHandler(onConnectionAttempt)
+	mqttOpts.SetReconnectingHandler(onReconnect)
+	if onConnect != nil {
+		mqttOpts.SetOnConnectHandler(onConnect)
+	}
+	if onLost != nil {
+		mqttOpts.SetConnectionLostHandler(onLost)
+	}
+	return MQTT.NewClient(mqttOpts)
+}
+
+// NewBrokerClient creates a client for a one-off connection that gives up when it cannot connect
+func NewBrokerClient(conf BrokerConfig) MQTT.Client {
+	if conf.ProtocolVersion == 5 {
+		return NewV5Client(conf, false, nil, nil)
+	}
+	return MQTT.NewClient(NewSubscriptionClientOptions(conf))
+}
+
+// Connect starts connecting every broker
+// A broker that is down does not hold up the others since each keeps retrying on its own
+func (s *BrokerSet) Connect() {
+	for _, broker := range s.brokers {
+		log.Info().Msgf("Will subscribe on broker %v server %v", broker.conf.Name, broker.conf.Host)
+		go func(broker *BrokerConnection) {
+			if token := broker.client.Connect(); token.Wait() && token.Error() != nil {
+				log.Warn().Msgf("Error Connecting to broker %v: %v", broker.conf.Name, token.Error())
+				broker.mu.Lock()
+				broker.status.LastError = token.Error().Error()
+				broker.mu.Unlock()
+			}
+		}(broker)
+	}
+}
+
+// RepostClient returns the client reposts and derived data are published through
+func (s *BrokerSet) RepostClient() MQTT.Client {
+	if s.repost == nil {
+		return nil
+	}
+	return s.repost.client
+}
+
+// Client returns the client of the named broker
+func (s *BrokerSet) Client(name string) MQTT.Client {
+	for _, broker := range s.brokers {
+		if broker.conf.Name == name {
+			return broker.client
+		}
+	}
+	return nil
+}
+
+// Statuses returns the connection status of every broker in configured order
+func (s *BrokerSet) Statuses() []BrokerStatus {
+	statuses := make([]BrokerStatus, 0, len(s.brokers))
+	for _, broker := range s.brokers {
+		statuses = append(statuses, broker.Status())
+	}
+	return statuses
+}
+
+func (s *BrokerSet) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/brokers", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, s.Statuses())
+	})
+}
+
+// Status returns a copy of the broker status
+func (b *BrokerConnection) Status() BrokerStatus {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.status
+}
+
+// This function gets called when a connection is successful
+// In the event of a reconnect scenario we can resubscribe to topics here
+func (b *BrokerConnection) onConnect(client MQTT.Client) {
+	log.Info().Msgf("Connected to broker %v!", b.conf.Name)
+	b.mu.Lock()
+	b.status.Connected = true
+	b.status.LastConnected = time.Now()
+	b.status.LastError = ""
+	b.mu.Unlock()
+	b.subscribe(client)
+	if SharedDaemonStatus != nil && (SharedBrokerSet == nil || SharedBrokerSet.repost == b) {
+		SharedDaemonStatus.PublishOnline(client)
+	}
+	b.publishStatus()
+}
+
+func (b *BrokerConnection) onConnectionLost(client MQTT.Client, err error) {
+	log.Warn().Msgf("Connection Lost to broker %v! %v", b.conf.Name, err.Error())
+	b.mu.Lock()
+	b.status.Connected = false
+	b.status.LastLost = time.Now()
+	b.status.LastError = err.Error()
+	b.mu.Unlock()
+	b.publishStatus()
+}
+
+// subscribe subscribes to this broker's topics for every enabled category
+func (b *BrokerConnection) subscribe(mqttClient MQTT.Client) {
+	for _, category := range RegisteredCategories() {
+		catConf := SharedSubscriptionConfig.Categories[category.Name]
+		if !catConf.Subscribed {
+			continue
+		}
+		for _, topic := range b.conf.Topics[category.Name] {
+			addSubscription(sharedTopic(b.conf.ShareGroup, topic), catConf.QoS, countMessages(category.Name, category.Handler), mqttClient)
+		}
+	}
+	// Anchor commands come from the broker reposts go to so the watch is only commanded once
+	if SharedAnchorWatch != nil && (SharedBrokerSet == nil || SharedBrokerSet.repost == b) {
+		addSubscription(SharedSubscriptionConfig.Anchor.CommandTopic, byte(1), OnAnchorCommandMessage, mqttClient)
+	}
+}
+
+// publishStatus reposts the broker status as derived data
+func (b *BrokerConnection) publishStatus() {
+	jsonData, err := json.Marshal(b.Status())
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(b.client, "brokers/"+b.conf.Name+"/status", string(jsonData))
+}
+
+// sharedTopic turns a topic into a shared subscription so instances in the group split the messages
+func sharedTopic(group string, topic string) string {
+	if group == "" {
+		return topic
+	}
+	return "$share/" + group + "/" + topic
+}
+
+// brokerTopicsSubscribed reports whether any broker subscribes to topics for the category
+func brokerTopicsSubscribed(name string) bool {
+	if !SharedSubscriptionConfig.Categories[name].Subscribed {
+		return false
+	}
+	for _, broker := range SharedSubscriptionConfig.Brokers {
+		if len(broker.Topics[name]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// repostClient returns the client to publish reposts with
+// Data received on any broker goes out through the one repost broker so consumers see a single stream
+func repostClient(client MQTT.Client) MQTT.Client {
+	if SharedBrokerSet == nil {
+		return client
+	}
+	if repost := SharedBrokerSet.RepostClient(); repost != nil {
+		return repost
+	}
+	return client
+}
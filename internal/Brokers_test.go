@@ -0,0 +1,239 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockBrokerSet builds a broker set whose clients are mocks so nothing connects
+func mockBrokerSet(brokers []BrokerConfig) (*BrokerSet, []*MockMQTTClient) {
+	set := &BrokerSet{}
+	var clients []*MockMQTTClient
+	for _, conf := range brokers {
+		client := &MockMQTTClient{}
+		clients = append(clients, client)
+		set.brokers = append(set.brokers, &BrokerConnection{
+			conf:   conf,
+			client: client,
+			status: BrokerStatus{Name: conf.Name, Host: conf.Host},
+		})
+	}
+	set.repost = set.brokers[0]
+	return set, clients
+}
+
+func TestBrokerSubscribe(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	SharedSubscriptionConfig.Categories["ble"] = CategoryConfig{Subscribed: false}
+	SharedSubscriptionConfig.Categories["esp"] = CategoryConfig{Subscribed: true, QoS: 1}
+	SharedSubscriptionConfig.Brokers = []BrokerConfig{
+		{Name: "cerbo", Topics: map[string][]string{"nav": {"N/123/vessels/self/navigation/#"}}},
+		{Name: "hub", ShareGroup: "msh", Topics: map[string][]string{"ble": {"ble/temperature"}, "esp": {"esp/status"}}},
+	}
+	set, clients := mockBrokerSet(SharedSubscriptionConfig.Brokers)
+	SharedBrokerSet = set
+	defer func() { SharedBrokerSet = nil }()
+
+	// Each broker only subscribes to its own topics and disabled categories are skipped
+	// The hub is in a share group so its topics are split between instances
+	set.brokers[0].onConnect(clients[0])
+	set.brokers[1].onConnect(clients[1])
+	assert.Equal(t, []string{"N/123/vessels/self/navigation/#"}, clients[0].Subscriptions)
+	assert.Equal(t, []string{"$share/msh/esp/status"}, clients[1].Subscriptions)
+	assert.Equal(t, byte(0), clients[0].SubscriptionQoS["N/123/vessels/self/navigation/#"])
+	assert.Equal(t, byte(1), clients[1].SubscriptionQoS["$share/msh/esp/status"])
+
+	assert.True(t, brokerTopicsSubscribed("nav"))
+	assert.False(t, brokerTopicsSubscribed("ble"))
+	assert.False(t, brokerTopicsSubscribed("ais"))
+}
+
+func TestBrokerStatus(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	set, clients := mockBrokerSet([]BrokerConfig{
+		{Name: "cerbo", Host: "tcp://venus.local:1883"},
+		{Name: "hub", Host: "tcp://hub.local:1883"},
+	})
+	SharedBrokerSet = set
+	defer func() { SharedBrokerSet = nil }()
+
+	set.brokers[1].onConnect(clients[1])
+	set.brokers[1].onConnectionLost(clients[1], errors.New("EOF"))
+
+	statuses := set.Statuses()
+	require.Len(t, statuses, 2)
+	assert.False(t, statuses[0].Connected)
+	assert.Equal(t, "hub", statuses[1].Name)
+	assert.False(t, statuses[1].Connected)
+	assert.False(t, statuses[1].LastConnected.IsZero())
+	assert.False(t, statuses[1].LastLost.IsZero())
+	assert.Equal(t, "EOF", statuses[1].LastError)
+
+	// Status changes on any broker go out through the repost broker
+	published := clients[0].PublishedTo("test/vessel/brokers/hub/status")
+	require.Len(t, published, 2)
+	var status BrokerStatus
+	require.NoError(t, json.Unmarshal([]byte(published[1].Payload.(string)), &status))
+	assert.False(t, status.Connected)
+	assert.Empty(t, clients[1].Published)
+
+	mux := http.NewServeMux()
+	set.RegisterAPI(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/brokers", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var apiStatuses []BrokerStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &apiStatuses))
+	assert.Len(t, apiStatuses, 2)
+}
+
+func TestBrokerRepost(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	set, clients := mockBrokerSet([]BrokerConfig{{Name: "cerbo"}, {Name: "hub"}})
+	SharedBrokerSet = set
+	defer func() { SharedBrokerSet = nil }()
+
+	// Data received on the hub is reposted through the repost broker
+	handleWindMessage(clients[1], NewMockMessage("vessels/self/environment/wind/speedApparent",
+		[]byte(`{"value": 5.0, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.100Z"}`)))
+	assert.Len(t, clients[0].PublishedTo("test/vessel/environment/wind/mapped-source/speedApparent"), 1)
+	assert.Empty(t, clients[1].Published)
+}
+
+func TestSubscriptionClientOptions(t *testing.T) {
+	// Clean sessions are the default and keep messages in memory
+	opts := NewSubscriptionClientOptions(BrokerConfig{Name: "cerbo", Host: "tcp://venus.local:1883", CleanSession: true})
+	reader := MQTT.NewOptionsReader(opts)
+	assert.True(t, reader.CleanSession())
+	assert.Empty(t, reader.ClientID())
+
+	storeDir := filepath.Join(t.TempDir(), "mqtt", "cerbo")
+	opts = NewSubscriptionClientOptions(BrokerConfig{
+		Name:     "cerbo",
+		Host:     "tcp://venus.local:1883",
+		ClientID: "boat-cerbo",
+		StoreDir: storeDir,
+	})
+	reader = MQTT.NewOptionsReader(opts)
+	assert.False(t, reader.WillEnabled())
+	assert.False(t, reader.CleanSession())
+	assert.True(t, reader.ResumeSubs())
+	assert.Equal(t, "boat-cerbo", reader.ClientID())
+	info, err := os.Stat(storeDir)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+
+	// The daemon status Last Will is retained so the broker leaves the offline message in place
+	opts = NewSubscriptionClientOptions(BrokerConfig{
+		Name:         "cerbo",
+		Host:         "tcp://venus.local:1883",
+		CleanSession: true,
+		WillTopic:    "msh/daemon/status",
+		WillPayload:  `{"Status":"offline"}`,
+	})
+	reader = MQTT.NewOptionsReader(opts)
+	assert.True(t, reader.WillEnabled())
+	assert.Equal(t, "msh/daemon/status", reader.WillTopic())
+	assert.Equal(t, []byte(`{"Status":"offline"}`), reader.WillPayload())
+	assert.Equal(t, byte(1), reader.WillQos())
+	assert.True(t, reader.WillRetained())
+}
+
+// writeTestKeyPair writes a self-signed client certificate and key to dir
+func writeTestKeyPair(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "boat"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	// Plain connections keep the client defaults
+	assert.Nil(t, newTLSConfig(nil, TLSOptions{}))
+
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir())
+	serverName, minVersion := "mqtt.example.com", "1.2"
+	clientTLS, err := loadTLSOptions("cloud", tlsFile{
+		CertFile:      &certFile,
+		KeyFile:       &keyFile,
+		ServerName:    &serverName,
+		TLSMinVersion: &minVersion,
+	})
+	require.NoError(t, err)
+	tlsConfig := newTLSConfig(nil, clientTLS)
+	require.NotNil(t, tlsConfig)
+	assert.Len(t, tlsConfig.Certificates, 1)
+	assert.Equal(t, "mqtt.example.com", tlsConfig.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.False(t, tlsConfig.InsecureSkipVerify)
+	assert.Nil(t, tlsConfig.RootCAs)
+
+	// A CA alone still builds a config that trusts it
+	tlsConfig = newTLSConfig([]byte("not a cert"), TLSOptions{Insecure: true})
+	require.NotNil(t, tlsConfig)
+	assert.NotNil(t, tlsConfig.RootCAs)
+	assert.True(t, tlsConfig.InsecureSkipVerify)
+	assert.Empty(t, tlsConfig.Certificates)
+
+	// The same options reach the v3 client
+	opts := NewSubscriptionClientOptions(BrokerConfig{
+		Name:         "cloud",
+		Host:         "ssl://mqtt.example.com:8883",
+		CleanSession: true,
+		TLS:          clientTLS,
+	})
+	reader := MQTT.NewOptionsReader(opts)
+	require.NotNil(t, reader.TLSConfig())
+	assert.Len(t, reader.TLSConfig().Certificates, 1)
+}
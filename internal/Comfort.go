@@ -0,0 +1,170 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// Magnus formula coefficients over water
+const (
+	magnusA = 17.62
+	magnusB = 243.12
+)
+
+// ComfortRisk is reposted when a location's condensation risk changes
+type ComfortRisk struct {
+	Location         string    `json:"Location"`
+	CondensationRisk bool      `json:"CondensationRisk"`
+	TempF            float64   `json:"TempF"`
+	Humidity         float64   `json:"Humidity"`
+	DewPointF        float64   `json:"DewPointF"`
+	SurfaceTempF     float64   `json:"SurfaceTempF"`
+	SurfaceSource    string    `json:"SurfaceSource"`
+	Timestamp        time.Time `json:"Timestamp"`
+}
+
+// DewPointF returns the dew point for a temperature and relative humidity in percent
+func DewPointF(tempF float64, humidity float64) float64 {
+	tempC := FahrenheitToCelsius(tempF)
+	gamma := math.Log(humidity/100) + magnusA*tempC/(magnusB+tempC)
+	return CelsiusToFahrenheit(magnusB * gamma / (magnusA - gamma))
+}
+
+// AbsoluteHumidity returns grams of water vapor per cubic meter of air
+func AbsoluteHumidity(tempF float64, humidity float64) float64 {
+	tempC := FahrenheitToCelsius(tempF)
+	saturation := 6.112 * math.Exp(magnusA*tempC/(magnusB+tempC))
+	return saturation * humidity * 2.1674 / (273.15 + tempC)
+}
+
+// HeatIndexF returns the NWS heat index
+// Below about 80F the simple formula is used and the result is close to the air temperature
+func HeatIndexF(tempF float64, humidity float64) float64 {
+	simple := 0.5 * (tempF + 61.0 + (tempF-68.0)*1.2 + humidity*0.094)
+	if (simple+tempF)/2 < 80.0 {
+		return simple
+	}
+	hi := -42.379 + 2.04901523*tempF + 10.14333127*humidity -
+		0.22475541*tempF*humidity - 0.00683783*tempF*tempF -
+		0.05481717*humidity*humidity + 0.00122874*tempF*tempF*humidity +
+		0.00085282*tempF*humidity*humidity - 0.00000199*tempF*tempF*humidity*humidity
+	if humidity < 13 && tempF >= 80 && tempF <= 112 {
+		hi -= ((13 - humidity) / 4) * math.Sqrt((17-math.Abs(tempF-95))/17)
+	} else if humidity > 85 && tempF >= 80 && tempF <= 87 {
+		hi += ((humidity - 85) / 10) * ((87 - tempF) / 5)
+	}
+	return hi
+}
+
+// ComfortMonitor adds comfort fields to BLE readings and flags condensation risk per location
+type ComfortMonitor struct {
+	mu   sync.Mutex
+	conf ComfortConfig
+	risk map[string]bool
+}
+
+var SharedComfortMonitor *ComfortMonitor
+
+func NewComfortMonitor(conf ComfortConfig) *ComfortMonitor {
+	return &ComfortMonitor{
+		conf: conf,
+		risk: make(map[string]bool),
+	}
+}
+
+// surfaceTemp picks the configured proxy for the temperature of the hull and other cold surfaces
+func (c *ComfortMonitor) surfaceTemp(snap VesselSnapshot, ts time.Time) (float64, string, bool) {
+	maxAge := time.Duration(c.conf.ProxyMaxAge) * time.Second
+	outside := !snap.OutsideTempTime.IsZero() && ts.Sub(snap.OutsideTempTime) <= maxAge
+	water := !snap.WaterTempTime.IsZero() && ts.Sub(snap.WaterTempTime) <= maxAge
+	if c.conf.Surface == "water" {
+		if water {
+			return snap.WaterTempF, "water", true
+		}
+		if outside {
+			return snap.OutsideTempF, "outside", true
+		}
+		return 0.0, "", false
+	}
+	if outside {
+		return snap.OutsideTempF, "outside", true
+	}
+	if water {
+		return snap.WaterTempF, "water", true
+	}
+	return 0.0, "", false
+}
+
+// Update fills in the comfort fields on a BLE reading and checks it for condensation risk
+func (c *ComfortMonitor) Update(client MQTT.Client, ble *BLETemperature, snap VesselSnapshot) {
+	if ble.Humidity <= 0.0 || ble.Humidity > 100.0 || (ble.TempF == 0.0 && !ble.IsPresent("TempF")) {
+		return
+	}
+	ble.DewPointF = DewPointF(ble.TempF, ble.Humidity)
+	ble.AbsHumidity = AbsoluteHumidity(ble.TempF, ble.Humidity)
+	ble.HeatIndexF = HeatIndexF(ble.TempF, ble.Humidity)
+
+	ts := ble.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	surface, source, ok := c.surfaceTemp(snap, ts)
+	if !ok {
+		return
+	}
+	risk := surface-ble.DewPointF <= c.conf.MarginF
+	ble.CondensationRisk = &risk
+
+	location := ble.Location
+	if location == "" {
+		location = ble.MAC
+	}
+	c.mu.Lock()
+	changed := c.risk[location] != risk
+	c.risk[location] = risk
+	c.mu.Unlock()
+	if !changed {
+		return
+	}
+	if risk {
+		log.Warn().Msgf("Condensation risk in %v: dew point %.1fF with %v at %.1fF", location, ble.DewPointF, source, surface)
+	} else {
+		log.Info().Msgf("Condensation risk in %v cleared", location)
+	}
+	jsonData, err := json.Marshal(ComfortRisk{
+		Location:         location,
+		CondensationRisk: risk,
+		TempF:            ble.TempF,
+		Humidity:         ble.Humidity,
+		DewPointF:        ble.DewPointF,
+		SurfaceTempF:     surface,
+		SurfaceSource:    source,
+		Timestamp:        ts,
+	})
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "comfort/"+location+"/risk", string(jsonData))
+}
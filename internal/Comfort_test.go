@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testComfortConfig() ComfortConfig {
+	return ComfortConfig{
+		Enabled:     true,
+		Surface:     "outside",
+		MarginF:     5.0,
+		ProxyMaxAge: 1800,
+	}
+}
+
+func bleAt(ts time.Time, tempF float64, humidity float64) *BLETemperature {
+	ble := &BLETemperature{Location: "VBerth", TempF: tempF, Humidity: humidity}
+	ble.Timestamp = ts
+	return ble
+}
+
+func TestDewPointF(t *testing.T) {
+	// 77F at 50% is a dew point of about 57F
+	assert.InDelta(t, 57.0, DewPointF(77.0, 50.0), 0.5)
+	// Saturated air is at its dew point
+	assert.InDelta(t, 60.0, DewPointF(60.0, 100.0), 0.01)
+	assert.Less(t, DewPointF(60.0, 40.0), DewPointF(60.0, 80.0))
+}
+
+func TestAbsoluteHumidity(t *testing.T) {
+	// 68F (20C) at 50% holds about 8.6 g/m3
+	assert.InDelta(t, 8.6, AbsoluteHumidity(68.0, 50.0), 0.1)
+	assert.InDelta(t, 0.0, AbsoluteHumidity(68.0, 0.0), 0.001)
+}
+
+func TestHeatIndexF(t *testing.T) {
+	// NWS table values
+	assert.InDelta(t, 100.0, HeatIndexF(90.0, 60.0), 1.0)
+	assert.InDelta(t, 86.0, HeatIndexF(82.0, 70.0), 1.0)
+	// Cool air is close to the air temperature
+	assert.InDelta(t, 60.0, HeatIndexF(60.0, 50.0), 2.0)
+}
+
+func TestComfortMonitorCondensationRisk(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	comfort := NewComfortMonitor(testComfortConfig())
+	now := time.Date(2025, 1, 10, 6, 0, 0, 0, time.UTC)
+
+	// No surface proxy yet so only the comfort fields are filled in
+	ble := bleAt(now, 65.0, 70.0)
+	comfort.Update(client, ble, VesselSnapshot{})
+	assert.InDelta(t, DewPointF(65.0, 70.0), ble.DewPointF, 0.001)
+	assert.Greater(t, ble.AbsHumidity, 0.0)
+	assert.Greater(t, ble.HeatIndexF, 0.0)
+	assert.Nil(t, ble.CondensationRisk)
+
+	// Cold night air against a warm damp cabin
+	snap := VesselSnapshot{OutsideTempF: 50.0, OutsideTempTime: now.Add(-time.Minute)}
+	ble = bleAt(now, 65.0, 70.0)
+	comfort.Update(client, ble, snap)
+	assert.NotNil(t, ble.CondensationRisk)
+	assert.True(t, *ble.CondensationRisk)
+	assert.True(t, comfort.risk["VBerth"])
+
+	// Drier cabin clears it
+	ble = bleAt(now.Add(time.Minute), 65.0, 35.0)
+	comfort.Update(client, ble, snap)
+	assert.False(t, *ble.CondensationRisk)
+	assert.False(t, comfort.risk["VBerth"])
+
+	// Stale proxy is not used
+	ble = bleAt(now.Add(time.Hour), 65.0, 70.0)
+	comfort.Update(client, ble, snap)
+	assert.Nil(t, ble.CondensationRisk)
+}
+
+func TestComfortMonitorSurfaceTemp(t *testing.T) {
+	conf := testComfortConfig()
+	now := time.Now()
+	snap := VesselSnapshot{
+		OutsideTempF:    50.0,
+		OutsideTempTime: now,
+		WaterTempF:      45.0,
+		WaterTempTime:   now,
+	}
+
+	temp, source, ok := NewComfortMonitor(conf).surfaceTemp(snap, now)
+	assert.True(t, ok)
+	assert.Equal(t, "outside", source)
+	assert.Equal(t, 50.0, temp)
+
+	conf.Surface = "water"
+	temp, source, ok = NewComfortMonitor(conf).surfaceTemp(snap, now)
+	assert.True(t, ok)
+	assert.Equal(t, "water", source)
+	assert.Equal(t, 45.0, temp)
+
+	// Falls back to the other proxy
+	snap.WaterTempTime = time.Time{}
+	_, source, ok = NewComfortMonitor(conf).surfaceTemp(snap, now)
+	assert.True(t, ok)
+	assert.Equal(t, "outside", source)
+}
+
+func TestComfortMonitorIgnoresMissingHumidity(t *testing.T) {
+	comfort := NewComfortMonitor(testComfortConfig())
+	ble := bleAt(time.Now(), 65.0, 0.0)
+	comfort.Update(nil, ble, VesselSnapshot{})
+	assert.Equal(t, 0.0, ble.DewPointF)
+	assert.Nil(t, ble.CondensationRisk)
+}
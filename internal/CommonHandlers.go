@@ -17,14 +17,32 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"context"
 	"encoding/json"
 	"strings"
+	"sync"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/rs/zerolog/log"
 )
 
+// activeHandlers counts message handlers that are still running
+var activeHandlers sync.WaitGroup
+
+// dispatchMessage runs the handler in its own goroutine so the MQTT client is not blocked
+func dispatchMessage(handler MQTT.MessageHandler, client MQTT.Client, message MQTT.Message) {
+	activeHandlers.Add(1)
+	go func() {
+		defer activeHandlers.Done()
+		handler(client, message)
+	}()
+}
+
+// waitForHandlers blocks until every dispatched message has been handled
+func waitForHandlers() {
+	activeHandlers.Wait()
+}
+
 // HandleJSONMessage handles messages that are already in JSON format
 // This is used by BLETemperature, ESPStatus, and PHYTemperature handlers
 func HandleJSONMessage(client MQTT.Client, message MQTT.Message, data SensorData) {
@@ -39,42 +57,19 @@ func HandleJSONMessage(client MQTT.Client, message MQTT.Message, data SensorData
 	err := json.Unmarshal(message.Payload(), data)
 	if err != nil {
 		log.Warn().Msgf("Error unmarshalling JSON for topic: %v error: %v", message.Topic(), err.Error())
+		countError(ErrorParse)
 		return
 	}
+	markJSONPresence(data, message.Payload())
 }
 
 func SendJSONMessage(client MQTT.Client, message MQTT.Message, data SensorData) {
-	// Log message receipt
-	logEnabled := data.GetLogEnabled()
-
-	// Skip empty data
-	if data.IsEmpty() {
+	measurement := message.Topic()[strings.LastIndex(message.Topic(), "/")+1:]
+	if isExcludedSource(data) {
+		log.Trace().Msgf("Ignoring excluded source %v", data.GetSource())
 		return
 	}
-
-	// Log the data
-	data.LogJSON()
-
-	// Publish to MQTT if enabled
-	if SharedSubscriptionConfig.Repost {
-		measurement := message.Topic()[strings.LastIndex(message.Topic(), "/")+1:]
-		PublishClientMessage(client,
-			SharedSubscriptionConfig.RepostRootTopic+"vessel/"+data.GetTopicPrefix()+"/"+data.GetSource()+"/"+measurement,
-			data.ToJSON(), true)
-	}
-
-	// Write to InfluxDB if enabled
-	if SharedSubscriptionConfig.InfluxEnabled {
-		p := data.ToInfluxPoint()
-		err := SharedInfluxWriteAPI.WritePoint(context.Background(), p)
-		if err != nil {
-			log.Warn().Msgf("Error writing to influx: %v", err.Error())
-		}
-		log.Trace().Msg("Wrote Point")
-		if logEnabled {
-			log.Debug().Msg("Wrote Point")
-		}
-	}
+	processSensorData(client, measurement, data)
 }
 
 // MapMACToLocation maps a MAC address to a location name
@@ -86,3 +81,20 @@ func MapMACToLocation(data SensorData, mac string) string {
 	log.Warn().Msgf("Location not found for MAC %v", mac)
 	return ""
 }
+
+// PublishDerivedMessage reposts data computed by the daemon itself under the vessel topic tree
+func PublishDerivedMessage(client MQTT.Client, subtopic string, messagedata string) {
+	repostMessage(client, RepostTopic{Category: DerivedCategory, Prefix: subtopic, Path: subtopic}, messagedata)
+}
+
+// WriteDerivedPoint writes a point computed by the daemon itself to InfluxDB
+func WriteDerivedPoint(p *write.Point) {
+	if !SharedSubscriptionConfig.InfluxEnabled || SharedInfluxWriteAPI == nil {
+		return
+	}
+	tagZone(p)
+	err := writeInfluxPoint(p)
+	if err != nil {
+		log.Warn().Msgf("Error writing to influx: %v", err.Error())
+	}
+}
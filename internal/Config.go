@@ -17,68 +17,329 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"path/filepath"
+	"sort"
 
 	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
 )
 
 type MQTTDestination struct {
-	Host     string
-	Topics   []string
-	Username string
-	Password string
-	CACert   []byte
+	Host            string
+	Topics          []string
+	Username        string
+	Password        Secret
+	CACert          []byte
+	TLS             TLSOptions
+	ProtocolVersion uint
+}
+
+// TLSOptions are the TLS settings shared by the MQTT brokers and InfluxDB
+// CertFile and KeyFile present a client certificate for brokers that require mTLS
+// Insecure skips verifying the server certificate and is only meant for testing
+type TLSOptions struct {
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	MinVersion uint16
+	Insecure   bool
+	// certificate is the client certificate loaded when the config was read
+	certificate *tls.Certificate
+}
+
+// tlsVersions maps the tls-min-version setting to the crypto/tls constant
+// 1 is accepted since YAML reads an unquoted 1.0 as a number
+var tlsVersions = map[string]uint16{
+	"1":   tls.VersionTLS10,
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
 }
 
 type SubscriptionConfig struct {
-	Host             string
-	Username         string
-	Password         string
-	CACert           []byte
-	BLETopics        []string
-	PHYTopics        []string
-	ESPTopics        []string
-	NavTopics        []string
-	GNSSTopics       []string
-	SteeringTopics   []string
-	WindTopics       []string
-	WaterTopics      []string
-	OutsideTopics    []string
-	PropulsionTopics []string
-	Repost           bool
-	RepostRootTopic  string
-	PublishTimeout   uint
-	MACtoLocation    map[string]string
-	N2KtoName        map[string]string
-	InfluxEnabled    bool
-	InfluxOrg        string
-	InfluxBucket     string
-	InfluxToken      string
-	InfluxUrl        string
-	BLESubEn         bool
-	GNSSSubEn        bool
-	ESPSubEn         bool
-	NavSubEn         bool
-	OutsideSubEn     bool
-	PHYSubEn         bool
-	PropSubEn        bool
-	SteerSubEn       bool
-	WaterSubEn       bool
-	WindSubEn        bool
-	BLELogEn         bool
-	GNSSLogEn        bool
-	ESPLogEn         bool
-	NavLogEn         bool
-	OutsideLogEn     bool
-	PHYLogEn         bool
-	PropLogEn        bool
-	SteerLogEn       bool
-	WaterLogEn       bool
-	WindLogEn        bool
+	Brokers         []BrokerConfig
+	RepostBroker    string
+	Categories      map[string]CategoryConfig
+	Repost          bool
+	RepostRootTopic string
+	RepostTargets   []RepostDestination
+	PublishTimeout  uint
+	MACtoLocation   map[string]string
+	N2KtoName       map[string]string
+	InfluxEnabled   bool
+	InfluxOrg       string
+	InfluxBucket    string
+	InfluxToken     Secret
+	InfluxUrl       string
+	InfluxCACert    []byte
+	InfluxTLS       TLSOptions
+	DataDir         string
+	Passage         PassageConfig
+	Fuel            FuelConfig
+	Engine          EngineConfig
+	Maintenance     MaintenanceConfig
+	Anchor          AnchorConfig
+	Geofence        GeofenceConfig
+	AIS             AISConfig
+	Barometer       BaroConfig
+	Comfort         ComfortConfig
+	Refrigeration   RefrigerationConfig
+	Filter          FilterConfig
+	Sources         SourceConfig
+	Aggregation     AggregationConfig
+	Deadband        DeadbandConfig
+	DaemonStatus    DaemonStatusConfig
+	Mappings        []PathMapping
+	API             APIConfig
+}
+
+// BrokerConfig is one broker the daemon subscribes to
+// Topics holds the category topic lists for this broker with RootTopic already prepended
+// ProtocolVersion 5 selects the MQTT 5 client and ShareGroup turns the topics into shared subscriptions
+// Without a clean session in-flight messages are kept in StoreDir so they survive a restart
+type BrokerConfig struct {
+	Name            string
+	Host            string
+	Username        string
+	Password        Secret
+	CACert          []byte
+	TLS             TLSOptions
+	RootTopic       string
+	Topics          map[string][]string
+	ClientID        string
+	CleanSession    bool
+	StoreDir        string
+	ProtocolVersion uint
+	ShareGroup      string
+	WillTopic       string
+	WillPayload     string
+}
+
+// RepostDestination is where reposts are published
+// Broker names a subscription broker to publish through, otherwise Host and its credentials get their own connection
+// Topic is a text/template and Categories limits which handler categories are sent, all of them when empty
+// MessageExpiry is only sent to MQTT 5 brokers, which drop reposts older than it
+type RepostDestination struct {
+	Name            string
+	Broker          string
+	Host            string
+	Username        string
+	Password        Secret
+	CACert          []byte
+	TLS             TLSOptions
+	ProtocolVersion uint
+	Topic           string
+	QoS             byte
+	Retained        bool
+	Categories      []string
+	MessageExpiry   uint32
+}
+
+// RepostBrokerConfig returns the broker reposts and anchor commands go through
+func (c SubscriptionConfig) RepostBrokerConfig() BrokerConfig {
+	for _, broker := range c.Brokers {
+		if broker.Name == c.RepostBroker {
+			return broker
+		}
+	}
+	return BrokerConfig{}
+}
+
+// CategoryConfig holds the topics and switches for one registered handler category
+type CategoryConfig struct {
+	Topics     []string
+	Subscribed bool
+	Verbose    bool
+	QoS        byte
+}
+
+type PassageConfig struct {
+	Enabled       bool
+	StartSOG      float64
+	StartSeconds  uint
+	StopSOG       float64
+	StopSeconds   uint
+	TrackInterval uint
+	TrackDistance float64
+}
+
+type FuelConfig struct {
+	Enabled         bool
+	PublishInterval uint
+	TripGap         uint
+	TankCapacity    map[string]float64
+}
+
+type EngineConfig struct {
+	Enabled          bool
+	StartRPM         int64
+	UnderwayRPM      int64
+	StopTimeout      uint
+	RunTimeTolerance float64
+}
+
+type MaintenanceConfig struct {
+	Enabled         bool
+	PublishInterval uint
+	WarnHours       float64
+	WarnDays        uint
+	Items           []MaintenanceItem
+}
+
+type MaintenanceItem struct {
+	Name   string
+	Engine string
+	Hours  float64
+	Days   uint
+	Months uint
+}
+
+type AnchorConfig struct {
+	Enabled         bool
+	CommandTopic    string
+	Radius          float64
+	AlarmSeconds    uint
+	PublishInterval uint
+	MaxHDOP         float64
+	MinSatellites   int64
+}
+
+type GeofenceConfig struct {
+	Enabled bool
+	Zones   []GeofenceZone
+}
+
+// GeofenceZone is either a circle around Lat and Lon or a polygon
+type GeofenceZone struct {
+	Name    string
+	Lat     float64
+	Lon     float64
+	Radius  float64
+	Polygon []GeoPoint
+}
+
+// APIConfig is the HTTP API server
+// Requests that change state need the Token, or come from the local host when no Token is set
+type APIConfig struct {
+	Listen string
+	Token  Secret
+}
+
+type DaemonStatusConfig struct {
+	Enabled         bool
+	PublishInterval uint
+}
+
+// AISConfig OwnTimeout limits how old our own position, SOG and COG may be when computing a CPA
+type AISConfig struct {
+	TargetTimeout   uint
+	OwnTimeout      uint
+	PublishInterval uint
+	CPAWarnNM       float64
+	TCPAWarnMinutes float64
+}
+
+type BaroConfig struct {
+	Enabled         bool
+	FallingFast     float64
+	PublishInterval uint
+}
+
+type ComfortConfig struct {
+	Enabled     bool
+	Surface     string
+	MarginF     float64
+	ProxyMaxAge uint
+}
+
+type RefrigerationConfig struct {
+	Enabled         bool
+	Hysteresis      float64
+	DoorRiseRate    float64
+	PulldownMinutes uint
+	DutyWarnPct     float64
+	Units           []RefrigUnitConfig
+}
+
+// RefrigUnitConfig is a fridge or freezer named by its BLE location
+type RefrigUnitConfig struct {
+	Name     string
+	Type     string
+	MaxTempF float64
+}
+
+type FilterConfig struct {
+	Enabled         bool
+	LogRejects      bool
+	PublishInterval uint
+	Rules           []FilterRule
+}
+
+// FilterRule is the checks for one field of one measurement
+// A Window of samples is needed for the Hampel and median filters
+type FilterRule struct {
+	Measurement string
+	Field       string
+	Min         *float64
+	Max         *float64
+	MaxRate     float64
+	Window      int
+	Hampel      float64
+	Median      bool
+}
+
+// SourceConfig decides which source to believe when several report the same thing
+// Exclude holds source name fragments whose data is dropped for a measurement
+type SourceConfig struct {
+	StaleAfter uint
+	BestSource string
+	Exclude    map[string][]string
+	Priority   []SourcePriority
+}
+
+// SourcePriority is the preferred sources for one SignalK leaf of a measurement in order
+// A Field of * covers every leaf without a rule of its own
+type SourcePriority struct {
+	Measurement string
+	Field       string
+	Sources     []string
+}
+
+type AggregationConfig struct {
+	Policies []AggregationPolicy
+}
+
+// AggregationPolicy downsamples one measurement into windows of Interval seconds
+// Angles names the fields averaged as directions rather than numbers
+type AggregationPolicy struct {
+	Measurement string
+	Interval    uint
+	Functions   []string
+	Angles      []string
+	KeepRaw     bool
+}
+
+type DeadbandConfig struct {
+	Policies []DeadbandPolicy
+}
+
+// DeadbandPolicy holds back unchanged readings of one measurement for up to MaxSilence seconds
+// Fields is keyed by lower case field name
+type DeadbandPolicy struct {
+	Measurement string
+	MaxSilence  uint
+	Fields      map[string]DeadbandField
+}
+
+// DeadbandField is how far a field must move to be passed on
+// Absolute is in the field's units and Percent is of the last value passed on
+type DeadbandField struct {
+	Absolute float64
+	Percent  float64
 }
 
 type PublishConfig struct {
@@ -88,32 +349,39 @@ type PublishConfig struct {
 }
 
 func LoadPublishConfig() (PublishConfig, error) {
+	return loadPublishConfig(readConfigFile().Publish)
+}
+
+func loadPublishConfig(conf *publishFile) (PublishConfig, error) {
 	publishConf := PublishConfig{}
-	if !viper.IsSet("publish.interval") {
+	if conf == nil {
+		conf = &publishFile{}
+	}
+	if conf.Interval == nil {
 		log.Error().Msg("Interval not configured")
 		return PublishConfig{}, errors.New("interval not set")
 	}
-	publishConf.Interval = viper.GetInt("publish.interval")
+	publishConf.Interval = *conf.Interval
 	if !(publishConf.Interval > 0) {
 		log.Error().Msgf("Interval set to invalid value: %v", publishConf.Interval)
 		return PublishConfig{}, fmt.Errorf("interval set to invalid value %v", publishConf.Interval)
 	}
 	log.Debug().Msgf("Interval Set to: %v", publishConf.Interval)
-	if !viper.IsSet("publish.timeout") {
+	if conf.Timeout == nil {
 		log.Error().Msg("Publish Timeout not configured")
 		return PublishConfig{}, errors.New("publishtimeout not set")
 	}
-	publishConf.PublishTimeout = viper.GetInt("publish.timeout")
+	publishConf.PublishTimeout = *conf.Timeout
 	if !(publishConf.PublishTimeout > 0) {
 		log.Error().Msgf("Publish Timeout set to invalid value: %v", publishConf.PublishTimeout)
 		return PublishConfig{}, fmt.Errorf("publishtimeout set to invalid value %v", publishConf.PublishTimeout)
 	}
 	log.Debug().Msgf("Publish Timeout Set to: %v", publishConf.PublishTimeout)
-	if !viper.IsSet("publish.disconnecttimeout") {
+	if conf.DisconnectTimeout == nil {
 		log.Error().Msg("Disconnect Timeout not configured")
 		return PublishConfig{}, errors.New("disconnecttimeout not set")
 	}
-	publishConf.DisconnectTimeout = viper.GetInt("publish.disconnecttimeout")
+	publishConf.DisconnectTimeout = *conf.DisconnectTimeout
 	if !(publishConf.DisconnectTimeout > 0) {
 		log.Error().Msgf("Disconnect Timeout set to invalid value: %v", publishConf.DisconnectTimeout)
 		return PublishConfig{}, fmt.Errorf("disconnecttimeout set to invalid value %v", publishConf.DisconnectTimeout)
@@ -123,45 +391,53 @@ func LoadPublishConfig() (PublishConfig, error) {
 }
 
 func LoadPublishServerConfig() ([]MQTTDestination, error) {
+	return loadPublishServerConfig(readConfigFile())
+}
+
+func loadPublishServerConfig(file configFile) ([]MQTTDestination, error) {
 	var destinations []MQTTDestination
-	if !viper.IsSet("pubservers") {
+	if file.PubServers == nil {
+		if file.invalid("pubservers") {
+			log.Error().Msg("Conversion failed: Publish Server config is not formatted correctly")
+			return nil, errors.New("publish server configuration formatting invalid")
+		}
 		log.Error().Msg("No Publish Servers Configured")
 		return nil, errors.New("no publish servers set in viper config")
 	}
-	genericConf := viper.Get("pubservers")
-	// Type assertion to convert 'any' to 'map[string]interface{}'
-	serverConf, ok := genericConf.(map[string]interface{})
-	if !ok {
-		log.Error().Msg("Conversion failed: Publish Server config is not formatted correctly")
-		return nil, errors.New("publish server configuration formatting invalid")
-	}
 
-	for k := range serverConf {
+	// Sorted so the servers connect in the same order every run
+	var hosts []string
+	for k := range file.PubServers {
+		hosts = append(hosts, k)
+	}
+	sort.Strings(hosts)
+	for _, k := range hosts {
+		server := file.PubServers[k]
 		dest := MQTTDestination{}
 		log.Debug().Msgf("Server: %v", k)
 		dest.Host = k
-		if !viper.IsSet("pubservers." + k + ".topics") {
+		if server.Topics == nil {
 			log.Error().Msgf("No Topics Configured for host %v", k)
 			return nil, fmt.Errorf("no topics set for host %v", k)
 		}
-		topics := viper.GetStringSlice("pubservers." + k + ".topics")
-		for _, topic := range topics {
+		for _, topic := range server.Topics {
 			log.Debug().Msgf("Topic %v", topic)
 			dest.Topics = append(dest.Topics, topic)
 		}
 
-		if viper.IsSet("pubservers." + k + ".username") {
-			dest.Username = viper.GetString("pubservers." + k + ".username")
+		if server.Username != nil {
+			dest.Username = *server.Username
 			log.Debug().Msgf("Username %v", dest.Username)
 		}
 
-		if viper.IsSet("pubservers." + k + ".password") {
-			dest.Password = viper.GetString("pubservers." + k + ".password")
-			log.Trace().Msgf("Password %v", dest.Password)
+		password, err := server.password("pubservers." + k)
+		if err != nil {
+			return nil, err
 		}
+		dest.Password = password
 
-		if viper.IsSet("pubservers." + k + ".cafile") {
-			cafilename := viper.GetString("pubservers." + k + ".cafile")
+		if server.CAFile != nil {
+			cafilename := *server.CAFile
 			log.Debug().Msgf("Using CA File %v", cafilename)
 			cabytes, err := os.ReadFile(cafilename)
 			if err != nil {
@@ -171,260 +447,1106 @@ func LoadPublishServerConfig() ([]MQTTDestination, error) {
 			log.Debug().Msgf("Loaded CAFile %v", cafilename)
 			dest.CACert = cabytes
 		}
+		tlsOpts, err := loadTLSOptions("pubservers."+k, server.tlsFile)
+		if err != nil {
+			return nil, err
+		}
+		dest.TLS = tlsOpts
+		dest.ProtocolVersion = loadProtocolVersion("pubservers."+k+".protocol-version", configValue(server.ProtocolVersion))
 		destinations = append(destinations, dest)
 	}
 	return destinations, nil
 }
 
 func LoadSubscribeServerConfig() (SubscriptionConfig, error) {
+	return loadSubscribeServerConfig(readConfigFile())
+}
+
+func loadSubscribeServerConfig(file configFile) (SubscriptionConfig, error) {
 	subConf := SubscriptionConfig{}
-	subConf.BLESubEn = true
-	subConf.GNSSSubEn = true
-	subConf.ESPSubEn = true
-	subConf.NavSubEn = true
-	subConf.OutsideSubEn = true
-	subConf.PHYSubEn = true
-	subConf.PropSubEn = true
-	subConf.SteerSubEn = true
-	subConf.WaterSubEn = true
-	subConf.WindSubEn = true
-	subConf.BLELogEn = false
-	subConf.GNSSLogEn = false
-	subConf.ESPLogEn = false
-	subConf.NavLogEn = false
-	subConf.OutsideLogEn = false
-	subConf.PHYLogEn = false
-	subConf.PropLogEn = false
-	subConf.SteerLogEn = false
-	subConf.WaterLogEn = false
-	subConf.WindLogEn = false
-	if !viper.IsSet("subscription") {
+	if file.Subscription == nil {
 		log.Error().Msg("No Subscription Information Configured")
 		return SubscriptionConfig{}, errors.New("no subscription information set in viper config")
 	}
-	subscriptionMap := viper.GetStringMapString("subscription")
-	v, ok := subscriptionMap["server"]
-	if ok {
-		log.Debug().Msgf("Setting host: %v", v)
-		subConf.Host = v
-	} else {
+	sub := *file.Subscription
+	legacy := BrokerConfig{Name: DefaultBrokerName}
+	loadBrokerSession(&legacy, sub.brokerFile)
+	tlsOpts, err := loadTLSOptions("subscription", sub.tlsFile)
+	if err != nil {
+		return SubscriptionConfig{}, err
+	}
+	legacy.TLS = tlsOpts
+	legacy.ProtocolVersion = loadProtocolVersion("subscription.protocol-version", configValue(sub.ProtocolVersion))
+	legacy.ShareGroup = configValue(sub.ShareGroup)
+	if sub.Server != nil {
+		log.Debug().Msgf("Setting host: %v", *sub.Server)
+		legacy.Host = *sub.Server
+	} else if sub.Brokers == nil {
 		log.Error().Msg("Server is required but is not configured")
 		return SubscriptionConfig{}, errors.New("server is required but is not set in viper config")
 	}
-	var configItems = []string{"username", "password", "cafile", "repost", "repost-root-topic", "publish-timeout"}
-	for _, confItem := range configItems {
-		v, ok = subscriptionMap[confItem]
-		if ok {
-			log.Debug().Msgf("Setting %v: %v", confItem, v)
-			switch confItem {
-			case "username":
-				subConf.Username = v
-			case "password":
-				subConf.Password = v
-			case "cafile":
-				log.Debug().Msgf("Using CA File %v", v)
-				cabytes, err := os.ReadFile(v)
-				if err != nil {
-					log.Warn().Msgf("Error Reading Defined CA File: %v", err.Error())
-				}
-				log.Debug().Msgf("Loaded CAFile %v", v)
-				subConf.CACert = cabytes
-			case "repost":
-				tmpbool, err := strconv.ParseBool(v)
-				if err != nil {
-					log.Warn().Msgf("Error parsing boolean from config: %v", err.Error())
-				} else {
-					subConf.Repost = tmpbool
-				}
-			case "repost-root-topic":
-				subConf.RepostRootTopic = v
-			case "publish-timeout":
-				inttmp, err := strconv.ParseUint(v, 10, 32)
-				if err != nil {
-					log.Warn().Msgf("Error parsing publish-timeout will use default: %v", err.Error())
-				} else {
-					subConf.PublishTimeout = uint(inttmp)
-				}
+	legacy.Password, err = sub.password("subscription")
+	if err != nil {
+		return SubscriptionConfig{}, err
+	}
+	override(&legacy.Username, sub.Username)
+	if sub.CAFile != nil {
+		legacy.CACert = readBrokerCAFile(*sub.CAFile)
+	}
+	override(&subConf.Repost, sub.Repost)
+	override(&subConf.RepostRootTopic, sub.RepostRootTopic)
+	override(&subConf.PublishTimeout, sub.PublishTimeout)
+
+	subConf.Categories = loadCategoryConfig(sub)
+	if legacy.Host != "" {
+		legacy.Topics = make(map[string][]string)
+		for name, catConf := range subConf.Categories {
+			if len(catConf.Topics) > 0 {
+				legacy.Topics[name] = catConf.Topics
 			}
-		} else {
-			log.Trace().Msgf("%v not found. Continuing", confItem)
 		}
+		subConf.Brokers = append(subConf.Brokers, legacy)
+	}
+	brokers, err := loadBrokerConfig(sub)
+	if err != nil {
+		return SubscriptionConfig{}, err
+	}
+	subConf.Brokers = append(subConf.Brokers, brokers...)
+	if len(subConf.Brokers) == 0 {
+		log.Error().Msg("Server is required but is not configured")
+		return SubscriptionConfig{}, errors.New("server is required but is not set in viper config")
+	}
+	subConf.RepostBroker = subConf.Brokers[0].Name
+	if sub.RepostBroker != nil {
+		subConf.RepostBroker = *sub.RepostBroker
+		found := false
+		for _, broker := range subConf.Brokers {
+			found = found || broker.Name == subConf.RepostBroker
+		}
+		if !found {
+			log.Error().Msgf("Repost broker %v is not configured", subConf.RepostBroker)
+			return SubscriptionConfig{}, fmt.Errorf("repost broker %v is not configured", subConf.RepostBroker)
+		}
+	}
+	subConf.RepostTargets, err = loadRepostConfig(sub, subConf.Brokers, subConf.RepostBroker)
+	if err != nil {
+		return SubscriptionConfig{}, err
 	}
 
-	if viper.IsSet("subscription.bleTopics") {
-		subConf.BLETopics = viper.GetStringSlice("subscription.bleTopics")
-		log.Debug().Msgf("BLE Topics: %v", subConf.BLETopics)
+	if sub.MACtoName == nil {
+		log.Warn().Msg("MAC to Location Mappings not found")
 	} else {
-		log.Warn().Msg("BLE Topics not set")
+		log.Debug().Msg("Loading MAC to Location Mappings")
+		subConf.MACtoLocation = sub.MACtoName
 	}
-	if viper.IsSet("subscription.phyTopics") {
-		subConf.PHYTopics = viper.GetStringSlice("subscription.phyTopics")
-		log.Debug().Msgf("PHY Topics: %v", subConf.PHYTopics)
-	} else {
-		log.Warn().Msg("PHY Topics not set")
+
+	subConf.DataDir = loadDataDir(sub)
+	for i := range subConf.Brokers {
+		if !subConf.Brokers[i].CleanSession {
+			subConf.Brokers[i].StoreDir = filepath.Join(subConf.DataDir, "mqtt", subConf.Brokers[i].Name)
+		}
 	}
-	if viper.IsSet("subscription.espTopics") {
-		subConf.ESPTopics = viper.GetStringSlice("subscription.espTopics")
-		log.Debug().Msgf("ESP Topics: %v", subConf.ESPTopics)
-	} else {
-		log.Warn().Msg("ESP Topics not set")
+	subConf.Passage = loadPassageConfig(sub.Passage)
+	subConf.Fuel = loadFuelConfig(sub.Fuel)
+	subConf.Engine = loadEngineConfig(sub.Engine)
+	subConf.Maintenance = loadMaintenanceConfig(sub.Maintenance)
+	subConf.Anchor = loadAnchorConfig(sub.Anchor)
+	subConf.Geofence = loadGeofenceConfig(sub.Geofence)
+	subConf.AIS = loadAISConfig(sub.AIS)
+	subConf.Barometer = loadBaroConfig(sub.Barometer)
+	subConf.Comfort = loadComfortConfig(sub.Comfort)
+	subConf.Refrigeration = loadRefrigerationConfig(sub.Refrigeration)
+	subConf.Filter = loadFilterConfig(sub.Filter)
+	subConf.Sources = loadSourceConfig(sub.Sources)
+	subConf.Aggregation = loadAggregationConfig(sub.Aggregation)
+	subConf.Deadband = loadDeadbandConfig(sub.Deadband)
+	subConf.DaemonStatus = loadDaemonStatusConfig(sub.DaemonStatus)
+	if sub.MappingFile != nil {
+		mappings, err := LoadPathMappings(*sub.MappingFile)
+		if err != nil {
+			log.Error().Msgf("Error loading mapping file: %v", err.Error())
+			return SubscriptionConfig{}, err
+		}
+		log.Debug().Msgf("Loaded %v path mappings", len(mappings))
+		subConf.Mappings = mappings
 	}
-	if viper.IsSet("subscription.navTopics") {
-		subConf.NavTopics = viper.GetStringSlice("subscription.navTopics")
-		log.Debug().Msgf("Nav Topics: %v", subConf.NavTopics)
-	} else {
-		log.Warn().Msg("Nav Topics not set")
+	subConf.API, err = loadAPIConfig(sub.API)
+	if err != nil {
+		return SubscriptionConfig{}, err
 	}
-	if viper.IsSet("subscription.gnssTopics") {
-		subConf.GNSSTopics = viper.GetStringSlice("subscription.gnssTopics")
-		log.Debug().Msgf("GNSS Topics: %v", subConf.GNSSTopics)
+
+	// Missing sections only warn so the sections after them are still loaded
+	if sub.N2KtoName == nil {
+		log.Warn().Msg("N2K to Name Mappings not found")
 	} else {
-		log.Warn().Msg("BLE Topics not set")
+		log.Debug().Msg("Loading N2K to Device Name Mappings")
+		subConf.N2KtoName = sub.N2KtoName
 	}
-	if viper.IsSet("subscription.steeringTopics") {
-		subConf.SteeringTopics = viper.GetStringSlice("subscription.steeringTopics")
-		log.Debug().Msgf("Steering Topics: %v", subConf.SteeringTopics)
+
+	if sub.InfluxDB == nil {
+		log.Warn().Msg("InfluxDB configuration not found")
 	} else {
-		log.Warn().Msg("BLE Topics not set")
+		log.Debug().Msg("Loading InfluxDB Config")
+		influx := sub.InfluxDB
+		override(&subConf.InfluxEnabled, influx.Enabled)
+		override(&subConf.InfluxOrg, influx.Org)
+		override(&subConf.InfluxBucket, influx.Bucket)
+		override(&subConf.InfluxUrl, influx.URL)
+		if influx.CAFile != nil {
+			subConf.InfluxCACert = readBrokerCAFile(*influx.CAFile)
+		}
+		subConf.InfluxToken, err = loadSecret("subscription.influxdb.token", influx.Token, influx.TokenFile)
+		if err != nil {
+			return SubscriptionConfig{}, err
+		}
+		tlsOpts, err := loadTLSOptions("subscription.influxdb", influx.tlsFile)
+		if err != nil {
+			return SubscriptionConfig{}, err
+		}
+		subConf.InfluxTLS = tlsOpts
 	}
-	if viper.IsSet("subscription.windTopics") {
-		subConf.WindTopics = viper.GetStringSlice("subscription.windTopics")
-		log.Debug().Msgf("Wind Topics: %v", subConf.WindTopics)
-	} else {
-		log.Warn().Msg("Wind Topics not set")
+
+	return subConf, nil
+}
+
+// LoadBrokerConfig loads the additional brokers keyed by name under subscription.brokers
+// Each broker lists its own topics per category using the same keys as the subscription section
+func LoadBrokerConfig() ([]BrokerConfig, error) {
+	return loadBrokerConfig(readConfigFile().subscription())
+}
+
+func loadBrokerConfig(sub subscriptionFile) ([]BrokerConfig, error) {
+	var brokers []BrokerConfig
+	if sub.Brokers == nil {
+		log.Debug().Msg("Additional brokers not found")
+		return brokers, nil
 	}
-	if viper.IsSet("subscription.waterTopics") {
-		subConf.WaterTopics = viper.GetStringSlice("subscription.waterTopics")
-		log.Debug().Msgf("Water Topics: %v", subConf.WaterTopics)
-	} else {
-		log.Warn().Msg("Water Topics not set")
+	var names []string
+	for name := range sub.Brokers {
+		names = append(names, name)
 	}
-	if viper.IsSet("subscription.outsideTopics") {
-		subConf.OutsideTopics = viper.GetStringSlice("subscription.outsideTopics")
-		log.Debug().Msgf("Outside Topics: %v", subConf.OutsideTopics)
-	} else {
-		log.Warn().Msg("Outside Topics not set")
+	sort.Strings(names)
+	for _, name := range names {
+		key := "subscription.brokers." + name
+		conf := sub.Brokers[name]
+		if name == DefaultBrokerName {
+			log.Error().Msgf("Broker name %v is reserved for subscription.server", name)
+			return nil, fmt.Errorf("broker name %v is reserved", name)
+		}
+		broker := BrokerConfig{
+			Name:      name,
+			Host:      configValue(conf.Server),
+			Username:  configValue(conf.Username),
+			RootTopic: configValue(conf.RootTopic),
+			Topics:    make(map[string][]string),
+		}
+		if broker.Host == "" {
+			log.Error().Msgf("No server configured for broker %v", name)
+			return nil, fmt.Errorf("no server set for broker %v", name)
+		}
+		password, err := conf.password(key)
+		if err != nil {
+			return nil, err
+		}
+		broker.Password = password
+		if conf.CAFile != nil {
+			broker.CACert = readBrokerCAFile(*conf.CAFile)
+		}
+		tlsOpts, err := loadTLSOptions(key, conf.tlsFile)
+		if err != nil {
+			return nil, err
+		}
+		broker.TLS = tlsOpts
+		loadBrokerSession(&broker, conf.brokerFile)
+		broker.ProtocolVersion = loadProtocolVersion(key+".protocol-version", configValue(conf.ProtocolVersion))
+		broker.ShareGroup = configValue(conf.ShareGroup)
+		for _, category := range RegisteredCategories() {
+			for _, topic := range conf.Topics[category.Name] {
+				broker.Topics[category.Name] = append(broker.Topics[category.Name], broker.RootTopic+topic)
+			}
+		}
+		if len(broker.Topics) == 0 {
+			log.Warn().Msgf("Broker %v has no topics", name)
+		}
+		log.Debug().Msgf("Broker %v: %v Topics: %v", name, broker.Host, broker.Topics)
+		brokers = append(brokers, broker)
 	}
-	if viper.IsSet("subscription.propulsionTopics") {
-		subConf.PropulsionTopics = viper.GetStringSlice("subscription.propulsionTopics")
-		log.Debug().Msgf("Propulsion Topics: %v", subConf.PropulsionTopics)
-	} else {
-		log.Warn().Msg("Propulsion Topics not set")
+	return brokers, nil
+}
+
+// LoadRepostConfig loads the repost destinations keyed by name under subscription.repost-destinations
+// Without any the data is reposted through the repost broker with the original topic layout
+func LoadRepostConfig(brokers []BrokerConfig, repostBroker string) ([]RepostDestination, error) {
+	return loadRepostConfig(readConfigFile().subscription(), brokers, repostBroker)
+}
+
+func loadRepostConfig(sub subscriptionFile, brokers []BrokerConfig, repostBroker string) ([]RepostDestination, error) {
+	if sub.RepostDestinations == nil {
+		log.Debug().Msg("Repost destinations not found")
+		return []RepostDestination{{
+			Name:     DefaultBrokerName,
+			Broker:   repostBroker,
+			Topic:    DefaultRepostTopic,
+			QoS:      loadQoS("subscription.repost-qos", configValue(sub.RepostQoS)),
+			Retained: configValue(sub.RepostRetained),
+		}}, nil
 	}
+	known := map[string]bool{DerivedCategory: true}
+	for _, category := range RegisteredCategories() {
+		known[category.Name] = true
+	}
+	var names []string
+	for name := range sub.RepostDestinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var destinations []RepostDestination
+	for _, name := range names {
+		key := "subscription.repost-destinations." + name
+		conf := sub.RepostDestinations[name]
+		dest := RepostDestination{
+			Name:       name,
+			Broker:     configValue(conf.Broker),
+			Host:       configValue(conf.Server),
+			Username:   configValue(conf.Username),
+			Topic:      DefaultRepostTopic,
+			Retained:   configValue(conf.Retained),
+			Categories: conf.Categories,
+		}
+		override(&dest.Topic, conf.Topic)
+		if _, err := parseRepostTopic(name, dest.Topic); err != nil {
+			log.Error().Msgf("Invalid topic template for repost destination %v: %v", name, err.Error())
+			return nil, fmt.Errorf("invalid topic template for repost destination %v: %v", name, err)
+		}
+		password, err := conf.password(key)
+		if err != nil {
+			return nil, err
+		}
+		dest.Password = password
+		dest.QoS = loadQoS(key+".qos", configValue(conf.QoS))
+		dest.ProtocolVersion = loadProtocolVersion(key+".protocol-version", configValue(conf.ProtocolVersion))
+		dest.MessageExpiry = configValue(conf.MessageExpiry)
+		if conf.CAFile != nil {
+			dest.CACert = readBrokerCAFile(*conf.CAFile)
+		}
+		tlsOpts, err := loadTLSOptions(key, conf.tlsFile)
+		if err != nil {
+			return nil, err
+		}
+		dest.TLS = tlsOpts
+		if dest.Broker != "" && dest.Host != "" {
+			log.Error().Msgf("Repost destination %v sets both a broker and a server", name)
+			return nil, fmt.Errorf("repost destination %v sets both broker and server", name)
+		}
+		if dest.Broker == "" && dest.Host == "" {
+			dest.Broker = repostBroker
+		}
+		if dest.Broker != "" {
+			found := false
+			for _, broker := range brokers {
+				found = found || broker.Name == dest.Broker
+			}
+			if !found {
+				log.Error().Msgf("Repost destination %v uses broker %v which is not configured", name, dest.Broker)
+				return nil, fmt.Errorf("repost destination %v uses unknown broker %v", name, dest.Broker)
+			}
+		}
+		for _, category := range dest.Categories {
+			if !known[category] {
+				log.Warn().Msgf("Repost destination %v lists unknown category %v", name, category)
+			}
+		}
+		log.Debug().Msgf("Repost destination %v: Broker %v Server %v Topic %v", name, dest.Broker, dest.Host, dest.Topic)
+		destinations = append(destinations, dest)
+	}
+	return destinations, nil
+}
 
-	if !viper.IsSet("subscription.MACtoName") {
-		log.Warn().Msg("MAC to Location Mappings not found")
-	} else {
-		log.Debug().Msg("Loading MAC to Location Mappings")
-		subConf.MACtoLocation = viper.GetStringMapString("subscription.MACtoName")
+// loadBrokerSession loads the client-id and clean-session settings of a broker
+// A persistent session needs a client ID the broker recognises so one is made up from the host name when not set
+func loadBrokerSession(broker *BrokerConfig, conf brokerFile) {
+	broker.CleanSession = true
+	override(&broker.CleanSession, conf.CleanSession)
+	broker.ClientID = configValue(conf.ClientID)
+	if broker.ClientID == "" && !broker.CleanSession {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Warn().Msgf("Error getting host name for client ID: %v", err.Error())
+			hostname = "localhost"
+		}
+		broker.ClientID = "marine-sensorhub-mqtt-" + hostname + "-" + broker.Name
+		log.Debug().Msgf("Using client ID %v for broker %v", broker.ClientID, broker.Name)
+	}
+}
+
+// loadQoS checks the QoS level set at key falling back to 0 when it is not 0, 1 or 2
+func loadQoS(key string, qos int) byte {
+	if qos < 0 || qos > 2 {
+		log.Warn().Msgf("Invalid QoS %v for %v will use 0", qos, key)
+		return 0
 	}
+	return byte(qos)
+}
+
+// loadProtocolVersion checks the MQTT protocol version set at key is 3, 4 or 5
+// 0 lets the v3 client pick between 3.1.1 and 3.1 as it always has
+func loadProtocolVersion(key string, version uint) uint {
+	switch version {
+	case 0, 3, 4, 5:
+		return version
+	}
+	log.Warn().Msgf("Invalid protocol version %v for %v will use the default", version, key)
+	return 0
+}
+
+// readBrokerCAFile reads a broker CA file, only warning on failure like the subscription server always has
+func readBrokerCAFile(cafilename string) []byte {
+	log.Debug().Msgf("Using CA File %v", cafilename)
+	cabytes, err := os.ReadFile(cafilename)
+	if err != nil {
+		log.Warn().Msgf("Error Reading Defined CA File: %v", err.Error())
+		return nil
+	}
+	log.Debug().Msgf("Loaded CAFile %v", cafilename)
+	return cabytes
+}
 
-	if !viper.IsSet("subscription.topic-overrides") {
+// loadTLSOptions loads the client certificate and TLS settings of the section at key
+// A client certificate that cannot be loaded stops the config from loading since the broker would refuse the connection
+func loadTLSOptions(key string, conf tlsFile) (TLSOptions, error) {
+	opts := TLSOptions{
+		CertFile:   configValue(conf.CertFile),
+		KeyFile:    configValue(conf.KeyFile),
+		ServerName: configValue(conf.ServerName),
+		Insecure:   configValue(conf.Insecure),
+	}
+	if (opts.CertFile == "") != (opts.KeyFile == "") {
+		log.Error().Msgf("certfile and keyfile must be set together for %v", key)
+		return TLSOptions{}, fmt.Errorf("certfile and keyfile must be set together for %v", key)
+	}
+	if opts.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			log.Error().Msgf("Error loading client certificate for %v: %v", key, err.Error())
+			return TLSOptions{}, fmt.Errorf("unable to load client certificate for %v: %v", key, err)
+		}
+		opts.certificate = &cert
+		log.Debug().Msgf("Using client certificate %v", opts.CertFile)
+	}
+	if conf.TLSMinVersion != nil {
+		version, ok := tlsVersions[*conf.TLSMinVersion]
+		if !ok {
+			log.Error().Msgf("Invalid tls-min-version %v for %v", *conf.TLSMinVersion, key)
+			return TLSOptions{}, fmt.Errorf("invalid tls-min-version for %v", key)
+		}
+		opts.MinVersion = version
+	}
+	if opts.Insecure {
+		log.Warn().Msgf("TLS certificate verification is disabled for %v", key)
+	}
+	return opts, nil
+}
+
+// LoadCategoryConfig loads the topics of every registered category along with
+// the topic-overrides and verbose-topic-logging switches keyed by category name
+func LoadCategoryConfig() map[string]CategoryConfig {
+	return loadCategoryConfig(readConfigFile().subscription())
+}
+
+func loadCategoryConfig(sub subscriptionFile) map[string]CategoryConfig {
+	categories := make(map[string]CategoryConfig)
+	for _, category := range RegisteredCategories() {
+		catConf := CategoryConfig{Subscribed: true}
+		if topics, ok := sub.Topics[category.Name]; ok {
+			catConf.Topics = topics
+			log.Debug().Msgf("%v Topics: %v", category.Name, catConf.Topics)
+		} else if category.Optional {
+			log.Debug().Msgf("%v Topics not set", category.Name)
+		} else {
+			log.Warn().Msgf("%v Topics not set", category.Name)
+		}
+		categories[category.Name] = catConf
+	}
+
+	// Keys that are not category names were already dropped when the config file was read
+	if sub.TopicOverrides == nil {
 		log.Debug().Msg("Subscription topic overrides not found")
-		return subConf, nil
 	} else {
 		log.Debug().Msg("Subscription topics overrides found")
-
-		tmpmap := viper.GetStringMap("subscription.topic-overrides")
-		for k, v := range tmpmap {
-			switch k {
-			case "ble":
-				subConf.BLESubEn = v.(bool)
-			case "gnss":
-				subConf.GNSSSubEn = v.(bool)
-			case "esp":
-				subConf.ESPSubEn = v.(bool)
-			case "nav":
-				subConf.NavSubEn = v.(bool)
-			case "outside":
-				subConf.OutsideSubEn = v.(bool)
-			case "phy":
-				subConf.PHYSubEn = v.(bool)
-			case "propulsion":
-				subConf.PropSubEn = v.(bool)
-			case "steering":
-				subConf.SteerSubEn = v.(bool)
-			case "water":
-				subConf.WaterSubEn = v.(bool)
-			case "wind":
-				subConf.WindSubEn = v.(bool)
-			default:
-				log.Warn().Msgf("Invalid Key %v found in EnableSubscriptions", k)
-			}
+		for k, subscribed := range sub.TopicOverrides {
+			catConf := categories[k]
+			catConf.Subscribed = subscribed
+			categories[k] = catConf
 		}
 	}
 
-	if !viper.IsSet("subscription.verbose-topic-logging") {
+	for k, qos := range sub.TopicQoS {
+		catConf := categories[k]
+		catConf.QoS = loadQoS("subscription.topic-qos."+k, qos)
+		categories[k] = catConf
+	}
+
+	if sub.VerboseTopicLogging == nil {
 		log.Debug().Msg("Subscription logging overrides not found")
-		return subConf, nil
 	} else {
 		log.Debug().Msg("Subscription logging overrides found")
+		for k, verbose := range sub.VerboseTopicLogging {
+			catConf := categories[k]
+			catConf.Verbose = verbose
+			categories[k] = catConf
+		}
+	}
+	return categories
+}
 
-		tmpmap := viper.GetStringMap("subscription.verbose-topic-logging")
-		for k, v := range tmpmap {
-			switch k {
-			case "ble":
-				subConf.BLELogEn = v.(bool)
-			case "gnss":
-				subConf.GNSSLogEn = v.(bool)
-			case "esp":
-				subConf.ESPLogEn = v.(bool)
-			case "nav":
-				subConf.NavLogEn = v.(bool)
-			case "outside":
-				subConf.OutsideLogEn = v.(bool)
-			case "phy":
-				subConf.PHYLogEn = v.(bool)
-			case "propulsion":
-				subConf.PropLogEn = v.(bool)
-			case "steering":
-				subConf.SteerLogEn = v.(bool)
-			case "water":
-				subConf.WaterLogEn = v.(bool)
-			case "wind":
-				subConf.WindLogEn = v.(bool)
-			default:
-				log.Warn().Msgf("Invalid Key %v found in VerboseSubscriptionLogging", k)
+// LoadDataDir returns the directory used for state the daemon persists between runs
+func LoadDataDir() string {
+	return loadDataDir(readConfigFile().subscription())
+}
+
+func loadDataDir(sub subscriptionFile) string {
+	if sub.DataDir != nil {
+		return *sub.DataDir
+	}
+	return "./"
+}
+
+// LoadPassageConfig loads the passage detection settings
+func LoadPassageConfig() PassageConfig {
+	return loadPassageConfig(readConfigFile().subscription().Passage)
+}
+
+func loadPassageConfig(conf *passageFile) PassageConfig {
+	passageConf := PassageConfig{
+		Enabled:       false,
+		StartSOG:      2.0,
+		StartSeconds:  120,
+		StopSOG:       0.5,
+		StopSeconds:   600,
+		TrackInterval: 30,
+		TrackDistance: 100,
+	}
+	if conf == nil {
+		log.Debug().Msg("Passage configuration not found")
+		return passageConf
+	}
+	log.Debug().Msg("Loading Passage Config")
+	override(&passageConf.Enabled, conf.Enabled)
+	override(&passageConf.StartSOG, conf.StartSOG)
+	override(&passageConf.StartSeconds, conf.StartSeconds)
+	override(&passageConf.StopSOG, conf.StopSOG)
+	override(&passageConf.StopSeconds, conf.StopSeconds)
+	override(&passageConf.TrackInterval, conf.TrackInterval)
+	override(&passageConf.TrackDistance, conf.TrackDistance)
+	if passageConf.StopSOG >= passageConf.StartSOG {
+		log.Warn().Msgf("Passage stop-sog %v should be below start-sog %v", passageConf.StopSOG, passageConf.StartSOG)
+	}
+	log.Debug().Msgf("Passage Config: %+v", passageConf)
+	return passageConf
+}
+
+// LoadFuelConfig loads the fuel consumption and economy settings
+func LoadFuelConfig() FuelConfig {
+	return loadFuelConfig(readConfigFile().subscription().Fuel)
+}
+
+func loadFuelConfig(conf *fuelFile) FuelConfig {
+	fuelConf := FuelConfig{
+		Enabled:         false,
+		PublishInterval: 10,
+		TripGap:         1800,
+		TankCapacity:    make(map[string]float64),
+	}
+	if conf == nil {
+		log.Debug().Msg("Fuel configuration not found")
+		return fuelConf
+	}
+	log.Debug().Msg("Loading Fuel Config")
+	override(&fuelConf.Enabled, conf.Enabled)
+	override(&fuelConf.PublishInterval, conf.PublishInterval)
+	if fuelConf.PublishInterval == 0 {
+		log.Warn().Msg("Fuel publish-interval must be positive will use default")
+		fuelConf.PublishInterval = 10
+	}
+	override(&fuelConf.TripGap, conf.TripGap)
+	for k, capacity := range conf.TankCapacity {
+		fuelConf.TankCapacity[k] = capacity
+	}
+	log.Debug().Msgf("Fuel Config: %+v", fuelConf)
+	return fuelConf
+}
+
+// LoadEngineConfig loads the engine run detection settings
+func LoadEngineConfig() EngineConfig {
+	return loadEngineConfig(readConfigFile().subscription().Engine)
+}
+
+func loadEngineConfig(conf *engineFile) EngineConfig {
+	engineConf := EngineConfig{
+		Enabled:          false,
+		StartRPM:         300,
+		UnderwayRPM:      1200,
+		StopTimeout:      60,
+		RunTimeTolerance: 6,
+	}
+	if conf == nil {
+		log.Debug().Msg("Engine configuration not found")
+		return engineConf
+	}
+	log.Debug().Msg("Loading Engine Config")
+	override(&engineConf.Enabled, conf.Enabled)
+	override(&engineConf.StartRPM, conf.StartRPM)
+	override(&engineConf.UnderwayRPM, conf.UnderwayRPM)
+	override(&engineConf.StopTimeout, conf.StopTimeout)
+	override(&engineConf.RunTimeTolerance, conf.RunTimeTolerance)
+	if engineConf.UnderwayRPM < engineConf.StartRPM {
+		log.Warn().Msgf("Engine underway-rpm %v should not be below start-rpm %v", engineConf.UnderwayRPM, engineConf.StartRPM)
+	}
+	log.Debug().Msgf("Engine Config: %+v", engineConf)
+	return engineConf
+}
+
+// LoadMaintenanceConfig loads the maintenance schedule
+func LoadMaintenanceConfig() MaintenanceConfig {
+	return loadMaintenanceConfig(readConfigFile().subscription().Maintenance)
+}
+
+func loadMaintenanceConfig(conf *maintenanceFile) MaintenanceConfig {
+	maintConf := MaintenanceConfig{
+		Enabled:         false,
+		PublishInterval: 3600,
+		WarnHours:       10,
+		WarnDays:        14,
+	}
+	if conf == nil {
+		log.Debug().Msg("Maintenance configuration not found")
+		return maintConf
+	}
+	log.Debug().Msg("Loading Maintenance Config")
+	override(&maintConf.Enabled, conf.Enabled)
+	override(&maintConf.PublishInterval, conf.PublishInterval)
+	if maintConf.PublishInterval == 0 {
+		log.Warn().Msg("Maintenance publish-interval must be positive will use default")
+		maintConf.PublishInterval = 3600
+	}
+	override(&maintConf.WarnHours, conf.WarnHours)
+	override(&maintConf.WarnDays, conf.WarnDays)
+	var names []string
+	for name := range conf.Items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		itemConf := conf.Items[name]
+		item := MaintenanceItem{
+			Name:   name,
+			Engine: configValue(itemConf.Engine),
+			Hours:  configValue(itemConf.Hours),
+			Days:   configValue(itemConf.Days),
+			Months: configValue(itemConf.Months),
+		}
+		if item.Hours == 0 && item.Days == 0 && item.Months == 0 {
+			log.Warn().Msgf("Maintenance item %v has no interval and will be ignored", name)
+			continue
+		}
+		maintConf.Items = append(maintConf.Items, item)
+	}
+	log.Debug().Msgf("Maintenance Config: %+v", maintConf)
+	return maintConf
+}
+
+// LoadAnchorConfig loads the anchor watch settings
+func LoadAnchorConfig() AnchorConfig {
+	return loadAnchorConfig(readConfigFile().subscription().Anchor)
+}
+
+func loadAnchorConfig(conf *anchorFile) AnchorConfig {
+	anchorConf := AnchorConfig{
+		Enabled:         false,
+		CommandTopic:    "msh/command/anchor",
+		Radius:          50,
+		AlarmSeconds:    30,
+		PublishInterval: 10,
+		MaxHDOP:         5,
+		MinSatellites:   4,
+	}
+	if conf == nil {
+		log.Debug().Msg("Anchor configuration not found")
+		return anchorConf
+	}
+	log.Debug().Msg("Loading Anchor Config")
+	override(&anchorConf.Enabled, conf.Enabled)
+	override(&anchorConf.CommandTopic, conf.CommandTopic)
+	override(&anchorConf.Radius, conf.Radius)
+	override(&anchorConf.AlarmSeconds, conf.AlarmSeconds)
+	override(&anchorConf.PublishInterval, conf.PublishInterval)
+	if anchorConf.PublishInterval == 0 {
+		log.Warn().Msg("Anchor publish-interval must be positive will use default")
+		anchorConf.PublishInterval = 10
+	}
+	override(&anchorConf.MaxHDOP, conf.MaxHDOP)
+	override(&anchorConf.MinSatellites, conf.MinSatellites)
+	log.Debug().Msgf("Anchor Config: %+v", anchorConf)
+	return anchorConf
+}
+
+// LoadGeofenceConfig loads the geofence zones
+func LoadGeofenceConfig() GeofenceConfig {
+	return loadGeofenceConfig(readConfigFile().subscription().Geofence)
+}
+
+func loadGeofenceConfig(conf *geofenceFile) GeofenceConfig {
+	fenceConf := GeofenceConfig{Enabled: false}
+	if conf == nil {
+		log.Debug().Msg("Geofence configuration not found")
+		return fenceConf
+	}
+	log.Debug().Msg("Loading Geofence Config")
+	override(&fenceConf.Enabled, conf.Enabled)
+	var names []string
+	for name := range conf.Zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		zoneConf := conf.Zones[name]
+		zone := GeofenceZone{
+			Name:   name,
+			Lat:    configValue(zoneConf.Lat),
+			Lon:    configValue(zoneConf.Lon),
+			Radius: configValue(zoneConf.Radius),
+		}
+		polygon, err := parsePolygon(zoneConf.Polygon)
+		if err != nil {
+			log.Warn().Msgf("Error parsing polygon for zone %v: %v", name, err.Error())
+			continue
+		}
+		zone.Polygon = polygon
+		if len(zone.Polygon) == 0 && zone.Radius <= 0 {
+			log.Warn().Msgf("Zone %v needs a polygon or a radius and will be ignored", name)
+			continue
+		}
+		if len(zone.Polygon) > 0 && len(zone.Polygon) < 3 {
+			log.Warn().Msgf("Zone %v polygon needs at least 3 points and will be ignored", name)
+			continue
+		}
+		fenceConf.Zones = append(fenceConf.Zones, zone)
+	}
+	log.Debug().Msgf("Geofence Config: %+v", fenceConf)
+	return fenceConf
+}
+
+// parsePolygon reads a list of [lat, lon] pairs
+func parsePolygon(raw any) ([]GeoPoint, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	points, ok := raw.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list of [lat, lon] pairs")
+	}
+	var polygon []GeoPoint
+	for _, p := range points {
+		pair, ok := p.([]any)
+		if !ok || len(pair) != 2 {
+			return nil, fmt.Errorf("expected a [lat, lon] pair but got %v", p)
+		}
+		lat, err := ParseFloat64(pair[0])
+		if err != nil {
+			return nil, err
+		}
+		lon, err := ParseFloat64(pair[1])
+		if err != nil {
+			return nil, err
+		}
+		polygon = append(polygon, GeoPoint{Lat: lat, Lon: lon})
+	}
+	return polygon, nil
+}
+
+// LoadAISConfig loads the AIS target tracking settings
+func LoadAISConfig() AISConfig {
+	return loadAISConfig(readConfigFile().subscription().AIS)
+}
+
+func loadAISConfig(conf *aisFile) AISConfig {
+	aisConf := AISConfig{
+		TargetTimeout:   600,
+		OwnTimeout:      30,
+		PublishInterval: 30,
+		CPAWarnNM:       0.5,
+		TCPAWarnMinutes: 15,
+	}
+	if conf == nil {
+		log.Debug().Msg("AIS configuration not found")
+		return aisConf
+	}
+	log.Debug().Msg("Loading AIS Config")
+	override(&aisConf.TargetTimeout, conf.TargetTimeout)
+	override(&aisConf.OwnTimeout, conf.OwnTimeout)
+	override(&aisConf.PublishInterval, conf.PublishInterval)
+	if aisConf.PublishInterval == 0 {
+		log.Warn().Msg("AIS publish-interval must be positive will use default")
+		aisConf.PublishInterval = 30
+	}
+	override(&aisConf.CPAWarnNM, conf.CPAWarn)
+	override(&aisConf.TCPAWarnMinutes, conf.TCPAWarn)
+	log.Debug().Msgf("AIS Config: %+v", aisConf)
+	return aisConf
+}
+
+// LoadAPIConfig loads the HTTP API server settings
+// The server only runs when subscription.api is set and listens on localhost unless told otherwise
+func LoadAPIConfig() (APIConfig, error) {
+	return loadAPIConfig(readConfigFile().subscription().API)
+}
+
+func loadAPIConfig(conf *apiFile) (APIConfig, error) {
+	apiConf := APIConfig{}
+	if conf == nil {
+		log.Debug().Msg("API configuration not found")
+		return apiConf, nil
+	}
+	log.Debug().Msg("Loading API Config")
+	apiConf.Listen = "127.0.0.1:8080"
+	override(&apiConf.Listen, conf.Listen)
+	token, err := loadSecret("subscription.api.token", conf.Token, conf.TokenFile)
+	if err != nil {
+		return APIConfig{}, err
+	}
+	apiConf.Token = token
+	if apiConf.Token == "" && !isLoopbackListen(apiConf.Listen) {
+		log.Warn().Msgf("API listens on %v without a token so changes are only accepted from localhost", apiConf.Listen)
+	}
+	log.Debug().Msgf("API Config: %+v", apiConf)
+	return apiConf, nil
+}
+
+// LoadDaemonStatusConfig loads the daemon status and self-telemetry settings
+func LoadDaemonStatusConfig() DaemonStatusConfig {
+	return loadDaemonStatusConfig(readConfigFile().subscription().DaemonStatus)
+}
+
+func loadDaemonStatusConfig(conf *daemonStatusFile) DaemonStatusConfig {
+	statusConf := DaemonStatusConfig{
+		Enabled:         true,
+		PublishInterval: 60,
+	}
+	if conf == nil {
+		log.Debug().Msg("Daemon status configuration not found")
+		return statusConf
+	}
+	log.Debug().Msg("Loading Daemon Status Config")
+	override(&statusConf.Enabled, conf.Enabled)
+	override(&statusConf.PublishInterval, conf.PublishInterval)
+	if statusConf.PublishInterval == 0 {
+		log.Warn().Msg("Daemon status publish-interval must be positive will use default")
+		statusConf.PublishInterval = 60
+	}
+	log.Debug().Msgf("Daemon Status Config: %+v", statusConf)
+	return statusConf
+}
+
+// LoadBaroConfig loads the barometric pressure tendency settings
+func LoadBaroConfig() BaroConfig {
+	return loadBaroConfig(readConfigFile().subscription().Barometer)
+}
+
+func loadBaroConfig(conf *baroFile) BaroConfig {
+	baroConf := BaroConfig{
+		Enabled:         false,
+		FallingFast:     3.0,
+		PublishInterval: 300,
+	}
+	if conf == nil {
+		log.Debug().Msg("Barometer configuration not found")
+		return baroConf
+	}
+	log.Debug().Msg("Loading Barometer Config")
+	override(&baroConf.Enabled, conf.Enabled)
+	override(&baroConf.FallingFast, conf.FallingFast)
+	override(&baroConf.PublishInterval, conf.PublishInterval)
+	if baroConf.PublishInterval == 0 {
+		log.Warn().Msg("Barometer publish-interval must be positive will use default")
+		baroConf.PublishInterval = 300
+	}
+	log.Debug().Msgf("Barometer Config: %+v", baroConf)
+	return baroConf
+}
+
+// LoadComfortConfig loads the cabin comfort and condensation risk settings
+func LoadComfortConfig() ComfortConfig {
+	return loadComfortConfig(readConfigFile().subscription().Comfort)
+}
+
+func loadComfortConfig(conf *comfortFile) ComfortConfig {
+	comfortConf := ComfortConfig{
+		Enabled:     false,
+		Surface:     "outside",
+		MarginF:     5.0,
+		ProxyMaxAge: 1800,
+	}
+	if conf == nil {
+		log.Debug().Msg("Comfort configuration not found")
+		return comfortConf
+	}
+	log.Debug().Msg("Loading Comfort Config")
+	override(&comfortConf.Enabled, conf.Enabled)
+	if conf.Surface != nil {
+		surface := *conf.Surface
+		if surface == "outside" || surface == "water" {
+			comfortConf.Surface = surface
+		} else {
+			log.Warn().Msgf("Unknown comfort surface %v. Use outside or water", surface)
+		}
+	}
+	override(&comfortConf.MarginF, conf.Margin)
+	override(&comfortConf.ProxyMaxAge, conf.ProxyMaxAge)
+	log.Debug().Msgf("Comfort Config: %+v", comfortConf)
+	return comfortConf
+}
+
+// LoadRefrigerationConfig loads the fridge and freezer analysis settings
+func LoadRefrigerationConfig() RefrigerationConfig {
+	return loadRefrigerationConfig(readConfigFile().subscription().Refrigeration)
+}
+
+func loadRefrigerationConfig(conf *refrigerationFile) RefrigerationConfig {
+	refrigConf := RefrigerationConfig{
+		Enabled:         false,
+		Hysteresis:      0.5,
+		DoorRiseRate:    2.0,
+		PulldownMinutes: 120,
+		DutyWarnPct:     70.0,
+	}
+	if conf == nil {
+		log.Debug().Msg("Refrigeration configuration not found")
+		return refrigConf
+	}
+	log.Debug().Msg("Loading Refrigeration Config")
+	override(&refrigConf.Enabled, conf.Enabled)
+	override(&refrigConf.Hysteresis, conf.Hysteresis)
+	override(&refrigConf.DoorRiseRate, conf.DoorRiseRate)
+	override(&refrigConf.PulldownMinutes, conf.PulldownMinutes)
+	override(&refrigConf.DutyWarnPct, conf.DutyWarn)
+	var names []string
+	for name := range conf.Units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		unitConf := conf.Units[name]
+		unit := RefrigUnitConfig{
+			Name: name,
+			Type: configValue(unitConf.Type),
+		}
+		switch unit.Type {
+		case "fridge":
+			unit.MaxTempF = 40.0
+		case "freezer":
+			unit.MaxTempF = 10.0
+		default:
+			log.Warn().Msgf("Refrigeration unit %v needs a type of fridge or freezer and will be ignored", name)
+			continue
+		}
+		override(&unit.MaxTempF, unitConf.MaxTemp)
+		refrigConf.Units = append(refrigConf.Units, unit)
+	}
+	log.Debug().Msgf("Refrigeration Config: %+v", refrigConf)
+	return refrigConf
+}
+
+// LoadFilterConfig loads the outlier filter rules
+func LoadFilterConfig() FilterConfig {
+	return loadFilterConfig(readConfigFile().subscription().Filter)
+}
+
+func loadFilterConfig(conf *filterFile) FilterConfig {
+	filterConf := FilterConfig{
+		Enabled:         false,
+		LogRejects:      false,
+		PublishInterval: 300,
+	}
+	if conf == nil {
+		log.Debug().Msg("Filter configuration not found")
+		return filterConf
+	}
+	log.Debug().Msg("Loading Filter Config")
+	override(&filterConf.Enabled, conf.Enabled)
+	override(&filterConf.LogRejects, conf.LogRejects)
+	override(&filterConf.PublishInterval, conf.PublishInterval)
+	if filterConf.PublishInterval == 0 {
+		log.Warn().Msg("Filter publish-interval must be positive will use default")
+		filterConf.PublishInterval = 300
+	}
+	var measurements []string
+	for measurement := range conf.Rules {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+	for _, measurement := range measurements {
+		var fields []string
+		for field := range conf.Rules[measurement] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			ruleConf := conf.Rules[measurement][field]
+			rule := FilterRule{
+				Measurement: measurement,
+				Field:       field,
+				Min:         ruleConf.Min,
+				Max:         ruleConf.Max,
+				MaxRate:     configValue(ruleConf.MaxRate),
+				Window:      configValue(ruleConf.Window),
+				Hampel:      configValue(ruleConf.Hampel),
+				Median:      configValue(ruleConf.Median),
 			}
+			if (rule.Hampel > 0 || rule.Median) && rule.Window < 3 {
+				log.Warn().Msgf("Filter rule for %v.%v needs a window of at least 3 and will be ignored", measurement, field)
+				continue
+			}
+			filterConf.Rules = append(filterConf.Rules, rule)
 		}
 	}
+	log.Debug().Msgf("Filter Config: %+v", filterConf)
+	return filterConf
+}
 
-	if !viper.IsSet("subscription.N2KtoName") {
-		log.Warn().Msg("N2K to Name Mappings not found")
-		return subConf, nil
-	} else {
-		log.Debug().Msg("Loading N2K to Device Name Mappings")
-		subConf.N2KtoName = viper.GetStringMapString("subscription.N2KtoName")
+// LoadSourceConfig loads the source exclusion and priority rules
+// Victron GPS positions are excluded unless exclusions are configured as they echo the N2K GPS
+func LoadSourceConfig() SourceConfig {
+	return loadSourceConfig(readConfigFile().subscription().Sources)
+}
+
+func loadSourceConfig(conf *sourceFile) SourceConfig {
+	sourceConf := SourceConfig{
+		StaleAfter: 10,
+		BestSource: "best",
+		Exclude:    map[string][]string{"navigation": {"venus.com.victronenergy.gps."}},
+	}
+	if conf == nil {
+		log.Debug().Msg("Source configuration not found")
+		return sourceConf
+	}
+	log.Debug().Msg("Loading Source Config")
+	override(&sourceConf.StaleAfter, conf.StaleAfter)
+	override(&sourceConf.BestSource, conf.BestSource)
+	if conf.Exclude != nil {
+		sourceConf.Exclude = conf.Exclude
+	}
+	var measurements []string
+	for measurement := range conf.Priority {
+		measurements = append(measurements, measurement)
 	}
+	sort.Strings(measurements)
+	for _, measurement := range measurements {
+		var fields []string
+		for field := range conf.Priority[measurement] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			sources := conf.Priority[measurement][field]
+			if len(sources) == 0 {
+				log.Warn().Msgf("Source priority for %v.%v lists no sources and will be ignored", measurement, field)
+				continue
+			}
+			sourceConf.Priority = append(sourceConf.Priority, SourcePriority{
+				Measurement: measurement,
+				Field:       field,
+				Sources:     sources,
+			})
+		}
+	}
+	log.Debug().Msgf("Source Config: %+v", sourceConf)
+	return sourceConf
+}
 
-	if !viper.IsSet("subscription.influxdb") {
-		log.Warn().Msg("InfluxDB configuration not found")
-		return subConf, nil
-	} else {
-		log.Debug().Msg("Loading InfluxDB Config")
-		tmpmap := viper.GetStringMapString("subscription.influxdb")
-		for k, v := range tmpmap {
-			switch k {
-			case "enabled":
-				booltmp, err := strconv.ParseBool(v)
-				if err != nil {
-					log.Warn().Msgf("Error parsing influx enabled boolean: %v", err.Error())
-					break
-				}
-				subConf.InfluxEnabled = booltmp
-			case "org":
-				subConf.InfluxOrg = v
-			case "bucket":
-				subConf.InfluxBucket = v
-			case "token":
-				subConf.InfluxToken = v
-			case "url":
-				subConf.InfluxUrl = v
+// LoadAggregationConfig loads the downsampling policy for each measurement
+func LoadAggregationConfig() AggregationConfig {
+	return loadAggregationConfig(readConfigFile().subscription().Aggregation)
+}
+
+func loadAggregationConfig(conf map[string]*aggregationFile) AggregationConfig {
+	aggConf := AggregationConfig{}
+	if conf == nil {
+		log.Debug().Msg("Aggregation configuration not found")
+		return aggConf
+	}
+	log.Debug().Msg("Loading Aggregation Config")
+	var measurements []string
+	for measurement := range conf {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+	for _, measurement := range measurements {
+		policyConf := conf[measurement]
+		policy := AggregationPolicy{
+			Measurement: measurement,
+			Interval:    configValue(policyConf.Interval),
+			Functions:   []string{AggregateMean},
+			Angles:      policyConf.Angles,
+			KeepRaw:     configValue(policyConf.KeepRaw),
+		}
+		if policy.Interval == 0 {
+			log.Warn().Msgf("Aggregation policy for %v needs an interval and will be ignored", measurement)
+			continue
+		}
+		if policyConf.Functions != nil {
+			policy.Functions = policyConf.Functions
+		}
+		valid := len(policy.Functions) > 0
+		for _, fn := range policy.Functions {
+			switch fn {
+			case AggregateMean, AggregateMin, AggregateMax, AggregateLast:
 			default:
-				log.Warn().Msgf("Invalid key %v found in InfluxDB", k)
+				valid = false
 			}
 		}
+		if !valid {
+			log.Warn().Msgf("Aggregation policy for %v has invalid functions %v and will be ignored", measurement, policy.Functions)
+			continue
+		}
+		aggConf.Policies = append(aggConf.Policies, policy)
 	}
+	log.Debug().Msgf("Aggregation Config: %+v", aggConf)
+	return aggConf
+}
 
-	return subConf, nil
+// LoadDeadbandConfig loads the change-only reporting policy for each measurement
+func LoadDeadbandConfig() DeadbandConfig {
+	return loadDeadbandConfig(readConfigFile().subscription().Deadband)
+}
+
+func loadDeadbandConfig(conf map[string]*deadbandFile) DeadbandConfig {
+	deadbandConf := DeadbandConfig{}
+	if conf == nil {
+		log.Debug().Msg("Deadband configuration not found")
+		return deadbandConf
+	}
+	log.Debug().Msg("Loading Deadband Config")
+	var measurements []string
+	for measurement := range conf {
+		measurements = append(measurements, measurement)
+	}
+	sort.Strings(measurements)
+	for _, measurement := range measurements {
+		policyConf := conf[measurement]
+		policy := DeadbandPolicy{
+			Measurement: measurement,
+			MaxSilence:  300,
+			Fields:      make(map[string]DeadbandField),
+		}
+		override(&policy.MaxSilence, policyConf.MaxSilence)
+		for field, fieldConf := range policyConf.Fields {
+			policy.Fields[field] = DeadbandField{
+				Absolute: configValue(fieldConf.Absolute),
+				Percent:  configValue(fieldConf.Percent),
+			}
+		}
+		deadbandConf.Policies = append(deadbandConf.Policies, policy)
+	}
+	log.Debug().Msgf("Deadband Config: %+v", deadbandConf)
+	return deadbandConf
 }
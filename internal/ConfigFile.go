@@ -0,0 +1,606 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cast"
+)
+
+// configFile is the layout of the config file
+// The loaders read their settings from it and ValidateConfig reports every key that does not fit it
+// A nil pointer, map or list is a key that is not set
+// The config tag names the key followed by the kind its value is checked against,
+// bycategory when map keys must be category names, or categorytopics for the field collecting each category's topics
+type configFile struct {
+	LogDir            *string                   `config:"logdir"`
+	Interval          *uint                     `config:"interval"`
+	PublishTimeout    *uint                     `config:"publishtimeout"`
+	DisconnectTimeout *uint                     `config:"disconnecttimeout"`
+	Publish           *publishFile              `config:"publish"`
+	PubServers        map[string]*pubServerFile `config:"pubservers"`
+	Subscription      *subscriptionFile         `config:"subscription"`
+
+	problems []ConfigProblem
+}
+
+type publishFile struct {
+	Interval          *int `config:"interval,uint"`
+	Timeout           *int `config:"timeout,uint"`
+	DisconnectTimeout *int `config:"disconnecttimeout,uint"`
+}
+
+// tlsFile is the TLS settings shared by the MQTT brokers and InfluxDB
+type tlsFile struct {
+	CAFile        *string `config:"cafile,file"`
+	CertFile      *string `config:"certfile,file"`
+	KeyFile       *string `config:"keyfile,file"`
+	ServerName    *string `config:"server-name"`
+	TLSMinVersion *string `config:"tls-min-version,tlsversion"`
+	Insecure      *bool   `config:"insecure"`
+}
+
+// mqttFile is the connection settings shared by pubservers, brokers and repost destinations
+type mqttFile struct {
+	tlsFile
+	Username        *string `config:"username"`
+	Password        *string `config:"password,secret"`
+	PasswordFile    *string `config:"password_file,secretfile"`
+	ProtocolVersion *uint   `config:"protocol-version,protocolversion"`
+}
+
+// password loads the password of the connection at key
+func (f mqttFile) password(key string) (Secret, error) {
+	return loadSecret(key+".password", f.Password, f.PasswordFile)
+}
+
+type pubServerFile struct {
+	mqttFile
+	Topics []string `config:"topics,topics"`
+}
+
+// brokerFile is a subscription broker, Topics is keyed by category name
+type brokerFile struct {
+	mqttFile
+	Server       *string             `config:"server,mqtturl"`
+	ClientID     *string             `config:"client-id"`
+	CleanSession *bool               `config:"clean-session"`
+	ShareGroup   *string             `config:"share-group"`
+	Topics       map[string][]string `config:",categorytopics"`
+}
+
+type namedBrokerFile struct {
+	brokerFile
+	RootTopic *string `config:"root-topic"`
+}
+
+type repostDestinationFile struct {
+	mqttFile
+	Broker        *string  `config:"broker"`
+	Server        *string  `config:"server,mqtturl"`
+	Topic         *string  `config:"topic"`
+	QoS           *int     `config:"qos,qos"`
+	Retained      *bool    `config:"retained"`
+	Categories    []string `config:"categories,categories"`
+	MessageExpiry *uint32  `config:"message-expiry"`
+}
+
+// subscriptionFile is the subscription section whose own broker settings are the default broker
+type subscriptionFile struct {
+	brokerFile
+	// Root topics of the sample config that only serve as documentation
+	EspMshRootTopic     *string                           `config:"esp-msh-root-topic"`
+	SignalkRootTopic    *string                           `config:"signalk-root-topic"`
+	CerboRootTopic      *string                           `config:"cerbo-root-topic"`
+	Repost              *bool                             `config:"repost"`
+	RepostRootTopic     *string                           `config:"repost-root-topic"`
+	RepostBroker        *string                           `config:"repost-broker"`
+	RepostQoS           *int                              `config:"repost-qos,qos"`
+	RepostRetained      *bool                             `config:"repost-retained"`
+	RepostDestinations  map[string]*repostDestinationFile `config:"repost-destinations"`
+	PublishTimeout      *uint                             `config:"publish-timeout"`
+	TopicOverrides      map[string]bool                   `config:"topic-overrides,bycategory"`
+	TopicQoS            map[string]int                    `config:"topic-qos,bycategory,qos"`
+	VerboseTopicLogging map[string]bool                   `config:"verbose-topic-logging,bycategory"`
+	Brokers             map[string]*namedBrokerFile       `config:"brokers"`
+	MACtoName           map[string]string                 `config:"MACtoName"`
+	N2KtoName           map[string]string                 `config:"N2KtoName"`
+	DataDir             *string                           `config:"data-dir"`
+	MappingFile         *string                           `config:"mapping-file,file"`
+	API                 *apiFile                          `config:"api"`
+	InfluxDB            *influxFile                       `config:"influxdb"`
+	DaemonStatus        *daemonStatusFile                 `config:"daemon-status"`
+	Passage             *passageFile                      `config:"passage"`
+	Fuel                *fuelFile                         `config:"fuel"`
+	Engine              *engineFile                       `config:"engine"`
+	Maintenance         *maintenanceFile                  `config:"maintenance"`
+	Anchor              *anchorFile                       `config:"anchor"`
+	Geofence            *geofenceFile                     `config:"geofence"`
+	AIS                 *aisFile                          `config:"ais"`
+	Barometer           *baroFile                         `config:"barometer"`
+	Comfort             *comfortFile                      `config:"comfort"`
+	Refrigeration       *refrigerationFile                `config:"refrigeration"`
+	Filter              *filterFile                       `config:"filter"`
+	Sources             *sourceFile                       `config:"sources"`
+	Aggregation         map[string]*aggregationFile       `config:"aggregation"`
+	Deadband            map[string]*deadbandFile          `config:"deadband"`
+}
+
+type apiFile struct {
+	Listen    *string `config:"listen"`
+	Token     *string `config:"token,secret"`
+	TokenFile *string `config:"token_file,secretfile"`
+}
+
+type influxFile struct {
+	tlsFile
+	Enabled   *bool   `config:"enabled"`
+	URL       *string `config:"url,httpurl"`
+	Org       *string `config:"org"`
+	Bucket    *string `config:"bucket"`
+	Token     *string `config:"token,secret"`
+	TokenFile *string `config:"token_file,secretfile"`
+}
+
+type daemonStatusFile struct {
+	Enabled         *bool `config:"enabled"`
+	PublishInterval *uint `config:"publish-interval,interval"`
+}
+
+type passageFile struct {
+	Enabled       *bool    `config:"enabled"`
+	StartSOG      *float64 `config:"start-sog"`
+	StartSeconds  *uint    `config:"start-seconds"`
+	StopSOG       *float64 `config:"stop-sog"`
+	StopSeconds   *uint    `config:"stop-seconds"`
+	TrackDistance *float64 `config:"track-distance"`
+	TrackInterval *uint    `config:"track-interval"`
+}
+
+type fuelFile struct {
+	Enabled         *bool              `config:"enabled"`
+	PublishInterval *uint              `config:"publish-interval,interval"`
+	TripGap         *uint              `config:"trip-gap"`
+	TankCapacity    map[string]float64 `config:"tank-capacity"`
+}
+
+type engineFile struct {
+	Enabled          *bool    `config:"enabled"`
+	StartRPM         *int64   `config:"start-rpm"`
+	UnderwayRPM      *int64   `config:"underway-rpm"`
+	StopTimeout      *uint    `config:"stop-timeout"`
+	RunTimeTolerance *float64 `config:"runtime-tolerance"`
+}
+
+type maintenanceFile struct {
+	Enabled         *bool                           `config:"enabled"`
+	PublishInterval *uint                           `config:"publish-interval,interval"`
+	WarnHours       *float64                        `config:"warn-hours"`
+	WarnDays        *uint                           `config:"warn-days"`
+	Items           map[string]*maintenanceItemFile `config:"items"`
+}
+
+type maintenanceItemFile struct {
+	Engine *string  `config:"engine"`
+	Hours  *float64 `config:"hours"`
+	Days   *uint    `config:"days"`
+	Months *uint    `config:"months"`
+}
+
+type anchorFile struct {
+	Enabled         *bool    `config:"enabled"`
+	Radius          *float64 `config:"radius"`
+	AlarmSeconds    *uint    `config:"alarm-seconds"`
+	MaxHDOP         *float64 `config:"max-hdop"`
+	MinSatellites   *int64   `config:"min-satellites"`
+	PublishInterval *uint    `config:"publish-interval,interval"`
+	CommandTopic    *string  `config:"command-topic"`
+}
+
+type geofenceFile struct {
+	Enabled *bool                        `config:"enabled"`
+	Zones   map[string]*geofenceZoneFile `config:"zones"`
+}
+
+// geofenceZoneFile keeps the polygon as read since parsePolygon reports what is wrong with it
+type geofenceZoneFile struct {
+	Lat     *float64 `config:"lat"`
+	Lon     *float64 `config:"lon"`
+	Radius  *float64 `config:"radius"`
+	Polygon any      `config:"polygon"`
+}
+
+type aisFile struct {
+	TargetTimeout   *uint    `config:"target-timeout"`
+	OwnTimeout      *uint    `config:"own-timeout"`
+	PublishInterval *uint    `config:"publish-interval,interval"`
+	CPAWarn         *float64 `config:"cpa-warn"`
+	TCPAWarn        *float64 `config:"tcpa-warn"`
+}
+
+type baroFile struct {
+	Enabled         *bool    `config:"enabled"`
+	FallingFast     *float64 `config:"falling-fast"`
+	PublishInterval *uint    `config:"publish-interval,interval"`
+}
+
+type comfortFile struct {
+	Enabled     *bool    `config:"enabled"`
+	Surface     *string  `config:"surface"`
+	Margin      *float64 `config:"margin"`
+	ProxyMaxAge *uint    `config:"proxy-max-age"`
+}
+
+type refrigerationFile struct {
+	Enabled         *bool                      `config:"enabled"`
+	Hysteresis      *float64                   `config:"hysteresis"`
+	DoorRiseRate    *float64                   `config:"door-rise-rate"`
+	PulldownMinutes *uint                      `config:"pulldown-minutes"`
+	DutyWarn        *float64                   `config:"duty-warn"`
+	Units           map[string]*refrigUnitFile `config:"units"`
+}
+
+type refrigUnitFile struct {
+	Type    *string  `config:"type"`
+	MaxTemp *float64 `config:"max-temp"`
+}
+
+// filterFile Rules is keyed by measurement and then field
+type filterFile struct {
+	Enabled         *bool                                 `config:"enabled"`
+	LogRejects      *bool                                 `config:"log-rejects"`
+	PublishInterval *uint                                 `config:"publish-interval,interval"`
+	Rules           map[string]map[string]*filterRuleFile `config:"rules"`
+}
+
+type filterRuleFile struct {
+	Min     *float64 `config:"min"`
+	Max     *float64 `config:"max"`
+	MaxRate *float64 `config:"max-rate"`
+	Window  *int     `config:"window,uint"`
+	Hampel  *float64 `config:"hampel"`
+	Median  *bool    `config:"median"`
+}
+
+// sourceFile Priority is keyed by measurement and then field
+type sourceFile struct {
+	StaleAfter *uint                          `config:"stale-after"`
+	BestSource *string                        `config:"best-source"`
+	Exclude    map[string][]string            `config:"exclude"`
+	Priority   map[string]map[string][]string `config:"priority"`
+}
+
+type aggregationFile struct {
+	Interval  *uint    `config:"interval"`
+	Functions []string `config:"functions"`
+	Angles    []string `config:"angles"`
+	KeepRaw   *bool    `config:"keep-raw"`
+}
+
+type deadbandFile struct {
+	MaxSilence *uint                         `config:"max-silence"`
+	Fields     map[string]*deadbandFieldFile `config:"fields"`
+}
+
+type deadbandFieldFile struct {
+	Absolute *float64 `config:"absolute"`
+	Percent  *float64 `config:"percent"`
+}
+
+// subscription returns the subscription section, empty when it is not set
+func (f configFile) subscription() subscriptionFile {
+	if f.Subscription == nil {
+		return subscriptionFile{}
+	}
+	return *f.Subscription
+}
+
+// invalid reports whether key was set to a value that could not be decoded
+func (f configFile) invalid(key string) bool {
+	for _, problem := range f.problems {
+		if strings.EqualFold(problem.Key, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// override sets target to the configured value when there is one
+func override[T any](target *T, value *T) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// configValue returns the configured value or the zero value when it is not set
+func configValue[T any](value *T) T {
+	if value == nil {
+		var zero T
+		return zero
+	}
+	return *value
+}
+
+// readConfigFile decodes the config file for the loaders
+// Keys that are unknown or cannot be read as their type are logged and left to their defaults
+func readConfigFile() configFile {
+	file := decodeConfig(false)
+	for _, problem := range file.problems {
+		log.Warn().Msgf("Ignoring %v", problem)
+	}
+	return file
+}
+
+// decodeConfig decodes the config file into its layout collecting a problem for every key that does not fit
+// With check set values are also checked against the kind in their tag, which reads files and the environment
+func decodeConfig(check bool) configFile {
+	d := &configDecoder{check: check}
+	var file configFile
+	d.decodeStruct(configSettings(), reflect.ValueOf(&file).Elem(), nil)
+	file.problems = d.problems
+	return file
+}
+
+// configKindNames maps the kinds used in config tags
+var configKindNames = map[string]configKind{
+	"uint":            kindUint,
+	"interval":        kindInterval,
+	"mqtturl":         kindMQTTURL,
+	"httpurl":         kindHTTPURL,
+	"file":            kindFile,
+	"secret":          kindSecret,
+	"secretfile":      kindSecretFile,
+	"topics":          kindTopics,
+	"categories":      kindCategories,
+	"qos":             kindQoS,
+	"protocolversion": kindProtocolVersion,
+	"tlsversion":      kindTLSVersion,
+}
+
+// configTag is a parsed config struct tag
+type configTag struct {
+	name           string
+	kind           configKind
+	byCategory     bool
+	categoryTopics bool
+}
+
+func parseConfigTag(tag string) configTag {
+	options := strings.Split(tag, ",")
+	parsed := configTag{name: options[0]}
+	for _, option := range options[1:] {
+		switch option {
+		case "bycategory":
+			parsed.byCategory = true
+		case "categorytopics":
+			parsed.categoryTopics = true
+		default:
+			kind, ok := configKindNames[option]
+			if !ok {
+				panic("unknown config tag option " + option)
+			}
+			parsed.kind = kind
+		}
+	}
+	return parsed
+}
+
+// configField is one field of a layout struct with the fields of embedded structs flattened
+type configField struct {
+	tag   configTag
+	value reflect.Value
+}
+
+func configFields(target reflect.Value) []configField {
+	var fields []configField
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		if field.Anonymous {
+			fields = append(fields, configFields(target.Field(i))...)
+			continue
+		}
+		tag, ok := field.Tag.Lookup("config")
+		if !ok {
+			continue
+		}
+		fields = append(fields, configField{tag: parseConfigTag(tag), value: target.Field(i)})
+	}
+	return fields
+}
+
+// configDecoder decodes settings into the config layout
+type configDecoder struct {
+	check    bool
+	problems []ConfigProblem
+}
+
+func (d *configDecoder) problem(path []string, err error) {
+	d.problems = append(d.problems, ConfigProblem{Key: strings.Join(path, "."), Message: err.Error()})
+}
+
+// decodeStruct matches each key to a field ignoring case since viper lowercases every key
+func (d *configDecoder) decodeStruct(settings map[string]any, target reflect.Value, path []string) {
+	fields := configFields(target)
+	for _, key := range sortedConfigKeys(settings) {
+		childPath := append(append([]string{}, path...), key)
+		decoded := false
+		for _, field := range fields {
+			if field.tag.categoryTopics {
+				category, ok := categoryForTopicsKey(key)
+				if !ok {
+					continue
+				}
+				var topics []string
+				if d.decode(settings[key], reflect.ValueOf(&topics).Elem(), childPath, configTag{kind: kindTopics}) {
+					if field.value.IsNil() {
+						field.value.Set(reflect.MakeMap(field.value.Type()))
+					}
+					field.value.SetMapIndex(reflect.ValueOf(category), reflect.ValueOf(topics))
+				}
+				decoded = true
+				break
+			}
+			if strings.EqualFold(field.tag.name, key) {
+				d.decode(settings[key], field.value, childPath, field.tag)
+				decoded = true
+				break
+			}
+		}
+		if !decoded {
+			d.problem(childPath, fmt.Errorf("unknown key"))
+		}
+	}
+}
+
+// decode sets target from value and returns whether it was set
+// A value that cannot be converted leaves target unset, one that converts but fails its kind check is still set
+func (d *configDecoder) decode(value any, target reflect.Value, path []string, tag configTag) bool {
+	if value == nil {
+		return false
+	}
+	switch target.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(target.Type().Elem())
+		if !d.decode(value, elem.Elem(), path, tag) {
+			return false
+		}
+		target.Set(elem)
+		return true
+	case reflect.Struct:
+		settings, ok := configMap(value)
+		if !ok {
+			d.problem(path, fmt.Errorf("must be a map but is %v", value))
+			return false
+		}
+		d.decodeStruct(settings, target, path)
+		return true
+	case reflect.Map:
+		settings, ok := configMap(value)
+		if !ok {
+			d.problem(path, fmt.Errorf("must be a map but is %v", value))
+			return false
+		}
+		target.Set(reflect.MakeMap(target.Type()))
+		elemTag := configTag{kind: tag.kind}
+		for _, key := range sortedConfigKeys(settings) {
+			childPath := append(append([]string{}, path...), key)
+			if tag.byCategory && !isCategory(key) {
+				d.problem(childPath, fmt.Errorf("unknown key"))
+				continue
+			}
+			elem := reflect.New(target.Type().Elem()).Elem()
+			// A named section with nothing under it is kept so the loader can say what it is missing
+			if settings[key] == nil && elem.Kind() == reflect.Pointer && elem.Type().Elem().Kind() == reflect.Struct {
+				target.SetMapIndex(reflect.ValueOf(key), reflect.New(elem.Type().Elem()))
+				continue
+			}
+			if d.decode(settings[key], elem, childPath, elemTag) {
+				target.SetMapIndex(reflect.ValueOf(key), elem)
+			}
+		}
+		return true
+	case reflect.Slice:
+		values, err := checkStrings(value)
+		if err != nil {
+			d.problem(path, err)
+			return false
+		}
+		target.Set(reflect.ValueOf(append([]string{}, values...)))
+	case reflect.Interface:
+		target.Set(reflect.ValueOf(value))
+	case reflect.Bool:
+		if !d.convert(kindBool, value, path) {
+			return false
+		}
+		target.SetBool(cast.ToBool(value))
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		if !d.convert(kindUint, value, path) {
+			return false
+		}
+		target.SetUint(cast.ToUint64(value))
+	case reflect.Int, reflect.Int64:
+		if !d.convert(kindInt, value, path) {
+			return false
+		}
+		target.SetInt(cast.ToInt64(value))
+	case reflect.Float64:
+		if !d.convert(kindFloat, value, path) {
+			return false
+		}
+		target.SetFloat(cast.ToFloat64(value))
+	case reflect.String:
+		if !d.convert(kindString, value, path) {
+			return false
+		}
+		target.SetString(cast.ToString(value))
+	default:
+		panic("unsupported config field type " + target.Type().String())
+	}
+	if d.check && tag.kind != kindNone {
+		if err := checkConfigValue(tag.kind, value); err != nil {
+			d.problem(path, err)
+		}
+	}
+	return true
+}
+
+// convert reports whether value can be converted to the kind of its field
+func (d *configDecoder) convert(kind configKind, value any, path []string) bool {
+	if err := checkConfigValue(kind, value); err != nil {
+		d.problem(path, err)
+		return false
+	}
+	return true
+}
+
+// configMap returns a map value keyed by string
+func configMap(value any) (map[string]any, bool) {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Map {
+		return nil, false
+	}
+	settings := make(map[string]any, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		settings[cast.ToString(iter.Key().Interface())] = iter.Value().Interface()
+	}
+	return settings, true
+}
+
+func sortedConfigKeys(settings map[string]any) []string {
+	var keys []string
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// categoryForTopicsKey returns the name of the category whose topic list is set by key
+func categoryForTopicsKey(key string) (string, bool) {
+	for _, category := range RegisteredCategories() {
+		if strings.EqualFold(category.TopicsKey, key) {
+			return category.Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,383 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// configKind is the type a config value is checked against
+type configKind int
+
+const (
+	kindNone configKind = iota
+	kindBool
+	kindUint
+	kindInterval
+	kindInt
+	kindFloat
+	kindString
+	kindMQTTURL
+	kindHTTPURL
+	kindFile
+	kindSecret
+	kindSecretFile
+	kindTopics
+	kindCategories
+	kindQoS
+	kindProtocolVersion
+	kindTLSVersion
+)
+
+// ConfigProblem is one problem found validating the config
+type ConfigProblem struct {
+	Key     string
+	Message string
+}
+
+func (p ConfigProblem) String() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + ": " + p.Message
+}
+
+// EffectiveConfig is every section of the config after defaults are applied
+type EffectiveConfig struct {
+	Publish        *PublishConfig      `json:"Publish,omitempty"`
+	PublishServers []MQTTDestination   `json:"PublishServers,omitempty"`
+	Subscription   *SubscriptionConfig `json:"Subscription,omitempty"`
+}
+
+// ValidateConfig checks the loaded config file and returns every problem found with its key
+// The file is decoded into the same layout the loaders read so every key they know is checked
+// Problems only a loader can see, like a repost destination naming an unknown broker,
+// are only reported once every key is valid
+func ValidateConfig() []ConfigProblem {
+	file := decodeConfig(true)
+	problems := append(file.problems, validateConfigRequired(file)...)
+	problems = append(problems, validateClientCertificates(file)...)
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Key < problems[j].Key
+	})
+	if len(problems) > 0 {
+		return problems
+	}
+	if file.Publish != nil {
+		if _, err := loadPublishConfig(file.Publish); err != nil {
+			problems = append(problems, ConfigProblem{Key: "publish", Message: err.Error()})
+		}
+	}
+	if file.PubServers != nil {
+		if _, err := loadPublishServerConfig(file); err != nil {
+			problems = append(problems, ConfigProblem{Key: "pubservers", Message: err.Error()})
+		}
+	}
+	if file.Subscription != nil {
+		if _, err := loadSubscribeServerConfig(file); err != nil {
+			problems = append(problems, ConfigProblem{Key: "subscription", Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+// LoadEffectiveConfig loads every section that is set in the config file
+func LoadEffectiveConfig() (EffectiveConfig, error) {
+	var conf EffectiveConfig
+	file := readConfigFile()
+	if file.Publish != nil {
+		publishConf, err := loadPublishConfig(file.Publish)
+		if err != nil {
+			return EffectiveConfig{}, err
+		}
+		conf.Publish = &publishConf
+	}
+	if file.PubServers != nil {
+		servers, err := loadPublishServerConfig(file)
+		if err != nil {
+			return EffectiveConfig{}, err
+		}
+		conf.PublishServers = servers
+	}
+	if file.Subscription != nil {
+		subConf, err := loadSubscribeServerConfig(file)
+		if err != nil {
+			return EffectiveConfig{}, err
+		}
+		conf.Subscription = &subConf
+	}
+	return conf, nil
+}
+
+// configSettings returns the settings keyed by top level key
+// viper.AllSettings is not used since it splits keys with dots like pubserver URLs and N2K sources
+// The sections of the layout are looked up as well since viper lists no keys for an empty one
+func configSettings() map[string]any {
+	settings := make(map[string]any)
+	for _, key := range viper.AllKeys() {
+		top, _, _ := strings.Cut(key, ".")
+		if _, ok := settings[top]; !ok {
+			settings[top] = viper.Get(top)
+		}
+	}
+	for _, field := range configFields(reflect.ValueOf(&configFile{}).Elem()) {
+		if _, ok := settings[field.tag.name]; !ok && viper.IsSet(field.tag.name) {
+			settings[field.tag.name] = viper.Get(field.tag.name)
+		}
+	}
+	return settings
+}
+
+// validateConfigRequired checks the keys a section cannot work without
+// Keys that are already reported as invalid are skipped so they are not reported twice
+func validateConfigRequired(file configFile) []ConfigProblem {
+	var problems []ConfigProblem
+	sub := file.subscription()
+	if file.Subscription != nil && sub.Server == nil && sub.Brokers == nil &&
+		!file.invalid("subscription.server") && !file.invalid("subscription.brokers") {
+		problems = append(problems, ConfigProblem{Key: "subscription.server", Message: "required unless subscription.brokers is set"})
+	}
+	for name, server := range file.PubServers {
+		key := "pubservers." + name
+		if server.Topics == nil && !file.invalid(key+".topics") {
+			problems = append(problems, ConfigProblem{Key: key + ".topics", Message: "required"})
+		}
+		if err := checkURL(name, "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss"); err != nil {
+			problems = append(problems, ConfigProblem{Key: key, Message: err.Error()})
+		}
+	}
+	for name, broker := range sub.Brokers {
+		key := "subscription.brokers." + name + ".server"
+		if broker.Server == nil && !file.invalid(key) {
+			problems = append(problems, ConfigProblem{Key: key, Message: "required"})
+		}
+	}
+	if influx := sub.InfluxDB; influx != nil && configValue(influx.Enabled) {
+		required := map[string]*string{"url": influx.URL, "org": influx.Org, "bucket": influx.Bucket}
+		for _, key := range []string{"url", "org", "bucket"} {
+			if required[key] == nil && !file.invalid("subscription.influxdb."+key) {
+				problems = append(problems, ConfigProblem{Key: "subscription.influxdb." + key, Message: "required when InfluxDB is enabled"})
+			}
+		}
+		if influx.Token == nil && influx.TokenFile == nil &&
+			!file.invalid("subscription.influxdb.token") && !file.invalid("subscription.influxdb.token_file") {
+			problems = append(problems, ConfigProblem{Key: "subscription.influxdb.token", Message: "required when InfluxDB is enabled"})
+		}
+	}
+	return problems
+}
+
+// validateClientCertificates checks that every client certificate loads with its key
+func validateClientCertificates(file configFile) []ConfigProblem {
+	sections := make(map[string]tlsFile)
+	for name, server := range file.PubServers {
+		sections["pubservers."+name] = server.tlsFile
+	}
+	sub := file.subscription()
+	if file.Subscription != nil {
+		sections["subscription"] = sub.tlsFile
+	}
+	for name, broker := range sub.Brokers {
+		sections["subscription.brokers."+name] = broker.tlsFile
+	}
+	for name, dest := range sub.RepostDestinations {
+		sections["subscription.repost-destinations."+name] = dest.tlsFile
+	}
+	if sub.InfluxDB != nil {
+		sections["subscription.influxdb"] = sub.InfluxDB.tlsFile
+	}
+	var problems []ConfigProblem
+	for key, conf := range sections {
+		if file.invalid(key+".certfile") || file.invalid(key+".keyfile") {
+			continue
+		}
+		switch {
+		case conf.CertFile == nil && conf.KeyFile == nil:
+		case conf.KeyFile == nil:
+			problems = append(problems, ConfigProblem{Key: key + ".keyfile", Message: "required when certfile is set"})
+		case conf.CertFile == nil:
+			problems = append(problems, ConfigProblem{Key: key + ".certfile", Message: "required when keyfile is set"})
+		default:
+			if _, err := tls.LoadX509KeyPair(*conf.CertFile, *conf.KeyFile); err != nil {
+				problems = append(problems, ConfigProblem{Key: key + ".certfile", Message: "cannot load client certificate: " + err.Error()})
+			}
+		}
+	}
+	return problems
+}
+
+func isCategory(name string) bool {
+	for _, category := range RegisteredCategories() {
+		if strings.EqualFold(category.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkConfigValue(kind configKind, value any) error {
+	switch kind {
+	case kindBool:
+		_, err := cast.ToBoolE(value)
+		return typeError("a boolean", value, err)
+	case kindUint:
+		_, err := cast.ToUint64E(value)
+		return typeError("a non-negative integer", value, err)
+	case kindInterval:
+		interval, err := cast.ToUint64E(value)
+		if err != nil || interval == 0 {
+			return fmt.Errorf("must be a positive integer but is %v", value)
+		}
+	case kindInt:
+		_, err := cast.ToInt64E(value)
+		return typeError("an integer", value, err)
+	case kindFloat:
+		_, err := cast.ToFloat64E(value)
+		return typeError("a number", value, err)
+	case kindString:
+		return checkString(value)
+	case kindMQTTURL:
+		if err := checkString(value); err != nil {
+			return err
+		}
+		return checkURL(cast.ToString(value), "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss")
+	case kindHTTPURL:
+		if err := checkString(value); err != nil {
+			return err
+		}
+		return checkURL(cast.ToString(value), "http", "https")
+	case kindFile:
+		if err := checkString(value); err != nil {
+			return err
+		}
+		return checkFile(cast.ToString(value))
+	case kindSecret:
+		if err := checkString(value); err != nil {
+			return err
+		}
+		_, err := expandSecretEnv(cast.ToString(value))
+		return err
+	case kindSecretFile:
+		if err := checkString(value); err != nil {
+			return err
+		}
+		filename, err := expandSecretEnv(cast.ToString(value))
+		if err != nil {
+			return err
+		}
+		return checkFile(filename)
+	case kindTopics:
+		topics, err := checkStrings(value)
+		if err != nil {
+			return err
+		}
+		if len(topics) == 0 {
+			return fmt.Errorf("must list at least one topic")
+		}
+		for _, topic := range topics {
+			if strings.TrimSpace(topic) == "" {
+				return fmt.Errorf("topics must not be empty")
+			}
+		}
+	case kindCategories:
+		categories, err := checkStrings(value)
+		if err != nil {
+			return err
+		}
+		for _, category := range categories {
+			if category != DerivedCategory && !isCategory(category) {
+				return fmt.Errorf("unknown category %v", category)
+			}
+		}
+	case kindQoS:
+		qos, err := cast.ToInt64E(value)
+		if err != nil || qos < 0 || qos > 2 {
+			return fmt.Errorf("must be 0, 1 or 2 but is %v", value)
+		}
+	case kindProtocolVersion:
+		version, err := cast.ToInt64E(value)
+		if err != nil || (version != 3 && version != 4 && version != 5) {
+			return fmt.Errorf("must be 3, 4 or 5 but is %v", value)
+		}
+	case kindTLSVersion:
+		if _, ok := tlsVersions[cast.ToString(value)]; !ok {
+			return fmt.Errorf("must be 1.0, 1.1, 1.2 or 1.3 but is %v", value)
+		}
+	}
+	return nil
+}
+
+func typeError(want string, value any, err error) error {
+	if err != nil {
+		return fmt.Errorf("must be %v but is %v", want, value)
+	}
+	return nil
+}
+
+// checkString refuses maps and lists which cast would otherwise print
+func checkString(value any) error {
+	switch value.(type) {
+	case map[string]any, []any, []string:
+		return fmt.Errorf("must be a string but is %v", value)
+	}
+	_, err := cast.ToStringE(value)
+	return typeError("a string", value, err)
+}
+
+// checkStrings requires a list since cast would split a single string on spaces
+func checkStrings(value any) ([]string, error) {
+	switch value.(type) {
+	case []any, []string:
+	default:
+		return nil, fmt.Errorf("must be a list but is %v", value)
+	}
+	values, err := cast.ToStringSliceE(value)
+	if err != nil {
+		return nil, fmt.Errorf("must be a list of strings but is %v", value)
+	}
+	return values, nil
+}
+
+func checkURL(value string, schemes ...string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("must be a URL like %v://host:port but is %v", schemes[0], value)
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(parsed.Scheme, scheme) {
+			return nil
+		}
+	}
+	return fmt.Errorf("scheme must be one of %v but is %v", strings.Join(schemes, ", "), parsed.Scheme)
+}
+
+func checkFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("cannot read %v: %v", filename, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func problemKeys(problems []ConfigProblem) map[string]string {
+	keys := make(map[string]string)
+	for _, problem := range problems {
+		keys[problem.Key] = problem.Message
+	}
+	return keys
+}
+
+func TestValidateConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	t.Run("Valid config", func(t *testing.T) {
+		assert.Empty(t, ValidateConfig())
+	})
+
+	t.Run("Every problem is reported", func(t *testing.T) {
+		viper.Set("publish.interval", -5)
+		viper.Set("publish.intervl", 10)
+		viper.Set("subscription.repost", "maybe")
+		viper.Set("subscription.server", "http://localhost:1883")
+		viper.Set("subscription.cafile", filepath.Join(t.TempDir(), "missing.pem"))
+		viper.Set("subscription.bleTopics", []string{})
+		viper.Set("subscription.phyTopics", "rtd/temperature")
+		viper.Set("subscription.topic-overrides.ble", "sometimes")
+		viper.Set("subscription.topic-overrides.radar", true)
+		viper.Set("subscription.topic-qos.ble", 3)
+		viper.Set("subscription.influxdb.url", "localhost:8086")
+		viper.Set("pubservers.tcp://localhost:1883.topics", []string{"test/topic1", " "})
+		viper.Set("subscription.fuel.publish-interval", 0)
+
+		problems := ValidateConfig()
+		keys := problemKeys(problems)
+		assert.Equal(t, "must be a non-negative integer but is -5", keys["publish.interval"])
+		assert.Equal(t, "unknown key", keys["publish.intervl"])
+		assert.Equal(t, "must be a boolean but is maybe", keys["subscription.repost"])
+		assert.Equal(t, "scheme must be one of tcp, ssl, tls, mqtt, mqtts, ws, wss but is http", keys["subscription.server"])
+		assert.Contains(t, keys["subscription.cafile"], "cannot read")
+		assert.Equal(t, "must list at least one topic", keys["subscription.bletopics"])
+		assert.Equal(t, "must be a list but is rtd/temperature", keys["subscription.phytopics"])
+		assert.Equal(t, "must be a boolean but is sometimes", keys["subscription.topic-overrides.ble"])
+		assert.Equal(t, "unknown key", keys["subscription.topic-overrides.radar"])
+		assert.Equal(t, "must be 0, 1 or 2 but is 3", keys["subscription.topic-qos.ble"])
+		assert.Contains(t, keys["subscription.influxdb.url"], "must be a URL like http://host:port")
+		assert.Equal(t, "topics must not be empty", keys["pubservers.tcp://localhost:1883.topics"])
+		assert.Equal(t, "must be a positive integer but is 0", keys["subscription.fuel.publish-interval"])
+		assert.Len(t, problems, 13)
+		assert.NotContains(t, keys, "subscription", "loaders only run once the schema checks pass")
+		assert.IsNonDecreasing(t, func() []string {
+			var sorted []string
+			for _, problem := range problems {
+				sorted = append(sorted, problem.Key)
+			}
+			return sorted
+		}())
+	})
+}
+
+func TestValidateConfigRequired(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	viper.Set("subscription.server", nil)
+	viper.Set("subscription.influxdb.bucket", nil)
+	viper.Set("subscription.influxdb.token", nil)
+	viper.Set("pubservers.localhost:1883.username", "user")
+
+	keys := problemKeys(ValidateConfig())
+	assert.Equal(t, "required unless subscription.brokers is set", keys["subscription.server"])
+	assert.Equal(t, "required when InfluxDB is enabled", keys["subscription.influxdb.bucket"])
+	assert.Equal(t, "required when InfluxDB is enabled", keys["subscription.influxdb.token"])
+	assert.Equal(t, "required", keys["pubservers.localhost:1883.topics"])
+	assert.Contains(t, keys, "pubservers.localhost:1883")
+}
+
+func TestValidateClientCertificates(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir())
+
+	viper.Set("subscription.certfile", certFile)
+	viper.Set("subscription.keyfile", keyFile)
+	assert.Empty(t, ValidateConfig())
+
+	// Files that can be read but are not a certificate and its key are reported with other problems
+	viper.Set("subscription.keyfile", certFile)
+	viper.Set("subscription.influxdb.certfile", certFile)
+	viper.Set("pubservers.tcp://localhost:1883.keyfile", keyFile)
+	viper.Set("publish.interval", -5)
+	keys := problemKeys(ValidateConfig())
+	assert.Contains(t, keys["subscription.certfile"], "cannot load client certificate")
+	assert.Equal(t, "required when certfile is set", keys["subscription.influxdb.keyfile"])
+	assert.Equal(t, "required when keyfile is set", keys["pubservers.tcp://localhost:1883.certfile"])
+	assert.Contains(t, keys, "publish.interval")
+}
+
+func TestValidateConfigLoaderErrors(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	viper.Set("subscription.brokers.hub.server", "tcp://hub:1883")
+	viper.Set("subscription.repost-destinations.cloud.broker", "nowhere")
+
+	problems := ValidateConfig()
+	require.Len(t, problems, 1)
+	assert.Equal(t, "subscription", problems[0].Key)
+	assert.Contains(t, problems[0].String(), "subscription: ")
+}
+
+func TestLoadSubscribeServerConfigMissingSections(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	viper.Set("subscription.N2KtoName", nil)
+	viper.Set("subscription.topic-overrides", map[string]any{"ble": "sometimes", "gnss": false})
+
+	var conf SubscriptionConfig
+	var err error
+	require.NotPanics(t, func() {
+		conf, err = LoadSubscribeServerConfig()
+	})
+	require.NoError(t, err)
+	assert.True(t, conf.InfluxEnabled, "InfluxDB is still loaded after a missing N2KtoName")
+	assert.Equal(t, "mybucket", conf.InfluxBucket)
+	assert.Empty(t, conf.N2KtoName)
+	assert.False(t, conf.Categories["gnss"].Subscribed)
+	assert.True(t, conf.Categories["ble"].Subscribed, "an invalid override keeps the default")
+}
+
+func TestLoadEffectiveConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	conf, err := LoadEffectiveConfig()
+	require.NoError(t, err)
+	require.NotNil(t, conf.Publish)
+	require.NotNil(t, conf.Subscription)
+	require.Len(t, conf.PublishServers, 2)
+	assert.Equal(t, "ssl://localhost:8883", conf.PublishServers[0].Host)
+	assert.Equal(t, "tcp://localhost:1883", conf.PublishServers[1].Host)
+
+	out, err := json.Marshal(conf)
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "testpass")
+	assert.NotContains(t, string(out), "subpass")
+	assert.NotContains(t, string(out), "mytoken")
+	assert.Contains(t, string(out), RedactedSecret)
+}
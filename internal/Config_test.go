@@ -17,12 +17,14 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
+	"crypto/tls"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // setupTestConfig creates a temporary config file for testing
@@ -86,7 +88,7 @@ func setupTestConfig(t *testing.T) func() {
 		"venus.com.victronenergy.gps.123":         "Main GPS",
 		"venus.com.victronenergy.temperature.456": "Engine Temp",
 	})
-	viper.Set("subscription.topic-overrides", map[string]bool{
+	viper.Set("subscription.topic-overrides", map[string]any{
 		"ble":        false,
 		"gnss":       true,
 		"esp":        true,
@@ -98,7 +100,7 @@ func setupTestConfig(t *testing.T) func() {
 		"water":      true,
 		"wind":       true,
 	})
-	viper.Set("subscription.verbose-topic-logging", map[string]bool{
+	viper.Set("subscription.verbose-topic-logging", map[string]any{
 		"ble":        true,
 		"gnss":       true,
 		"esp":        true,
@@ -192,19 +194,18 @@ func TestLoadPublishServerConfig(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, destinations, 2)
 
-	// Check first destination
-	assert.Equal(t, "tcp://localhost:1883", destinations[0].Host)
-	assert.Equal(t, []string{"test/topic1", "test/topic2"}, destinations[0].Topics)
-	assert.Equal(t, "testuser", destinations[0].Username)
-	assert.Equal(t, "testpass", destinations[0].Password)
-	assert.Empty(t, destinations[0].CACert)
+	// Servers are sorted by URL so the order is the same every run
+	assert.Equal(t, "ssl://localhost:8883", destinations[0].Host)
+	assert.Equal(t, []string{"secure/topic"}, destinations[0].Topics)
+	assert.Equal(t, "secureuser", destinations[0].Username)
+	assert.Equal(t, "securepass", destinations[0].Password.Value())
+	assert.NotEmpty(t, destinations[0].CACert)
 
-	// Check second destination
-	assert.Equal(t, "ssl://localhost:8883", destinations[1].Host)
-	assert.Equal(t, []string{"secure/topic"}, destinations[1].Topics)
-	assert.Equal(t, "secureuser", destinations[1].Username)
-	assert.Equal(t, "securepass", destinations[1].Password)
-	assert.NotEmpty(t, destinations[1].CACert)
+	assert.Equal(t, "tcp://localhost:1883", destinations[1].Host)
+	assert.Equal(t, []string{"test/topic1", "test/topic2"}, destinations[1].Topics)
+	assert.Equal(t, "testuser", destinations[1].Username)
+	assert.Equal(t, "testpass", destinations[1].Password.Value())
+	assert.Empty(t, destinations[1].CACert)
 
 	// Test missing pubservers
 	viper.Set("pubservers", nil)
@@ -242,23 +243,37 @@ func TestLoadSubscribeServerConfig(t *testing.T) {
 	// Test successful config load
 	subConf, err := LoadSubscribeServerConfig()
 	assert.NoError(t, err)
-	assert.Equal(t, "tcp://localhost:1883", subConf.Host)
-	assert.Equal(t, "subuser", subConf.Username)
-	assert.Equal(t, "subpass", subConf.Password)
-	assert.NotEmpty(t, subConf.CACert)
+	assert.Len(t, subConf.Brokers, 1)
+	assert.Equal(t, DefaultBrokerName, subConf.Brokers[0].Name)
+	assert.Equal(t, "tcp://localhost:1883", subConf.Brokers[0].Host)
+	assert.Equal(t, "subuser", subConf.Brokers[0].Username)
+	assert.Equal(t, "subpass", subConf.Brokers[0].Password.Value())
+	assert.NotEmpty(t, subConf.Brokers[0].CACert)
+	assert.Equal(t, []string{"vessels/+/navigation/#"}, subConf.Brokers[0].Topics["nav"])
+	assert.Equal(t, DefaultBrokerName, subConf.RepostBroker)
+	assert.True(t, subConf.Brokers[0].CleanSession)
+	assert.Empty(t, subConf.Brokers[0].ClientID)
+	assert.Empty(t, subConf.Brokers[0].StoreDir)
 	assert.True(t, subConf.Repost)
 	assert.Equal(t, "test/", subConf.RepostRootTopic)
 	assert.Equal(t, uint(1000), subConf.PublishTimeout)
-	assert.Equal(t, []string{"ble/temperature"}, subConf.BLETopics)
-	assert.Equal(t, []string{"rtd/temperature"}, subConf.PHYTopics)
-	assert.Equal(t, []string{"esp/status"}, subConf.ESPTopics)
-	assert.Equal(t, []string{"vessels/+/navigation/#"}, subConf.NavTopics)
-	assert.Equal(t, []string{"vessels/+/gnss/#"}, subConf.GNSSTopics)
-	assert.Equal(t, []string{"vessels/+/steering/#"}, subConf.SteeringTopics)
-	assert.Equal(t, []string{"vessels/+/environment/wind/#"}, subConf.WindTopics)
-	assert.Equal(t, []string{"vessels/+/environment/water/#"}, subConf.WaterTopics)
-	assert.Equal(t, []string{"vessels/+/environment/outside/#"}, subConf.OutsideTopics)
-	assert.Equal(t, []string{"vessels/+/propulsion/#"}, subConf.PropulsionTopics)
+	assert.Equal(t, []string{"ble/temperature"}, subConf.Categories["ble"].Topics)
+	assert.Equal(t, []string{"rtd/temperature"}, subConf.Categories["phy"].Topics)
+	assert.Equal(t, []string{"esp/status"}, subConf.Categories["esp"].Topics)
+	assert.Equal(t, []string{"vessels/+/navigation/#"}, subConf.Categories["nav"].Topics)
+	assert.Equal(t, []string{"vessels/+/gnss/#"}, subConf.Categories["gnss"].Topics)
+	assert.Equal(t, []string{"vessels/+/steering/#"}, subConf.Categories["steering"].Topics)
+	assert.Equal(t, []string{"vessels/+/environment/wind/#"}, subConf.Categories["wind"].Topics)
+	assert.Equal(t, []string{"vessels/+/environment/water/#"}, subConf.Categories["water"].Topics)
+	assert.Equal(t, []string{"vessels/+/environment/outside/#"}, subConf.Categories["outside"].Topics)
+	assert.Equal(t, []string{"vessels/+/propulsion/#"}, subConf.Categories["propulsion"].Topics)
+	assert.False(t, subConf.Categories["ble"].Subscribed)
+	assert.True(t, subConf.Categories["ble"].Verbose)
+	assert.True(t, subConf.Categories["nav"].Subscribed)
+	// Categories without topics are still present so their switches can be read
+	assert.Empty(t, subConf.Categories["tank"].Topics)
+	assert.True(t, subConf.Categories["tank"].Subscribed)
+	assert.False(t, subConf.Categories["ais"].Verbose)
 	assert.Equal(t, map[string]string{
 		"aa:bb:cc:dd:ee:ff": "Engine Room",
 		"11:22:33:44:55:66": "Cabin",
@@ -273,7 +288,7 @@ func TestLoadSubscribeServerConfig(t *testing.T) {
 	assert.True(t, subConf.InfluxEnabled)
 	assert.Equal(t, "myorg", subConf.InfluxOrg)
 	assert.Equal(t, "mybucket", subConf.InfluxBucket)
-	assert.Equal(t, "mytoken", subConf.InfluxToken)
+	assert.Equal(t, "mytoken", subConf.InfluxToken.Value())
 	assert.Equal(t, "http://localhost:8086", subConf.InfluxUrl)
 
 	// Test missing subscription
@@ -345,3 +360,776 @@ func TestLoadSubscribeServerConfig(t *testing.T) {
 	assert.NoError(t, err) // Should not error, just warn
 	cleanup()              // Final cleanup
 }
+
+func TestLoadPassageConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	// Defaults when the section is missing
+	passageConf := LoadPassageConfig()
+	assert.False(t, passageConf.Enabled)
+	assert.Equal(t, 2.0, passageConf.StartSOG)
+	assert.Equal(t, uint(600), passageConf.StopSeconds)
+	assert.Equal(t, "./", LoadDataDir())
+
+	viper.Set("subscription.data-dir", "/var/lib/msh")
+	viper.Set("subscription.passage.enabled", true)
+	viper.Set("subscription.passage.start-sog", 3.5)
+	viper.Set("subscription.passage.start-seconds", 30)
+	viper.Set("subscription.passage.stop-sog", 0.3)
+	viper.Set("subscription.passage.stop-seconds", 900)
+	viper.Set("subscription.passage.track-interval", 10)
+	viper.Set("subscription.passage.track-distance", 25.0)
+	passageConf = LoadPassageConfig()
+	assert.True(t, passageConf.Enabled)
+	assert.Equal(t, 3.5, passageConf.StartSOG)
+	assert.Equal(t, uint(30), passageConf.StartSeconds)
+	assert.Equal(t, 0.3, passageConf.StopSOG)
+	assert.Equal(t, uint(900), passageConf.StopSeconds)
+	assert.Equal(t, uint(10), passageConf.TrackInterval)
+	assert.Equal(t, 25.0, passageConf.TrackDistance)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/lib/msh", subConf.DataDir)
+	assert.Equal(t, passageConf, subConf.Passage)
+}
+
+func TestLoadFuelConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	fuelConf := LoadFuelConfig()
+	assert.False(t, fuelConf.Enabled)
+	assert.Equal(t, uint(10), fuelConf.PublishInterval)
+	assert.Equal(t, uint(1800), fuelConf.TripGap)
+	assert.Empty(t, fuelConf.TankCapacity)
+
+	viper.Set("subscription.fuel.enabled", true)
+	viper.Set("subscription.fuel.publish-interval", 30)
+	viper.Set("subscription.fuel.trip-gap", 600)
+	viper.Set("subscription.fuel.tank-capacity", map[string]any{"0": 150, "1": "invalid"})
+	viper.Set("subscription.tankTopics", []string{"vessels/+/tanks/fuel/#"})
+	fuelConf = LoadFuelConfig()
+	assert.True(t, fuelConf.Enabled)
+	assert.Equal(t, uint(30), fuelConf.PublishInterval)
+	assert.Equal(t, uint(600), fuelConf.TripGap)
+	assert.Equal(t, map[string]float64{"0": 150}, fuelConf.TankCapacity)
+
+	viper.Set("subscription.fuel.publish-interval", 0)
+	assert.Equal(t, uint(10), LoadFuelConfig().PublishInterval, "A zero interval falls back to the default")
+	viper.Set("subscription.fuel.publish-interval", 30)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, fuelConf, subConf.Fuel)
+	assert.Equal(t, []string{"vessels/+/tanks/fuel/#"}, subConf.Categories["tank"].Topics)
+	assert.True(t, subConf.Categories["tank"].Subscribed)
+}
+
+func TestLoadEngineConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	engineConf := LoadEngineConfig()
+	assert.False(t, engineConf.Enabled)
+	assert.Equal(t, int64(300), engineConf.StartRPM)
+	assert.Equal(t, int64(1200), engineConf.UnderwayRPM)
+	assert.Equal(t, uint(60), engineConf.StopTimeout)
+	assert.Equal(t, 6.0, engineConf.RunTimeTolerance)
+
+	viper.Set("subscription.engine.enabled", true)
+	viper.Set("subscription.engine.start-rpm", 400)
+	viper.Set("subscription.engine.underway-rpm", 1500)
+	viper.Set("subscription.engine.stop-timeout", 120)
+	viper.Set("subscription.engine.runtime-tolerance", 12.0)
+	engineConf = LoadEngineConfig()
+	assert.True(t, engineConf.Enabled)
+	assert.Equal(t, int64(400), engineConf.StartRPM)
+	assert.Equal(t, int64(1500), engineConf.UnderwayRPM)
+	assert.Equal(t, uint(120), engineConf.StopTimeout)
+	assert.Equal(t, 12.0, engineConf.RunTimeTolerance)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, engineConf, subConf.Engine)
+}
+
+func TestLoadMaintenanceConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	maintConf := LoadMaintenanceConfig()
+	assert.False(t, maintConf.Enabled)
+	assert.Equal(t, uint(3600), maintConf.PublishInterval)
+	assert.Equal(t, 10.0, maintConf.WarnHours)
+	assert.Equal(t, uint(14), maintConf.WarnDays)
+	assert.Empty(t, maintConf.Items)
+
+	viper.Set("subscription.maintenance.enabled", true)
+	viper.Set("subscription.maintenance.warn-days", 30)
+	viper.Set("subscription.maintenance.items", map[string]interface{}{
+		"oil-change": map[string]interface{}{"hours": 100, "engine": "port"},
+		"impeller":   map[string]interface{}{"hours": 300, "months": 12},
+		"broken":     map[string]interface{}{"engine": "port"},
+	})
+	viper.Set("subscription.maintenance.publish-interval", 0)
+	viper.Set("subscription.api.listen", ":8080")
+	maintConf = LoadMaintenanceConfig()
+	assert.True(t, maintConf.Enabled)
+	assert.Equal(t, uint(3600), maintConf.PublishInterval, "A zero interval falls back to the default")
+	assert.Equal(t, uint(30), maintConf.WarnDays)
+	assert.Equal(t, []MaintenanceItem{
+		{Name: "impeller", Hours: 300, Months: 12},
+		{Name: "oil-change", Engine: "port", Hours: 100},
+	}, maintConf.Items)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, maintConf, subConf.Maintenance)
+	assert.Equal(t, ":8080", subConf.API.Listen)
+}
+
+func TestLoadAPIConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	apiConf, err := LoadAPIConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, APIConfig{}, apiConf, "The API is off unless configured")
+
+	viper.Set("subscription.api.token", "")
+	apiConf, err = LoadAPIConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:8080", apiConf.Listen)
+
+	t.Setenv("MSH_TEST_API_TOKEN", "s3cret")
+	viper.Set("subscription.api.listen", ":9090")
+	viper.Set("subscription.api.token", "${MSH_TEST_API_TOKEN}")
+	apiConf, err = LoadAPIConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, ":9090", apiConf.Listen)
+	assert.Equal(t, "s3cret", apiConf.Token.Value())
+}
+
+func TestLoadAnchorConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	anchorConf := LoadAnchorConfig()
+	assert.False(t, anchorConf.Enabled)
+	assert.Equal(t, "msh/command/anchor", anchorConf.CommandTopic)
+	assert.Equal(t, 50.0, anchorConf.Radius)
+	assert.Equal(t, uint(30), anchorConf.AlarmSeconds)
+	assert.Equal(t, uint(10), anchorConf.PublishInterval)
+	assert.Equal(t, 5.0, anchorConf.MaxHDOP)
+	assert.Equal(t, int64(4), anchorConf.MinSatellites)
+
+	viper.Set("subscription.anchor.enabled", true)
+	viper.Set("subscription.anchor.command-topic", "boat/anchor")
+	viper.Set("subscription.anchor.radius", 75)
+	viper.Set("subscription.anchor.alarm-seconds", 60)
+	viper.Set("subscription.anchor.publish-interval", 5)
+	viper.Set("subscription.anchor.max-hdop", 3.5)
+	viper.Set("subscription.anchor.min-satellites", 6)
+	anchorConf = LoadAnchorConfig()
+	assert.True(t, anchorConf.Enabled)
+	assert.Equal(t, "boat/anchor", anchorConf.CommandTopic)
+	assert.Equal(t, 75.0, anchorConf.Radius)
+	assert.Equal(t, uint(60), anchorConf.AlarmSeconds)
+	assert.Equal(t, uint(5), anchorConf.PublishInterval)
+	assert.Equal(t, 3.5, anchorConf.MaxHDOP)
+	assert.Equal(t, int64(6), anchorConf.MinSatellites)
+
+	viper.Set("subscription.anchor.publish-interval", 0)
+	assert.Equal(t, uint(10), LoadAnchorConfig().PublishInterval, "A zero interval falls back to the default")
+	viper.Set("subscription.anchor.publish-interval", 5)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, anchorConf, subConf.Anchor)
+}
+
+func TestLoadGeofenceConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	fenceConf := LoadGeofenceConfig()
+	assert.False(t, fenceConf.Enabled)
+	assert.Empty(t, fenceConf.Zones)
+
+	viper.Set("subscription.geofence.enabled", true)
+	viper.Set("subscription.geofence.zones", map[string]interface{}{
+		"no-wake": map[string]interface{}{"lat": 37.81, "lon": -122.41, "radius": 200},
+		"home-marina": map[string]interface{}{"polygon": []interface{}{
+			[]interface{}{37.80, -122.42},
+			[]interface{}{37.80, -122.40},
+			[]interface{}{37.82, -122.40},
+		}},
+		"no-shape":    map[string]interface{}{"lat": 37.81},
+		"bad-polygon": map[string]interface{}{"polygon": []interface{}{[]interface{}{37.80}}},
+		"too-short":   map[string]interface{}{"polygon": []interface{}{[]interface{}{37.80, -122.42}}},
+	})
+	fenceConf = LoadGeofenceConfig()
+	assert.True(t, fenceConf.Enabled)
+	assert.Equal(t, []GeofenceZone{
+		{
+			Name: "home-marina",
+			Polygon: []GeoPoint{
+				{Lat: 37.80, Lon: -122.42},
+				{Lat: 37.80, Lon: -122.40},
+				{Lat: 37.82, Lon: -122.40},
+			},
+		},
+		{Name: "no-wake", Lat: 37.81, Lon: -122.41, Radius: 200},
+	}, fenceConf.Zones)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, fenceConf, subConf.Geofence)
+}
+
+func TestLoadAISConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	aisConf := LoadAISConfig()
+	assert.Equal(t, uint(600), aisConf.TargetTimeout)
+	assert.Equal(t, uint(30), aisConf.OwnTimeout)
+	assert.Equal(t, uint(30), aisConf.PublishInterval)
+	assert.Equal(t, 0.5, aisConf.CPAWarnNM)
+	assert.Equal(t, 15.0, aisConf.TCPAWarnMinutes)
+
+	viper.Set("subscription.ais.target-timeout", 300)
+	viper.Set("subscription.ais.own-timeout", 60)
+	viper.Set("subscription.ais.publish-interval", 10)
+	viper.Set("subscription.ais.cpa-warn", 1.0)
+	viper.Set("subscription.ais.tcpa-warn", 20)
+	viper.Set("subscription.aisTopics", []string{"vessels/+/navigation/#"})
+	viper.Set("subscription.verbose-topic-logging", map[string]any{"ais": true})
+	aisConf = LoadAISConfig()
+	assert.Equal(t, uint(300), aisConf.TargetTimeout)
+	assert.Equal(t, uint(60), aisConf.OwnTimeout)
+	assert.Equal(t, uint(10), aisConf.PublishInterval)
+	assert.Equal(t, 1.0, aisConf.CPAWarnNM)
+	assert.Equal(t, 20.0, aisConf.TCPAWarnMinutes)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, aisConf, subConf.AIS)
+
+	viper.Set("subscription.ais.publish-interval", 0)
+	assert.Equal(t, uint(30), LoadAISConfig().PublishInterval, "A zero interval falls back to the default")
+	assert.Equal(t, []string{"vessels/+/navigation/#"}, subConf.Categories["ais"].Topics)
+	assert.True(t, subConf.Categories["ais"].Subscribed)
+	assert.True(t, subConf.Categories["ais"].Verbose)
+}
+
+func TestLoadTLSOptions(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+	certFile, keyFile := writeTestKeyPair(t, t.TempDir())
+
+	viper.Set("subscription.brokers.cloud", map[string]any{
+		"server":          "ssl://mqtt.example.com:8883",
+		"certfile":        certFile,
+		"keyfile":         keyFile,
+		"server-name":     "broker.example.com",
+		"tls-min-version": "1.3",
+	})
+	viper.Set("subscription.tls-min-version", 1.0)
+	viper.Set("subscription.insecure", true)
+	viper.Set("subscription.influxdb.cafile", certFile)
+	viper.Set("subscription.influxdb.tls-min-version", "1.2")
+	viper.Set("pubservers.ssl://localhost:8883.certfile", certFile)
+	viper.Set("pubservers.ssl://localhost:8883.keyfile", keyFile)
+	subConf, err := LoadSubscribeServerConfig()
+	require.NoError(t, err)
+	require.Len(t, subConf.Brokers, 2)
+	assert.Equal(t, TLSOptions{MinVersion: tls.VersionTLS10, Insecure: true}, subConf.Brokers[0].TLS)
+	cloudTLS := subConf.Brokers[1].TLS
+	assert.Equal(t, certFile, cloudTLS.CertFile)
+	assert.Equal(t, keyFile, cloudTLS.KeyFile)
+	assert.Equal(t, "broker.example.com", cloudTLS.ServerName)
+	assert.Equal(t, uint16(tls.VersionTLS13), cloudTLS.MinVersion)
+	assert.NotNil(t, cloudTLS.certificate, "the certificate is loaded with the config")
+	assert.NotEmpty(t, subConf.InfluxCACert)
+	assert.Equal(t, TLSOptions{MinVersion: tls.VersionTLS12}, subConf.InfluxTLS)
+
+	destinations, err := LoadPublishServerConfig()
+	require.NoError(t, err)
+	for _, dest := range destinations {
+		if dest.Host == "ssl://localhost:8883" {
+			assert.Equal(t, certFile, dest.TLS.CertFile)
+		} else {
+			assert.Empty(t, dest.TLS)
+		}
+	}
+
+	// A certificate without its key is refused
+	viper.Set("subscription.brokers.cloud.keyfile", "")
+	_, err = LoadSubscribeServerConfig()
+	assert.ErrorContains(t, err, "certfile and keyfile must be set together")
+
+	// As is a key that cannot be read
+	viper.Set("subscription.brokers.cloud.keyfile", filepath.Join(t.TempDir(), "missing.key"))
+	_, err = LoadSubscribeServerConfig()
+	assert.ErrorContains(t, err, "unable to load client certificate")
+
+	// Or one that is not a key
+	viper.Set("subscription.brokers.cloud.keyfile", certFile)
+	_, err = LoadSubscribeServerConfig()
+	assert.ErrorContains(t, err, "unable to load client certificate")
+
+	viper.Set("subscription.brokers.cloud.keyfile", keyFile)
+	viper.Set("subscription.brokers.cloud.tls-min-version", "2.0")
+	_, err = LoadSubscribeServerConfig()
+	assert.ErrorContains(t, err, "invalid tls-min-version")
+}
+
+func TestLoadDaemonStatusConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	statusConf := LoadDaemonStatusConfig()
+	assert.True(t, statusConf.Enabled)
+	assert.Equal(t, uint(60), statusConf.PublishInterval)
+
+	viper.Set("subscription.daemon-status.enabled", false)
+	viper.Set("subscription.daemon-status.publish-interval", 0)
+	statusConf = LoadDaemonStatusConfig()
+	assert.False(t, statusConf.Enabled)
+	// A zero interval would stop the ticker so the default is kept
+	assert.Equal(t, uint(60), statusConf.PublishInterval)
+
+	viper.Set("subscription.daemon-status.publish-interval", 300)
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, DaemonStatusConfig{Enabled: false, PublishInterval: 300}, subConf.DaemonStatus)
+}
+
+func TestLoadBaroConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	baroConf := LoadBaroConfig()
+	assert.False(t, baroConf.Enabled)
+	assert.Equal(t, 3.0, baroConf.FallingFast)
+	assert.Equal(t, uint(300), baroConf.PublishInterval)
+
+	viper.Set("subscription.barometer.enabled", true)
+	viper.Set("subscription.barometer.falling-fast", 4.5)
+	viper.Set("subscription.barometer.publish-interval", 60)
+	baroConf = LoadBaroConfig()
+	assert.True(t, baroConf.Enabled)
+	assert.Equal(t, 4.5, baroConf.FallingFast)
+	assert.Equal(t, uint(60), baroConf.PublishInterval)
+
+	viper.Set("subscription.barometer.publish-interval", 0)
+	assert.Equal(t, uint(300), LoadBaroConfig().PublishInterval, "A zero interval falls back to the default")
+	viper.Set("subscription.barometer.publish-interval", 60)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, baroConf, subConf.Barometer)
+}
+
+func TestLoadComfortConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	comfortConf := LoadComfortConfig()
+	assert.False(t, comfortConf.Enabled)
+	assert.Equal(t, "outside", comfortConf.Surface)
+	assert.Equal(t, 5.0, comfortConf.MarginF)
+	assert.Equal(t, uint(1800), comfortConf.ProxyMaxAge)
+
+	viper.Set("subscription.comfort.enabled", true)
+	viper.Set("subscription.comfort.surface", "water")
+	viper.Set("subscription.comfort.margin", 3.5)
+	viper.Set("subscription.comfort.proxy-max-age", 600)
+	comfortConf = LoadComfortConfig()
+	assert.True(t, comfortConf.Enabled)
+	assert.Equal(t, "water", comfortConf.Surface)
+	assert.Equal(t, 3.5, comfortConf.MarginF)
+	assert.Equal(t, uint(600), comfortConf.ProxyMaxAge)
+
+	viper.Set("subscription.comfort.surface", "hull")
+	assert.Equal(t, "outside", LoadComfortConfig().Surface)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, LoadComfortConfig(), subConf.Comfort)
+}
+
+func TestLoadRefrigerationConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	refrigConf := LoadRefrigerationConfig()
+	assert.False(t, refrigConf.Enabled)
+	assert.Equal(t, 0.5, refrigConf.Hysteresis)
+	assert.Equal(t, 2.0, refrigConf.DoorRiseRate)
+	assert.Equal(t, uint(120), refrigConf.PulldownMinutes)
+	assert.Equal(t, 70.0, refrigConf.DutyWarnPct)
+	assert.Empty(t, refrigConf.Units)
+
+	viper.Set("subscription.refrigeration.enabled", true)
+	viper.Set("subscription.refrigeration.hysteresis", 1.0)
+	viper.Set("subscription.refrigeration.door-rise-rate", 3.0)
+	viper.Set("subscription.refrigeration.pulldown-minutes", 60)
+	viper.Set("subscription.refrigeration.duty-warn", 80.0)
+	viper.Set("subscription.refrigeration.units", map[string]any{
+		"Fridge":  map[string]any{"type": "fridge"},
+		"Freezer": map[string]any{"type": "freezer", "max-temp": 5.0},
+		"Salon":   map[string]any{"type": "cabin"},
+	})
+	refrigConf = LoadRefrigerationConfig()
+	assert.True(t, refrigConf.Enabled)
+	assert.Equal(t, 1.0, refrigConf.Hysteresis)
+	assert.Equal(t, 3.0, refrigConf.DoorRiseRate)
+	assert.Equal(t, uint(60), refrigConf.PulldownMinutes)
+	assert.Equal(t, 80.0, refrigConf.DutyWarnPct)
+	assert.Equal(t, []RefrigUnitConfig{
+		{Name: "freezer", Type: "freezer", MaxTempF: 5.0},
+		{Name: "fridge", Type: "fridge", MaxTempF: 40.0},
+	}, refrigConf.Units)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, refrigConf, subConf.Refrigeration)
+}
+
+func TestLoadFilterConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	filterConf := LoadFilterConfig()
+	assert.False(t, filterConf.Enabled)
+	assert.False(t, filterConf.LogRejects)
+	assert.Equal(t, uint(300), filterConf.PublishInterval)
+	assert.Empty(t, filterConf.Rules)
+
+	viper.Set("subscription.filter.enabled", true)
+	viper.Set("subscription.filter.log-rejects", true)
+	viper.Set("subscription.filter.publish-interval", 60)
+	viper.Set("subscription.filter.rules", map[string]any{
+		"water": map[string]any{
+			"DepthUnderTransducerFt": map[string]any{"min": 0.5, "max": 1000, "max-rate": 10},
+		},
+		"bleTemperature": map[string]any{
+			"TempF":    map[string]any{"window": 5, "hampel": 3},
+			"Humidity": map[string]any{"median": true},
+		},
+	})
+	filterConf = LoadFilterConfig()
+	assert.True(t, filterConf.Enabled)
+	assert.True(t, filterConf.LogRejects)
+	assert.Equal(t, uint(60), filterConf.PublishInterval)
+	// Humidity is dropped since a median needs a window
+	assert.Equal(t, []FilterRule{
+		{Measurement: "bletemperature", Field: "tempf", Window: 5, Hampel: 3},
+		{Measurement: "water", Field: "depthundertransducerft", Min: floatPtr(0.5), Max: floatPtr(1000), MaxRate: 10},
+	}, filterConf.Rules)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, filterConf, subConf.Filter)
+
+	viper.Set("subscription.filter.publish-interval", 0)
+	assert.Equal(t, uint(300), LoadFilterConfig().PublishInterval, "A zero interval falls back to the default")
+}
+
+func TestLoadMappingConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Empty(t, subConf.Categories["mapped"].Topics)
+	assert.True(t, subConf.Categories["mapped"].Subscribed)
+	assert.False(t, subConf.Categories["mapped"].Verbose)
+	assert.Empty(t, subConf.Mappings)
+
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	err = os.WriteFile(path, []byte("mappings:\n  - path: electrical.batteries.*.voltage\n    measurement: electrical\n    field: Voltage\n"), 0644)
+	assert.NoError(t, err)
+	viper.Set("subscription.mapping-file", path)
+	viper.Set("subscription.mappedTopics", []string{"vessels/self/electrical/#"})
+	viper.Set("subscription.topic-overrides", map[string]any{"mapped": false})
+	viper.Set("subscription.verbose-topic-logging", map[string]any{"mapped": true})
+	subConf, err = LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"vessels/self/electrical/#"}, subConf.Categories["mapped"].Topics)
+	assert.False(t, subConf.Categories["mapped"].Subscribed)
+	assert.True(t, subConf.Categories["mapped"].Verbose)
+	assert.Equal(t, []PathMapping{{Path: "electrical.batteries.*.voltage", Measurement: "electrical", Field: "Voltage"}}, subConf.Mappings)
+
+	viper.Set("subscription.mapping-file", filepath.Join(t.TempDir(), "missing.yaml"))
+	_, err = LoadSubscribeServerConfig()
+	assert.Error(t, err)
+}
+
+func TestLoadSourceConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	sourceConf := LoadSourceConfig()
+	assert.Equal(t, uint(10), sourceConf.StaleAfter)
+	assert.Equal(t, "best", sourceConf.BestSource)
+	assert.Equal(t, map[string][]string{"navigation": {"venus.com.victronenergy.gps."}}, sourceConf.Exclude)
+	assert.Empty(t, sourceConf.Priority)
+
+	viper.Set("subscription.sources.stale-after", 30)
+	viper.Set("subscription.sources.best-source", "primary")
+	viper.Set("subscription.sources.exclude", map[string]any{"gnss": []string{"ais."}})
+	viper.Set("subscription.sources.priority", map[string]any{
+		"navigation": map[string]any{
+			"position": []string{"GPS", "Backup GPS"},
+			"*":        []string{"Compass"},
+			"log":      []string{},
+		},
+	})
+	sourceConf = LoadSourceConfig()
+	assert.Equal(t, uint(30), sourceConf.StaleAfter)
+	assert.Equal(t, "primary", sourceConf.BestSource)
+	assert.Equal(t, map[string][]string{"gnss": {"ais."}}, sourceConf.Exclude)
+	assert.Equal(t, []SourcePriority{
+		{Measurement: "navigation", Field: "*", Sources: []string{"Compass"}},
+		{Measurement: "navigation", Field: "position", Sources: []string{"GPS", "Backup GPS"}},
+	}, sourceConf.Priority)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, sourceConf, subConf.Sources)
+}
+
+func TestLoadAggregationConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	assert.Empty(t, LoadAggregationConfig().Policies)
+
+	viper.Set("subscription.aggregation", map[string]any{
+		"wind":       map[string]any{"interval": 1, "functions": []string{"mean", "min", "max"}, "angles": []string{"AngleApp", "DirectionTrue"}},
+		"gnss":       map[string]any{"interval": 10, "functions": []string{"last"}, "keep-raw": true},
+		"navigation": map[string]any{"interval": 5},
+		"steering":   map[string]any{"functions": []string{"mean"}},
+		"water":      map[string]any{"interval": 5, "functions": []string{"median"}},
+	})
+	aggConf := LoadAggregationConfig()
+	// Steering has no interval and water asks for an unknown function
+	assert.Equal(t, []AggregationPolicy{
+		{Measurement: "gnss", Interval: 10, Functions: []string{"last"}, KeepRaw: true},
+		{Measurement: "navigation", Interval: 5, Functions: []string{"mean"}},
+		{Measurement: "wind", Interval: 1, Functions: []string{"mean", "min", "max"}, Angles: []string{"AngleApp", "DirectionTrue"}},
+	}, aggConf.Policies)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, aggConf, subConf.Aggregation)
+}
+
+func TestLoadDeadbandConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	assert.Empty(t, LoadDeadbandConfig().Policies)
+
+	viper.Set("subscription.deadband", map[string]any{
+		"espStatus": map[string]any{
+			"max-silence": 600,
+			"fields": map[string]any{
+				"FreeHeap": map[string]any{"percent": 5},
+				"FreeSRAM": map[string]any{"absolute": 1024},
+			},
+		},
+		"steering": map[string]any{"fields": map[string]any{}},
+	})
+	deadbandConf := LoadDeadbandConfig()
+	assert.Equal(t, []DeadbandPolicy{
+		{Measurement: "espstatus", MaxSilence: 600, Fields: map[string]DeadbandField{
+			"freeheap": {Percent: 5},
+			"freesram": {Absolute: 1024},
+		}},
+		{Measurement: "steering", MaxSilence: 300, Fields: map[string]DeadbandField{}},
+	}, deadbandConf.Policies)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, deadbandConf, subConf.Deadband)
+}
+
+func TestLoadBrokerConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	brokers, err := LoadBrokerConfig()
+	assert.NoError(t, err)
+	assert.Empty(t, brokers)
+
+	viper.Set("subscription.brokers", map[string]any{
+		"hub": map[string]any{
+			"server":    "tcp://hub.local:1883",
+			"bleTopics": []string{"ble/temperature"},
+			"espTopics": []string{"esp/status"},
+		},
+		"cerbo": map[string]any{
+			"server":     "tcp://venus.local:1883",
+			"username":   "cerbo",
+			"root-topic": "N/c0619ab12345/",
+			"navTopics":  []string{"vessels/self/navigation/#"},
+		},
+	})
+	brokers, err = LoadBrokerConfig()
+	assert.NoError(t, err)
+	assert.Len(t, brokers, 2)
+	assert.Equal(t, "cerbo", brokers[0].Name)
+	assert.Equal(t, "cerbo", brokers[0].Username)
+	assert.Equal(t, map[string][]string{"nav": {"N/c0619ab12345/vessels/self/navigation/#"}}, brokers[0].Topics)
+	assert.Equal(t, "hub", brokers[1].Name)
+	assert.Equal(t, "tcp://hub.local:1883", brokers[1].Host)
+	assert.Equal(t, map[string][]string{"ble": {"ble/temperature"}, "esp": {"esp/status"}}, brokers[1].Topics)
+
+	// The legacy server comes first and is the repost broker unless one is named
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Len(t, subConf.Brokers, 3)
+	assert.Equal(t, DefaultBrokerName, subConf.Brokers[0].Name)
+	assert.Equal(t, DefaultBrokerName, subConf.RepostBroker)
+
+	viper.Set("subscription.repost-broker", "hub")
+	subConf, err = LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "tcp://hub.local:1883", subConf.RepostBrokerConfig().Host)
+
+	viper.Set("subscription.repost-broker", "missing")
+	_, err = LoadSubscribeServerConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "repost broker missing is not configured")
+	viper.Set("subscription.repost-broker", nil)
+
+	// Brokers alone are enough without the legacy server
+	viper.Set("subscription.server", nil)
+	subConf, err = LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Len(t, subConf.Brokers, 2)
+	assert.Equal(t, "cerbo", subConf.RepostBroker)
+
+	viper.Set("subscription.brokers.hub.server", "")
+	_, err = LoadBrokerConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no server set for broker hub")
+
+	viper.Set("subscription.brokers", map[string]any{"default": map[string]any{"server": "tcp://x:1883"}})
+	_, err = LoadBrokerConfig()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "reserved")
+}
+
+func TestLoadRepostConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+	brokers := []BrokerConfig{{Name: DefaultBrokerName}, {Name: "hub"}}
+
+	// Without destinations everything goes through the repost broker as before
+	destinations, err := LoadRepostConfig(brokers, "hub")
+	assert.NoError(t, err)
+	assert.Equal(t, []RepostDestination{{Name: DefaultBrokerName, Broker: "hub", Topic: DefaultRepostTopic}}, destinations)
+
+	viper.Set("subscription.repost-qos", 1)
+	viper.Set("subscription.repost-retained", true)
+	destinations, err = LoadRepostConfig(brokers, "hub")
+	assert.NoError(t, err)
+	assert.Equal(t, []RepostDestination{{Name: DefaultBrokerName, Broker: "hub", Topic: DefaultRepostTopic, QoS: 1, Retained: true}}, destinations)
+
+	viper.Set("subscription.repost-destinations", map[string]any{
+		"cloud": map[string]any{
+			"server":           "ssl://cloud.example.com:8883",
+			"username":         "boat",
+			"topic":            "boats/test/{{.Category}}/{{.Path}}",
+			"qos":              1,
+			"retained":         true,
+			"categories":       []string{"nav", "derived"},
+			"protocol-version": 5,
+			"message-expiry":   300,
+		},
+		"local": map[string]any{"qos": 7},
+	})
+	destinations, err = LoadRepostConfig(brokers, DefaultBrokerName)
+	assert.NoError(t, err)
+	assert.Equal(t, []RepostDestination{
+		{Name: "cloud", Host: "ssl://cloud.example.com:8883", Username: "boat", Topic: "boats/test/{{.Category}}/{{.Path}}",
+			QoS: 1, Retained: true, Categories: []string{"nav", "derived"}, ProtocolVersion: 5, MessageExpiry: 300},
+		{Name: "local", Broker: DefaultBrokerName, Topic: DefaultRepostTopic},
+	}, destinations)
+
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, destinations, subConf.RepostTargets)
+
+	viper.Set("subscription.repost-destinations.local.broker", "missing")
+	_, err = LoadRepostConfig(brokers, DefaultBrokerName)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown broker missing")
+
+	viper.Set("subscription.repost-destinations.local.broker", "hub")
+	viper.Set("subscription.repost-destinations.local.server", "tcp://x:1883")
+	_, err = LoadRepostConfig(brokers, DefaultBrokerName)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "sets both broker and server")
+
+	viper.Set("subscription.repost-destinations.local.server", "")
+	viper.Set("subscription.repost-destinations.local.topic", "{{.Device}}")
+	_, err = LoadRepostConfig(brokers, DefaultBrokerName)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid topic template for repost destination local")
+}
+
+func TestLoadBrokerSession(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	viper.Set("subscription.data-dir", "/var/lib/msh")
+	viper.Set("subscription.clean-session", false)
+	viper.Set("subscription.topic-qos", map[string]any{"nav": 1, "esp": 2, "wind": 5, "bogus": 1})
+	viper.Set("subscription.brokers", map[string]any{
+		"hub": map[string]any{
+			"server":           "tcp://hub.local:1883",
+			"client-id":        "boat-hub",
+			"clean-session":    false,
+			"protocol-version": 5,
+			"share-group":      "msh",
+		},
+		"cloud": map[string]any{"server": "tcp://cloud.local:1883", "client-id": "boat-cloud", "protocol-version": 6},
+	})
+	subConf, err := LoadSubscribeServerConfig()
+	assert.NoError(t, err)
+	require.Len(t, subConf.Brokers, 3)
+
+	// A persistent session without a client ID gets a stable one
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assert.False(t, subConf.Brokers[0].CleanSession)
+	assert.Equal(t, "marine-sensorhub-mqtt-"+hostname+"-default", subConf.Brokers[0].ClientID)
+	assert.Equal(t, filepath.Join("/var/lib/msh", "mqtt", "default"), subConf.Brokers[0].StoreDir)
+
+	assert.Equal(t, "cloud", subConf.Brokers[1].Name)
+	assert.True(t, subConf.Brokers[1].CleanSession)
+	assert.Equal(t, "boat-cloud", subConf.Brokers[1].ClientID)
+	assert.Empty(t, subConf.Brokers[1].StoreDir)
+
+	assert.False(t, subConf.Brokers[2].CleanSession)
+	assert.Equal(t, "boat-hub", subConf.Brokers[2].ClientID)
+	assert.Equal(t, filepath.Join("/var/lib/msh", "mqtt", "hub"), subConf.Brokers[2].StoreDir)
+	assert.Equal(t, uint(5), subConf.Brokers[2].ProtocolVersion)
+	assert.Equal(t, "msh", subConf.Brokers[2].ShareGroup)
+	// An unknown protocol version falls back to the default
+	assert.Equal(t, uint(0), subConf.Brokers[1].ProtocolVersion)
+	assert.Empty(t, subConf.Brokers[1].ShareGroup)
+
+	assert.Equal(t, byte(1), subConf.Categories["nav"].QoS)
+	assert.Equal(t, byte(2), subConf.Categories["esp"].QoS)
+	assert.Equal(t, byte(0), subConf.Categories["wind"].QoS)
+	assert.Equal(t, byte(0), subConf.Categories["gnss"].QoS)
+}
@@ -57,3 +57,19 @@ func CubicMetersPerSecondToGallonsPerMinute(cumps float64) float64 {
 func CubicMetersPerSecondToGallonsPerSecond(cumps float64) float64 {
 	return cumps * 264.172056
 }
+
+func MetersToNauticalMiles(m float64) float64 {
+	return m / 1852
+}
+
+func CubicMetersToGallons(cum float64) float64 {
+	return cum * 264.172056
+}
+
+func FahrenheitToCelsius(tempf float64) float64 {
+	return (tempf - 32) / 1.8
+}
+
+func CelsiusToFahrenheit(tempc float64) float64 {
+	return tempc*1.8 + 32
+}
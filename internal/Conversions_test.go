@@ -209,3 +209,79 @@ func TestCubicMetersPerSecondToGallonsPerSecond(t *testing.T) {
 		})
 	}
 }
+
+func TestMetersToNauticalMiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    float64
+		expected float64
+	}{
+		{"zero", 0, 0},
+		{"one_nm", 1852, 1},
+		{"ten_nm", 18520, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := MetersToNauticalMiles(tt.input)
+			assert.InDelta(t, tt.expected, result, 0.0001)
+		})
+	}
+}
+
+func TestCubicMetersToGallons(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    float64
+		expected float64
+	}{
+		{"zero", 0, 0},
+		{"one", 1, 264.172056},
+		{"half", 0.5, 132.086028},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CubicMetersToGallons(tt.input)
+			assert.InDelta(t, tt.expected, result, 0.0001)
+		})
+	}
+}
+
+func TestFahrenheitToCelsius(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    float64
+		expected float64
+	}{
+		{"freezing", 32, 0},
+		{"boiling", 212, 100},
+		{"minus_forty", -40, -40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := FahrenheitToCelsius(tt.input)
+			assert.InDelta(t, tt.expected, result, 0.0001)
+		})
+	}
+}
+
+func TestCelsiusToFahrenheit(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    float64
+		expected float64
+	}{
+		{"freezing", 0, 32},
+		{"boiling", 100, 212},
+		{"minus_forty", -40, -40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CelsiusToFahrenheit(tt.input)
+			assert.InDelta(t, tt.expected, result, 0.0001)
+		})
+	}
+}
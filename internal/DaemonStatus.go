@@ -0,0 +1,245 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DaemonOnline  = "online"
+	DaemonOffline = "offline"
+)
+
+// Kinds of errors counted in the daemon metrics
+const (
+	ErrorParse   = "parse"
+	ErrorInflux  = "influx"
+	ErrorPublish = "publish"
+)
+
+// DaemonVersion is set by the sub command from the build version
+var DaemonVersion = "dev"
+
+// DaemonInfo is published retained on the status topic
+// The same message with Status offline is registered as the Last Will so the broker reports a dead daemon
+type DaemonInfo struct {
+	Status  string    `json:"Status"`
+	Version string    `json:"Version"`
+	Host    string    `json:"Host"`
+	Started time.Time `json:"Started"`
+}
+
+// DaemonMetrics is published periodically on the metrics topic
+// InfluxBacklog counts the points waiting to be written, either in flight or held in aggregation windows
+type DaemonMetrics struct {
+	UptimeSeconds float64           `json:"UptimeSeconds"`
+	Messages      map[string]uint64 `json:"Messages"`
+	Errors        map[string]uint64 `json:"Errors"`
+	InfluxBacklog int               `json:"InfluxBacklog"`
+	Timestamp     time.Time         `json:"Timestamp"`
+}
+
+// DaemonStatus reports whether the daemon is running and how it is doing
+type DaemonStatus struct {
+	mu       sync.Mutex
+	conf     DaemonStatusConfig
+	root     string
+	info     DaemonInfo
+	messages map[string]uint64
+	errors   map[string]uint64
+}
+
+var SharedDaemonStatus *DaemonStatus
+
+// influxInFlight is the number of blocking InfluxDB writes that have not returned yet
+var influxInFlight atomic.Int64
+
+func NewDaemonStatus(conf DaemonStatusConfig, root string, version string) *DaemonStatus {
+	host, err := os.Hostname()
+	if err != nil {
+		log.Warn().Msgf("Error getting hostname: %v", err.Error())
+	}
+	return &DaemonStatus{
+		conf:     conf,
+		root:     root,
+		info:     DaemonInfo{Status: DaemonOnline, Version: version, Host: host, Started: time.Now()},
+		messages: make(map[string]uint64),
+		errors:   make(map[string]uint64),
+	}
+}
+
+// daemonTopic puts a subtopic under the repost root topic
+func (d *DaemonStatus) daemonTopic(subtopic string) string {
+	root := strings.TrimSuffix(d.root, "/")
+	if root == "" {
+		return "daemon/" + subtopic
+	}
+	return root + "/daemon/" + subtopic
+}
+
+// StatusTopic is where the retained online message and the Last Will go
+func (d *DaemonStatus) StatusTopic() string {
+	return d.daemonTopic("status")
+}
+
+// MetricsTopic is where the periodic metrics go
+func (d *DaemonStatus) MetricsTopic() string {
+	return d.daemonTopic("metrics")
+}
+
+// Info returns the status message for the given status
+func (d *DaemonStatus) Info(status string) DaemonInfo {
+	info := d.info
+	info.Status = status
+	return info
+}
+
+func (d *DaemonStatus) infoJSON(status string) string {
+	jsonData, err := json.Marshal(d.Info(status))
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+	}
+	return string(jsonData)
+}
+
+// SetWill registers the offline message as the Last Will on the repost broker
+// Only that broker gets it since it is also where the online message is published
+func (d *DaemonStatus) SetWill(brokers []BrokerConfig, repostBroker string) {
+	for i := range brokers {
+		if brokers[i].Name == repostBroker {
+			brokers[i].WillTopic = d.StatusTopic()
+			brokers[i].WillPayload = d.infoJSON(DaemonOffline)
+			return
+		}
+	}
+}
+
+// PublishOnline publishes the retained online message
+// It is sent on every connect since the broker publishes the Last Will whenever the connection drops
+func (d *DaemonStatus) PublishOnline(client MQTT.Client) {
+	log.Info().Msgf("Publishing daemon status to %v", d.StatusTopic())
+	publishClientMessage(client, d.StatusTopic(), d.infoJSON(DaemonOnline), false, byte(1), true, nil)
+}
+
+// CountMessage counts a message received for a category
+func (d *DaemonStatus) CountMessage(category string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.messages[category]++
+}
+
+// CountError counts an error of the given kind
+func (d *DaemonStatus) CountError(kind string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors[kind]++
+}
+
+// Metrics returns a snapshot of the counters
+func (d *DaemonStatus) Metrics(now time.Time) DaemonMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	metrics := DaemonMetrics{
+		UptimeSeconds: now.Sub(d.info.Started).Seconds(),
+		Messages:      make(map[string]uint64, len(d.messages)),
+		Errors:        make(map[string]uint64, len(d.errors)),
+		InfluxBacklog: influxBacklog(),
+		Timestamp:     now,
+	}
+	for category, count := range d.messages {
+		metrics.Messages[category] = count
+	}
+	for kind, count := range d.errors {
+		metrics.Errors[kind] = count
+	}
+	return metrics
+}
+
+func (d *DaemonStatus) publishMetrics(client MQTT.Client, now time.Time) {
+	jsonData, err := json.Marshal(d.Metrics(now))
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	publishClientMessage(client, d.MetricsTopic(), string(jsonData), false, byte(0), false, nil)
+}
+
+// Run publishes the metrics every publish interval
+func (d *DaemonStatus) Run(client MQTT.Client) {
+	ticker := time.NewTicker(time.Duration(d.conf.PublishInterval) * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		d.publishMetrics(client, now)
+	}
+}
+
+func (d *DaemonStatus) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/daemon", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, struct {
+			Info    DaemonInfo    `json:"Info"`
+			Metrics DaemonMetrics `json:"Metrics"`
+		}{d.Info(DaemonOnline), d.Metrics(time.Now())})
+	})
+}
+
+// countMessages wraps a category handler so every message it receives is counted
+func countMessages(category string, handler MQTT.MessageHandler) MQTT.MessageHandler {
+	return func(client MQTT.Client, message MQTT.Message) {
+		if SharedDaemonStatus != nil {
+			SharedDaemonStatus.CountMessage(category)
+		}
+		handler(client, message)
+	}
+}
+
+// countError counts an error when the daemon status is enabled
+func countError(kind string) {
+	if SharedDaemonStatus != nil {
+		SharedDaemonStatus.CountError(kind)
+	}
+}
+
+// writeInfluxPoint writes a point and keeps track of how many writes are waiting on InfluxDB
+func writeInfluxPoint(p *write.Point) error {
+	influxInFlight.Add(1)
+	defer influxInFlight.Add(-1)
+	err := SharedInfluxWriteAPI.WritePoint(context.Background(), p)
+	if err != nil {
+		countError(ErrorInflux)
+	}
+	return err
+}
+
+func influxBacklog() int {
+	backlog := int(influxInFlight.Load())
+	if SharedAggregator != nil {
+		backlog += SharedAggregator.Pending()
+	}
+	return backlog
+}
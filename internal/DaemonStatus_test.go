@@ -0,0 +1,149 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDaemonStatus(t *testing.T) *DaemonStatus {
+	cleanup := SetupTestEnvironment()
+	originalStatus := SharedDaemonStatus
+	originalAggregator := SharedAggregator
+	SharedDaemonStatus = NewDaemonStatus(DaemonStatusConfig{Enabled: true, PublishInterval: 60}, SharedSubscriptionConfig.RepostRootTopic, "1.2.3")
+	SharedAggregator = nil
+	t.Cleanup(func() {
+		SharedDaemonStatus = originalStatus
+		SharedAggregator = originalAggregator
+		cleanup()
+	})
+	return SharedDaemonStatus
+}
+
+func TestDaemonStatusTopics(t *testing.T) {
+	status := NewDaemonStatus(DaemonStatusConfig{}, "msh/", "1.2.3")
+	assert.Equal(t, "msh/daemon/status", status.StatusTopic())
+	assert.Equal(t, "msh/daemon/metrics", status.MetricsTopic())
+
+	status = NewDaemonStatus(DaemonStatusConfig{}, "", "1.2.3")
+	assert.Equal(t, "daemon/status", status.StatusTopic())
+}
+
+func TestDaemonStatusWill(t *testing.T) {
+	status := setupDaemonStatus(t)
+	brokers := []BrokerConfig{{Name: "cerbo"}, {Name: "hub"}}
+	status.SetWill(brokers, "hub")
+	assert.Empty(t, brokers[0].WillTopic)
+	assert.Equal(t, "test/daemon/status", brokers[1].WillTopic)
+
+	var will DaemonInfo
+	require.NoError(t, json.Unmarshal([]byte(brokers[1].WillPayload), &will))
+	assert.Equal(t, DaemonOffline, will.Status)
+	assert.Equal(t, "1.2.3", will.Version)
+	assert.Equal(t, status.info.Host, will.Host)
+	assert.WithinDuration(t, status.info.Started, will.Started, time.Millisecond)
+}
+
+func TestDaemonStatusOnline(t *testing.T) {
+	setupDaemonStatus(t)
+	SharedSubscriptionConfig.Brokers = []BrokerConfig{{Name: "cerbo"}, {Name: "hub"}}
+	originalSet := SharedBrokerSet
+	defer func() { SharedBrokerSet = originalSet }()
+	set, clients := mockBrokerSet(SharedSubscriptionConfig.Brokers)
+	SharedBrokerSet = set
+
+	// Only the repost broker carries the Last Will so only it gets the online message
+	set.brokers[1].onConnect(clients[1])
+	assert.Empty(t, clients[1].PublishedTo("test/daemon/status"))
+	set.brokers[0].onConnect(clients[0])
+	published := clients[0].PublishedTo("test/daemon/status")
+	require.Len(t, published, 1)
+	assert.Equal(t, byte(1), published[0].Qos)
+	assert.True(t, published[0].Retained)
+	var info DaemonInfo
+	require.NoError(t, json.Unmarshal([]byte(published[0].Payload.(string)), &info))
+	assert.Equal(t, DaemonOnline, info.Status)
+	assert.Equal(t, "1.2.3", info.Version)
+}
+
+func TestDaemonStatusMetrics(t *testing.T) {
+	status := setupDaemonStatus(t)
+	handled := 0
+	handler := countMessages("nav", func(client MQTT.Client, message MQTT.Message) { handled++ })
+	handler(nil, nil)
+	handler(nil, nil)
+	countMessages("wind", func(client MQTT.Client, message MQTT.Message) {})(nil, nil)
+	assert.Equal(t, 2, handled)
+
+	// Bad JSON is counted as a parse error
+	HandleSensorMessage(&MockMQTTClient{}, NewMockMessage("test/navigation/position", []byte("not json")), &MockSensorData{}, nil)
+
+	// Failed writes are counted as influx errors
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	mockWriteAPI.Err = errors.New("influx is down")
+	SharedInfluxWriteAPI = mockWriteAPI
+	WriteDerivedPoint(influxdb2.NewPointWithMeasurement("test").AddField("value", 1))
+
+	// Open aggregation windows are waiting to be written
+	SharedAggregator = NewAggregator(AggregationConfig{Policies: []AggregationPolicy{{Measurement: "test", Interval: 60, Functions: []string{AggregateMean}}}})
+	SharedAggregator.Add(influxdb2.NewPointWithMeasurement("test").AddField("value", 1.0).SetTime(time.Now()))
+
+	now := status.info.Started.Add(90 * time.Second)
+	metrics := status.Metrics(now)
+	assert.Equal(t, 90.0, metrics.UptimeSeconds)
+	assert.Equal(t, map[string]uint64{"nav": 2, "wind": 1}, metrics.Messages)
+	assert.Equal(t, map[string]uint64{ErrorParse: 1, ErrorInflux: 1}, metrics.Errors)
+	assert.Equal(t, 1, metrics.InfluxBacklog)
+
+	client := &MockMQTTClient{}
+	status.publishMetrics(client, now)
+	published := client.PublishedTo("test/daemon/metrics")
+	require.Len(t, published, 1)
+	assert.False(t, published[0].Retained)
+	var sent DaemonMetrics
+	require.NoError(t, json.Unmarshal([]byte(published[0].Payload.(string)), &sent))
+	assert.Equal(t, metrics.Messages, sent.Messages)
+	assert.Equal(t, metrics.Errors, sent.Errors)
+}
+
+func TestDaemonStatusAPI(t *testing.T) {
+	status := setupDaemonStatus(t)
+	status.CountMessage("nav")
+	mux := http.NewServeMux()
+	status.RegisterAPI(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/daemon", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Info    DaemonInfo
+		Metrics DaemonMetrics
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, DaemonOnline, body.Info.Status)
+	assert.Equal(t, uint64(1), body.Metrics.Messages["nav"])
+}
@@ -0,0 +1,143 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deadbandValue is the last value of a field that was passed on to the sinks
+type deadbandValue struct {
+	value any
+	sent  time.Time
+}
+
+// Deadband holds back readings that have not changed enough since the last one passed on
+type Deadband struct {
+	mu       sync.Mutex
+	policies []DeadbandPolicy
+	last     map[string]map[string]deadbandValue
+}
+
+var SharedDeadband *Deadband
+
+func NewDeadband(conf DeadbandConfig) *Deadband {
+	return &Deadband{
+		policies: conf.Policies,
+		last:     make(map[string]map[string]deadbandValue),
+	}
+}
+
+func (d *Deadband) policy(measurement string) *DeadbandPolicy {
+	for i := range d.policies {
+		if strings.EqualFold(d.policies[i].Measurement, measurement) {
+			return &d.policies[i]
+		}
+	}
+	return nil
+}
+
+// deadbandKey identifies a series by its measurement and tags so each source is tracked on its own
+func deadbandKey(data SensorData) string {
+	tags := data.GetInfluxTags()
+	parts := make([]string, 0, len(tags))
+	for k, v := range tags {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return data.GetMeasurementName() + "," + strings.Join(parts, ",")
+}
+
+// changed reports whether a value moved outside the field's deadband
+// Fields without a deadband pass on any change
+func (p *DeadbandPolicy) changed(field string, last any, value any) bool {
+	lastNum, lastOk := deadbandNumber(last)
+	num, ok := deadbandNumber(value)
+	if !lastOk || !ok {
+		return last != value
+	}
+	band, configured := p.Fields[strings.ToLower(field)]
+	if !configured {
+		return num != lastNum
+	}
+	diff := math.Abs(num - lastNum)
+	if band.Absolute > 0 && diff > band.Absolute {
+		return true
+	}
+	if band.Percent > 0 && diff > math.Abs(lastNum)*band.Percent/100 {
+		return true
+	}
+	return band.Absolute == 0 && band.Percent == 0 && diff != 0
+}
+
+func deadbandNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// Allow returns whether a reading should go to the sinks
+// It passes when any field moved outside its deadband or has not been sent for MaxSilence seconds
+func (d *Deadband) Allow(data SensorData) bool {
+	policy := d.policy(data.GetMeasurementName())
+	if policy == nil {
+		return true
+	}
+	fields := data.GetInfluxFields()
+	ts := data.GetTimestamp()
+	silence := time.Duration(policy.MaxSilence) * time.Second
+	key := deadbandKey(data)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	last, ok := d.last[key]
+	if !ok {
+		last = make(map[string]deadbandValue)
+		d.last[key] = last
+	}
+	allow := false
+	for field, value := range fields {
+		prev, seen := last[field]
+		if !seen || policy.changed(field, prev.value, value) || (silence > 0 && ts.Sub(prev.sent) >= silence) {
+			allow = true
+			break
+		}
+	}
+	if !allow {
+		return false
+	}
+	for field, value := range fields {
+		last[field] = deadbandValue{value: value, sent: ts}
+	}
+	return true
+}
+
+// deadbandAllows runs the shared deadband if one is configured
+func deadbandAllows(data SensorData) bool {
+	if SharedDeadband == nil {
+		return true
+	}
+	return SharedDeadband.Allow(data)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadbandAllow(t *testing.T) {
+	deadband := NewDeadband(DeadbandConfig{Policies: []DeadbandPolicy{
+		{Measurement: "tanks", MaxSilence: 60, Fields: map[string]DeadbandField{"levelpct": {Absolute: 1}}},
+		{Measurement: "espStatus", MaxSilence: 300, Fields: map[string]DeadbandField{"freeheap": {Percent: 5}}},
+		{Measurement: "steering", MaxSilence: 60},
+	}})
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tank := func(level float64, after time.Duration) *Tank {
+		tk := &Tank{BaseSensorData: BaseSensorData{Source: "Tank Sender", Timestamp: start.Add(after)}, Type: "fuel", Device: "0", LevelPct: level}
+		tk.MarkPresent("LevelPct")
+		return tk
+	}
+
+	assert.True(t, deadband.Allow(tank(50, 0)))
+	assert.False(t, deadband.Allow(tank(50.5, 5*time.Second)))
+	// Measured from the last value passed on, not the last reading
+	assert.False(t, deadband.Allow(tank(50.9, 10*time.Second)))
+	assert.True(t, deadband.Allow(tank(51.1, 15*time.Second)))
+	// The heartbeat goes out after MaxSilence even without a change
+	assert.False(t, deadband.Allow(tank(51.1, 74*time.Second)))
+	assert.True(t, deadband.Allow(tank(51.1, 75*time.Second)))
+
+	// Another tank is tracked on its own
+	other := tank(51.1, 76*time.Second)
+	other.Device = "1"
+	assert.True(t, deadband.Allow(other))
+
+	esp := func(heap int64) *ESPStatus {
+		return &ESPStatus{BaseSensorData: BaseSensorData{Timestamp: start}, MAC: "aa", FreeHeap: heap}
+	}
+	assert.True(t, deadband.Allow(esp(100000)))
+	assert.False(t, deadband.Allow(esp(104000)))
+	assert.True(t, deadband.Allow(esp(94000)))
+
+	// Fields without a deadband pass on any change, including text
+	steer := func(state string) *Steering {
+		st := &Steering{BaseSensorData: BaseSensorData{Source: "Autopilot", Timestamp: start}, AutopilotState: state}
+		st.MarkPresent("AutopilotState")
+		return st
+	}
+	assert.True(t, deadband.Allow(steer("standby")))
+	assert.False(t, deadband.Allow(steer("standby")))
+	assert.True(t, deadband.Allow(steer("auto")))
+
+	// Measurements without a policy always pass
+	wind := &Wind{BaseSensorData: BaseSensorData{Timestamp: start}, SpeedApp: 5}
+	assert.True(t, deadband.Allow(wind))
+	assert.True(t, deadband.Allow(wind))
+}
+
+func TestDeadbandSensorData(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+	SharedDeadband = NewDeadband(DeadbandConfig{Policies: []DeadbandPolicy{{Measurement: "tanks", MaxSilence: 600}}})
+	defer func() { SharedDeadband = nil }()
+
+	for _, payload := range []string{
+		`{"value": 0.5, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.000Z"}`,
+		`{"value": 0.5, "$source": "test-source", "timestamp": "2025-01-01T12:00:05.000Z"}`,
+		`{"value": 0.4, "$source": "test-source", "timestamp": "2025-01-01T12:00:10.000Z"}`,
+	} {
+		handleTankMessage(&MockMQTTClient{}, NewMockMessage("vessels/self/tanks/fuel/0/currentLevel", []byte(payload)))
+	}
+	points := pointsNamed(mockWriteAPI, "tanks")
+	require.Len(t, points, 2)
+	assert.Equal(t, 40.0, pointField(points[1], "LevelPct"))
+}
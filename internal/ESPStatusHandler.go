@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -44,9 +42,18 @@ type ESPStatus struct {
 	HasResetMQTT       bool   `json:"HasResetMQTT,omitempty"`
 }
 
+func init() {
+	RegisterCategory(Category{
+		Name:      "esp",
+		TopicsKey: "espTopics",
+		Handler:   OnESPStatusMessage,
+		NewData:   func() SensorData { return &ESPStatus{} },
+	})
+}
+
 // OnESPStatusMessage is called when an ESP status message is received
 func OnESPStatusMessage(client MQTT.Client, message MQTT.Message) {
-	go handleESPStatusMessage(client, message)
+	dispatchMessage(handleESPStatusMessage, client, message)
 }
 
 // handleESPStatusMessage processes ESP status messages
@@ -66,7 +73,7 @@ func handleESPStatusMessage(client MQTT.Client, message MQTT.Message) {
 
 // ToJSON serializes the data to JSON
 func (meas *ESPStatus) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -77,7 +84,7 @@ func (meas *ESPStatus) ToJSON() string {
 func (meas *ESPStatus) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("ESP Status: %v", json)
-	if SharedSubscriptionConfig.ESPLogEn {
+	if SharedSubscriptionConfig.Categories["esp"].Verbose {
 		log.Info().Msgf("ESP Status: %v", json)
 	}
 }
@@ -107,13 +114,13 @@ func (meas *ESPStatus) GetInfluxTags() map[string]string {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *ESPStatus) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.FreeSRAM != 0 {
+	if meas.FreeSRAM != 0 || meas.IsPresent("FreeSRAM") {
 		measTmp["FreeSRAM"] = meas.FreeSRAM
 	}
-	if meas.FreeHeap != 0 {
+	if meas.FreeHeap != 0 || meas.IsPresent("FreeHeap") {
 		measTmp["FreeHeap"] = meas.FreeHeap
 	}
-	if meas.FreePSRAM != 0 {
+	if meas.FreePSRAM != 0 || meas.IsPresent("FreePSRAM") {
 		measTmp["FreePSRAM"] = meas.FreePSRAM
 	}
 	// These being zero is a valid case so just always include them
@@ -139,7 +146,7 @@ func (meas *ESPStatus) GetInfluxFields() map[string]interface{} {
 	} else {
 		measTmp["HasResetMQTT"] = 0
 	}
-	if meas.WiFiRSSI != 0 {
+	if meas.WiFiRSSI != 0 || meas.IsPresent("WiFiRSSI") {
 		measTmp["WiFiRSSI"] = meas.WiFiRSSI
 	}
 	return measTmp
@@ -162,7 +169,12 @@ func (meas *ESPStatus) SetSource(source string) {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *ESPStatus) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.ESPLogEn
+	return SharedSubscriptionConfig.Categories["esp"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *ESPStatus) GetCategory() string {
+	return "esp"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
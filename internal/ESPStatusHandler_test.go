@@ -157,7 +157,7 @@ func TestESPStatusStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.ESPLogEn, espStatus.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["esp"].Verbose, espStatus.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := espStatus.ToInfluxPoint()
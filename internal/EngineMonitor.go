@@ -0,0 +1,301 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EngineStopped  = "stopped"
+	EngineIdle     = "idle"
+	EngineUnderway = "underway"
+)
+
+// EngineRunSummary is written and reposted when an engine run ends
+type EngineRunSummary struct {
+	Device          string    `json:"Device"`
+	Start           time.Time `json:"Start"`
+	End             time.Time `json:"End"`
+	DurationHours   float64   `json:"DurationHours"`
+	IdleHours       float64   `json:"IdleHours"`
+	UnderwayHours   float64   `json:"UnderwayHours"`
+	MaxRPM          int64     `json:"MaxRPM"`
+	AvgRPM          float64   `json:"AvgRPM"`
+	MaxCoolantTempF float64   `json:"MaxCoolantTempF,omitempty"`
+	MaxOilTempF     float64   `json:"MaxOilTempF,omitempty"`
+	FuelUsedGallons float64   `json:"FuelUsedGallons"`
+	MinAltVoltage   float64   `json:"MinAltVoltage,omitempty"`
+	MaxAltVoltage   float64   `json:"MaxAltVoltage,omitempty"`
+	ECUHours        float64   `json:"ECUHours,omitempty"`
+	RunTimeAgrees   *bool     `json:"RunTimeAgrees,omitempty"`
+}
+
+// EngineStateEvent is reposted whenever an engine changes state
+type EngineStateEvent struct {
+	Device    string    `json:"Device"`
+	State     string    `json:"State"`
+	RPM       int64     `json:"RPM"`
+	Timestamp time.Time `json:"Timestamp"`
+}
+
+type engineRun struct {
+	state        string
+	summary      EngineRunSummary
+	lastRPM      int64
+	lastRPMTime  time.Time
+	rpmSeconds   float64
+	fuelRate     float64
+	fuelTime     time.Time
+	runTimeStart int64
+	runTimeEnd   int64
+}
+
+// EngineMonitor runs a per engine state machine over Propulsion.RPM
+type EngineMonitor struct {
+	mu      sync.Mutex
+	conf    EngineConfig
+	engines map[string]*engineRun
+	client  MQTT.Client
+	// latest is the newest message time and latestSeen is when it arrived
+	latest     time.Time
+	latestSeen time.Time
+}
+
+var SharedEngineMonitor *EngineMonitor
+
+func NewEngineMonitor(conf EngineConfig) *EngineMonitor {
+	return &EngineMonitor{
+		conf:    conf,
+		engines: make(map[string]*engineRun),
+	}
+}
+
+// Update feeds a single propulsion measurement into the engine state machine
+func (m *EngineMonitor) Update(client MQTT.Client, measurement string, prop *Propulsion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.client = client
+	device := prop.Device
+	if device == "" {
+		device = fuelDefaultEngine
+	}
+	run, ok := m.engines[device]
+	if !ok {
+		run = &engineRun{state: EngineStopped}
+		m.engines[device] = run
+	}
+	ts := prop.Timestamp
+	if ts.After(m.latest) {
+		m.latest = ts
+		m.latestSeen = time.Now()
+	}
+
+	if measurement == "revolutions" {
+		m.updateRPM(client, device, run, prop.RPM, ts)
+		return
+	}
+	if run.state == EngineStopped {
+		return
+	}
+	switch measurement {
+	case "temperature":
+		run.summary.MaxCoolantTempF = math.Max(run.summary.MaxCoolantTempF, prop.CoolantTempF)
+	case "oilTemperature":
+		run.summary.MaxOilTempF = math.Max(run.summary.MaxOilTempF, prop.OilTempF)
+	case "alternatorVoltage":
+		if prop.AltVoltage == 0.0 {
+			break
+		}
+		if run.summary.MinAltVoltage == 0.0 || prop.AltVoltage < run.summary.MinAltVoltage {
+			run.summary.MinAltVoltage = prop.AltVoltage
+		}
+		run.summary.MaxAltVoltage = math.Max(run.summary.MaxAltVoltage, prop.AltVoltage)
+	case "rate":
+		dt := ts.Sub(run.fuelTime)
+		if !run.fuelTime.IsZero() && dt > 0 && dt <= fuelMaxSampleGap {
+			run.summary.FuelUsedGallons += (run.fuelRate + prop.FuelRate) / 2 * dt.Hours()
+		}
+		run.fuelRate = prop.FuelRate
+		run.fuelTime = ts
+	case "runTime":
+		if prop.RunTime == 0 {
+			break
+		}
+		if run.runTimeStart == 0 {
+			run.runTimeStart = prop.RunTime
+		}
+		run.runTimeEnd = prop.RunTime
+	}
+}
+
+func (m *EngineMonitor) updateRPM(client MQTT.Client, device string, run *engineRun, rpm int64, ts time.Time) {
+	if run.state != EngineStopped {
+		// Time weighted RPM and state durations between samples
+		dt := ts.Sub(run.lastRPMTime)
+		if dt > 0 && dt <= time.Duration(m.conf.StopTimeout)*time.Second {
+			run.rpmSeconds += float64(run.lastRPM) * dt.Seconds()
+			if run.state == EngineIdle {
+				run.summary.IdleHours += dt.Hours()
+			} else {
+				run.summary.UnderwayHours += dt.Hours()
+			}
+		}
+	}
+
+	newState := EngineStopped
+	if rpm >= m.conf.UnderwayRPM {
+		newState = EngineUnderway
+	} else if rpm >= m.conf.StartRPM {
+		newState = EngineIdle
+	}
+
+	if newState == EngineStopped {
+		if run.state != EngineStopped {
+			m.stop(client, device, run, ts)
+		}
+		return
+	}
+
+	if run.state == EngineStopped {
+		log.Info().Msgf("Engine %v started", device)
+		*run = engineRun{
+			summary: EngineRunSummary{
+				Device: device,
+				Start:  ts,
+			},
+		}
+	}
+	run.lastRPM = rpm
+	run.lastRPMTime = ts
+	if rpm > run.summary.MaxRPM {
+		run.summary.MaxRPM = rpm
+	}
+	if newState != run.state {
+		run.state = newState
+		m.publishState(client, device, newState, rpm, ts)
+	}
+}
+
+// CheckStale stops engines whose RPM has not been seen within the stop timeout
+// Some gateways stop sending revolutions entirely when the engine is shut down
+// Timeouts are measured on the message clock, advanced by the wall time since the newest message,
+// so a gateway whose clock lags the host does not stop running engines
+func (m *EngineMonitor) CheckStale(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	messageNow := m.latest.Add(now.Sub(m.latestSeen))
+	for device, run := range m.engines {
+		if run.state == EngineStopped {
+			continue
+		}
+		if messageNow.Sub(run.lastRPMTime) > time.Duration(m.conf.StopTimeout)*time.Second {
+			log.Info().Msgf("No RPM from engine %v since %v", device, run.lastRPMTime)
+			m.stop(m.client, device, run, run.lastRPMTime)
+		}
+	}
+}
+
+// Run checks for stale engines for the life of the daemon
+func (m *EngineMonitor) Run() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		m.CheckStale(now)
+	}
+}
+
+// State returns the current state of an engine
+func (m *EngineMonitor) State(device string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	run, ok := m.engines[device]
+	if !ok {
+		return EngineStopped
+	}
+	return run.state
+}
+
+func (m *EngineMonitor) stop(client MQTT.Client, device string, run *engineRun, end time.Time) {
+	run.state = EngineStopped
+	run.summary.End = end
+	duration := end.Sub(run.summary.Start)
+	run.summary.DurationHours = duration.Hours()
+	if duration > 0 {
+		run.summary.AvgRPM = run.rpmSeconds / duration.Seconds()
+	}
+	if run.runTimeEnd > run.runTimeStart {
+		run.summary.ECUHours = float64(run.runTimeEnd-run.runTimeStart) / 3600
+	}
+	if run.runTimeStart != 0 {
+		agrees := math.Abs(run.summary.ECUHours-run.summary.DurationHours) <= m.conf.RunTimeTolerance/60
+		run.summary.RunTimeAgrees = &agrees
+	}
+	log.Info().Msgf("Engine %v stopped after %.2f h", device, run.summary.DurationHours)
+	m.publishState(client, device, EngineStopped, 0, end)
+	m.publishSummary(client, run.summary)
+}
+
+func (m *EngineMonitor) publishState(client MQTT.Client, device string, state string, rpm int64, ts time.Time) {
+	jsonData, err := json.Marshal(EngineStateEvent{Device: device, State: state, RPM: rpm, Timestamp: ts})
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "propulsion/"+device+"/state", string(jsonData))
+}
+
+func (m *EngineMonitor) publishSummary(client MQTT.Client, summary EngineRunSummary) {
+	jsonData, err := json.Marshal(summary)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "propulsion/"+summary.Device+"/run", string(jsonData))
+
+	fields := map[string]interface{}{
+		"DurationHours":   summary.DurationHours,
+		"IdleHours":       summary.IdleHours,
+		"UnderwayHours":   summary.UnderwayHours,
+		"MaxRPM":          summary.MaxRPM,
+		"AvgRPM":          summary.AvgRPM,
+		"FuelUsedGallons": summary.FuelUsedGallons,
+	}
+	if summary.MaxCoolantTempF != 0.0 {
+		fields["MaxCoolantTempF"] = summary.MaxCoolantTempF
+	}
+	if summary.MaxOilTempF != 0.0 {
+		fields["MaxOilTempF"] = summary.MaxOilTempF
+	}
+	if summary.MinAltVoltage != 0.0 {
+		fields["MinAltVoltage"] = summary.MinAltVoltage
+		fields["MaxAltVoltage"] = summary.MaxAltVoltage
+	}
+	if summary.RunTimeAgrees != nil {
+		fields["ECUHours"] = summary.ECUHours
+		fields["RunTimeAgrees"] = *summary.RunTimeAgrees
+	}
+	WriteDerivedPoint(influxdb2.NewPoint("engineRun", map[string]string{"Device": summary.Device}, fields, summary.End))
+}
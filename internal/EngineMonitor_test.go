@@ -0,0 +1,140 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testEngineConfig() EngineConfig {
+	return EngineConfig{
+		Enabled:          true,
+		StartRPM:         300,
+		UnderwayRPM:      1200,
+		StopTimeout:      60,
+		RunTimeTolerance: 6,
+	}
+}
+
+func propAt(ts time.Time, prop Propulsion) *Propulsion {
+	prop.Device = "port"
+	prop.Timestamp = ts
+	return &prop
+}
+
+func TestEngineMonitorRun(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	client := &MockMQTTClient{}
+	monitor := NewEngineMonitor(testEngineConfig())
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, EngineStopped, monitor.State("port"))
+
+	// Readings while stopped are ignored
+	monitor.Update(client, "temperature", propAt(start, Propulsion{CoolantTempF: 80}))
+
+	// Idle for ten minutes
+	monitor.Update(client, "runTime", propAt(start, Propulsion{RunTime: 3600 * 1000}))
+	monitor.Update(client, "revolutions", propAt(start, Propulsion{RPM: 700}))
+	assert.Equal(t, EngineIdle, monitor.State("port"))
+	monitor.Update(client, "runTime", propAt(start, Propulsion{RunTime: 3600 * 1000}))
+	for i := 1; i < 10; i++ {
+		monitor.Update(client, "revolutions", propAt(start.Add(time.Duration(i)*time.Minute), Propulsion{RPM: 700}))
+	}
+	assert.Equal(t, EngineIdle, monitor.State("port"))
+	monitor.Update(client, "revolutions", propAt(start.Add(10*time.Minute), Propulsion{RPM: 2500}))
+	assert.Equal(t, EngineUnderway, monitor.State("port"))
+
+	// Underway for fifty minutes
+	monitor.Update(client, "temperature", propAt(start.Add(20*time.Minute), Propulsion{CoolantTempF: 185}))
+	monitor.Update(client, "oilTemperature", propAt(start.Add(20*time.Minute), Propulsion{OilTempF: 210}))
+	monitor.Update(client, "alternatorVoltage", propAt(start.Add(20*time.Minute), Propulsion{AltVoltage: 13.8}))
+	monitor.Update(client, "alternatorVoltage", propAt(start.Add(30*time.Minute), Propulsion{AltVoltage: 14.4}))
+	for i := 0; i <= 30; i++ {
+		monitor.Update(client, "rate", propAt(start.Add(time.Duration(30+i)*time.Minute), Propulsion{FuelRate: 4.0}))
+	}
+	for i := 11; i <= 60; i++ {
+		monitor.Update(client, "revolutions", propAt(start.Add(time.Duration(i)*time.Minute), Propulsion{RPM: 2500}))
+	}
+	monitor.Update(client, "runTime", propAt(start.Add(60*time.Minute), Propulsion{RunTime: 3600 * 1001}))
+
+	// Zero RPM stops the engine and writes the summary
+	monitor.Update(client, "revolutions", propAt(start.Add(61*time.Minute), Propulsion{RPM: 0}))
+	assert.Equal(t, EngineStopped, monitor.State("port"))
+
+	assert.Len(t, mockWriteAPI.Points, 1)
+	point := mockWriteAPI.Points[0]
+	assert.Equal(t, "engineRun", point.Name())
+	fields := make(map[string]interface{})
+	for _, field := range point.FieldList() {
+		fields[field.Key] = field.Value
+	}
+	assert.InDelta(t, 61.0/60.0, fields["DurationHours"], 0.001)
+	assert.InDelta(t, 10.0/60.0, fields["IdleHours"], 0.001)
+	assert.InDelta(t, 51.0/60.0, fields["UnderwayHours"], 0.001)
+	assert.Equal(t, int64(2500), fields["MaxRPM"])
+	assert.InDelta(t, (700.0*10+2500.0*51)/61, fields["AvgRPM"], 0.01)
+	assert.Equal(t, 185.0, fields["MaxCoolantTempF"])
+	assert.Equal(t, 210.0, fields["MaxOilTempF"])
+	assert.Equal(t, 13.8, fields["MinAltVoltage"])
+	assert.Equal(t, 14.4, fields["MaxAltVoltage"])
+	assert.InDelta(t, 2.0, fields["FuelUsedGallons"], 0.001)
+	assert.Equal(t, 1.0, fields["ECUHours"])
+	assert.Equal(t, true, fields["RunTimeAgrees"])
+}
+
+func TestEngineMonitorStale(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	client := &MockMQTTClient{}
+	monitor := NewEngineMonitor(testEngineConfig())
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	monitor.Update(client, "runTime", propAt(start, Propulsion{RunTime: 3600 * 1000}))
+	monitor.Update(client, "revolutions", propAt(start, Propulsion{RPM: 800}))
+	monitor.Update(client, "revolutions", propAt(start.Add(30*time.Minute), Propulsion{RPM: 800}))
+	monitor.Update(client, "runTime", propAt(start.Add(30*time.Minute), Propulsion{RunTime: 3600 * 1002}))
+
+	// Message time lags the wall clock by years so only the time since the last message counts
+	now := time.Now()
+	monitor.CheckStale(now)
+	assert.Equal(t, EngineIdle, monitor.State("port"))
+	monitor.CheckStale(now.Add(30 * time.Second))
+	assert.Equal(t, EngineIdle, monitor.State("port"))
+
+	// The run ends at the last RPM seen rather than when it was noticed
+	monitor.CheckStale(now.Add(5 * time.Minute))
+	assert.Equal(t, EngineStopped, monitor.State("port"))
+	assert.Len(t, mockWriteAPI.Points, 1)
+	assert.Equal(t, start.Add(30*time.Minute), mockWriteAPI.Points[0].Time())
+	for _, field := range mockWriteAPI.Points[0].FieldList() {
+		if field.Key == "RunTimeAgrees" {
+			// The ECU counted two hours for a half hour run
+			assert.Equal(t, false, field.Value)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FilterRejectRange  = "range"
+	FilterRejectRate   = "rate"
+	FilterRejectHampel = "hampel"
+)
+
+const (
+	// The rate check is skipped when the last accepted value is older than this
+	filterRateMaxGap = 5 * time.Minute
+	// After this many rate rejections in a row the next value is taken as a new baseline
+	filterMaxRateRejects = 3
+	// Scales the median absolute deviation to a standard deviation for normal data
+	hampelMADScale = 1.4826
+)
+
+// FilterRejects is the number of samples rejected for one field and reason
+type FilterRejects struct {
+	Measurement string `json:"Measurement"`
+	Field       string `json:"Field"`
+	Reason      string `json:"Reason"`
+	Count       uint64 `json:"Count"`
+}
+
+// filterSeries is the recent history of one field from one source
+type filterSeries struct {
+	last        float64
+	lastTime    time.Time
+	rateRejects int
+	window      []float64
+}
+
+// SensorFilter drops impossible values before they reach the derived features and the sinks
+type SensorFilter struct {
+	mu      sync.Mutex
+	conf    FilterConfig
+	rules   map[string][]FilterRule
+	series  map[string]*filterSeries
+	rejects map[FilterRejects]uint64
+}
+
+var SharedSensorFilter *SensorFilter
+
+// NewSensorFilter resolves the configured rules against the data types
+// Viper lowercases keys so measurement and field names are matched without regard to case
+func NewSensorFilter(conf FilterConfig) *SensorFilter {
+	f := &SensorFilter{
+		conf:    conf,
+		rules:   make(map[string][]FilterRule),
+		series:  make(map[string]*filterSeries),
+		rejects: make(map[FilterRejects]uint64),
+	}
+	for _, rule := range conf.Rules {
+		measurement, field, ok := resolveFilterField(rule.Measurement, rule.Field)
+		if !ok {
+			log.Warn().Msgf("Filter rule for %v.%v does not match a numeric field and will be ignored", rule.Measurement, rule.Field)
+			continue
+		}
+		rule.Measurement = measurement
+		rule.Field = field
+		f.rules[measurement] = append(f.rules[measurement], rule)
+	}
+	return f
+}
+
+func resolveFilterField(measurement string, field string) (string, string, bool) {
+	for name, typ := range filterableTypes() {
+		if !strings.EqualFold(name, measurement) {
+			continue
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			sf := typ.Field(i)
+			if !strings.EqualFold(sf.Name, field) {
+				continue
+			}
+			switch sf.Type.Kind() {
+			case reflect.Float64, reflect.Int64:
+				return name, sf.Name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// Apply checks every filtered field of a sample and clears the ones that are rejected
+// It returns false when nothing useful is left so the sample should be dropped
+func (f *SensorFilter) Apply(data SensorData) bool {
+	rules, ok := f.rules[data.GetMeasurementName()]
+	if !ok {
+		return true
+	}
+	ts := data.GetTimestamp()
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	key := filterSeriesKey(data)
+	v := reflect.ValueOf(data).Elem()
+	rejected := false
+
+	f.mu.Lock()
+	for _, rule := range rules {
+		fv := v.FieldByName(rule.Field)
+		var value float64
+		if fv.Kind() == reflect.Int64 {
+			value = float64(fv.Int())
+		} else {
+			value = fv.Float()
+		}
+		if value == 0.0 && !data.IsPresent(rule.Field) {
+			continue
+		}
+		series, ok := f.series[key+"/"+rule.Field]
+		if !ok {
+			series = &filterSeries{}
+			f.series[key+"/"+rule.Field] = series
+		}
+		reason := f.check(rule, series, value, ts)
+		if reason != "" {
+			f.rejects[FilterRejects{Measurement: rule.Measurement, Field: rule.Field, Reason: reason}]++
+			log.Trace().Msgf("Filter rejected %v %v=%v from %v: %v", rule.Measurement, rule.Field, value, key, reason)
+			if f.conf.LogRejects {
+				log.Info().Msgf("Filter rejected %v %v=%v from %v: %v", rule.Measurement, rule.Field, value, key, reason)
+			}
+			fv.Set(reflect.Zero(fv.Type()))
+			data.ClearPresent(rule.Field)
+			rejected = true
+			continue
+		}
+		if rule.Median && len(series.window) > 0 {
+			value = median(series.window)
+			if fv.Kind() == reflect.Int64 {
+				fv.SetInt(int64(math.Round(value)))
+			} else {
+				fv.SetFloat(value)
+			}
+		}
+	}
+	f.mu.Unlock()
+
+	return !rejected || !data.IsEmpty()
+}
+
+// check returns the reason a value is rejected or an empty string when it is accepted
+func (f *SensorFilter) check(rule FilterRule, series *filterSeries, value float64, ts time.Time) string {
+	if (rule.Min != nil && value < *rule.Min) || (rule.Max != nil && value > *rule.Max) {
+		return FilterRejectRange
+	}
+	// The value is tested against the window before it joins it
+	outlier := rule.Hampel > 0 && len(series.window) >= 3 && isHampelOutlier(series.window, value, rule.Hampel)
+	if rule.Window > 0 {
+		series.window = append(series.window, value)
+		if len(series.window) > rule.Window {
+			series.window = series.window[len(series.window)-rule.Window:]
+		}
+	}
+	if rule.MaxRate > 0 && !series.lastTime.IsZero() {
+		dt := ts.Sub(series.lastTime)
+		if dt > 0 && dt <= filterRateMaxGap && math.Abs(value-series.last)/dt.Seconds() > rule.MaxRate {
+			series.rateRejects++
+			if series.rateRejects <= filterMaxRateRejects {
+				return FilterRejectRate
+			}
+			// The value really has moved so start again from here
+			log.Debug().Msgf("Filter %v.%v accepted a new baseline of %v", rule.Measurement, rule.Field, value)
+		}
+	}
+	if outlier {
+		return FilterRejectHampel
+	}
+	series.last = value
+	series.lastTime = ts
+	series.rateRejects = 0
+	return ""
+}
+
+// isHampelOutlier reports whether value is more than k scaled MADs from the window median
+// A flat window has no spread to judge against so nothing is an outlier
+func isHampelOutlier(window []float64, value float64, k float64) bool {
+	m := median(window)
+	deviations := make([]float64, len(window))
+	for i, w := range window {
+		deviations[i] = math.Abs(w - m)
+	}
+	mad := median(deviations)
+	if mad == 0 {
+		return false
+	}
+	return math.Abs(value-m) > k*hampelMADScale*mad
+}
+
+// filterSeriesKey keeps readings from different sources and devices apart
+func filterSeriesKey(data SensorData) string {
+	tags := data.GetInfluxTags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(data.GetMeasurementName())
+	for _, k := range keys {
+		sb.WriteString("," + k + "=" + tags[k])
+	}
+	return sb.String()
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// Rejects returns the reject counts sorted by measurement, field and reason
+func (f *SensorFilter) Rejects() []FilterRejects {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rejects := []FilterRejects{}
+	for k, count := range f.rejects {
+		k.Count = count
+		rejects = append(rejects, k)
+	}
+	sort.Slice(rejects, func(i, j int) bool {
+		a, b := rejects[i], rejects[j]
+		if a.Measurement != b.Measurement {
+			return a.Measurement < b.Measurement
+		}
+		if a.Field != b.Field {
+			return a.Field < b.Field
+		}
+		return a.Reason < b.Reason
+	})
+	return rejects
+}
+
+// Run reposts the reject counts every publish interval for the life of the daemon
+func (f *SensorFilter) Run(client MQTT.Client) {
+	ticker := time.NewTicker(time.Duration(f.conf.PublishInterval) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		jsonData, err := json.Marshal(f.Rejects())
+		if err != nil {
+			log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+			continue
+		}
+		PublishDerivedMessage(client, "filter/rejects", string(jsonData))
+	}
+}
+
+// RegisterAPI adds the filter endpoint to the API server
+func (f *SensorFilter) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/filter", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, f.Rejects())
+	})
+}
+
+// filterSensorData runs the shared filter if one is configured
+func filterSensorData(data SensorData) bool {
+	if SharedSensorFilter == nil {
+		return true
+	}
+	return SharedSensorFilter.Apply(data)
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func depthAt(ts time.Time, depth float64) *Water {
+	water := &Water{DepthUnderTransducerFt: depth}
+	water.Source = "Depth"
+	water.Timestamp = ts
+	return water
+}
+
+func TestSensorFilterRange(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "bletemperature", Field: "tempf", Min: floatPtr(-20), Max: floatPtr(150)},
+	}})
+	now := time.Now()
+
+	ble := &BLETemperature{MAC: "aa", TempF: -40.0, Humidity: 50.0}
+	ble.Timestamp = now
+	// The humidity is still good so the reading is kept without the temperature
+	assert.True(t, filter.Apply(ble))
+	assert.Equal(t, 0.0, ble.TempF)
+	assert.Equal(t, 50.0, ble.Humidity)
+
+	ble = &BLETemperature{MAC: "aa", TempF: 38.0}
+	ble.Timestamp = now
+	assert.True(t, filter.Apply(ble))
+	assert.Equal(t, 38.0, ble.TempF)
+
+	assert.Equal(t, []FilterRejects{
+		{Measurement: "bleTemperature", Field: "TempF", Reason: FilterRejectRange, Count: 1},
+	}, filter.Rejects())
+}
+
+func TestSensorFilterDropsEmpty(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "water", Field: "DepthUnderTransducerFt", Min: floatPtr(1.0)},
+	}})
+	assert.False(t, filter.Apply(depthAt(time.Now(), 0.3)))
+	assert.True(t, filter.Apply(depthAt(time.Now(), 12.0)))
+	// Zero is a missing field rather than a reading
+	water := &Water{TempF: 60.0}
+	assert.True(t, filter.Apply(water))
+}
+
+func TestSensorFilterRate(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "water", Field: "DepthUnderTransducerFt", MaxRate: 1.0},
+	}})
+	start := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, filter.Apply(depthAt(start, 20.0)))
+	assert.True(t, filter.Apply(depthAt(start.Add(time.Second), 20.5)))
+	// A jump of 80 ft in a second
+	assert.False(t, filter.Apply(depthAt(start.Add(2*time.Second), 100.0)))
+	assert.True(t, filter.Apply(depthAt(start.Add(3*time.Second), 21.0)))
+
+	// Readings from another source are tracked on their own
+	other := depthAt(start.Add(4*time.Second), 5.0)
+	other.Source = "Sounder"
+	assert.True(t, filter.Apply(other))
+
+	// A change that sticks becomes the new baseline
+	for i := 0; i < filterMaxRateRejects; i++ {
+		assert.False(t, filter.Apply(depthAt(start.Add(time.Duration(5+i)*time.Second), 60.0)))
+	}
+	assert.True(t, filter.Apply(depthAt(start.Add(10*time.Second), 60.0)))
+
+	// The rate is not checked across a long gap
+	assert.True(t, filter.Apply(depthAt(start.Add(time.Hour), 10.0)))
+
+	rejects := filter.Rejects()
+	assert.Len(t, rejects, 1)
+	assert.Equal(t, uint64(1+filterMaxRateRejects), rejects[0].Count)
+}
+
+func TestSensorFilterHampel(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "water", Field: "DepthUnderTransducerFt", Window: 7, Hampel: 3.0},
+	}})
+	start := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	depths := []float64{20.0, 20.4, 19.8, 20.2, 20.1, 19.9}
+	for i, depth := range depths {
+		assert.True(t, filter.Apply(depthAt(start.Add(time.Duration(i)*time.Second), depth)))
+	}
+	assert.False(t, filter.Apply(depthAt(start.Add(6*time.Second), 3.5)))
+	assert.True(t, filter.Apply(depthAt(start.Add(7*time.Second), 20.3)))
+	assert.Equal(t, FilterRejectHampel, filter.Rejects()[0].Reason)
+}
+
+func TestSensorFilterHampelFlatWindow(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "water", Field: "DepthUnderTransducerFt", Window: 5, Hampel: 3.0},
+	}})
+	start := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		assert.True(t, filter.Apply(depthAt(start.Add(time.Duration(i)*time.Second), 20.0)))
+	}
+	// A window with no spread has nothing to judge a change against
+	assert.True(t, filter.Apply(depthAt(start.Add(5*time.Second), 20.1)))
+	assert.Empty(t, filter.Rejects())
+
+	// The candidate is not part of the window it is tested against
+	assert.True(t, isHampelOutlier([]float64{20.0, 20.4, 19.8, 20.2}, 3.5, 3.0))
+	assert.False(t, isHampelOutlier([]float64{20.0, 20.0, 20.0}, 3.5, 3.0))
+}
+
+func TestSensorFilterMedian(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "gnss", Field: "satellites", Window: 3, Median: true},
+	}})
+	now := time.Now()
+	for i, sats := range []int64{8, 9, 3} {
+		gnss := &GNSS{Satellites: sats}
+		gnss.Timestamp = now.Add(time.Duration(i) * time.Second)
+		assert.True(t, filter.Apply(gnss))
+		if i == 2 {
+			assert.Equal(t, int64(8), gnss.Satellites)
+		}
+	}
+}
+
+func TestSensorFilterUnknownField(t *testing.T) {
+	filter := NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "water", Field: "Salinity", Min: floatPtr(0)},
+		{Measurement: "espStatus", Field: "IPAddress", Min: floatPtr(0)},
+		{Measurement: "bilge", Field: "Level", Min: floatPtr(0)},
+	}})
+	assert.Empty(t, filter.rules)
+}
+
+func TestHandleSensorMessageFiltered(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	SharedSensorFilter = NewSensorFilter(FilterConfig{Enabled: true, Rules: []FilterRule{
+		{Measurement: "water", Field: "DepthUnderTransducerFt", Max: floatPtr(1000)},
+	}})
+	defer func() { SharedSensorFilter = nil }()
+
+	client := &MockMQTTClient{}
+	topic := "vessels/self/environment/depth/belowTransducer"
+	HandleSensorMessage(client, NewMockMessage(topic,
+		[]byte(`{"value": 1000, "$source": "test-source", "timestamp": "2025-08-01T12:00:00.000Z"}`)), &Water{}, processWaterData)
+	assert.Empty(t, pointsNamed(mockWriteAPI, "water"))
+
+	HandleSensorMessage(client, NewMockMessage(topic,
+		[]byte(`{"value": 10, "$source": "test-source", "timestamp": "2025-08-01T12:00:01.000Z"}`)), &Water{}, processWaterData)
+	assert.Len(t, pointsNamed(mockWriteAPI, "water"), 1)
+}
@@ -0,0 +1,355 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Samples further apart than this are treated as a gap in the data rather than integrated across
+const fuelMaxSampleGap = 5 * time.Minute
+
+const fuelSaveInterval = time.Minute
+
+const fuelDefaultEngine = "engine"
+
+// EngineFuel holds the accumulated fuel used by a single engine
+type EngineFuel struct {
+	RateGPH     float64   `json:"RateGPH"`
+	LastTime    time.Time `json:"LastTime"`
+	TripGallons float64   `json:"TripGallons"`
+	DayGallons  float64   `json:"DayGallons"`
+}
+
+// FuelEconomy is the vessel level summary published on every interval
+type FuelEconomy struct {
+	Timestamp        time.Time `json:"Timestamp"`
+	TripID           string    `json:"TripID,omitempty"`
+	RateGPH          float64   `json:"RateGPH"`
+	TripGallons      float64   `json:"TripGallons"`
+	DayGallons       float64   `json:"DayGallons"`
+	TripDistanceNM   float64   `json:"TripDistanceNM"`
+	DayDistanceNM    float64   `json:"DayDistanceNM"`
+	InstantNMPG      float64   `json:"InstantNMPG,omitempty"`
+	AvgNMPG          float64   `json:"AvgNMPG,omitempty"`
+	RemainingGallons float64   `json:"RemainingGallons,omitempty"`
+	RangeNM          float64   `json:"RangeNM,omitempty"`
+	EnduranceHours   float64   `json:"EnduranceHours,omitempty"`
+}
+
+// fuelState is the part of the tracker that survives a restart
+type fuelState struct {
+	Day            string                 `json:"Day"`
+	TripID         string                 `json:"TripID"`
+	TripDistanceNM float64                `json:"TripDistanceNM"`
+	DayDistanceNM  float64                `json:"DayDistanceNM"`
+	LastFlow       time.Time              `json:"LastFlow"`
+	Engines        map[string]*EngineFuel `json:"Engines"`
+}
+
+type fuelTank struct {
+	LevelPct    float64
+	CapacityGal float64
+	VolumeGal   float64
+}
+
+// FuelTracker integrates Propulsion.FuelRate into consumption totals and economy figures
+type FuelTracker struct {
+	mu          sync.Mutex
+	conf        FuelConfig
+	dataDir     string
+	state       fuelState
+	sog         float64
+	sogTime     time.Time
+	tanks       map[string]*fuelTank
+	lastPublish time.Time
+	lastSaved   time.Time
+}
+
+var SharedFuelTracker *FuelTracker
+
+// NewFuelTracker creates a tracker and restores the trip and day totals from the data dir
+func NewFuelTracker(conf FuelConfig, dataDir string) *FuelTracker {
+	tracker := &FuelTracker{
+		conf:    conf,
+		dataDir: dataDir,
+		state: fuelState{
+			Engines: make(map[string]*EngineFuel),
+		},
+		tanks: make(map[string]*fuelTank),
+	}
+	err := readJSONFile(tracker.statePath(), &tracker.state)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msgf("Error loading fuel state: %v", err.Error())
+	}
+	if tracker.state.Engines == nil {
+		tracker.state.Engines = make(map[string]*EngineFuel)
+	}
+	return tracker
+}
+
+func (t *FuelTracker) statePath() string {
+	return filepath.Join(t.dataDir, "fuel.json")
+}
+
+// UpdateFuelRate integrates a new fuel rate sample in gallons per hour for an engine
+func (t *FuelTracker) UpdateFuelRate(client MQTT.Client, device string, rateGPH float64, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if device == "" {
+		device = fuelDefaultEngine
+	}
+	t.rollover(ts, rateGPH)
+	engine, ok := t.state.Engines[device]
+	if !ok {
+		engine = &EngineFuel{}
+		t.state.Engines[device] = engine
+	}
+	dt := ts.Sub(engine.LastTime)
+	if !engine.LastTime.IsZero() && dt > 0 && dt <= fuelMaxSampleGap {
+		// Trapezoidal integration between the two samples
+		used := (engine.RateGPH + rateGPH) / 2 * dt.Hours()
+		engine.TripGallons += used
+		engine.DayGallons += used
+	}
+	engine.RateGPH = rateGPH
+	engine.LastTime = ts
+	if rateGPH > 0 {
+		t.state.LastFlow = ts
+	}
+
+	if ts.Sub(t.lastPublish) >= time.Duration(t.conf.PublishInterval)*time.Second {
+		t.publish(client, ts)
+	}
+	if ts.Sub(t.lastSaved) >= fuelSaveInterval {
+		t.save(ts)
+	}
+}
+
+// UpdateSOG integrates distance run so average economy can be computed
+func (t *FuelTracker) UpdateSOG(sog float64, ts time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollover(ts, 0)
+	dt := ts.Sub(t.sogTime)
+	if !t.sogTime.IsZero() && dt > 0 && dt <= fuelMaxSampleGap {
+		dist := (t.sog + sog) / 2 * dt.Hours()
+		t.state.TripDistanceNM += dist
+		t.state.DayDistanceNM += dist
+	}
+	t.sog = sog
+	t.sogTime = ts
+}
+
+// UpdateTank records the latest fuel tank values so remaining range can be computed
+func (t *FuelTracker) UpdateTank(tank *Tank) {
+	if tank.Type != "fuel" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	known, ok := t.tanks[tank.Device]
+	if !ok {
+		known = &fuelTank{}
+		t.tanks[tank.Device] = known
+	}
+	if tank.LevelPct != 0.0 {
+		known.LevelPct = tank.LevelPct
+	}
+	if tank.CapacityGal != 0.0 {
+		known.CapacityGal = tank.CapacityGal
+	}
+	if tank.VolumeGal != 0.0 {
+		known.VolumeGal = tank.VolumeGal
+	}
+}
+
+// Economy returns the current vessel level fuel summary
+func (t *FuelTracker) Economy(ts time.Time) FuelEconomy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.economy(ts)
+}
+
+func (t *FuelTracker) economy(ts time.Time) FuelEconomy {
+	econ := FuelEconomy{
+		Timestamp:      ts,
+		TripID:         t.state.TripID,
+		TripDistanceNM: t.state.TripDistanceNM,
+		DayDistanceNM:  t.state.DayDistanceNM,
+	}
+	for _, engine := range t.state.Engines {
+		econ.TripGallons += engine.TripGallons
+		econ.DayGallons += engine.DayGallons
+		if ts.Sub(engine.LastTime) <= fuelMaxSampleGap {
+			econ.RateGPH += engine.RateGPH
+		}
+	}
+	if econ.RateGPH > 0 && ts.Sub(t.sogTime) <= fuelMaxSampleGap {
+		econ.InstantNMPG = t.sog / econ.RateGPH
+	}
+	if econ.TripGallons > 0 {
+		econ.AvgNMPG = econ.TripDistanceNM / econ.TripGallons
+	}
+
+	remaining, known := t.remainingGallons()
+	if known {
+		econ.RemainingGallons = remaining
+		nmpg := econ.AvgNMPG
+		if nmpg == 0 {
+			nmpg = econ.InstantNMPG
+		}
+		econ.RangeNM = remaining * nmpg
+		if econ.RateGPH > 0 {
+			econ.EnduranceHours = remaining / econ.RateGPH
+		}
+	}
+	return econ
+}
+
+// remainingGallons sums the fuel tanks preferring a reported volume over level times capacity
+func (t *FuelTracker) remainingGallons() (float64, bool) {
+	known := false
+	total := 0.0
+	for id, tank := range t.tanks {
+		if tank.VolumeGal > 0 {
+			total += tank.VolumeGal
+			known = true
+			continue
+		}
+		capacity := tank.CapacityGal
+		if capacity == 0 {
+			capacity = t.conf.TankCapacity[id]
+		}
+		if tank.LevelPct > 0 && capacity > 0 {
+			total += tank.LevelPct / 100 * capacity
+			known = true
+		}
+	}
+	return total, known
+}
+
+// rollover resets the day totals at local midnight and the trip totals when a new trip starts
+// A trip follows the current passage when passage detection is on
+// otherwise it starts when fuel flows again after the engines were off for trip-gap seconds
+func (t *FuelTracker) rollover(ts time.Time, rateGPH float64) {
+	day := ts.Local().Format("2006-01-02")
+	if day != t.state.Day {
+		if t.state.Day != "" {
+			log.Info().Msgf("Fuel day %v closed", t.state.Day)
+		}
+		t.state.Day = day
+		t.state.DayDistanceNM = 0
+		for _, engine := range t.state.Engines {
+			engine.DayGallons = 0
+		}
+	}
+
+	newTrip := ""
+	if SharedPassageTracker != nil {
+		if id := SharedPassageTracker.CurrentID(); id != "" && id != t.state.TripID {
+			newTrip = id
+		}
+	} else if rateGPH > 0 && (t.state.LastFlow.IsZero() || ts.Sub(t.state.LastFlow) > time.Duration(t.conf.TripGap)*time.Second) {
+		newTrip = ts.UTC().Format(passageIDLayout)
+	}
+	if newTrip == "" {
+		return
+	}
+	log.Info().Msgf("Fuel trip %v started", newTrip)
+	t.state.TripID = newTrip
+	t.state.TripDistanceNM = 0
+	for _, engine := range t.state.Engines {
+		engine.TripGallons = 0
+	}
+}
+
+func (t *FuelTracker) publish(client MQTT.Client, ts time.Time) {
+	t.lastPublish = ts
+
+	devices := make([]string, 0, len(t.state.Engines))
+	for device := range t.state.Engines {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		engine := t.state.Engines[device]
+		jsonData, err := json.Marshal(engine)
+		if err != nil {
+			log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+			continue
+		}
+		PublishDerivedMessage(client, "propulsion/"+device+"/fuelEconomy", string(jsonData))
+		WriteDerivedPoint(influxdb2.NewPoint("fuelEconomy",
+			map[string]string{"Device": device},
+			map[string]interface{}{
+				"RateGPH":     engine.RateGPH,
+				"TripGallons": engine.TripGallons,
+				"DayGallons":  engine.DayGallons,
+			}, ts))
+	}
+
+	econ := t.economy(ts)
+	jsonData, err := json.Marshal(econ)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "fuel/economy", string(jsonData))
+	fields := map[string]interface{}{
+		"RateGPH":        econ.RateGPH,
+		"TripGallons":    econ.TripGallons,
+		"DayGallons":     econ.DayGallons,
+		"TripDistanceNM": econ.TripDistanceNM,
+		"DayDistanceNM":  econ.DayDistanceNM,
+	}
+	if econ.InstantNMPG != 0 {
+		fields["InstantNMPG"] = econ.InstantNMPG
+	}
+	if econ.AvgNMPG != 0 {
+		fields["AvgNMPG"] = econ.AvgNMPG
+	}
+	if econ.RemainingGallons != 0 {
+		fields["RemainingGallons"] = econ.RemainingGallons
+		fields["RangeNM"] = econ.RangeNM
+	}
+	if econ.EnduranceHours != 0 {
+		fields["EnduranceHours"] = econ.EnduranceHours
+	}
+	WriteDerivedPoint(influxdb2.NewPoint("fuelEconomy", map[string]string{"Device": "total"}, fields, ts))
+}
+
+func (t *FuelTracker) save(ts time.Time) {
+	t.lastSaved = ts
+	err := writeJSONFile(t.statePath(), t.state)
+	if err != nil {
+		log.Warn().Msgf("Error saving fuel state: %v", err.Error())
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testFuelConfig() FuelConfig {
+	return FuelConfig{
+		Enabled:         true,
+		PublishInterval: 10,
+		TripGap:         1800,
+		TankCapacity:    map[string]float64{"0": 100.0},
+	}
+}
+
+func TestFuelTrackerIntegration(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	tracker := NewFuelTracker(testFuelConfig(), t.TempDir())
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+
+	// Two engines each burning 4 gph for half an hour
+	for i := 0; i <= 30; i++ {
+		ts := start.Add(time.Duration(i) * time.Minute)
+		tracker.UpdateFuelRate(client, "port", 4.0, ts)
+		tracker.UpdateFuelRate(client, "starboard", 4.0, ts)
+		tracker.UpdateSOG(8.0, ts)
+	}
+
+	econ := tracker.Economy(start.Add(30 * time.Minute))
+	assert.InDelta(t, 4.0, econ.TripGallons, 0.001)
+	assert.InDelta(t, 4.0, econ.DayGallons, 0.001)
+	assert.InDelta(t, 8.0, econ.RateGPH, 0.001)
+	assert.InDelta(t, 4.0, econ.TripDistanceNM, 0.001)
+	assert.InDelta(t, 1.0, econ.InstantNMPG, 0.001)
+	assert.InDelta(t, 1.0, econ.AvgNMPG, 0.001)
+	assert.Equal(t, start.UTC().Format(passageIDLayout), econ.TripID)
+
+	// No range until a tank level is known
+	assert.Equal(t, 0.0, econ.RemainingGallons)
+	assert.Equal(t, 0.0, econ.RangeNM)
+
+	// Level with a configured capacity gives a remaining range
+	tracker.UpdateTank(&Tank{Type: "fuel", Device: "0", LevelPct: 50.0})
+	tracker.UpdateTank(&Tank{Type: "freshWater", Device: "1", LevelPct: 90.0})
+	econ = tracker.Economy(start.Add(30 * time.Minute))
+	assert.InDelta(t, 50.0, econ.RemainingGallons, 0.001)
+	assert.InDelta(t, 50.0, econ.RangeNM, 0.001)
+	assert.InDelta(t, 6.25, econ.EnduranceHours, 0.001)
+
+	// A reported volume wins over level times capacity
+	tracker.UpdateTank(&Tank{Type: "fuel", Device: "0", VolumeGal: 40.0})
+	econ = tracker.Economy(start.Add(30 * time.Minute))
+	assert.InDelta(t, 40.0, econ.RemainingGallons, 0.001)
+}
+
+func TestFuelTrackerGapsAndRollover(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	tracker := NewFuelTracker(testFuelConfig(), t.TempDir())
+	start := time.Date(2025, 6, 1, 22, 0, 0, 0, time.Local)
+
+	for i := 0; i <= 10; i++ {
+		tracker.UpdateFuelRate(client, "", 6.0, start.Add(time.Duration(i)*time.Minute))
+	}
+	assert.InDelta(t, 1.0, tracker.Economy(start).TripGallons, 0.001)
+
+	// A gap in the data is not integrated across
+	tracker.UpdateFuelRate(client, "", 6.0, start.Add(40*time.Minute))
+	assert.InDelta(t, 1.0, tracker.Economy(start).TripGallons, 0.001)
+
+	// Engines off for longer than the trip gap starts a new trip
+	tracker.UpdateFuelRate(client, "", 0.0, start.Add(41*time.Minute))
+	tracker.UpdateFuelRate(client, "", 6.0, start.Add(90*time.Minute))
+	econ := tracker.Economy(start.Add(90 * time.Minute))
+	assert.Equal(t, 0.0, econ.TripGallons)
+	assert.InDelta(t, 1.05, econ.DayGallons, 0.001)
+
+	// Midnight resets the day total
+	tracker.UpdateFuelRate(client, "", 6.0, start.Add(121*time.Minute))
+	tracker.UpdateFuelRate(client, "", 6.0, start.Add(125*time.Minute))
+	econ = tracker.Economy(start.Add(125 * time.Minute))
+	assert.InDelta(t, 0.4, econ.DayGallons, 0.001)
+}
+
+func TestFuelTrackerPersistence(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	dataDir := t.TempDir()
+	tracker := NewFuelTracker(testFuelConfig(), dataDir)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local)
+	for i := 0; i <= 10; i++ {
+		tracker.UpdateFuelRate(client, "main", 6.0, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	restored := NewFuelTracker(testFuelConfig(), dataDir)
+	econ := restored.Economy(start.Add(10 * time.Minute))
+	assert.InDelta(t, 1.0, econ.TripGallons, 0.001)
+	assert.Equal(t, start.UTC().Format(passageIDLayout), econ.TripID)
+}
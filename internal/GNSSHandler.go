@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -37,9 +35,37 @@ type GNSS struct {
 	MethodQuality string  `json:"MethodQuality,omitempty"`
 }
 
+// gnssPathMappings are the SignalK paths the gnss handler parses
+var gnssPathMappings = []PathMapping{
+	{Path: "navigation.gnss.antennaAltitude", Measurement: "gnss", Field: "AntennaAlt"},
+	{Path: "navigation.gnss.satellites", Measurement: "gnss", Field: "Satellites"},
+	{Path: "navigation.gnss.horizontalDilution", Measurement: "gnss", Field: "HozDilution"},
+	{Path: "navigation.gnss.positionDilution", Measurement: "gnss", Field: "PosDilution"},
+	{Path: "navigation.gnss.geoidalSeparation", Measurement: "gnss", Field: "GeoidalSep"},
+	{Path: "navigation.gnss.type", Measurement: "gnss", Field: "Type"},
+	{Path: "navigation.gnss.methodQuality", Measurement: "gnss", Field: "MethodQuality"},
+	{Path: "navigation.gnss.integrity", Measurement: "gnss"},
+	{Path: "navigation.gnss.satellitesInView", Measurement: "gnss"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "gnss",
+		TopicsKey:   "gnssTopics",
+		Handler:     OnGNSSMessage,
+		NewData:     func() SensorData { return &GNSS{} },
+		Mappings:    gnssPathMappings,
+		UpdateState: updateGNSSState,
+	})
+}
+
+func updateGNSSState(client MQTT.Client, measurement string, data SensorData) {
+	SharedVesselState.UpdateGNSS(data.(*GNSS), measurement)
+}
+
 // OnGNSSMessage is called when a GNSS message is received
 func OnGNSSMessage(client MQTT.Client, message MQTT.Message) {
-	go handleGNSSMessage(client, message)
+	dispatchMessage(handleGNSSMessage, client, message)
 }
 
 // handleGNSSMessage processes GNSS messages
@@ -56,72 +82,14 @@ func processGNSSData(rawData map[string]any, measurement string, data SensorData
 		return
 	}
 
-	var err error
-	var floatTmp float64
-	var strtmp string
-
-	switch measurement {
-	case "antennaAltitude":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			gnss.AntennaAlt = floatTmp
-		}
-	case "satellites":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			gnss.Satellites = int64(floatTmp)
-		}
-	case "horizontalDilution":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			gnss.HozDilution = floatTmp
-		}
-	case "positionDilution":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			gnss.PosDilution = floatTmp
-		}
-	case "geoidalSeparation":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			gnss.GeoidalSep = floatTmp
-		}
-	case "type":
-		strtmp, err = ParseString(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing string: %v", err.Error())
-		} else {
-			gnss.Type = strtmp
-		}
-	case "methodQuality":
-		strtmp, err = ParseString(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing string: %v", err.Error())
-		} else {
-			gnss.MethodQuality = strtmp
-		}
-	case "integrity":
-		break
-	case "satellitesInView":
-		break
-	default:
+	if !applyPathMappings(rawData, measurement, gnss) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *GNSS) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -132,13 +100,16 @@ func (meas *GNSS) ToJSON() string {
 func (meas *GNSS) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("GNSS: %v", json)
-	if SharedSubscriptionConfig.GNSSLogEn {
+	if SharedSubscriptionConfig.Categories["gnss"].Verbose {
 		log.Info().Msgf("GNSS: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *GNSS) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.AntennaAlt == 0.0 && meas.Satellites == 0 && meas.HozDilution == 0.0 && meas.PosDilution == 0.0 &&
 		meas.GeoidalSep == 0.0 && meas.Type == "" && meas.MethodQuality == "" {
 		return true
@@ -149,19 +120,19 @@ func (meas *GNSS) IsEmpty() bool {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *GNSS) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.AntennaAlt != 0.0 {
+	if meas.AntennaAlt != 0.0 || meas.IsPresent("AntennaAlt") {
 		measTmp["AntennaAlt"] = meas.AntennaAlt
 	}
-	if meas.Satellites != 0 {
+	if meas.Satellites != 0 || meas.IsPresent("Satellites") {
 		measTmp["Satellites"] = meas.Satellites
 	}
-	if meas.HozDilution != 0.0 {
+	if meas.HozDilution != 0.0 || meas.IsPresent("HozDilution") {
 		measTmp["HozDilution"] = meas.HozDilution
 	}
-	if meas.PosDilution != 0.0 {
+	if meas.PosDilution != 0.0 || meas.IsPresent("PosDilution") {
 		measTmp["PosDilution"] = meas.PosDilution
 	}
-	if meas.GeoidalSep != 0.0 {
+	if meas.GeoidalSep != 0.0 || meas.IsPresent("GeoidalSep") {
 		measTmp["GeoidalSep"] = meas.GeoidalSep
 	}
 	if meas.Type != "" {
@@ -180,7 +151,12 @@ func (meas *GNSS) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *GNSS) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.GNSSLogEn
+	return SharedSubscriptionConfig.Categories["gnss"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *GNSS) GetCategory() string {
+	return "gnss"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
@@ -80,7 +80,7 @@ func TestGNSSStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.GNSSLogEn, gnss.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["gnss"].Verbose, gnss.GetLogEnabled())
 }
 
 func TestProcessGNSSData(t *testing.T) {
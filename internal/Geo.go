@@ -0,0 +1,107 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import "math"
+
+const earthRadiusMeters = 6371008.8
+
+func DegreesToRadians(deg float64) float64 {
+	return deg * (math.Pi / 180)
+}
+
+// DistanceMeters returns the great circle distance between two positions using the haversine formula
+func DistanceMeters(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	phi1 := DegreesToRadians(lat1)
+	phi2 := DegreesToRadians(lat2)
+	dPhi := DegreesToRadians(lat2 - lat1)
+	dLambda := DegreesToRadians(lon2 - lon1)
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return earthRadiusMeters * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// BearingDegrees returns the initial true bearing from the first position to the second
+func BearingDegrees(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	phi1 := DegreesToRadians(lat1)
+	phi2 := DegreesToRadians(lat2)
+	dLambda := DegreesToRadians(lon2 - lon1)
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(RadiansToDegrees(math.Atan2(y, x))+360, 360)
+}
+
+// GeoPoint is a single latitude and longitude in degrees
+type GeoPoint struct {
+	Lat float64 `json:"Lat"`
+	Lon float64 `json:"Lon"`
+}
+
+// PointInPolygon reports whether a position is inside a polygon using ray casting
+// Edges are treated as straight lines in latitude and longitude which is fine at harbor scale
+func PointInPolygon(lat float64, lon float64, polygon []GeoPoint) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > lat) != (b.Lat > lat) &&
+			lon < (b.Lon-a.Lon)*(lat-a.Lat)/(b.Lat-a.Lat)+a.Lon {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// PolygonAreaSquareMeters returns the approximate area of a small polygon
+func PolygonAreaSquareMeters(polygon []GeoPoint) float64 {
+	if len(polygon) < 3 {
+		return 0.0
+	}
+	// Project onto a flat plane around the first vertex then use the shoelace formula
+	cosLat := math.Cos(DegreesToRadians(polygon[0].Lat))
+	area := 0.0
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		xi := DegreesToRadians(polygon[i].Lon-polygon[0].Lon) * cosLat * earthRadiusMeters
+		yi := DegreesToRadians(polygon[i].Lat-polygon[0].Lat) * earthRadiusMeters
+		xj := DegreesToRadians(polygon[j].Lon-polygon[0].Lon) * cosLat * earthRadiusMeters
+		yj := DegreesToRadians(polygon[j].Lat-polygon[0].Lat) * earthRadiusMeters
+		area += xj*yi - xi*yj
+	}
+	return math.Abs(area) / 2
+}
+
+// ClosestApproach returns the closest point of approach in nautical miles and the time to it in minutes
+// for two vessels holding their course and speed. A negative time means the vessels are already diverging.
+// Positions are projected onto a flat plane around our own position which is fine at AIS range.
+func ClosestApproach(ownLat float64, ownLon float64, ownSOG float64, ownCOG float64,
+	lat float64, lon float64, sog float64, cog float64) (float64, float64) {
+	cosLat := math.Cos(DegreesToRadians(ownLat))
+	// Relative position in nautical miles and relative velocity in knots
+	rx := (lon - ownLon) * 60 * cosLat
+	ry := (lat - ownLat) * 60
+	vx := sog*math.Sin(DegreesToRadians(cog)) - ownSOG*math.Sin(DegreesToRadians(ownCOG))
+	vy := sog*math.Cos(DegreesToRadians(cog)) - ownSOG*math.Cos(DegreesToRadians(ownCOG))
+	v2 := vx*vx + vy*vy
+	if v2 < 1e-9 {
+		// Same course and speed so the range never changes
+		return math.Hypot(rx, ry), 0.0
+	}
+	tcpa := -(rx*vx + ry*vy) / v2
+	if tcpa < 0 {
+		return math.Hypot(rx, ry), tcpa * 60
+	}
+	return math.Hypot(rx+vx*tcpa, ry+vy*tcpa), tcpa * 60
+}
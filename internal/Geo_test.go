@@ -0,0 +1,117 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistanceMeters(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat1     float64
+		lon1     float64
+		lat2     float64
+		lon2     float64
+		expected float64
+		delta    float64
+	}{
+		{"same_point", 37.0, -122.0, 37.0, -122.0, 0, 0.001},
+		{"one_minute_latitude", 37.0, -122.0, 37.0 + 1.0/60.0, -122.0, 1853.2, 1.0},
+		{"one_degree_equator", 0.0, 0.0, 0.0, 1.0, 111195, 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := DistanceMeters(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			assert.InDelta(t, tt.expected, result, tt.delta)
+		})
+	}
+}
+
+func TestBearingDegrees(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat1     float64
+		lon1     float64
+		lat2     float64
+		lon2     float64
+		expected float64
+	}{
+		{"north", 37.0, -122.0, 38.0, -122.0, 0},
+		{"south", 37.0, -122.0, 36.0, -122.0, 180},
+		{"east_on_equator", 0.0, 0.0, 0.0, 1.0, 90},
+		{"west_on_equator", 0.0, 0.0, 0.0, -1.0, 270},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := BearingDegrees(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			assert.InDelta(t, tt.expected, result, 0.01)
+		})
+	}
+}
+
+func TestPointInPolygon(t *testing.T) {
+	square := []GeoPoint{
+		{Lat: 37.80, Lon: -122.42},
+		{Lat: 37.80, Lon: -122.40},
+		{Lat: 37.82, Lon: -122.40},
+		{Lat: 37.82, Lon: -122.42},
+	}
+	assert.True(t, PointInPolygon(37.81, -122.41, square))
+	assert.False(t, PointInPolygon(37.83, -122.41, square))
+	assert.False(t, PointInPolygon(37.81, -122.39, square))
+	assert.False(t, PointInPolygon(37.81, -122.41, square[:2]))
+}
+
+func TestPolygonAreaSquareMeters(t *testing.T) {
+	// Roughly 1 km on a side at the equator
+	square := []GeoPoint{
+		{Lat: 0, Lon: 0},
+		{Lat: 0, Lon: 0.008993},
+		{Lat: 0.008993, Lon: 0.008993},
+		{Lat: 0.008993, Lon: 0},
+	}
+	assert.InDelta(t, 1000000.0, PolygonAreaSquareMeters(square), 1000.0)
+	assert.Equal(t, 0.0, PolygonAreaSquareMeters(square[:2]))
+}
+
+func TestClosestApproach(t *testing.T) {
+	// Target 2 nm due north heading south at 10 kn while we sit still
+	cpa, tcpa := ClosestApproach(37.8, -122.4, 0, 0, 37.8+2.0/60, -122.4, 10, 180)
+	assert.InDelta(t, 0.0, cpa, 0.001)
+	assert.InDelta(t, 12.0, tcpa, 0.01)
+
+	// Crossing ahead: target 1 nm east heading west while we head north, both at 6 kn
+	cpa, tcpa = ClosestApproach(0, 0, 6, 0, 0, 1.0/60, 6, 270)
+	assert.InDelta(t, math.Sqrt(0.5), cpa, 0.001)
+	assert.InDelta(t, 5.0, tcpa, 0.01)
+
+	// Target astern and opening
+	cpa, tcpa = ClosestApproach(0, 0, 0, 0, -1.0/60, 0, 5, 180)
+	assert.InDelta(t, 1.0, cpa, 0.001)
+	assert.Less(t, tcpa, 0.0)
+
+	// Same course and speed keeps the range
+	cpa, tcpa = ClosestApproach(0, 0, 6, 90, 1.0/60, 0, 6, 90)
+	assert.InDelta(t, 1.0, cpa, 0.001)
+	assert.Equal(t, 0.0, tcpa)
+}
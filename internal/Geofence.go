@@ -0,0 +1,201 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	GeofenceEnter = "enter"
+	GeofenceExit  = "exit"
+)
+
+// GeofenceEvent is reposted and written when the boat enters or leaves a zone
+type GeofenceEvent struct {
+	Zone      string    `json:"Zone"`
+	Event     string    `json:"Event"`
+	Lat       float64   `json:"Lat"`
+	Lon       float64   `json:"Lon"`
+	Timestamp time.Time `json:"Timestamp"`
+}
+
+// GeofenceState is the set of zones the boat is in
+// Zone is the smallest of them and is what gets tagged on points
+type GeofenceState struct {
+	Zone      string    `json:"Zone"`
+	Zones     []string  `json:"Zones"`
+	Timestamp time.Time `json:"Timestamp,omitempty"`
+}
+
+// Geofence checks position fixes against the configured zones
+type Geofence struct {
+	mu      sync.RWMutex
+	conf    GeofenceConfig
+	dataDir string
+	state   GeofenceState
+}
+
+var SharedGeofence *Geofence
+
+func NewGeofence(conf GeofenceConfig, dataDir string) *Geofence {
+	fence := &Geofence{
+		conf:    conf,
+		dataDir: dataDir,
+	}
+	// Zones are restored so a restart inside the marina does not log a new entry
+	err := readJSONFile(fence.statePath(), &fence.state)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Msgf("Error loading geofence state: %v", err.Error())
+	}
+	return fence
+}
+
+func (g *Geofence) statePath() string {
+	return filepath.Join(g.dataDir, "geofence.json")
+}
+
+// Contains reports whether a position is inside the zone
+func (z GeofenceZone) Contains(lat float64, lon float64) bool {
+	if len(z.Polygon) > 0 {
+		return PointInPolygon(lat, lon, z.Polygon)
+	}
+	return DistanceMeters(z.Lat, z.Lon, lat, lon) <= z.Radius
+}
+
+// Area is used to pick the most specific zone when zones overlap
+func (z GeofenceZone) Area() float64 {
+	if len(z.Polygon) > 0 {
+		return PolygonAreaSquareMeters(z.Polygon)
+	}
+	return math.Pi * z.Radius * z.Radius
+}
+
+// State returns a copy of the current geofence state
+func (g *Geofence) State() GeofenceState {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	state := g.state
+	state.Zones = append([]string{}, g.state.Zones...)
+	return state
+}
+
+// CurrentZone returns the zone tagged on points or an empty string when outside all zones
+func (g *Geofence) CurrentZone() string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.state.Zone
+}
+
+// Update checks a single position fix against every zone
+func (g *Geofence) Update(client MQTT.Client, snap VesselSnapshot, ts time.Time) {
+	state, events := g.evaluate(snap, ts)
+	if len(events) == 0 {
+		return
+	}
+	// Published outside the lock since writing a point looks up the current zone
+	for _, event := range events {
+		g.publishEvent(client, event)
+	}
+	jsonData, err := json.Marshal(state)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "geofence/state", string(jsonData))
+}
+
+func (g *Geofence) evaluate(snap VesselSnapshot, ts time.Time) (GeofenceState, []GeofenceEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	was := make(map[string]bool)
+	for _, name := range g.state.Zones {
+		was[name] = true
+	}
+	var zones []string
+	zone := ""
+	smallest := math.Inf(1)
+	var events []GeofenceEvent
+	for _, z := range g.conf.Zones {
+		if !z.Contains(snap.Lat, snap.Lon) {
+			if was[z.Name] {
+				events = append(events, GeofenceEvent{Zone: z.Name, Event: GeofenceExit, Lat: snap.Lat, Lon: snap.Lon, Timestamp: ts})
+			}
+			continue
+		}
+		zones = append(zones, z.Name)
+		if area := z.Area(); area < smallest {
+			smallest = area
+			zone = z.Name
+		}
+		if !was[z.Name] {
+			events = append(events, GeofenceEvent{Zone: z.Name, Event: GeofenceEnter, Lat: snap.Lat, Lon: snap.Lon, Timestamp: ts})
+		}
+	}
+	if len(events) == 0 {
+		return g.state, nil
+	}
+	sort.Strings(zones)
+	g.state = GeofenceState{Zone: zone, Zones: zones, Timestamp: ts}
+	if err := writeJSONFile(g.statePath(), g.state); err != nil {
+		log.Warn().Msgf("Error saving geofence state: %v", err.Error())
+	}
+	return g.state, events
+}
+
+func (g *Geofence) publishEvent(client MQTT.Client, event GeofenceEvent) {
+	log.Info().Msgf("Geofence %v %v", event.Event, event.Zone)
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "geofence/"+event.Zone+"/event", string(jsonData))
+	WriteDerivedPoint(influxdb2.NewPoint("geofence",
+		map[string]string{"Zone": event.Zone, "Event": event.Event},
+		map[string]interface{}{"Lat": event.Lat, "Lon": event.Lon}, event.Timestamp))
+}
+
+// tagZone adds the current zone to a point unless the point already names a zone
+func tagZone(p *write.Point) {
+	if SharedGeofence == nil {
+		return
+	}
+	zone := SharedGeofence.CurrentZone()
+	if zone == "" {
+		return
+	}
+	for _, tag := range p.TagList() {
+		if tag.Key == "Zone" {
+			return
+		}
+	}
+	p.AddTag("Zone", zone)
+}
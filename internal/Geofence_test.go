@@ -0,0 +1,133 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGeofenceConfig() GeofenceConfig {
+	return GeofenceConfig{
+		Enabled: true,
+		Zones: []GeofenceZone{
+			{
+				Name: "home-marina",
+				Polygon: []GeoPoint{
+					{Lat: 37.80, Lon: -122.42},
+					{Lat: 37.80, Lon: -122.40},
+					{Lat: 37.82, Lon: -122.40},
+					{Lat: 37.82, Lon: -122.42},
+				},
+			},
+			{Name: "no-wake", Lat: 37.81, Lon: -122.41, Radius: 200},
+		},
+	}
+}
+
+// pointsNamed ignores points written by handler goroutines left over from other tests
+func pointsNamed(mockWriteAPI *MockInfluxWriteAPI, name string) []*write.Point {
+	var points []*write.Point
+	for _, p := range mockWriteAPI.Points {
+		if p.Name() == name {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+func pointTag(p *write.Point, key string) string {
+	for _, tag := range p.TagList() {
+		if tag.Key == key {
+			return tag.Value
+		}
+	}
+	return ""
+}
+
+func TestGeofenceEntryExit(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	client := &MockMQTTClient{}
+	dataDir := t.TempDir()
+	fence := NewGeofence(testGeofenceConfig(), dataDir)
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Outside every zone
+	fence.Update(client, VesselSnapshot{Lat: 37.70, Lon: -122.41}, start)
+	assert.Equal(t, "", fence.CurrentZone())
+	assert.Len(t, pointsNamed(mockWriteAPI, "geofence"), 0)
+
+	// Into the marina
+	fence.Update(client, VesselSnapshot{Lat: 37.801, Lon: -122.419}, start.Add(time.Minute))
+	assert.Equal(t, "home-marina", fence.CurrentZone())
+	assert.Len(t, pointsNamed(mockWriteAPI, "geofence"), 1)
+	assert.Equal(t, "home-marina", pointTag(pointsNamed(mockWriteAPI, "geofence")[0], "Zone"))
+	assert.Equal(t, GeofenceEnter, pointTag(pointsNamed(mockWriteAPI, "geofence")[0], "Event"))
+
+	// The no-wake circle is inside the marina and is the more specific zone
+	fence.Update(client, VesselSnapshot{Lat: 37.8101, Lon: -122.4101}, start.Add(2*time.Minute))
+	assert.Equal(t, "no-wake", fence.CurrentZone())
+	assert.Equal(t, []string{"home-marina", "no-wake"}, fence.State().Zones)
+	assert.Len(t, pointsNamed(mockWriteAPI, "geofence"), 2)
+
+	// No new events while staying put
+	fence.Update(client, VesselSnapshot{Lat: 37.8102, Lon: -122.4102}, start.Add(3*time.Minute))
+	assert.Len(t, pointsNamed(mockWriteAPI, "geofence"), 2)
+
+	// The zone survives a restart
+	restored := NewGeofence(testGeofenceConfig(), dataDir)
+	assert.Equal(t, "no-wake", restored.CurrentZone())
+
+	// Straight out of both zones
+	fence.Update(client, VesselSnapshot{Lat: 37.90, Lon: -122.41}, start.Add(10*time.Minute))
+	assert.Equal(t, "", fence.CurrentZone())
+	assert.Len(t, pointsNamed(mockWriteAPI, "geofence"), 4)
+	assert.Equal(t, GeofenceExit, pointTag(pointsNamed(mockWriteAPI, "geofence")[2], "Event"))
+	assert.Equal(t, GeofenceExit, pointTag(pointsNamed(mockWriteAPI, "geofence")[3], "Event"))
+}
+
+func TestTagZone(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	original := SharedGeofence
+	defer func() { SharedGeofence = original }()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	SharedGeofence = nil
+	WriteDerivedPoint(influxdb2.NewPointWithMeasurement("zoneTest").AddField("Value", 1))
+	assert.Equal(t, "", pointTag(pointsNamed(mockWriteAPI, "zoneTest")[0], "Zone"))
+
+	SharedGeofence = NewGeofence(testGeofenceConfig(), t.TempDir())
+	SharedGeofence.Update(nil, VesselSnapshot{Lat: 37.801, Lon: -122.419}, time.Now())
+	mockWriteAPI.Points = nil
+	WriteDerivedPoint(influxdb2.NewPointWithMeasurement("zoneTest").AddField("Value", 1))
+	assert.Equal(t, "home-marina", pointTag(pointsNamed(mockWriteAPI, "zoneTest")[0], "Zone"))
+
+	// A point that already names a zone keeps it
+	WriteDerivedPoint(influxdb2.NewPointWithMeasurement("zoneTest").AddTag("Zone", "no-wake").AddField("Value", 1))
+	assert.Equal(t, "no-wake", pointTag(pointsNamed(mockWriteAPI, "zoneTest")[1], "Zone"))
+}
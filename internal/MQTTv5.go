@@ -0,0 +1,406 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	"github.com/eclipse/paho.golang/paho/store/file"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// v5SessionExpiry is how long an MQTT 5 broker keeps a persistent session while the daemon is away
+const v5SessionExpiry = 24 * 60 * 60
+
+// V5Client adapts an MQTT 5 connection to the MQTT.Client interface so the handlers work with either protocol
+// With retry the connection is kept up in the background, otherwise Connect fails on the first error
+type V5Client struct {
+	conf      BrokerConfig
+	retry     bool
+	onConnect MQTT.OnConnectHandler
+	onLost    MQTT.ConnectionLostHandler
+	router    *paho.StandardRouter
+	connected atomic.Bool
+
+	mu        sync.Mutex
+	cm        *autopaho.ConnectionManager
+	cancel    context.CancelFunc
+	connToken *v5Token
+	routes    map[string]MQTT.MessageHandler
+}
+
+func NewV5Client(conf BrokerConfig, retry bool, onConnect MQTT.OnConnectHandler, onLost MQTT.ConnectionLostHandler) *V5Client {
+	return &V5Client{
+		conf:      conf,
+		retry:     retry,
+		onConnect: onConnect,
+		onLost:    onLost,
+		router:    paho.NewStandardRouter(),
+		routes:    make(map[string]MQTT.MessageHandler),
+	}
+}
+
+// clientConfig builds the autopaho config with the same credentials, TLS and session settings as the v3 client
+func (c *V5Client) clientConfig() (autopaho.ClientConfig, error) {
+	serverURL, err := url.Parse(c.conf.Host)
+	if err != nil {
+		return autopaho.ClientConfig{}, err
+	}
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverURL},
+		TlsCfg:                        brokerTLSConfig(c.conf),
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: c.conf.CleanSession,
+		ConnectUsername:               c.conf.Username,
+		ConnectPassword:               []byte(c.conf.Password.Value()),
+		OnConnectionUp:                c.connectionUp,
+		OnConnectError:                c.connectError,
+		ClientConfig: paho.ClientConfig{
+			ClientID:           c.conf.ClientID,
+			OnPublishReceived:  []func(paho.PublishReceived) (bool, error){c.publishReceived},
+			OnClientError:      c.connectionLost,
+			OnServerDisconnect: c.serverDisconnect,
+		},
+	}
+	if c.conf.WillTopic != "" {
+		cfg.WillMessage = &paho.WillMessage{Topic: c.conf.WillTopic, Payload: []byte(c.conf.WillPayload), QoS: 1, Retain: true}
+	}
+	if !c.conf.CleanSession {
+		cfg.SessionExpiryInterval = v5SessionExpiry
+		if c.conf.StoreDir != "" {
+			if err := os.MkdirAll(c.conf.StoreDir, 0750); err != nil {
+				return autopaho.ClientConfig{}, err
+			}
+			clientStore, err := file.New(c.conf.StoreDir, "client", ".msg")
+			if err != nil {
+				return autopaho.ClientConfig{}, err
+			}
+			serverStore, err := file.New(c.conf.StoreDir, "server", ".msg")
+			if err != nil {
+				return autopaho.ClientConfig{}, err
+			}
+			cfg.Session = state.New(clientStore, serverStore)
+		}
+	}
+	return cfg, nil
+}
+
+func (c *V5Client) connectionUp(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	c.connected.Store(true)
+	c.mu.Lock()
+	token := c.connToken
+	c.mu.Unlock()
+	token.complete(nil)
+	if c.onConnect != nil {
+		c.onConnect(c)
+	}
+}
+
+func (c *V5Client) connectError(err error) {
+	log.Warn().Msgf("Error connecting to %v: %v", c.conf.Host, err.Error())
+	if c.retry {
+		return
+	}
+	c.mu.Lock()
+	token := c.connToken
+	c.mu.Unlock()
+	token.complete(err)
+	c.Disconnect(0)
+}
+
+func (c *V5Client) connectionLost(err error) {
+	if !c.connected.Swap(false) {
+		return
+	}
+	if c.onLost != nil {
+		c.onLost(c, err)
+	}
+}
+
+func (c *V5Client) serverDisconnect(disconnect *paho.Disconnect) {
+	reason := "server disconnected"
+	if disconnect.Properties != nil && disconnect.Properties.ReasonString != "" {
+		reason = disconnect.Properties.ReasonString
+	}
+	c.connectionLost(errors.New(reason))
+}
+
+func (c *V5Client) publishReceived(received paho.PublishReceived) (bool, error) {
+	packet := received.Packet.Packet()
+	if packet.Properties == nil {
+		// The router expects properties which every publish read off the wire has
+		packet.Properties = &packets.Properties{}
+	}
+	c.router.Route(packet)
+	return true, nil
+}
+
+// Connect starts the connection and returns a token that completes once connected
+func (c *V5Client) Connect() MQTT.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connToken = newV5Token()
+	cfg, err := c.clientConfig()
+	if err != nil {
+		c.connToken.complete(err)
+		return c.connToken
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cm, err := autopaho.NewConnection(ctx, cfg)
+	if err != nil {
+		cancel()
+		c.connToken.complete(err)
+		return c.connToken
+	}
+	c.cm = cm
+	c.cancel = cancel
+	return c.connToken
+}
+
+// Disconnect closes the connection waiting up to quiesce milliseconds
+func (c *V5Client) Disconnect(quiesce uint) {
+	c.mu.Lock()
+	cm, cancel := c.cm, c.cancel
+	c.cm, c.cancel = nil, nil
+	c.mu.Unlock()
+	c.connected.Store(false)
+	if cm == nil {
+		return
+	}
+	go func() {
+		ctx, done := context.WithTimeout(context.Background(), time.Duration(quiesce)*time.Millisecond)
+		defer done()
+		err := cm.Disconnect(ctx)
+		if err != nil {
+			log.Debug().Msgf("Error disconnecting from %v: %v", c.conf.Host, err.Error())
+		}
+		cancel()
+	}()
+}
+
+func (c *V5Client) manager() *autopaho.ConnectionManager {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cm
+}
+
+func (c *V5Client) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	return c.PublishWithProperties(topic, qos, retained, payload, nil)
+}
+
+// PublishWithProperties publishes with MQTT 5 properties such as user properties and message expiry
+func (c *V5Client) PublishWithProperties(topic string, qos byte, retained bool, payload interface{}, props *paho.PublishProperties) MQTT.Token {
+	token := newV5Token()
+	cm := c.manager()
+	if cm == nil || !c.IsConnected() {
+		token.complete(MQTT.ErrNotConnected)
+		return token
+	}
+	var body []byte
+	switch p := payload.(type) {
+	case string:
+		body = []byte(p)
+	case []byte:
+		body = p
+	default:
+		token.complete(errors.New("unknown payload type"))
+		return token
+	}
+	go func() {
+		_, err := cm.Publish(context.Background(), &paho.Publish{
+			Topic:      topic,
+			QoS:        qos,
+			Retain:     retained,
+			Payload:    body,
+			Properties: props,
+		})
+		token.complete(err)
+	}()
+	return token
+}
+
+func (c *V5Client) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+func (c *V5Client) SubscribeMultiple(filters map[string]byte, callback MQTT.MessageHandler) MQTT.Token {
+	token := newV5Token()
+	cm := c.manager()
+	if cm == nil {
+		token.complete(MQTT.ErrNotConnected)
+		return token
+	}
+	sub := &paho.Subscribe{}
+	for topic, qos := range filters {
+		if callback != nil {
+			c.AddRoute(topic, callback)
+		}
+		sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: qos})
+	}
+	go func() {
+		_, err := cm.Subscribe(context.Background(), sub)
+		token.complete(err)
+	}()
+	return token
+}
+
+func (c *V5Client) Unsubscribe(topics ...string) MQTT.Token {
+	token := newV5Token()
+	cm := c.manager()
+	if cm == nil {
+		token.complete(MQTT.ErrNotConnected)
+		return token
+	}
+	c.mu.Lock()
+	for _, topic := range topics {
+		delete(c.routes, topic)
+		c.router.UnregisterHandler(topic)
+	}
+	c.mu.Unlock()
+	go func() {
+		_, err := cm.Unsubscribe(context.Background(), &paho.Unsubscribe{Topics: topics})
+		token.complete(err)
+	}()
+	return token
+}
+
+// AddRoute sets the callback for a topic filter, replacing any earlier one as the v3 client does
+// The filter is registered with the router once since subscribing again on every reconnect would add handlers
+func (c *V5Client) AddRoute(topic string, callback MQTT.MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, registered := c.routes[topic]
+	c.routes[topic] = callback
+	if registered {
+		return
+	}
+	c.router.RegisterHandler(topic, func(p *paho.Publish) {
+		c.mu.Lock()
+		callback := c.routes[topic]
+		c.mu.Unlock()
+		if callback != nil {
+			callback(c, &v5Message{publish: p})
+		}
+	})
+}
+
+// OptionsReader describes the connection, the v3 options have no way to say MQTT 5
+func (c *V5Client) OptionsReader() MQTT.ClientOptionsReader {
+	opts := MQTT.NewClientOptions()
+	opts.AddBroker(c.conf.Host)
+	opts.SetClientID(c.conf.ClientID)
+	opts.SetCleanSession(c.conf.CleanSession)
+	return MQTT.NewOptionsReader(opts)
+}
+
+func (c *V5Client) IsConnected() bool {
+	return c.connected.Load()
+}
+
+func (c *V5Client) IsConnectionOpen() bool {
+	return c.connected.Load()
+}
+
+// v5Token is an MQTT.Token completed by the goroutine doing the work
+type v5Token struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newV5Token() *v5Token {
+	return &v5Token{done: make(chan struct{})}
+}
+
+func (t *v5Token) complete(err error) {
+	t.once.Do(func() {
+		t.err = err
+		close(t.done)
+	})
+}
+
+func (t *v5Token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *v5Token) WaitTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *v5Token) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *v5Token) Error() error {
+	select {
+	case <-t.done:
+		return t.err
+	default:
+		return nil
+	}
+}
+
+// v5Message adapts a received MQTT 5 publish to MQTT.Message
+type v5Message struct {
+	publish *paho.Publish
+}
+
+func (m *v5Message) Duplicate() bool {
+	return false
+}
+
+func (m *v5Message) Qos() byte {
+	return m.publish.QoS
+}
+
+func (m *v5Message) Retained() bool {
+	return m.publish.Retain
+}
+
+func (m *v5Message) Topic() string {
+	return m.publish.Topic
+}
+
+func (m *v5Message) MessageID() uint16 {
+	return m.publish.PacketID
+}
+
+func (m *v5Message) Payload() []byte {
+	return m.publish.Payload
+}
+
+// Ack is a no-op since autopaho acknowledges once the handlers return
+func (m *v5Message) Ack() {}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV5ClientConfig(t *testing.T) {
+	client := NewV5Client(BrokerConfig{
+		Name:         "cloud",
+		Host:         "tls://mqtt.example.com:8883",
+		Username:     "boat",
+		Password:     "secret",
+		CACert:       []byte("not a cert"),
+		ClientID:     "boat-cloud",
+		CleanSession: true,
+	}, true, nil, nil)
+	cfg, err := client.clientConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "tls://mqtt.example.com:8883", cfg.ServerUrls[0].String())
+	assert.Equal(t, "boat", cfg.ConnectUsername)
+	assert.Equal(t, []byte("secret"), cfg.ConnectPassword)
+	assert.Equal(t, "boat-cloud", cfg.ClientID)
+	assert.NotNil(t, cfg.TlsCfg)
+	assert.True(t, cfg.CleanStartOnInitialConnection)
+	assert.Zero(t, cfg.SessionExpiryInterval)
+	assert.Nil(t, cfg.Session)
+	assert.Nil(t, cfg.WillMessage)
+
+	// Persistent sessions outlive the connection and keep in-flight messages on disk
+	client.conf.CleanSession = false
+	client.conf.StoreDir = filepath.Join(t.TempDir(), "mqtt", "cloud")
+	cfg, err = client.clientConfig()
+	require.NoError(t, err)
+	assert.False(t, cfg.CleanStartOnInitialConnection)
+	assert.Equal(t, uint32(v5SessionExpiry), cfg.SessionExpiryInterval)
+	assert.NotNil(t, cfg.Session)
+	assert.DirExists(t, client.conf.StoreDir)
+
+	client.conf.WillTopic = "msh/daemon/status"
+	client.conf.WillPayload = `{"Status":"offline"}`
+	cfg, err = client.clientConfig()
+	require.NoError(t, err)
+	require.NotNil(t, cfg.WillMessage)
+	assert.Equal(t, "msh/daemon/status", cfg.WillMessage.Topic)
+	assert.Equal(t, []byte(`{"Status":"offline"}`), cfg.WillMessage.Payload)
+	assert.Equal(t, byte(1), cfg.WillMessage.QoS)
+	assert.True(t, cfg.WillMessage.Retain)
+
+	reader := client.OptionsReader()
+	assert.Equal(t, "boat-cloud", reader.ClientID())
+}
+
+func TestV5ClientRouting(t *testing.T) {
+	client := NewV5Client(BrokerConfig{Host: "tcp://localhost:1883"}, true, nil, nil)
+	received := make(chan MQTT.Message, 2)
+	handler := func(c MQTT.Client, m MQTT.Message) {
+		assert.Same(t, client, c)
+		received <- m
+	}
+	client.AddRoute("$share/msh/vessels/+/navigation/#", handler)
+
+	handled, err := client.publishReceived(paho.PublishReceived{Packet: &paho.Publish{
+		Topic:   "vessels/self/navigation/speedOverGround",
+		QoS:     1,
+		Retain:  true,
+		Payload: []byte(`{"value": 1}`),
+	}})
+	assert.True(t, handled)
+	assert.NoError(t, err)
+	select {
+	case message := <-received:
+		assert.Equal(t, "vessels/self/navigation/speedOverGround", message.Topic())
+		assert.Equal(t, byte(1), message.Qos())
+		assert.True(t, message.Retained())
+		assert.Equal(t, []byte(`{"value": 1}`), message.Payload())
+	case <-time.After(time.Second):
+		t.Fatal("message was not routed")
+	}
+
+	// Nothing can be sent before connecting
+	assert.False(t, client.IsConnected())
+	token := client.Publish("test/topic", 1, false, "payload")
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.ErrorIs(t, token.Error(), MQTT.ErrNotConnected)
+	token = client.Subscribe("test/topic", 1, nil)
+	assert.True(t, token.WaitTimeout(time.Second))
+	assert.ErrorIs(t, token.Error(), MQTT.ErrNotConnected)
+}
+
+func TestV5ClientResubscribe(t *testing.T) {
+	var handled atomic.Int32
+	handler := func(c MQTT.Client, m MQTT.Message) {
+		handled.Add(1)
+	}
+	onConnect := func(c MQTT.Client) {
+		c.Subscribe("vessels/self/navigation/#", 1, handler)
+	}
+	client := NewV5Client(BrokerConfig{Host: "tcp://127.0.0.1:1", CleanSession: true}, true, onConnect, nil)
+	client.Connect()
+	defer client.Disconnect(0)
+
+	// Every reconnect subscribes again but each message is still handled once
+	client.connectionUp(nil, nil)
+	client.connectionUp(nil, nil)
+	_, err := client.publishReceived(paho.PublishReceived{Packet: &paho.Publish{Topic: "vessels/self/navigation/speedOverGround"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), handled.Load())
+
+	// Unsubscribing removes the route
+	client.Unsubscribe("vessels/self/navigation/#")
+	_, err = client.publishReceived(paho.PublishReceived{Packet: &paho.Publish{Topic: "vessels/self/navigation/speedOverGround"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), handled.Load())
+}
+
+func TestV5ClientConnectError(t *testing.T) {
+	// A one-off client gives up on the first failed attempt
+	client := NewBrokerClient(BrokerConfig{Host: "tcp://127.0.0.1:1", CleanSession: true, ProtocolVersion: 5})
+	require.IsType(t, &V5Client{}, client)
+	token := client.Connect()
+	require.True(t, token.WaitTimeout(15*time.Second))
+	assert.Error(t, token.Error())
+	assert.False(t, client.IsConnected())
+
+	// Other protocol versions keep using the v3 client
+	assert.IsType(t, MQTT.NewClient(MQTT.NewClientOptions()), NewBrokerClient(BrokerConfig{Host: "tcp://127.0.0.1:1", ProtocolVersion: 4}))
+}
+
+func TestV5Token(t *testing.T) {
+	token := newV5Token()
+	assert.False(t, token.WaitTimeout(10*time.Millisecond))
+	assert.NoError(t, token.Error())
+	token.complete(MQTT.ErrNotConnected)
+	token.complete(nil)
+	assert.True(t, token.Wait())
+	assert.ErrorIs(t, token.Error(), MQTT.ErrNotConnected)
+	<-token.Done()
+}
@@ -0,0 +1,383 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MaintenanceOK      = "ok"
+	MaintenanceDueSoon = "due-soon"
+	MaintenanceOverdue = "overdue"
+	MaintenanceUnknown = "unknown"
+)
+
+// Engine hours are only written to disk when they move by at least this much
+const maintenanceHoursSaveStep = 0.1
+
+// ErrUnknownMaintenanceItem is returned for an item that is not in the config
+var ErrUnknownMaintenanceItem = errors.New("unknown maintenance item")
+
+// MaintenanceRecord is the persisted history of a single item
+type MaintenanceRecord struct {
+	LastDone      time.Time `json:"LastDone"`
+	LastDoneHours float64   `json:"LastDoneHours"`
+}
+
+// maintenanceState is what is kept in the data dir between runs and shared with the CLI
+// Items never marked done are counted from FirstRun and FirstEngineHours
+type maintenanceState struct {
+	EngineHours      map[string]float64            `json:"EngineHours"`
+	Items            map[string]*MaintenanceRecord `json:"Items"`
+	FirstRun         time.Time                     `json:"FirstRun,omitempty"`
+	FirstEngineHours map[string]float64            `json:"FirstEngineHours,omitempty"`
+}
+
+// MaintenanceStatus is the computed status of a single item
+type MaintenanceStatus struct {
+	Name           string    `json:"Name"`
+	State          string    `json:"State"`
+	Engine         string    `json:"Engine,omitempty"`
+	IntervalHours  float64   `json:"IntervalHours,omitempty"`
+	IntervalDays   uint      `json:"IntervalDays,omitempty"`
+	IntervalMonths uint      `json:"IntervalMonths,omitempty"`
+	LastDone       time.Time `json:"LastDone,omitempty"`
+	LastDoneHours  float64   `json:"LastDoneHours,omitempty"`
+	EngineHours    float64   `json:"EngineHours,omitempty"`
+	HoursRemaining *float64  `json:"HoursRemaining,omitempty"`
+	DueDate        time.Time `json:"DueDate,omitempty"`
+	DaysRemaining  *float64  `json:"DaysRemaining,omitempty"`
+}
+
+// MaintenanceScheduler tracks maintenance items against engine hours and the calendar
+type MaintenanceScheduler struct {
+	mu        sync.Mutex
+	conf      MaintenanceConfig
+	dataDir   string
+	lastSaved map[string]float64
+}
+
+var SharedMaintenanceScheduler *MaintenanceScheduler
+
+func NewMaintenanceScheduler(conf MaintenanceConfig, dataDir string) *MaintenanceScheduler {
+	return &MaintenanceScheduler{
+		conf:      conf,
+		dataDir:   dataDir,
+		lastSaved: make(map[string]float64),
+	}
+}
+
+func (s *MaintenanceScheduler) statePath() string {
+	return filepath.Join(s.dataDir, "maintenance.json")
+}
+
+// The state file is re-read on every change since the CLI updates it while the daemon runs
+// A missing file is an empty state
+func (s *MaintenanceScheduler) load() (maintenanceState, error) {
+	state := maintenanceState{}
+	err := readJSONFile(s.statePath(), &state)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return maintenanceState{}, err
+	}
+	if state.EngineHours == nil {
+		state.EngineHours = make(map[string]float64)
+	}
+	if state.Items == nil {
+		state.Items = make(map[string]*MaintenanceRecord)
+	}
+	if state.FirstEngineHours == nil {
+		state.FirstEngineHours = make(map[string]float64)
+	}
+	return state, nil
+}
+
+// update applies change to the saved state under the state file lock and saves it when change returns true
+// Without the lock a change from the CLI could be lost to one the daemon loaded before it
+func (s *MaintenanceScheduler) update(change func(state *maintenanceState) bool) error {
+	unlock, err := lockJSONFile(s.statePath())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	state, err := s.load()
+	if err != nil {
+		return err
+	}
+	if !change(&state) {
+		return nil
+	}
+	return writeJSONFile(s.statePath(), state)
+}
+
+// UpdateEngineHours records the ECU run time for an engine
+func (s *MaintenanceScheduler) UpdateEngineHours(device string, hours float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if device == "" {
+		device = fuelDefaultEngine
+	}
+	if math.Abs(hours-s.lastSaved[device]) < maintenanceHoursSaveStep {
+		return
+	}
+	err := s.update(func(state *maintenanceState) bool {
+		state.EngineHours[device] = hours
+		if _, ok := state.FirstEngineHours[device]; !ok {
+			state.FirstEngineHours[device] = hours
+		}
+		return true
+	})
+	if err != nil {
+		log.Warn().Msgf("Error saving maintenance state: %v", err.Error())
+		return
+	}
+	s.lastSaved[device] = hours
+}
+
+// RecordFirstRun keeps the time the daemon first ran so items never marked done become due
+func (s *MaintenanceScheduler) RecordFirstRun(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.update(func(state *maintenanceState) bool {
+		if !state.FirstRun.IsZero() {
+			return false
+		}
+		state.FirstRun = now
+		return true
+	})
+	if err != nil {
+		log.Warn().Msgf("Error saving maintenance state: %v", err.Error())
+	}
+}
+
+// MarkDone records an item as done at the given time
+// A negative hours value means use the last known engine hours
+func (s *MaintenanceScheduler) MarkDone(name string, when time.Time, hours float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.item(name)
+	if !ok {
+		return fmt.Errorf("%w %v", ErrUnknownMaintenanceItem, name)
+	}
+	err := s.update(func(state *maintenanceState) bool {
+		if hours < 0 {
+			hours = s.engineHours(*state, item)
+		}
+		state.Items[item.Name] = &MaintenanceRecord{
+			LastDone:      when,
+			LastDoneHours: hours,
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("unable to save maintenance state: %w", err)
+	}
+	log.Info().Msgf("Maintenance item %v done at %v hours", item.Name, hours)
+	return nil
+}
+
+// Statuses computes the status of every configured item
+func (s *MaintenanceScheduler) Statuses(now time.Time) []MaintenanceStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.load()
+	if err != nil {
+		log.Warn().Msgf("Error loading maintenance state: %v", err.Error())
+	}
+	var statuses []MaintenanceStatus
+	for _, item := range s.conf.Items {
+		statuses = append(statuses, s.status(item, state, now))
+	}
+	return statuses
+}
+
+func (s *MaintenanceScheduler) item(name string) (MaintenanceItem, bool) {
+	for _, item := range s.conf.Items {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return MaintenanceItem{}, false
+}
+
+// engineHours returns the hours for the item's engine or the highest of all engines when none is set
+func (s *MaintenanceScheduler) engineHours(state maintenanceState, item MaintenanceItem) float64 {
+	if item.Engine != "" {
+		return state.EngineHours[item.Engine]
+	}
+	hours := 0.0
+	for _, h := range state.EngineHours {
+		hours = math.Max(hours, h)
+	}
+	return hours
+}
+
+// firstEngineHours is engineHours at the first reading the daemon saw
+func (s *MaintenanceScheduler) firstEngineHours(state maintenanceState, item MaintenanceItem) (float64, bool) {
+	if item.Engine != "" {
+		hours, ok := state.FirstEngineHours[item.Engine]
+		return hours, ok
+	}
+	hours := 0.0
+	for _, h := range state.FirstEngineHours {
+		hours = math.Max(hours, h)
+	}
+	return hours, len(state.FirstEngineHours) > 0
+}
+
+func (s *MaintenanceScheduler) status(item MaintenanceItem, state maintenanceState, now time.Time) MaintenanceStatus {
+	status := MaintenanceStatus{
+		Name:           item.Name,
+		State:          MaintenanceUnknown,
+		Engine:         item.Engine,
+		IntervalHours:  item.Hours,
+		IntervalDays:   item.Days,
+		IntervalMonths: item.Months,
+		EngineHours:    s.engineHours(state, item),
+	}
+	since, sinceHours, haveHours := time.Time{}, 0.0, true
+	if record, ok := state.Items[item.Name]; ok {
+		status.LastDone = record.LastDone
+		status.LastDoneHours = record.LastDoneHours
+		since, sinceHours = record.LastDone, record.LastDoneHours
+	} else {
+		// Never marked done so it is counted from the daemon's first run
+		since = state.FirstRun
+		sinceHours, haveHours = s.firstEngineHours(state, item)
+	}
+	hoursDue := item.Hours > 0 && haveHours
+	calendarDue := (item.Days > 0 || item.Months > 0) && !since.IsZero()
+	if !hoursDue && !calendarDue {
+		return status
+	}
+	status.State = MaintenanceOK
+
+	if hoursDue {
+		remaining := sinceHours + item.Hours - status.EngineHours
+		status.HoursRemaining = &remaining
+		if remaining <= 0 {
+			status.State = MaintenanceOverdue
+		} else if remaining <= s.conf.WarnHours {
+			status.State = MaintenanceDueSoon
+		}
+	}
+	if calendarDue {
+		status.DueDate = since.AddDate(0, int(item.Months), int(item.Days))
+		days := status.DueDate.Sub(now).Hours() / 24
+		status.DaysRemaining = &days
+		if days <= 0 {
+			status.State = MaintenanceOverdue
+		} else if days <= float64(s.conf.WarnDays) && status.State != MaintenanceOverdue {
+			status.State = MaintenanceDueSoon
+		}
+	}
+	return status
+}
+
+// Publish reposts the status of every item and a summary of the items needing attention
+func (s *MaintenanceScheduler) Publish(client MQTT.Client, now time.Time) {
+	statuses := s.Statuses(now)
+	var due []MaintenanceStatus
+	for _, status := range statuses {
+		jsonData, err := json.Marshal(status)
+		if err != nil {
+			log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+			continue
+		}
+		PublishDerivedMessage(client, "maintenance/"+status.Name, string(jsonData))
+		switch status.State {
+		case MaintenanceOverdue:
+			log.Warn().Msgf("Maintenance item %v is overdue", status.Name)
+			due = append(due, status)
+		case MaintenanceDueSoon:
+			log.Info().Msgf("Maintenance item %v is due soon", status.Name)
+			due = append(due, status)
+		}
+	}
+	if due == nil {
+		due = []MaintenanceStatus{}
+	}
+	jsonData, err := json.Marshal(due)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "maintenance/due", string(jsonData))
+}
+
+// Run publishes the maintenance status every publish interval for the life of the daemon
+func (s *MaintenanceScheduler) Run(client MQTT.Client) {
+	s.RecordFirstRun(time.Now())
+	s.Publish(client, time.Now())
+	ticker := time.NewTicker(time.Duration(s.conf.PublishInterval) * time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.Publish(client, now)
+	}
+}
+
+// RegisterAPI adds the maintenance endpoints to the API server
+func (s *MaintenanceScheduler) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, s.Statuses(time.Now()))
+	})
+	mux.HandleFunc("POST /api/maintenance/{item}/done", func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			Hours *float64 `json:"Hours"`
+		}{}
+		if r.ContentLength > 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		hours := -1.0
+		if req.Hours != nil {
+			hours = *req.Hours
+		}
+		name := r.PathValue("item")
+		if err := s.MarkDone(name, time.Now(), hours); errors.Is(err, ErrUnknownMaintenanceItem) {
+			writeAPIError(w, http.StatusNotFound, err.Error())
+			return
+		} else if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, status := range s.Statuses(time.Now()) {
+			if status.Name == name {
+				writeAPIJSON(w, http.StatusOK, status)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMaintenanceConfig() MaintenanceConfig {
+	return MaintenanceConfig{
+		Enabled:         true,
+		PublishInterval: 3600,
+		WarnHours:       10,
+		WarnDays:        14,
+		Items: []MaintenanceItem{
+			{Name: "oil-change", Engine: "port", Hours: 100},
+			{Name: "impeller", Hours: 300, Months: 12},
+			{Name: "zincs", Months: 6},
+		},
+	}
+}
+
+func findMaintenanceStatus(statuses []MaintenanceStatus, name string) MaintenanceStatus {
+	for _, status := range statuses {
+		if status.Name == name {
+			return status
+		}
+	}
+	return MaintenanceStatus{}
+}
+
+func TestMaintenanceStatus(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	dataDir := t.TempDir()
+	scheduler := NewMaintenanceScheduler(testMaintenanceConfig(), dataDir)
+	done := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Nothing has been done yet
+	statuses := scheduler.Statuses(done)
+	assert.Len(t, statuses, 3)
+	for _, status := range statuses {
+		assert.Equal(t, MaintenanceUnknown, status.State)
+	}
+
+	scheduler.UpdateEngineHours("port", 1000)
+	scheduler.UpdateEngineHours("starboard", 1200)
+	assert.NoError(t, scheduler.MarkDone("oil-change", done, -1))
+	assert.NoError(t, scheduler.MarkDone("impeller", done, -1))
+	assert.NoError(t, scheduler.MarkDone("zincs", done, -1))
+	assert.Error(t, scheduler.MarkDone("bilge", done, -1))
+
+	statuses = scheduler.Statuses(done.AddDate(0, 1, 0))
+	oil := findMaintenanceStatus(statuses, "oil-change")
+	assert.Equal(t, MaintenanceOK, oil.State)
+	assert.Equal(t, 1000.0, oil.LastDoneHours)
+	assert.InDelta(t, 100.0, *oil.HoursRemaining, 0.001)
+	impeller := findMaintenanceStatus(statuses, "impeller")
+	assert.Equal(t, 1200.0, impeller.LastDoneHours, "Items without an engine use the highest hours")
+	assert.Equal(t, done.AddDate(0, 12, 0), impeller.DueDate)
+
+	// Hours drive the oil change, the calendar drives the zincs
+	scheduler.UpdateEngineHours("port", 1095)
+	statuses = scheduler.Statuses(time.Date(2025, 6, 25, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, MaintenanceDueSoon, findMaintenanceStatus(statuses, "oil-change").State)
+	assert.Equal(t, MaintenanceDueSoon, findMaintenanceStatus(statuses, "zincs").State)
+	assert.Equal(t, MaintenanceOK, findMaintenanceStatus(statuses, "impeller").State)
+
+	scheduler.UpdateEngineHours("port", 1101)
+	statuses = scheduler.Statuses(time.Date(2025, 7, 2, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, MaintenanceOverdue, findMaintenanceStatus(statuses, "oil-change").State)
+	assert.Equal(t, MaintenanceOverdue, findMaintenanceStatus(statuses, "zincs").State)
+
+	// The state survives a restart
+	restored := NewMaintenanceScheduler(testMaintenanceConfig(), dataDir)
+	assert.NoError(t, restored.MarkDone("oil-change", done.AddDate(0, 6, 0), 1101))
+	statuses = restored.Statuses(time.Date(2025, 7, 2, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, MaintenanceOK, findMaintenanceStatus(statuses, "oil-change").State)
+	assert.Equal(t, MaintenanceOverdue, findMaintenanceStatus(statuses, "zincs").State)
+
+	client := &MockMQTTClient{}
+	restored.Publish(client, time.Now())
+}
+
+func TestMaintenanceFirstRun(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	scheduler := NewMaintenanceScheduler(testMaintenanceConfig(), t.TempDir())
+	firstRun := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	scheduler.RecordFirstRun(firstRun)
+	scheduler.RecordFirstRun(firstRun.AddDate(0, 3, 0))
+
+	// Calendar items count from the first run, hour items wait for a first reading
+	statuses := scheduler.Statuses(firstRun.AddDate(0, 1, 0))
+	assert.Equal(t, MaintenanceOK, findMaintenanceStatus(statuses, "zincs").State)
+	assert.Equal(t, firstRun.AddDate(0, 6, 0), findMaintenanceStatus(statuses, "zincs").DueDate)
+	assert.Equal(t, MaintenanceUnknown, findMaintenanceStatus(statuses, "oil-change").State)
+
+	scheduler.UpdateEngineHours("port", 1000)
+	scheduler.UpdateEngineHours("port", 1095)
+	statuses = scheduler.Statuses(firstRun.AddDate(0, 7, 0))
+	oil := findMaintenanceStatus(statuses, "oil-change")
+	assert.Equal(t, MaintenanceDueSoon, oil.State)
+	assert.InDelta(t, 5.0, *oil.HoursRemaining, 0.001)
+	assert.True(t, oil.LastDone.IsZero(), "The item is still never done")
+	assert.Equal(t, MaintenanceOverdue, findMaintenanceStatus(statuses, "zincs").State)
+}
+
+func TestMaintenanceSharedState(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	// The daemon and the CLI each have their own scheduler on the same data dir
+	dataDir := t.TempDir()
+	daemon := NewMaintenanceScheduler(testMaintenanceConfig(), dataDir)
+	cli := NewMaintenanceScheduler(testMaintenanceConfig(), dataDir)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for hours := 1; hours <= 50; hours++ {
+			daemon.UpdateEngineHours("port", float64(hours))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			for _, item := range testMaintenanceConfig().Items {
+				assert.NoError(t, cli.MarkDone(item.Name, time.Now(), 0))
+			}
+		}
+	}()
+	wg.Wait()
+
+	statuses := cli.Statuses(time.Now())
+	for _, item := range testMaintenanceConfig().Items {
+		assert.False(t, findMaintenanceStatus(statuses, item.Name).LastDone.IsZero(), "%v was kept", item.Name)
+	}
+	assert.Equal(t, 50.0, findMaintenanceStatus(statuses, "oil-change").EngineHours)
+
+	// A state file that cannot be parsed is left alone rather than replaced
+	statePath := filepath.Join(dataDir, "maintenance.json")
+	require.NoError(t, os.WriteFile(statePath, []byte("{"), 0644))
+	assert.Error(t, cli.MarkDone("zincs", time.Now(), 0))
+	daemon.UpdateEngineHours("port", 60)
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "{", string(data))
+}
+
+func TestMaintenanceAPI(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	scheduler := NewMaintenanceScheduler(testMaintenanceConfig(), t.TempDir())
+	scheduler.UpdateEngineHours("port", 500)
+	mux := http.NewServeMux()
+	scheduler.RegisterAPI(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/maintenance/oil-change/done", strings.NewReader(`{"Hours": 480}`)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var status MaintenanceStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, "oil-change", status.Name)
+	assert.Equal(t, 480.0, status.LastDoneHours)
+	assert.InDelta(t, 80.0, *status.HoursRemaining, 0.001)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/maintenance/bilge/done", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// A known item that cannot be saved is a server error
+	notADir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notADir, nil, 0644))
+	broken := http.NewServeMux()
+	NewMaintenanceScheduler(testMaintenanceConfig(), notADir).RegisterAPI(broken)
+	rec = httptest.NewRecorder()
+	broken.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/maintenance/zincs/done", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/maintenance", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var statuses []MaintenanceStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, MaintenanceUnknown, findMaintenanceStatus(statuses, "zincs").State)
+}
@@ -0,0 +1,424 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// PathMapping maps a SignalK path to a measurement field
+// Path is a dotted SignalK path relative to the vessel where * matches one segment
+// A rule with no Field marks a known path that carries nothing to keep
+type PathMapping struct {
+	Path        string            `yaml:"path"`
+	Measurement string            `yaml:"measurement"`
+	Field       string            `yaml:"field"`
+	Key         string            `yaml:"key"`
+	Conversion  string            `yaml:"conversion"`
+	Tags        map[string]string `yaml:"tags"`
+	Optional    bool              `yaml:"optional"`
+}
+
+// mappingConversions are the unit conversions a mapping can name
+var mappingConversions = map[string]func(float64) float64{
+	"":                      func(v float64) float64 { return v },
+	"radians-to-degrees":    RadiansToDegrees,
+	"mps-to-knots":          MetersPerSecondToKnots,
+	"meters-to-feet":        MetersToFeet,
+	"kelvin-to-fahrenheit":  KelvinToFarenheit,
+	"kelvin-to-celsius":     KelvinToCelsius,
+	"celsius-to-fahrenheit": CelsiusToFahrenheit,
+	"pascal-to-psi":         PascalToPSI,
+	"pascal-to-hpa":         func(v float64) float64 { return v / 100 },
+	"pascal-to-inhg":        func(v float64) float64 { return MillibarToInHg(v / 100) },
+	"ratio-to-percent":      func(v float64) float64 { return v * 100 },
+	"hz-to-rpm":             func(v float64) float64 { return math.Trunc(v) * 60 },
+	"m3-to-gallons":         CubicMetersToGallons,
+	"m3s-to-gph":            CubicMetersPerSecondToGallonsPerHour,
+}
+
+// matchPath matches a glob against the end of a path
+// The path may be just its last segments, as the built-in handlers only know the topic leaf
+// It returns what each * matched and how many literal segments matched
+func matchPath(glob string, path string) ([]string, int, bool) {
+	globParts := strings.Split(glob, ".")
+	pathParts := strings.Split(path, ".")
+	if len(pathParts) > len(globParts) {
+		return nil, 0, false
+	}
+	globParts = globParts[len(globParts)-len(pathParts):]
+	var captures []string
+	score := 0
+	for i, g := range globParts {
+		switch g {
+		case "*":
+			captures = append(captures, pathParts[i])
+		case pathParts[i]:
+			score++
+		default:
+			return nil, 0, false
+		}
+	}
+	return captures, score, true
+}
+
+// findPathMappings returns the rules for the most specific glob matching a path
+// Rules sharing that glob all apply, such as latitude and longitude from one position
+// Ties go to the shorter glob, so a bare oilTemperature is the engine's rather than the transmission's,
+// and then to the glob that sorts first so the order of the rules never matters
+func findPathMappings(mappings []PathMapping, measurement string, path string) ([]PathMapping, []string) {
+	var found []PathMapping
+	var captures []string
+	best := -1
+	bestPath := ""
+	for _, mapping := range mappings {
+		if measurement != "" && mapping.Measurement != measurement {
+			continue
+		}
+		c, score, ok := matchPath(mapping.Path, path)
+		if !ok {
+			continue
+		}
+		if mapping.Path == bestPath {
+			found = append(found, mapping)
+		} else if score > best || (score == best && morePreciseGlob(mapping.Path, bestPath)) {
+			best = score
+			bestPath = mapping.Path
+			captures = c
+			found = []PathMapping{mapping}
+		}
+	}
+	return found, captures
+}
+
+// morePreciseGlob breaks a tie between two globs that matched as many literal segments
+func morePreciseGlob(glob string, other string) bool {
+	segments, otherSegments := strings.Count(glob, "."), strings.Count(other, ".")
+	if segments != otherSegments {
+		return segments < otherSegments
+	}
+	return glob < other
+}
+
+// mappingValue pulls the raw value for a rule out of a SignalK message
+func mappingValue(rawData map[string]any, mapping PathMapping) (any, error) {
+	if mapping.Key == "" {
+		return rawData["value"], nil
+	}
+	obj, err := ParseMapString(rawData["value"])
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing map[string]: %v", err.Error())
+	}
+	return obj[mapping.Key], nil
+}
+
+// applyPathMappings sets the fields of a built-in data type from the rules matching a path
+// Configured rules take precedence over the defaults so a default can be overridden by path
+// It returns false when no rule knows the path
+func applyPathMappings(rawData map[string]any, path string, data SensorData) bool {
+	found, _ := findPathMappings(SharedSubscriptionConfig.Mappings, data.GetMeasurementName(), path)
+	if len(found) == 0 {
+		found, _ = findPathMappings(DefaultPathMappings(), data.GetMeasurementName(), path)
+	}
+	if len(found) == 0 {
+		return false
+	}
+	v := reflect.ValueOf(data).Elem()
+	for _, mapping := range found {
+		if mapping.Field == "" {
+			continue
+		}
+		fv := v.FieldByName(mapping.Field)
+		if !fv.IsValid() || !fv.CanSet() {
+			log.Warn().Msgf("Mapping for %v names unknown field %v", mapping.Path, mapping.Field)
+			continue
+		}
+		raw, err := mappingValue(rawData, mapping)
+		if err != nil {
+			log.Warn().Msg(err.Error())
+			continue
+		}
+		value, err := convertMappingValue(raw, mapping, fv.Kind() == reflect.String)
+		if err != nil {
+			if mapping.Optional {
+				log.Trace().Msg(err.Error())
+			} else {
+				log.Warn().Msg(err.Error())
+			}
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(value.(string))
+		case reflect.Int64:
+			fv.SetInt(int64(value.(float64)))
+		case reflect.Float64:
+			fv.SetFloat(value.(float64))
+		default:
+			log.Warn().Msgf("Mapping for %v names field %v which is not a number or string", mapping.Path, mapping.Field)
+			continue
+		}
+		data.MarkPresent(mapping.Field)
+	}
+	return true
+}
+
+// convertMappingValue parses a raw value and applies the rule's conversion
+func convertMappingValue(raw any, mapping PathMapping, asString bool) (any, error) {
+	if asString {
+		str, err := ParseString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing string: %v", err.Error())
+		}
+		return strings.TrimSpace(str), nil
+	}
+	floatTmp, err := ParseFloat64(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing float64: %v", err.Error())
+	}
+	conversion, ok := mappingConversions[mapping.Conversion]
+	if !ok {
+		return nil, fmt.Errorf("unknown conversion %v for %v", mapping.Conversion, mapping.Path)
+	}
+	return conversion(floatTmp), nil
+}
+
+// LoadPathMappings reads the mapping rules from a YAML file
+// It is read directly rather than through viper so tag names keep their case
+func LoadPathMappings(path string) ([]PathMapping, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Mappings []PathMapping `yaml:"mappings"`
+	}
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return nil, err
+	}
+	mappings := file.Mappings
+	var valid []PathMapping
+	for _, mapping := range mappings {
+		if mapping.Path == "" || mapping.Measurement == "" {
+			log.Warn().Msgf("Mapping %+v needs a path and a measurement and will be ignored", mapping)
+			continue
+		}
+		if _, ok := mappingConversions[mapping.Conversion]; !ok {
+			log.Warn().Msgf("Mapping for %v has unknown conversion %v and will be ignored", mapping.Path, mapping.Conversion)
+			continue
+		}
+		valid = append(valid, mapping)
+	}
+	return valid, nil
+}
+
+// MappedData is a measurement built entirely from configured path mappings
+type MappedData struct {
+	BaseSensorData
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:      "mapped",
+		TopicsKey: "mappedTopics",
+		Handler:   OnMappedMessage,
+		Optional:  true,
+	})
+}
+
+// OnMappedMessage is called when a message arrives on a topic handled by the configured mappings
+func OnMappedMessage(client MQTT.Client, message MQTT.Message) {
+	dispatchMessage(handleMappedMessage, client, message)
+}
+
+// handleMappedMessage builds one measurement per mapped target of the message's path
+func handleMappedMessage(client MQTT.Client, message MQTT.Message) {
+	path := signalKPathFromTopic(message.Topic())
+	found, captures := findPathMappings(SharedSubscriptionConfig.Mappings, "", path)
+	if len(found) == 0 {
+		log.Debug().Msgf("No mapping for path %v", path)
+		return
+	}
+	byMeasurement := make(map[string][]PathMapping)
+	var order []string
+	for _, mapping := range found {
+		if _, ok := byMeasurement[mapping.Measurement]; !ok {
+			order = append(order, mapping.Measurement)
+		}
+		byMeasurement[mapping.Measurement] = append(byMeasurement[mapping.Measurement], mapping)
+	}
+	for _, measurement := range order {
+		mappings := byMeasurement[measurement]
+		data := &MappedData{
+			Measurement: measurement,
+			Tags:        make(map[string]string),
+			Fields:      make(map[string]interface{}),
+		}
+		HandleSensorMessage(client, message, data, func(rawData map[string]any, _ string, data SensorData) {
+			processMappedData(rawData, mappings, captures, data)
+		})
+	}
+}
+
+// signalKPathFromTopic turns .../vessels/self/environment/inside/humidity into environment.inside.humidity
+func signalKPathFromTopic(topic string) string {
+	idx := strings.Index("/"+topic, "/vessels/")
+	if idx < 0 {
+		return strings.ReplaceAll(topic, "/", ".")
+	}
+	path := topic[idx+len("vessels/"):]
+	if end := strings.Index(path, "/"); end >= 0 {
+		path = path[end+1:]
+	}
+	return strings.ReplaceAll(path, "/", ".")
+}
+
+// expandCaptures replaces $1, $2... with what each * in the path glob matched
+func expandCaptures(s string, captures []string) string {
+	for i := len(captures); i > 0; i-- {
+		s = strings.ReplaceAll(s, "$"+strconv.Itoa(i), captures[i-1])
+	}
+	return s
+}
+
+// processMappedData fills a MappedData from its rules
+// String values are kept as they are and numbers go through the rule's conversion
+func processMappedData(rawData map[string]any, mappings []PathMapping, captures []string, data SensorData) {
+	mapped, ok := data.(*MappedData)
+	if !ok {
+		log.Error().Msg("Failed to cast data to MappedData type")
+		return
+	}
+	for _, mapping := range mappings {
+		for k, v := range mapping.Tags {
+			mapped.Tags[k] = expandCaptures(v, captures)
+		}
+		if mapping.Field == "" {
+			continue
+		}
+		raw, err := mappingValue(rawData, mapping)
+		if err != nil {
+			log.Warn().Msg(err.Error())
+			continue
+		}
+		_, isString := raw.(string)
+		value, err := convertMappingValue(raw, mapping, isString)
+		if err != nil {
+			if mapping.Optional {
+				log.Trace().Msg(err.Error())
+			} else {
+				log.Warn().Msg(err.Error())
+			}
+			continue
+		}
+		field := expandCaptures(mapping.Field, captures)
+		mapped.Fields[field] = value
+		mapped.MarkPresent(field)
+	}
+}
+
+// ToJSON serializes the data to JSON
+func (meas *MappedData) ToJSON() string {
+	out := make(map[string]interface{})
+	for k, v := range meas.Tags {
+		out[k] = v
+	}
+	for k, v := range meas.Fields {
+		out[k] = v
+	}
+	if meas.Source != "" {
+		out["Source"] = meas.Source
+	}
+	out["Timestamp"] = meas.Timestamp
+	jsonData, err := json.Marshal(out)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+	}
+	return string(jsonData)
+}
+
+// LogJSON logs the JSON representation of the data
+func (meas *MappedData) LogJSON() {
+	json := meas.ToJSON()
+	log.Trace().Msgf("Mapped %v: %v", meas.Measurement, json)
+	if SharedSubscriptionConfig.Categories["mapped"].Verbose {
+		log.Info().Msgf("Mapped %v: %v", meas.Measurement, json)
+	}
+}
+
+// IsEmpty checks if the data has any meaningful values
+func (meas *MappedData) IsEmpty() bool {
+	return len(meas.Fields) == 0
+}
+
+// GetInfluxTags returns tags for InfluxDB
+func (meas *MappedData) GetInfluxTags() map[string]string {
+	tagTmp := meas.BaseSensorData.GetInfluxTags()
+	for k, v := range meas.Tags {
+		tagTmp[k] = v
+	}
+	return tagTmp
+}
+
+// GetInfluxFields returns fields for InfluxDB
+func (meas *MappedData) GetInfluxFields() map[string]interface{} {
+	measTmp := make(map[string]interface{})
+	for k, v := range meas.Fields {
+		measTmp[k] = v
+	}
+	return measTmp
+}
+
+// ToInfluxPoint creates an InfluxDB point
+func (meas *MappedData) ToInfluxPoint() *write.Point {
+	return influxdb2.NewPoint(meas.Measurement, meas.GetInfluxTags(), meas.GetInfluxFields(), meas.Timestamp)
+}
+
+// GetLogEnabled returns whether logging is enabled for this data type
+func (meas *MappedData) GetLogEnabled() bool {
+	return SharedSubscriptionConfig.Categories["mapped"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *MappedData) GetCategory() string {
+	return "mapped"
+}
+
+// GetMeasurementName returns the measurement name for InfluxDB
+func (meas *MappedData) GetMeasurementName() string {
+	return meas.Measurement
+}
+
+// GetTopicPrefix returns the topic prefix for MQTT publishing
+func (meas *MappedData) GetTopicPrefix() string {
+	return meas.Measurement
+}
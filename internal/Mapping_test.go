@@ -0,0 +1,207 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		glob     string
+		path     string
+		ok       bool
+		score    int
+		captures []string
+	}{
+		{"navigation.position", "navigation.position", true, 2, nil},
+		{"navigation.position", "position", true, 1, nil},
+		{"navigation.position", "navigation.attitude", false, 0, nil},
+		{"propulsion.*.oilPressure", "propulsion.port.oilPressure", true, 2, []string{"port"}},
+		{"propulsion.*.oilPressure", "transmission.oilPressure", true, 1, []string{"transmission"}},
+		{"propulsion.*.transmission.oilPressure", "transmission.oilPressure", true, 2, nil},
+		{"tanks.*.*.currentLevel", "tanks.fuel.0.currentLevel", true, 2, []string{"fuel", "0"}},
+		{"name", "navigation.name", false, 0, nil},
+	}
+	for _, tt := range tests {
+		captures, score, ok := matchPath(tt.glob, tt.path)
+		assert.Equal(t, tt.ok, ok, "%v %v", tt.glob, tt.path)
+		assert.Equal(t, tt.score, score, "%v %v", tt.glob, tt.path)
+		assert.Equal(t, tt.captures, captures, "%v %v", tt.glob, tt.path)
+	}
+}
+
+func TestFindPathMappingsTies(t *testing.T) {
+	engine := PathMapping{Path: "propulsion.*.oilTemperature", Measurement: "propulsion", Field: "OilTempF"}
+	tranny := PathMapping{Path: "propulsion.*.transmission.oilTemperature", Measurement: "propulsion", Field: "TransOilTempF"}
+	alpha := PathMapping{Path: "environment.a.temperature", Measurement: "outside", Field: "TempF"}
+	beta := PathMapping{Path: "environment.b.temperature", Measurement: "outside", Field: "TempF"}
+
+	// The rule order does not change the winner
+	for _, mappings := range [][]PathMapping{{engine, tranny, alpha, beta}, {beta, alpha, tranny, engine}} {
+		found, _ := findPathMappings(mappings, "propulsion", "oilTemperature")
+		assert.Equal(t, []PathMapping{engine}, found)
+		found, _ = findPathMappings(mappings, "propulsion", "transmission.oilTemperature")
+		assert.Equal(t, []PathMapping{tranny}, found)
+		found, _ = findPathMappings(mappings, "outside", "temperature")
+		assert.Equal(t, []PathMapping{alpha}, found)
+	}
+}
+
+func TestDefaultPathMappings(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	// Full paths and the leaf names the built-in handlers pass resolve the same way
+	prop := &Propulsion{}
+	assert.True(t, applyPathMappings(map[string]any{"value": 373.15}, "propulsion.port.transmission.oilTemperature", prop))
+	assert.InDelta(t, 212.0, prop.TransOilTempF, 0.01)
+	assert.Zero(t, prop.OilTempF)
+	assert.True(t, applyPathMappings(map[string]any{"value": 373.15}, "oilTemperature", prop))
+	assert.InDelta(t, 212.0, prop.OilTempF, 0.01)
+	// The fraction of a Hz is dropped before it is scaled
+	assert.True(t, applyPathMappings(map[string]any{"value": 12.5}, "revolutions", prop))
+	assert.Equal(t, int64(720), prop.RPM)
+
+	nav := &Navigation{}
+	assert.True(t, applyPathMappings(map[string]any{"value": map[string]any{"latitude": 0.0, "longitude": -76.5}}, "navigation.position", nav))
+	assert.Equal(t, -76.5, nav.Lon)
+	assert.True(t, nav.IsPresent("Lat"))
+	assert.False(t, nav.IsPresent("Alt"))
+
+	// Steering's headingMagnetic is the autopilot target, not the boat's heading
+	steer := &Steering{}
+	assert.True(t, applyPathMappings(map[string]any{"value": 1.0}, "headingMagnetic", steer))
+	assert.InDelta(t, 57.2958, steer.TargetHeadingMag, 0.001)
+
+	gnss := &GNSS{}
+	assert.True(t, applyPathMappings(map[string]any{"value": " GPS "}, "type", gnss))
+	assert.Equal(t, "GPS", gnss.Type)
+
+	// Known paths that carry nothing still count as handled
+	assert.True(t, applyPathMappings(map[string]any{"value": "x"}, "datetime", nav))
+	assert.False(t, applyPathMappings(map[string]any{"value": 1.0}, "unknown", nav))
+}
+
+func TestApplyPathMappingsOverride(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	SharedSubscriptionConfig.Mappings = []PathMapping{
+		{Path: "environment.water.temperature", Measurement: "water", Field: "TempF", Conversion: "kelvin-to-fahrenheit"},
+		{Path: "environment.water.salinity", Measurement: "water", Field: "Salinity"},
+	}
+	water := &Water{}
+	assert.True(t, applyPathMappings(map[string]any{"value": 293.15}, "temperature", water))
+	assert.InDelta(t, 68.0, water.TempF, 0.01)
+
+	// A rule naming a field the type does not have is skipped
+	assert.True(t, applyPathMappings(map[string]any{"value": 35.0}, "salinity", water))
+	assert.False(t, water.IsPresent("Salinity"))
+}
+
+func TestHandleMappedMessage(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+
+	SharedSubscriptionConfig.Mappings = []PathMapping{
+		{Path: "electrical.batteries.*.voltage", Measurement: "electrical", Field: "Voltage", Tags: map[string]string{"Battery": "$1"}},
+		{Path: "electrical.batteries.*.temperature", Measurement: "electrical", Field: "TempF", Conversion: "kelvin-to-fahrenheit", Tags: map[string]string{"Battery": "$1"}},
+		{Path: "environment.inside.*.relativeHumidity", Measurement: "inside", Field: "Humidity", Conversion: "ratio-to-percent", Tags: map[string]string{"Location": "$1"}},
+	}
+	client := &MockMQTTClient{}
+
+	handleMappedMessage(client, NewMockMessage("msh/signalk/vessels/self/electrical/batteries/house/voltage",
+		[]byte(`{"value": 0, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.000Z"}`)))
+	handleMappedMessage(client, NewMockMessage("msh/signalk/vessels/self/environment/inside/salon/relativeHumidity",
+		[]byte(`{"value": 0.55, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.000Z"}`)))
+	handleMappedMessage(client, NewMockMessage("msh/signalk/vessels/self/electrical/chargers/1/current",
+		[]byte(`{"value": 3, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.000Z"}`)))
+
+	points := pointsNamed(mockWriteAPI, "electrical")
+	require.Len(t, points, 1)
+	assert.Equal(t, "house", pointTag(points[0], "Battery"))
+	assert.Equal(t, "mapped-source", pointTag(points[0], "Source"))
+	require.Len(t, points[0].FieldList(), 1)
+	// A zero voltage was read and is kept
+	assert.Equal(t, "Voltage", points[0].FieldList()[0].Key)
+	assert.Equal(t, 0.0, points[0].FieldList()[0].Value)
+
+	points = pointsNamed(mockWriteAPI, "inside")
+	require.Len(t, points, 1)
+	assert.Equal(t, "salon", pointTag(points[0], "Location"))
+	assert.InDelta(t, 55.0, points[0].FieldList()[0].Value.(float64), 0.001)
+	assert.Len(t, mockWriteAPI.Points, 2)
+}
+
+func TestMappedData(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	data := &MappedData{Measurement: "electrical", Tags: map[string]string{"Battery": "house"}, Fields: map[string]interface{}{}}
+	assert.True(t, data.IsEmpty())
+	data.Fields["Voltage"] = 13.2
+	assert.False(t, data.IsEmpty())
+	assert.Equal(t, "electrical", data.GetMeasurementName())
+	assert.Equal(t, "electrical", data.GetTopicPrefix())
+	assert.Contains(t, data.ToJSON(), `"Battery":"house"`)
+	assert.Contains(t, data.ToJSON(), `"Voltage":13.2`)
+	assert.Equal(t, "house", data.GetInfluxTags()["Battery"])
+	assert.True(t, data.GetLogEnabled())
+}
+
+func TestSignalKPathFromTopic(t *testing.T) {
+	assert.Equal(t, "environment.inside.salon.temperature",
+		signalKPathFromTopic("msh/cerbo/N/signalk/123456789/vessels/self/environment/inside/salon/temperature"))
+	assert.Equal(t, "navigation.position",
+		signalKPathFromTopic("vessels/urn:mrn:imo:mmsi:366123456/navigation/position"))
+	assert.Equal(t, "electrical.batteries.house.voltage", signalKPathFromTopic("electrical/batteries/house/voltage"))
+}
+
+func TestLoadPathMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	err := os.WriteFile(path, []byte(`mappings:
+  - path: electrical.batteries.*.voltage
+    measurement: electrical
+    field: Voltage
+    tags:
+      Battery: $1
+  - path: electrical.batteries.*.current
+    measurement: electrical
+    field: Current
+    conversion: furlongs-to-feet
+  - path: environment.inside.humidity
+    field: Humidity
+`), 0644)
+	require.NoError(t, err)
+
+	// Rules with an unknown conversion or without a measurement are dropped
+	mappings, err := LoadPathMappings(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []PathMapping{
+		{Path: "electrical.batteries.*.voltage", Measurement: "electrical", Field: "Voltage", Tags: map[string]string{"Battery": "$1"}},
+	}, mappings)
+
+	_, err = LoadPathMappings(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
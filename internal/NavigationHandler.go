@@ -17,9 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-	"strings"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -45,9 +42,64 @@ type Navigation struct {
 	STW          float64 `json:"SpeedThroughWater,omitempty"`
 }
 
+// navigationPathMappings are the SignalK paths the navigation handler parses
+var navigationPathMappings = []PathMapping{
+	{Path: "navigation.headingMagnetic", Measurement: "navigation", Field: "HeadingMag", Conversion: "radians-to-degrees"},
+	{Path: "navigation.rateOfTurn", Measurement: "navigation", Field: "ROT", Conversion: "radians-to-degrees"},
+	{Path: "navigation.speedOverGround", Measurement: "navigation", Field: "SOG", Conversion: "mps-to-knots"},
+	{Path: "navigation.position", Measurement: "navigation", Field: "Lat", Key: "latitude"},
+	{Path: "navigation.position", Measurement: "navigation", Field: "Lon", Key: "longitude"},
+	// Altitude isn't always a thing
+	{Path: "navigation.position", Measurement: "navigation", Field: "Alt", Key: "altitude", Conversion: "meters-to-feet", Optional: true},
+	{Path: "navigation.headingTrue", Measurement: "navigation", Field: "HeadingTrue", Conversion: "radians-to-degrees"},
+	{Path: "navigation.magneticVariation", Measurement: "navigation", Field: "MagVariation", Conversion: "radians-to-degrees"},
+	{Path: "navigation.magneticDeviation", Measurement: "navigation", Field: "MagDeviation", Conversion: "radians-to-degrees"},
+	{Path: "navigation.datetime", Measurement: "navigation"},
+	{Path: "navigation.courseOverGroundTrue", Measurement: "navigation", Field: "COGTrue", Conversion: "radians-to-degrees"},
+	// Yaw isn't always included
+	{Path: "navigation.attitude", Measurement: "navigation", Field: "Yaw", Key: "yaw", Conversion: "radians-to-degrees", Optional: true},
+	{Path: "navigation.attitude", Measurement: "navigation", Field: "Pitch", Key: "pitch", Conversion: "radians-to-degrees"},
+	{Path: "navigation.attitude", Measurement: "navigation", Field: "Roll", Key: "roll", Conversion: "radians-to-degrees"},
+	{Path: "navigation.speedThroughWater", Measurement: "navigation", Field: "STW", Conversion: "mps-to-knots"},
+	{Path: "navigation.speedThroughWaterReferenceType", Measurement: "navigation"},
+	{Path: "navigation.log", Measurement: "navigation"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "nav",
+		TopicsKey:   "navTopics",
+		Handler:     OnNavigationMessage,
+		NewData:     func() SensorData { return &Navigation{} },
+		Mappings:    navigationPathMappings,
+		UpdateState: updateNavigationState,
+	})
+}
+
+// updateNavigationState feeds our own position and speed to the derived features
+func updateNavigationState(client MQTT.Client, measurement string, data SensorData) {
+	meas := data.(*Navigation)
+	SharedVesselState.UpdateNavigation(meas, measurement)
+	if SharedGeofence != nil && measurement == "position" {
+		SharedGeofence.Update(client, SharedVesselState.Snapshot(), meas.Timestamp)
+	}
+	if SharedAnchorWatch != nil && measurement == "position" {
+		SharedAnchorWatch.Update(client, SharedVesselState.Snapshot(), meas.Timestamp)
+	}
+	if SharedPassageTracker != nil {
+		switch measurement {
+		case "position", "speedOverGround":
+			SharedPassageTracker.Update(client, SharedVesselState.Snapshot(), meas.Timestamp, measurement == "position")
+		}
+	}
+	if SharedFuelTracker != nil && measurement == "speedOverGround" {
+		SharedFuelTracker.UpdateSOG(meas.SOG, meas.Timestamp)
+	}
+}
+
 // OnNavigationMessage is called when a navigation message is received
 func OnNavigationMessage(client MQTT.Client, message MQTT.Message) {
-	go handleNavigationMessage(client, message)
+	dispatchMessage(handleNavigationMessage, client, message)
 }
 
 // handleNavigationMessage processes navigation messages
@@ -64,141 +116,14 @@ func processNavigationData(rawData map[string]any, measurement string, data Sens
 		return
 	}
 
-	// Skip Victron GPS data
-	if strings.Contains(nav.Source, "venus.com.victronenergy.gps.") {
-		return
-	}
-
-	var err error
-	var floatTmp float64
-
-	switch measurement {
-	case "headingMagnetic":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.HeadingMag = RadiansToDegrees(floatTmp)
-		}
-
-	case "rateOfTurn":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.ROT = RadiansToDegrees(floatTmp)
-		}
-
-	case "speedOverGround":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.SOG = MetersPerSecondToKnots(floatTmp)
-		}
-
-	case "position":
-		postmp, err := ParseMapString(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing map[string]: %v", err.Error())
-		} else {
-			floatTmp, err = ParseFloat64(postmp["latitude"])
-			if err != nil {
-				log.Warn().Msgf("Error parsing float64: %v", err.Error())
-			} else {
-				nav.Lat = floatTmp
-			}
-
-			floatTmp, err = ParseFloat64(postmp["longitude"])
-			if err != nil {
-				log.Warn().Msgf("Error parsing float64: %v", err.Error())
-			} else {
-				nav.Lon = floatTmp
-			}
-
-			floatTmp, err = ParseFloat64(postmp["altitude"])
-			if err != nil {
-				// Altitude isn't always a thing so just leaving this as a trace
-				log.Trace().Msgf("Error parsing float64: %v", err.Error())
-			} else {
-				nav.Alt = MetersToFeet(floatTmp)
-			}
-		}
-	case "headingTrue":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.HeadingTrue = RadiansToDegrees(floatTmp)
-		}
-	case "magneticVariation":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.MagVariation = RadiansToDegrees(floatTmp)
-		}
-	case "magneticDeviation":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.MagDeviation = RadiansToDegrees(floatTmp)
-		}
-	case "datetime":
-		break
-	case "courseOverGroundTrue":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.COGTrue = RadiansToDegrees(floatTmp)
-		}
-	case "attitude":
-		atttmp, err := ParseMapString(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing map[string]: %v", err.Error())
-		} else {
-			floatTmp, err = ParseFloat64(atttmp["yaw"])
-			if err != nil {
-				// Yaw isn't always included to lowering log to trace
-				log.Trace().Msgf("Error parsing float64: %v", err.Error())
-			} else {
-				nav.Yaw = RadiansToDegrees(floatTmp)
-			}
-			floatTmp, err = ParseFloat64(atttmp["pitch"])
-			if err != nil {
-				log.Warn().Msgf("Error parsing float64: %v", err.Error())
-			} else {
-				nav.Pitch = RadiansToDegrees(floatTmp)
-			}
-
-			floatTmp, err = ParseFloat64(atttmp["roll"])
-			if err != nil {
-				log.Warn().Msgf("Error parsing float64: %v", err.Error())
-			} else {
-				nav.Roll = RadiansToDegrees(floatTmp)
-			}
-		}
-	case "speedThroughWater":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			nav.STW = MetersPerSecondToKnots(floatTmp)
-		}
-	case "speedThroughWaterReferenceType":
-		break
-	case "log":
-		break
-	default:
+	if !applyPathMappings(rawData, measurement, nav) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *Navigation) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -209,13 +134,16 @@ func (meas *Navigation) ToJSON() string {
 func (meas *Navigation) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Navigation: %v", json)
-	if SharedSubscriptionConfig.NavLogEn {
+	if SharedSubscriptionConfig.Categories["nav"].Verbose {
 		log.Info().Msgf("Navigation: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *Navigation) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.Lat == 0.0 && meas.Lon == 0.0 && meas.Alt == 0.0 && meas.SOG == 0.0 && meas.ROT == 0.0 && meas.COGTrue == 0.0 &&
 		meas.HeadingMag == 0.0 && meas.MagVariation == 0.0 && meas.MagDeviation == 0.0 && meas.Yaw == 0.0 &&
 		meas.Pitch == 0.0 && meas.Roll == 0.0 && meas.HeadingTrue == 0.0 && meas.STW == 0.0 {
@@ -227,46 +155,46 @@ func (meas *Navigation) IsEmpty() bool {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *Navigation) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.Lat != 0.0 {
+	if meas.Lat != 0.0 || meas.IsPresent("Lat") {
 		measTmp["Latitude"] = meas.Lat
 	}
-	if meas.Lon != 0.0 {
+	if meas.Lon != 0.0 || meas.IsPresent("Lon") {
 		measTmp["Longitude"] = meas.Lon
 	}
-	if meas.Alt != 0.0 {
+	if meas.Alt != 0.0 || meas.IsPresent("Alt") {
 		measTmp["Altitude"] = meas.Alt
 	}
-	if meas.SOG != 0.0 {
+	if meas.SOG != 0.0 || meas.IsPresent("SOG") {
 		measTmp["SpeedOverGround"] = meas.SOG
 	}
-	if meas.ROT != 0.0 {
+	if meas.ROT != 0.0 || meas.IsPresent("ROT") {
 		measTmp["RateOfTurn"] = meas.ROT
 	}
-	if meas.COGTrue != 0.0 {
+	if meas.COGTrue != 0.0 || meas.IsPresent("COGTrue") {
 		measTmp["CourseOverGroundTrue"] = meas.COGTrue
 	}
-	if meas.HeadingMag != 0.0 {
+	if meas.HeadingMag != 0.0 || meas.IsPresent("HeadingMag") {
 		measTmp["HeadingMagnetic"] = meas.HeadingMag
 	}
-	if meas.MagVariation != 0.0 {
+	if meas.MagVariation != 0.0 || meas.IsPresent("MagVariation") {
 		measTmp["MagneticVariation"] = meas.MagVariation
 	}
-	if meas.MagDeviation != 0.0 {
+	if meas.MagDeviation != 0.0 || meas.IsPresent("MagDeviation") {
 		measTmp["MagneticDeviation"] = meas.MagDeviation
 	}
-	if meas.Yaw != 0.0 {
+	if meas.Yaw != 0.0 || meas.IsPresent("Yaw") {
 		measTmp["Yaw"] = meas.Yaw
 	}
-	if meas.Pitch != 0.0 {
+	if meas.Pitch != 0.0 || meas.IsPresent("Pitch") {
 		measTmp["Pitch"] = meas.Pitch
 	}
-	if meas.Roll != 0.0 {
+	if meas.Roll != 0.0 || meas.IsPresent("Roll") {
 		measTmp["Roll"] = meas.Roll
 	}
-	if meas.HeadingTrue != 0.0 {
+	if meas.HeadingTrue != 0.0 || meas.IsPresent("HeadingTrue") {
 		measTmp["HeadingTrue"] = meas.HeadingTrue
 	}
-	if meas.STW != 0.0 {
+	if meas.STW != 0.0 || meas.IsPresent("STW") {
 		measTmp["SpeedThroughWater"] = meas.STW
 	}
 	return measTmp
@@ -279,7 +207,12 @@ func (meas *Navigation) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *Navigation) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.NavLogEn
+	return SharedSubscriptionConfig.Categories["nav"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Navigation) GetCategory() string {
+	return "nav"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
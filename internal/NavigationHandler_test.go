@@ -102,7 +102,7 @@ func TestNavigationStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.NavLogEn, nav.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["nav"].Verbose, nav.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := nav.ToInfluxPoint()
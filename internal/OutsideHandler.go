@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -26,16 +24,47 @@ import (
 )
 
 // Outside represents outside environment sensor data
+// The pressure changes and tendencies are filled in by the barometer history
 type Outside struct {
 	BaseSensorData
-	TempF        float64 `json:"TempF,omitempty"`
-	Pressure     float64 `json:"Pressure,omitempty"`
-	PressureInHg float64 `json:"PressureInHg,omitempty"`
+	TempF              float64 `json:"TempF,omitempty"`
+	Pressure           float64 `json:"Pressure,omitempty"`
+	PressureInHg       float64 `json:"PressureInHg,omitempty"`
+	PressureChange1h   float64 `json:"PressureChange1h,omitempty"`
+	PressureTendency1h string  `json:"PressureTendency1h,omitempty"`
+	PressureChange3h   float64 `json:"PressureChange3h,omitempty"`
+	PressureTendency3h string  `json:"PressureTendency3h,omitempty"`
+}
+
+// outsidePathMappings are the SignalK paths the outside handler parses
+var outsidePathMappings = []PathMapping{
+	{Path: "environment.outside.temperature", Measurement: "outside", Field: "TempF", Conversion: "kelvin-to-fahrenheit"},
+	{Path: "environment.outside.pressure", Measurement: "outside", Field: "Pressure", Conversion: "pascal-to-hpa"},
+	{Path: "environment.outside.pressure", Measurement: "outside", Field: "PressureInHg", Conversion: "pascal-to-inhg"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "outside",
+		TopicsKey:   "outsideTopics",
+		Handler:     OnOutsideMessage,
+		NewData:     func() SensorData { return &Outside{} },
+		Mappings:    outsidePathMappings,
+		UpdateState: updateOutsideState,
+	})
+}
+
+func updateOutsideState(client MQTT.Client, measurement string, data SensorData) {
+	meas := data.(*Outside)
+	SharedVesselState.UpdateTemperature(meas, measurement)
+	if SharedBarometer != nil && measurement == "pressure" && meas.Pressure != 0.0 {
+		SharedBarometer.Update(client, meas)
+	}
 }
 
 // OnOutsideMessage is called when an outside environment message is received
 func OnOutsideMessage(client MQTT.Client, message MQTT.Message) {
-	go handleOutsideMessage(client, message)
+	dispatchMessage(handleOutsideMessage, client, message)
 }
 
 // handleOutsideMessage processes outside environment messages
@@ -52,33 +81,14 @@ func processOutsideData(rawData map[string]any, measurement string, data SensorD
 		return
 	}
 
-	var err error
-	var floatTmp float64
-
-	switch measurement {
-	case "temperature":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			out.TempF = KelvinToFarenheit(floatTmp)
-		}
-	case "pressure":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			out.Pressure = floatTmp / 100
-			out.PressureInHg = MillibarToInHg(out.Pressure)
-		}
-	default:
+	if !applyPathMappings(rawData, measurement, out) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *Outside) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -89,13 +99,16 @@ func (meas *Outside) ToJSON() string {
 func (meas *Outside) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Outside: %v", json)
-	if SharedSubscriptionConfig.OutsideLogEn {
+	if SharedSubscriptionConfig.Categories["outside"].Verbose {
 		log.Info().Msgf("Outside: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *Outside) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.TempF == 0.0 && meas.Pressure == 0.0 && meas.PressureInHg == 0.0 {
 		return true
 	}
@@ -105,15 +118,24 @@ func (meas *Outside) IsEmpty() bool {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *Outside) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.TempF != 0.0 {
+	if meas.TempF != 0.0 || meas.IsPresent("TempF") {
 		measTmp["TempF"] = meas.TempF
 	}
-	if meas.Pressure != 0.0 {
+	if meas.Pressure != 0.0 || meas.IsPresent("Pressure") {
 		measTmp["Pressure"] = meas.Pressure
 	}
-	if meas.PressureInHg != 0.0 {
+	if meas.PressureInHg != 0.0 || meas.IsPresent("PressureInHg") {
 		measTmp["PressureInHg"] = meas.PressureInHg
 	}
+	// A steady barometer has a real zero change so the tendency decides whether it is written
+	if meas.PressureTendency1h != "" {
+		measTmp["PressureChange1h"] = meas.PressureChange1h
+		measTmp["PressureTendency1h"] = meas.PressureTendency1h
+	}
+	if meas.PressureTendency3h != "" {
+		measTmp["PressureChange3h"] = meas.PressureChange3h
+		measTmp["PressureTendency3h"] = meas.PressureTendency3h
+	}
 	return measTmp
 }
 
@@ -124,7 +146,12 @@ func (meas *Outside) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *Outside) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.OutsideLogEn
+	return SharedSubscriptionConfig.Categories["outside"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Outside) GetCategory() string {
+	return "outside"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
@@ -68,7 +68,7 @@ func TestOutsideStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.OutsideLogEn, outside.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["outside"].Verbose, outside.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := outside.ToInfluxPoint()
@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -35,9 +33,18 @@ type PHYTemperature struct {
 	TempF     float64 `json:"TempF,omitempty"`
 }
 
+func init() {
+	RegisterCategory(Category{
+		Name:      "phy",
+		TopicsKey: "phyTopics",
+		Handler:   OnPHYTemperatureMessage,
+		NewData:   func() SensorData { return &PHYTemperature{} },
+	})
+}
+
 // OnPHYTemperatureMessage is called when a physical temperature message is received
 func OnPHYTemperatureMessage(client MQTT.Client, message MQTT.Message) {
-	go handlePHYTemperatureMessage(client, message)
+	dispatchMessage(handlePHYTemperatureMessage, client, message)
 }
 
 // handlePHYTemperatureMessage processes physical temperature messages
@@ -58,7 +65,7 @@ func handlePHYTemperatureMessage(client MQTT.Client, message MQTT.Message) {
 
 // ToJSON serializes the data to JSON
 func (meas *PHYTemperature) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -69,14 +76,14 @@ func (meas *PHYTemperature) ToJSON() string {
 func (meas *PHYTemperature) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Physical Temp: %v", json)
-	if SharedSubscriptionConfig.PHYLogEn {
+	if SharedSubscriptionConfig.Categories["phy"].Verbose {
 		log.Info().Msgf("Physical Temp: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *PHYTemperature) IsEmpty() bool {
-	return meas.TempF == 0.0
+	return meas.TempF == 0.0 && !meas.IsPresent("TempF")
 }
 
 // GetInfluxTags returns tags for InfluxDB
@@ -98,7 +105,7 @@ func (meas *PHYTemperature) GetInfluxTags() map[string]string {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *PHYTemperature) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.TempF != 0.0 {
+	if meas.TempF != 0.0 || meas.IsPresent("TempF") {
 		measTmp["TempF"] = meas.TempF
 	}
 	return measTmp
@@ -121,7 +128,12 @@ func (meas *PHYTemperature) SetSource(source string) {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *PHYTemperature) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.PHYLogEn
+	return SharedSubscriptionConfig.Categories["phy"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *PHYTemperature) GetCategory() string {
+	return "phy"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
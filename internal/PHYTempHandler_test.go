@@ -105,7 +105,7 @@ func TestPHYTemperatureStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.PHYLogEn, phyTemp.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["phy"].Verbose, phyTemp.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := phyTemp.ToInfluxPoint()
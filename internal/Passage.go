@@ -0,0 +1,337 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// How often an in progress passage is written to disk so a restart doesn't lose the track
+const passageSaveInterval = 5 * time.Minute
+
+// Wind older than this is not attached to a track point
+const passageWindMaxAge = time.Minute
+
+const passageIDLayout = "20060102T150405Z"
+
+// TrackPoint is a single decimated position on a passage track
+type TrackPoint struct {
+	Time              time.Time `json:"Time"`
+	Lat               float64   `json:"Latitude"`
+	Lon               float64   `json:"Longitude"`
+	SOG               float64   `json:"SpeedOverGround"`
+	COGTrue           float64   `json:"CourseOverGroundTrue"`
+	WindSpeedApp      float64   `json:"WindSpeedApp,omitempty"`
+	WindAngleApp      float64   `json:"WindAngleApp,omitempty"`
+	WindDirectionTrue float64   `json:"WindDirectionTrue,omitempty"`
+}
+
+// Passage is a recorded trip from departure until the boat is stationary again
+type Passage struct {
+	ID         string       `json:"ID"`
+	Start      time.Time    `json:"Start"`
+	End        *time.Time   `json:"End,omitempty"`
+	DistanceNM float64      `json:"DistanceNM"`
+	MaxSOG     float64      `json:"MaxSOG"`
+	Track      []TrackPoint `json:"Track"`
+}
+
+// PassageEvent is reposted when a passage starts or ends
+type PassageEvent struct {
+	State      string     `json:"State"`
+	ID         string     `json:"ID"`
+	Start      time.Time  `json:"Start"`
+	End        *time.Time `json:"End,omitempty"`
+	DistanceNM float64    `json:"DistanceNM"`
+	MaxSOG     float64    `json:"MaxSOG"`
+}
+
+type passageState int
+
+const (
+	passageIdle passageState = iota
+	passageStarting
+	passageUnderway
+	passageStopping
+)
+
+// PassageTracker detects passages from SOG and records their tracks
+type PassageTracker struct {
+	mu        sync.Mutex
+	conf      PassageConfig
+	dataDir   string
+	state     passageState
+	since     time.Time
+	current   *Passage
+	lastSaved time.Time
+}
+
+var SharedPassageTracker *PassageTracker
+
+// NewPassageTracker creates a tracker and resumes an unfinished passage if the daemon was restarted mid trip
+// A passage whose last fix is older than stop-seconds ended while the daemon was down and is closed at that fix
+func NewPassageTracker(conf PassageConfig, dataDir string) *PassageTracker {
+	tracker := &PassageTracker{
+		conf:    conf,
+		dataDir: dataDir,
+		state:   passageIdle,
+	}
+	ids, err := ListPassages(dataDir)
+	if err != nil {
+		log.Warn().Msgf("Error listing passages: %v", err.Error())
+		return tracker
+	}
+	if len(ids) == 0 {
+		return tracker
+	}
+	latest, err := LoadPassage(dataDir, ids[len(ids)-1])
+	if err != nil {
+		log.Warn().Msgf("Error loading passage %v: %v", ids[len(ids)-1], err.Error())
+		return tracker
+	}
+	if latest.End != nil {
+		return tracker
+	}
+	tracker.current = latest
+	lastFix := latest.Start
+	if len(latest.Track) > 0 {
+		lastFix = latest.Track[len(latest.Track)-1].Time
+	}
+	if time.Since(lastFix) >= time.Duration(conf.StopSeconds)*time.Second {
+		log.Info().Msgf("Closing passage %v at its last fix %v", latest.ID, lastFix)
+		tracker.finishPassage(lastFix)
+		tracker.current = nil
+		return tracker
+	}
+	log.Info().Msgf("Resuming passage %v", latest.ID)
+	tracker.state = passageUnderway
+	return tracker
+}
+
+// Update runs the passage state machine against the latest vessel state
+// positionFix is true when the update was caused by a new position so a track point may be recorded
+func (t *PassageTracker) Update(client MQTT.Client, snap VesselSnapshot, ts time.Time, positionFix bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch t.state {
+	case passageIdle:
+		if snap.SOG >= t.conf.StartSOG {
+			t.state = passageStarting
+			t.since = ts
+		}
+	case passageStarting:
+		if snap.SOG < t.conf.StartSOG {
+			t.state = passageIdle
+		} else if ts.Sub(t.since) >= time.Duration(t.conf.StartSeconds)*time.Second {
+			t.startPassage(client, t.since)
+		}
+	case passageUnderway:
+		if snap.SOG <= t.conf.StopSOG {
+			t.state = passageStopping
+			t.since = ts
+		}
+	case passageStopping:
+		if snap.SOG > t.conf.StopSOG {
+			t.state = passageUnderway
+		} else if ts.Sub(t.since) >= time.Duration(t.conf.StopSeconds)*time.Second {
+			t.endPassage(client, t.since)
+			return
+		}
+	}
+
+	if t.current == nil {
+		return
+	}
+	if positionFix {
+		t.recordPoint(snap, ts)
+	}
+	if ts.Sub(t.lastSaved) >= passageSaveInterval {
+		t.save(ts)
+	}
+}
+
+// Current returns a copy of the passage in progress or nil when not underway
+func (t *PassageTracker) Current() *Passage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return nil
+	}
+	passage := *t.current
+	passage.Track = append([]TrackPoint(nil), t.current.Track...)
+	return &passage
+}
+
+// CurrentID returns the ID of the passage in progress or "" when not underway
+func (t *PassageTracker) CurrentID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current == nil {
+		return ""
+	}
+	return t.current.ID
+}
+
+func (t *PassageTracker) startPassage(client MQTT.Client, start time.Time) {
+	t.state = passageUnderway
+	t.current = &Passage{
+		ID:    start.UTC().Format(passageIDLayout),
+		Start: start,
+	}
+	log.Info().Msgf("Passage %v started", t.current.ID)
+	t.save(start)
+	t.publishEvent(client, "underway")
+}
+
+func (t *PassageTracker) endPassage(client MQTT.Client, end time.Time) {
+	t.finishPassage(end)
+	t.publishEvent(client, "ended")
+	t.current = nil
+	t.state = passageIdle
+}
+
+// finishPassage saves the current passage with its end and writes its summary
+func (t *PassageTracker) finishPassage(end time.Time) {
+	t.current.End = &end
+	log.Info().Msgf("Passage %v ended after %.1f nm", t.current.ID, t.current.DistanceNM)
+	t.save(end)
+
+	duration := end.Sub(t.current.Start).Hours()
+	fields := map[string]interface{}{
+		"DistanceNM":    t.current.DistanceNM,
+		"MaxSOG":        t.current.MaxSOG,
+		"DurationHours": duration,
+	}
+	if duration > 0 {
+		fields["AvgSOG"] = t.current.DistanceNM / duration
+	}
+	WriteDerivedPoint(influxdb2.NewPoint("passage", map[string]string{"PassageID": t.current.ID}, fields, end))
+}
+
+func (t *PassageTracker) recordPoint(snap VesselSnapshot, ts time.Time) {
+	if snap.PositionTime.IsZero() {
+		return
+	}
+	point := TrackPoint{
+		Time:    ts,
+		Lat:     snap.Lat,
+		Lon:     snap.Lon,
+		SOG:     snap.SOG,
+		COGTrue: snap.COGTrue,
+	}
+	if !snap.WindTime.IsZero() && ts.Sub(snap.WindTime) <= passageWindMaxAge {
+		point.WindSpeedApp = snap.WindSpeedApp
+		point.WindAngleApp = snap.WindAngleApp
+		point.WindDirectionTrue = snap.WindDirectionTrue
+	}
+	if snap.SOG > t.current.MaxSOG {
+		t.current.MaxSOG = snap.SOG
+	}
+	if len(t.current.Track) > 0 {
+		last := t.current.Track[len(t.current.Track)-1]
+		dist := DistanceMeters(last.Lat, last.Lon, point.Lat, point.Lon)
+		if ts.Sub(last.Time) < time.Duration(t.conf.TrackInterval)*time.Second && dist < t.conf.TrackDistance {
+			return
+		}
+		t.current.DistanceNM += MetersToNauticalMiles(dist)
+	}
+	t.current.Track = append(t.current.Track, point)
+}
+
+func (t *PassageTracker) save(ts time.Time) {
+	t.lastSaved = ts
+	err := SavePassage(t.dataDir, t.current)
+	if err != nil {
+		log.Warn().Msgf("Error saving passage %v: %v", t.current.ID, err.Error())
+	}
+}
+
+func (t *PassageTracker) publishEvent(client MQTT.Client, state string) {
+	event := PassageEvent{
+		State:      state,
+		ID:         t.current.ID,
+		Start:      t.current.Start,
+		End:        t.current.End,
+		DistanceNM: t.current.DistanceNM,
+		MaxSOG:     t.current.MaxSOG,
+	}
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "passage/state", string(jsonData))
+}
+
+func passageDir(dataDir string) string {
+	return filepath.Join(dataDir, "passages")
+}
+
+// SavePassage writes a passage to the passages directory under the data dir
+func SavePassage(dataDir string, passage *Passage) error {
+	return writeJSONFile(filepath.Join(passageDir(dataDir), passage.ID+".json"), passage)
+}
+
+// LoadPassage reads a single passage by ID
+func LoadPassage(dataDir string, id string) (*Passage, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid passage id %q", id)
+	}
+	passage := &Passage{}
+	if err := readJSONFile(filepath.Join(passageDir(dataDir), id+".json"), passage); err != nil {
+		return nil, err
+	}
+	// Passages saved before End was optional carry a zero End while underway
+	if passage.End != nil && passage.End.IsZero() {
+		passage.End = nil
+	}
+	return passage, nil
+}
+
+// ListPassages returns the IDs of all recorded passages oldest first
+func ListPassages(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(passageDir(dataDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	// IDs are UTC start times so lexical order is chronological
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const gpxExtensionNamespace = "https://github.com/dpmcgarry/marine-sensorhub-mqtt"
+
+type gpxFile struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsMSH string      `xml:"xmlns:msh,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Track    gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Time string `xml:"time"`
+}
+
+type gpxTrack struct {
+	Name    string          `xml:"name"`
+	Segment gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxTrackPoint `xml:"trkpt"`
+}
+
+type gpxTrackPoint struct {
+	Lat        string        `xml:"lat,attr"`
+	Lon        string        `xml:"lon,attr"`
+	Time       string        `xml:"time"`
+	Extensions gpxExtensions `xml:"extensions"`
+}
+
+// GPX 1.1 dropped course and speed from trkpt so they go in our own extension namespace
+type gpxExtensions struct {
+	SOG               string `xml:"msh:sog"`
+	COGTrue           string `xml:"msh:cogtrue"`
+	WindSpeedApp      string `xml:"msh:windspeedapp,omitempty"`
+	WindAngleApp      string `xml:"msh:windangleapp,omitempty"`
+	WindDirectionTrue string `xml:"msh:winddirectiontrue,omitempty"`
+}
+
+type kmlFile struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	TimeStamp   *kmlTimeStamp  `xml:"TimeStamp,omitempty"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+func formatCoord(f float64) string {
+	return strconv.FormatFloat(f, 'f', 7, 64)
+}
+
+func formatValue(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+func formatOptionalValue(f float64) string {
+	if f == 0.0 {
+		return ""
+	}
+	return formatValue(f)
+}
+
+// ExportPassageGPX writes a passage track as a GPX 1.1 document
+func ExportPassageGPX(w io.Writer, passage *Passage) error {
+	doc := gpxFile{
+		Version:  "1.1",
+		Creator:  "marine-sensorhub-mqtt",
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsMSH: gpxExtensionNamespace,
+		Metadata: gpxMetadata{
+			Name: "Passage " + passage.ID,
+			Time: passage.Start.UTC().Format(time.RFC3339),
+		},
+		Track: gpxTrack{
+			Name: passage.ID,
+		},
+	}
+	for _, point := range passage.Track {
+		doc.Track.Segment.Points = append(doc.Track.Segment.Points, gpxTrackPoint{
+			Lat:  formatCoord(point.Lat),
+			Lon:  formatCoord(point.Lon),
+			Time: point.Time.UTC().Format(time.RFC3339),
+			Extensions: gpxExtensions{
+				SOG:               formatValue(point.SOG),
+				COGTrue:           formatValue(point.COGTrue),
+				WindSpeedApp:      formatOptionalValue(point.WindSpeedApp),
+				WindAngleApp:      formatOptionalValue(point.WindAngleApp),
+				WindDirectionTrue: formatOptionalValue(point.WindDirectionTrue),
+			},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// ExportPassageKML writes a passage track as a KML document with start and end markers
+func ExportPassageKML(w io.Writer, passage *Passage) error {
+	doc := kmlFile{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlDocument{
+			Name: "Passage " + passage.ID,
+		},
+	}
+	var coords []string
+	for _, point := range passage.Track {
+		coords = append(coords, formatCoord(point.Lon)+","+formatCoord(point.Lat)+",0")
+	}
+	description := fmt.Sprintf("Distance: %.1f nm, Max SOG: %.1f kn", passage.DistanceNM, passage.MaxSOG)
+	doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+		Name:        "Track",
+		Description: description,
+		LineString: &kmlLineString{
+			Tessellate:  1,
+			Coordinates: strings.Join(coords, " "),
+		},
+	})
+	if len(passage.Track) > 0 {
+		first := passage.Track[0]
+		last := passage.Track[len(passage.Track)-1]
+		doc.Document.Placemarks = append(doc.Document.Placemarks,
+			kmlPlacemark{
+				Name:      "Start",
+				TimeStamp: &kmlTimeStamp{When: first.Time.UTC().Format(time.RFC3339)},
+				Point:     &kmlPoint{Coordinates: formatCoord(first.Lon) + "," + formatCoord(first.Lat) + ",0"},
+			},
+			kmlPlacemark{
+				Name:      "End",
+				TimeStamp: &kmlTimeStamp{When: last.Time.UTC().Format(time.RFC3339)},
+				Point:     &kmlPoint{Coordinates: formatCoord(last.Lon) + "," + formatCoord(last.Lat) + ",0"},
+			})
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testPassage() *Passage {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	return &Passage{
+		ID:         start.Format(passageIDLayout),
+		Start:      start,
+		End:        &end,
+		DistanceNM: 6.2,
+		MaxSOG:     7.1,
+		Track: []TrackPoint{
+			{Time: start, Lat: 37.8, Lon: -122.4, SOG: 5.5, COGTrue: 270.0, WindSpeedApp: 14.2},
+			{Time: start.Add(time.Hour), Lat: 37.9, Lon: -122.5, SOG: 6.0, COGTrue: 265.0},
+		},
+	}
+}
+
+func TestExportPassageGPX(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportPassageGPX(&buf, testPassage())
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, `<gpx version="1.1"`)
+	assert.Contains(t, out, `<trkpt lat="37.8000000" lon="-122.4000000">`)
+	assert.Contains(t, out, `<time>2025-06-01T12:00:00Z</time>`)
+	assert.Contains(t, out, `<msh:sog>5.50</msh:sog>`)
+	assert.Contains(t, out, `<msh:windspeedapp>14.20</msh:windspeedapp>`)
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("<msh:windspeedapp>")))
+
+	// The output must be well formed
+	var parsed struct{}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &parsed))
+}
+
+func TestExportPassageKML(t *testing.T) {
+	var buf bytes.Buffer
+	err := ExportPassageKML(&buf, testPassage())
+	assert.NoError(t, err)
+
+	out := buf.String()
+	assert.Contains(t, out, `<kml xmlns="http://www.opengis.net/kml/2.2">`)
+	assert.Contains(t, out, `<coordinates>-122.4000000,37.8000000,0 -122.5000000,37.9000000,0</coordinates>`)
+	assert.Contains(t, out, `<name>Start</name>`)
+	assert.Contains(t, out, `<name>End</name>`)
+	assert.Contains(t, out, `Distance: 6.2 nm`)
+
+	var parsed struct{}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &parsed))
+}
+
+func TestExportPassageKMLEmptyTrack(t *testing.T) {
+	var buf bytes.Buffer
+	passage := testPassage()
+	passage.Track = nil
+	err := ExportPassageKML(&buf, passage)
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), `<name>Start</name>`)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPassageConfig() PassageConfig {
+	return PassageConfig{
+		Enabled:       true,
+		StartSOG:      2.0,
+		StartSeconds:  60,
+		StopSOG:       0.5,
+		StopSeconds:   300,
+		TrackInterval: 30,
+		TrackDistance: 100,
+	}
+}
+
+func TestPassageTrackerLifecycle(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	dataDir := t.TempDir()
+	tracker := NewPassageTracker(testPassageConfig(), dataDir)
+	client := &MockMQTTClient{}
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	snap := VesselSnapshot{Lat: 37.0, Lon: -122.0, PositionTime: start, SOG: 5.0}
+
+	// A short burst of speed does not start a passage
+	tracker.Update(client, snap, start, true)
+	snap.SOG = 1.0
+	tracker.Update(client, snap, start.Add(10*time.Second), false)
+	assert.Nil(t, tracker.Current())
+	assert.Equal(t, "", tracker.CurrentID())
+
+	// Sustained speed starts a passage at the time the speed was first seen
+	snap.SOG = 5.0
+	tracker.Update(client, snap, start.Add(20*time.Second), false)
+	tracker.Update(client, snap, start.Add(90*time.Second), true)
+	current := tracker.Current()
+	assert.NotNil(t, current)
+	assert.Equal(t, current.ID, tracker.CurrentID())
+	assert.Equal(t, start.Add(20*time.Second), current.Start)
+	assert.Len(t, current.Track, 1)
+
+	// Points closer than the decimation interval and distance are dropped
+	snap.Lat += 0.0001
+	tracker.Update(client, snap, start.Add(100*time.Second), true)
+	assert.Len(t, tracker.Current().Track, 1)
+
+	// One nautical mile north is recorded and counted
+	snap.Lat = 37.0 + 1.0/60.0
+	snap.WindSpeedApp = 12.0
+	snap.WindTime = start.Add(110 * time.Second)
+	tracker.Update(client, snap, start.Add(120*time.Second), true)
+	current = tracker.Current()
+	assert.Len(t, current.Track, 2)
+	assert.InDelta(t, 1.0, current.DistanceNM, 0.01)
+	assert.Equal(t, 12.0, current.Track[1].WindSpeedApp)
+
+	// Being stationary long enough ends the passage and saves it
+	snap.SOG = 0.0
+	tracker.Update(client, snap, start.Add(200*time.Second), false)
+	assert.NotNil(t, tracker.Current())
+	tracker.Update(client, snap, start.Add(600*time.Second), false)
+	assert.Nil(t, tracker.Current())
+
+	ids, err := ListPassages(dataDir)
+	assert.NoError(t, err)
+	assert.Len(t, ids, 1)
+	saved, err := LoadPassage(dataDir, ids[0])
+	assert.NoError(t, err)
+	require.NotNil(t, saved.End)
+	assert.Equal(t, start.Add(200*time.Second), *saved.End)
+	assert.Len(t, saved.Track, 2)
+	assert.Equal(t, 5.0, saved.MaxSOG)
+}
+
+func TestPassageTrackerResume(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	dataDir := t.TempDir()
+	start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	passage := &Passage{
+		ID:    start.Format(passageIDLayout),
+		Start: start,
+		Track: []TrackPoint{{Time: time.Now().UTC().Add(-time.Minute), Lat: 37.0, Lon: -122.0, SOG: 5.0}},
+	}
+	assert.NoError(t, SavePassage(dataDir, passage))
+
+	// The last fix is within stop-seconds so the passage carries on
+	tracker := NewPassageTracker(testPassageConfig(), dataDir)
+	current := tracker.Current()
+	require.NotNil(t, current)
+	assert.Equal(t, passage.ID, current.ID)
+	assert.Nil(t, current.End)
+
+	// Without a fix for longer than stop-seconds it ended while the daemon was down
+	lastFix := start.Add(10 * time.Minute)
+	passage.Track[0].Time = lastFix
+	assert.NoError(t, SavePassage(dataDir, passage))
+	tracker = NewPassageTracker(testPassageConfig(), dataDir)
+	assert.Nil(t, tracker.Current())
+	saved, err := LoadPassage(dataDir, passage.ID)
+	require.NoError(t, err)
+	require.NotNil(t, saved.End)
+	assert.True(t, lastFix.Equal(*saved.End))
+}
+
+func TestPassageEnd(t *testing.T) {
+	dataDir := t.TempDir()
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	passage := &Passage{ID: start.Format(passageIDLayout), Start: start}
+
+	// A passage underway has no End at all
+	jsonData, err := json.Marshal(passage)
+	require.NoError(t, err)
+	assert.NotContains(t, string(jsonData), `"End"`)
+	jsonData, err = json.Marshal(PassageEvent{State: "underway", ID: passage.ID, Start: start})
+	require.NoError(t, err)
+	assert.NotContains(t, string(jsonData), `"End"`)
+
+	// Files written with a zero End are still underway
+	require.NoError(t, writeJSONFile(filepath.Join(passageDir(dataDir), passage.ID+".json"),
+		map[string]any{"ID": passage.ID, "Start": start, "End": time.Time{}}))
+	saved, err := LoadPassage(dataDir, passage.ID)
+	require.NoError(t, err)
+	assert.Nil(t, saved.End)
+}
+
+func TestLoadPassageInvalidID(t *testing.T) {
+	_, err := LoadPassage(t.TempDir(), "../etc/passwd")
+	assert.Error(t, err)
+
+	_, err = LoadPassage(t.TempDir(), "missing")
+	assert.Error(t, err)
+}
+
+func TestListPassagesMissingDir(t *testing.T) {
+	ids, err := ListPassages(t.TempDir())
+	assert.NoError(t, err)
+	assert.Empty(t, ids)
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// writeJSONFile saves state under the data dir
+// It writes then renames so a crash never leaves a truncated file behind
+func writeJSONFile(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create directory %v", err)
+	}
+	jsonData, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpName := path + ".tmp"
+	if err := os.WriteFile(tmpName, jsonData, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// readJSONFile loads state saved by writeJSONFile
+func readJSONFile(path string, v any) error {
+	jsonData, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(jsonData, v); err != nil {
+		return fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+	return nil
+}
+
+// lockJSONFile holds an exclusive lock on the state file at path until unlock is called
+// The CLI and the daemon both update some state files, so each load, change and save runs under the lock
+// The lock is taken on a separate file since writeJSONFile replaces the file at path
+func lockJSONFile(path string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("unable to create directory %v", err)
+	}
+	lockFile, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file %v", err)
+	}
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		lockFile.Close()
+		return nil, fmt.Errorf("unable to lock %v: %v", path, err)
+	}
+	return func() {
+		syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		lockFile.Close()
+	}, nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// MarshalSensorJSON serializes sensor data like encoding/json
+// except that omitempty fields are kept when they were parsed from the message
+func MarshalSensorJSON(data SensorData) ([]byte, error) {
+	v := reflect.Indirect(reflect.ValueOf(data))
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	first := true
+	err := writeSensorFields(&buf, v, data, &first)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func writeSensorFields(buf *bytes.Buffer, v reflect.Value, data SensorData, first *bool) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			if err := writeSensorFields(buf, fv, data, first); err != nil {
+				return err
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name, omitEmpty := jsonFieldName(sf)
+		if name == "-" {
+			continue
+		}
+		if omitEmpty && isEmptyJSONValue(fv) && !data.IsPresent(sf.Name) {
+			continue
+		}
+		value, err := json.Marshal(fv.Interface())
+		if err != nil {
+			return err
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return err
+		}
+		if !*first {
+			buf.WriteByte(',')
+		}
+		*first = false
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	return nil
+}
+
+func jsonFieldName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "-", false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = sf.Name
+	}
+	omitEmpty := false
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+	return name, omitEmpty
+}
+
+// isEmptyJSONValue matches what encoding/json treats as empty for omitempty
+func isEmptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// markJSONPresence marks the fields whose keys appear in a JSON payload
+// Keys are matched without regard to case as encoding/json does
+func markJSONPresence(data SensorData, payload []byte) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return
+	}
+	t := reflect.Indirect(reflect.ValueOf(data)).Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous || !sf.IsExported() {
+			continue
+		}
+		name, _ := jsonFieldName(sf)
+		for key := range raw {
+			if strings.EqualFold(key, name) {
+				data.MarkPresent(sf.Name)
+				break
+			}
+		}
+	}
+}
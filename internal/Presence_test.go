@@ -0,0 +1,112 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalSensorJSONMatchesEncoding(t *testing.T) {
+	risk := true
+	values := []SensorData{
+		&Navigation{BaseSensorData: BaseSensorData{Source: "GPS", Timestamp: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}, Lat: 37.8, SOG: 5.2},
+		&BLETemperature{MAC: "aa", TempF: 38.5, CondensationRisk: &risk},
+		&Propulsion{Device: "port", RPM: 1800},
+		&Water{},
+	}
+	for _, v := range values {
+		expected, err := json.Marshal(v)
+		assert.NoError(t, err)
+		actual, err := MarshalSensorJSON(v)
+		assert.NoError(t, err)
+		assert.Equal(t, string(expected), string(actual))
+	}
+}
+
+func TestMarshalSensorJSONKeepsPresentZeros(t *testing.T) {
+	steering := &Steering{}
+	steering.Source = "Autopilot"
+	steering.MarkPresent("RudderAngle")
+	jsonData, err := MarshalSensorJSON(steering)
+	assert.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"RudderAngle":0`)
+	assert.NotContains(t, string(jsonData), "TargetHeadingMag")
+
+	steering.ClearPresent("RudderAngle")
+	jsonData, err = MarshalSensorJSON(steering)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(jsonData), "RudderAngle")
+}
+
+func TestPresenceKeepsZeroReadings(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	nav := &Navigation{}
+	processNavigationData(map[string]any{"value": 0.0}, "speedOverGround", nav)
+	assert.True(t, nav.IsPresent("SOG"))
+	assert.False(t, nav.IsPresent("COGTrue"))
+	assert.False(t, nav.IsEmpty())
+	fields := nav.GetInfluxFields()
+	assert.Equal(t, map[string]interface{}{"SpeedOverGround": 0.0}, fields)
+
+	prop := &Propulsion{}
+	processPropulsionData(map[string]any{"value": 0.0}, "revolutions", prop, nil)
+	assert.False(t, prop.IsEmpty())
+	assert.Equal(t, int64(0), prop.GetInfluxFields()["RPM"])
+
+	// Nothing parsed is still empty
+	nav = &Navigation{}
+	processNavigationData(map[string]any{"value": "bad"}, "speedOverGround", nav)
+	assert.True(t, nav.IsEmpty())
+}
+
+func TestHandleSensorMessageZeroReading(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+
+	client := &MockMQTTClient{}
+	HandleSensorMessage(client, NewMockMessage("vessels/self/steering/rudderAngle",
+		[]byte(`{"value": 0, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.000Z"}`)), &Steering{}, processSteeringData)
+
+	points := pointsNamed(mockWriteAPI, "steering")
+	assert.Len(t, points, 1)
+	fields := make(map[string]interface{})
+	for _, field := range points[0].FieldList() {
+		fields[field.Key] = field.Value
+	}
+	assert.Equal(t, 0.0, fields["RudderAngle"])
+}
+
+func TestMarkJSONPresence(t *testing.T) {
+	ble := &BLETemperature{}
+	payload := []byte(`{"MAC": "aa", "TempF": 0, "humidity": 40}`)
+	assert.NoError(t, json.Unmarshal(payload, ble))
+	markJSONPresence(ble, payload)
+	assert.True(t, ble.IsPresent("TempF"))
+	assert.True(t, ble.IsPresent("Humidity"))
+	assert.False(t, ble.IsPresent("RSSI"))
+	assert.Equal(t, 0.0, ble.GetInfluxFields()["TempF"])
+	_, ok := ble.GetInfluxFields()["RSSI"]
+	assert.False(t, ok)
+}
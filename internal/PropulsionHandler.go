@@ -17,7 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
 	"strings"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -44,15 +43,58 @@ type Propulsion struct {
 	FuelRate         float64 `json:"FuelRate,omitempty"`
 }
 
+// propulsionPathMappings are the SignalK paths the propulsion handler parses
+var propulsionPathMappings = []PathMapping{
+	{Path: "propulsion.*.revolutions", Measurement: "propulsion", Field: "RPM", Conversion: "hz-to-rpm"},
+	{Path: "propulsion.*.boostPressure", Measurement: "propulsion", Field: "BoostPSI", Conversion: "pascal-to-psi"},
+	{Path: "propulsion.*.oilTemperature", Measurement: "propulsion", Field: "OilTempF", Conversion: "kelvin-to-fahrenheit"},
+	{Path: "propulsion.*.transmission.oilTemperature", Measurement: "propulsion", Field: "TransOilTempF", Conversion: "kelvin-to-fahrenheit"},
+	{Path: "propulsion.*.oilPressure", Measurement: "propulsion", Field: "OilPressure", Conversion: "pascal-to-psi"},
+	{Path: "propulsion.*.transmission.oilPressure", Measurement: "propulsion", Field: "TransOilPressure", Conversion: "pascal-to-psi"},
+	{Path: "propulsion.*.temperature", Measurement: "propulsion", Field: "CoolantTempF", Conversion: "kelvin-to-fahrenheit"},
+	{Path: "propulsion.*.alternatorVoltage", Measurement: "propulsion", Field: "AltVoltage"},
+	{Path: "propulsion.*.transmission", Measurement: "propulsion"},
+	{Path: "propulsion.*.fuel", Measurement: "propulsion"},
+	{Path: "propulsion.*.fuel.rate", Measurement: "propulsion", Field: "FuelRate", Conversion: "m3s-to-gph"},
+	{Path: "propulsion.*.runTime", Measurement: "propulsion", Field: "RunTime"},
+	{Path: "propulsion.*.engineLoad", Measurement: "propulsion", Field: "EngineLoad", Conversion: "ratio-to-percent"},
+	{Path: "propulsion.*.engineTorque", Measurement: "propulsion", Field: "EngineTorque", Conversion: "ratio-to-percent"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "propulsion",
+		TopicsKey:   "propulsionTopics",
+		Handler:     OnPropulsionMessage,
+		NewData:     func() SensorData { return &Propulsion{} },
+		Mappings:    propulsionPathMappings,
+		UpdateState: updatePropulsionState,
+	})
+}
+
+// updatePropulsionState feeds the engine monitor, fuel tracker and maintenance hours
+func updatePropulsionState(client MQTT.Client, measurement string, data SensorData) {
+	meas := data.(*Propulsion)
+	if SharedEngineMonitor != nil {
+		SharedEngineMonitor.Update(client, measurement, meas)
+	}
+	if SharedFuelTracker != nil && measurement == "rate" {
+		SharedFuelTracker.UpdateFuelRate(client, meas.Device, meas.FuelRate, meas.Timestamp)
+	}
+	if SharedMaintenanceScheduler != nil && measurement == "runTime" && meas.RunTime != 0 {
+		SharedMaintenanceScheduler.UpdateEngineHours(meas.Device, float64(meas.RunTime)/3600)
+	}
+}
+
 // OnPropulsionMessage is called when a propulsion message is received
 func OnPropulsionMessage(client MQTT.Client, message MQTT.Message) {
-	go handlePropulsionMessage(client, message)
+	dispatchMessage(handlePropulsionMessage, client, message)
 }
 
 // handlePropulsionMessage processes propulsion messages
 func handlePropulsionMessage(client MQTT.Client, message MQTT.Message) {
-	// TODO: Support Multiple Engines
 	prop := &Propulsion{}
+	prop.Device = propulsionDeviceFromTopic(message.Topic())
 
 	// Check if this is a transmission message
 	isTranny := false
@@ -71,6 +113,19 @@ func handlePropulsionMessage(client MQTT.Client, message MQTT.Message) {
 	})
 }
 
+// propulsionDeviceFromTopic pulls the engine instance out of a topic like .../propulsion/port/revolutions
+func propulsionDeviceFromTopic(topic string) string {
+	idx := strings.LastIndex(topic, "/propulsion/")
+	if idx < 0 {
+		return ""
+	}
+	parts := strings.Split(topic[idx+len("/propulsion/"):], "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0]
+}
+
 // processPropulsionData processes specific propulsion data fields
 func processPropulsionData(rawData map[string]any, measurement string, data SensorData, context map[string]interface{}) {
 	prop, ok := data.(*Propulsion)
@@ -79,105 +134,21 @@ func processPropulsionData(rawData map[string]any, measurement string, data Sens
 		return
 	}
 
-	// Get the transmission flag from context
+	// Transmission readings share leaf names with the engine
 	isTranny, _ := context["isTranny"].(bool)
 
-	var err error
-	var floatTmp float64
-
-	switch measurement {
-	case "revolutions":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.RPM = int64(floatTmp) * 60
-		}
-	case "boostPressure":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.BoostPSI = PascalToPSI(floatTmp)
-		}
-	case "oilTemperature":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			if isTranny {
-				prop.TransOilTempF = KelvinToFarenheit(floatTmp)
-			} else {
-				prop.OilTempF = KelvinToFarenheit(floatTmp)
-			}
-		}
-	case "oilPressure":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			if isTranny {
-				prop.TransOilPressure = PascalToPSI(floatTmp)
-			} else {
-				prop.OilPressure = PascalToPSI(floatTmp)
-			}
-		}
-	case "temperature":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.CoolantTempF = KelvinToFarenheit(floatTmp)
-		}
-	case "alternatorVoltage":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.AltVoltage = floatTmp
-		}
-	case "transmission":
-		// Just a container topic, no data to process
-		break
-	case "fuel":
-		// Just a container topic, no data to process
-		break
-	case "rate":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.FuelRate = CubicMetersPerSecondToGallonsPerHour(floatTmp)
-		}
-	case "runTime":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.RunTime = int64(floatTmp)
-		}
-	case "engineLoad":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.EngineLoad = floatTmp * 100
-		}
-	case "engineTorque":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			prop.EngineTorque = floatTmp * 100
-		}
-	default:
+	path := measurement
+	if isTranny {
+		path = "transmission." + measurement
+	}
+	if !applyPathMappings(rawData, path, prop) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *Propulsion) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -188,13 +159,16 @@ func (meas *Propulsion) ToJSON() string {
 func (meas *Propulsion) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Propulsion: %v", json)
-	if SharedSubscriptionConfig.PropLogEn {
+	if SharedSubscriptionConfig.Categories["propulsion"].Verbose {
 		log.Info().Msgf("Propulsion: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *Propulsion) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.RPM == 0 && meas.BoostPSI == 0.0 && meas.OilTempF == 0.0 && meas.OilPressure == 0.0 &&
 		meas.CoolantTempF == 0.0 && meas.RunTime == 0 && meas.EngineLoad == 0.0 && meas.EngineTorque == 0.0 &&
 		meas.TransOilTempF == 0.0 && meas.TransOilPressure == 0.0 && meas.AltVoltage == 0.0 && meas.FuelRate == 0.0 {
@@ -218,40 +192,40 @@ func (meas *Propulsion) GetInfluxTags() map[string]string {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *Propulsion) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.RPM != 0 {
+	if meas.RPM != 0 || meas.IsPresent("RPM") {
 		measTmp["RPM"] = meas.RPM
 	}
-	if meas.BoostPSI != 0.0 {
+	if meas.BoostPSI != 0.0 || meas.IsPresent("BoostPSI") {
 		measTmp["BoostPSI"] = meas.BoostPSI
 	}
-	if meas.OilTempF != 0.0 {
+	if meas.OilTempF != 0.0 || meas.IsPresent("OilTempF") {
 		measTmp["OilTempF"] = meas.OilTempF
 	}
-	if meas.OilPressure != 0.0 {
+	if meas.OilPressure != 0.0 || meas.IsPresent("OilPressure") {
 		measTmp["OilPressure"] = meas.OilPressure
 	}
-	if meas.CoolantTempF != 0.0 {
+	if meas.CoolantTempF != 0.0 || meas.IsPresent("CoolantTempF") {
 		measTmp["CoolantTempF"] = meas.CoolantTempF
 	}
-	if meas.RunTime != 0 {
+	if meas.RunTime != 0 || meas.IsPresent("RunTime") {
 		measTmp["RunTime"] = meas.RunTime
 	}
-	if meas.EngineLoad != 0.0 {
+	if meas.EngineLoad != 0.0 || meas.IsPresent("EngineLoad") {
 		measTmp["EngineLoad"] = meas.EngineLoad
 	}
-	if meas.EngineTorque != 0.0 {
+	if meas.EngineTorque != 0.0 || meas.IsPresent("EngineTorque") {
 		measTmp["EngineTorque"] = meas.EngineTorque
 	}
-	if meas.TransOilTempF != 0.0 {
+	if meas.TransOilTempF != 0.0 || meas.IsPresent("TransOilTempF") {
 		measTmp["TransOilTempF"] = meas.TransOilTempF
 	}
-	if meas.TransOilPressure != 0.0 {
+	if meas.TransOilPressure != 0.0 || meas.IsPresent("TransOilPressure") {
 		measTmp["TransOilPressure"] = meas.TransOilPressure
 	}
-	if meas.AltVoltage != 0.0 {
+	if meas.AltVoltage != 0.0 || meas.IsPresent("AltVoltage") {
 		measTmp["AlternatorVoltage"] = meas.AltVoltage
 	}
-	if meas.FuelRate != 0.0 {
+	if meas.FuelRate != 0.0 || meas.IsPresent("FuelRate") {
 		measTmp["FuelRate"] = meas.FuelRate
 	}
 	return measTmp
@@ -264,7 +238,12 @@ func (meas *Propulsion) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *Propulsion) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.PropLogEn
+	return SharedSubscriptionConfig.Categories["propulsion"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Propulsion) GetCategory() string {
+	return "propulsion"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
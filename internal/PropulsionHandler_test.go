@@ -121,7 +121,7 @@ func TestPropulsionStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.PropLogEn, prop.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["propulsion"].Verbose, prop.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := prop.ToInfluxPoint()
@@ -349,3 +349,23 @@ func TestHandlePropulsionMessage(t *testing.T) {
 	invalidMessage := NewMockMessage("vessels/test/propulsion/port/revolutions", []byte("invalid json"))
 	OnPropulsionMessage(client, invalidMessage)
 }
+
+func TestPropulsionDeviceFromTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		topic    string
+		expected string
+	}{
+		{"engine", "vessels/self/propulsion/port/revolutions", "port"},
+		{"transmission", "vessels/self/propulsion/starboard/transmission/oilTemperature", "starboard"},
+		{"fuel", "vessels/self/propulsion/main/fuel/rate", "main"},
+		{"no_device", "vessels/self/propulsion/revolutions", ""},
+		{"not_propulsion", "vessels/self/environment/wind/speedApparent", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, propulsionDeviceFromTopic(tt.topic))
+		})
+	}
+}
@@ -17,11 +17,10 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"strings"
 	"time"
 
+	"github.com/eclipse/paho.golang/paho"
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/rs/zerolog/log"
 )
@@ -30,34 +29,16 @@ import (
 // But that said the complexity of reusing connections isn't worth it at this point
 func PublishMessage(publishConf PublishConfig, serverConf MQTTDestination) {
 	log.Debug().Msgf("Will publish to %v", serverConf.Host)
-	mqttOpts := MQTT.NewClientOptions()
-	mqttOpts.AddBroker(serverConf.Host)
-	if serverConf.Username != "" {
-		mqttOpts.SetUsername(serverConf.Username)
-		log.Debug().Msgf("Using Username: %v", serverConf.Username)
-	}
-	if serverConf.Password != "" {
-		mqttOpts.SetPassword(serverConf.Password)
-		log.Trace().Msgf("Using Password: %v", serverConf.Password)
-	}
-	if len(serverConf.CACert) > 0 {
-		log.Debug().Msg("Constructing x509 Cert Pool")
-		rootCAs, err := x509.SystemCertPool()
-		if err != nil || rootCAs == nil {
-			log.Warn().Msg("Unable to get system cert pool")
-			rootCAs = x509.NewCertPool()
-		}
-		if ok := rootCAs.AppendCertsFromPEM(serverConf.CACert); !ok {
-			log.Warn().Msg("No certs appended, using system certs only")
-		}
-
-		tlsConfig := &tls.Config{
-			RootCAs: rootCAs,
-		}
-		mqttOpts.SetTLSConfig(tlsConfig)
-		log.Debug().Msg("Configured TLS")
-	}
-	client := MQTT.NewClient(mqttOpts)
+	client := NewBrokerClient(BrokerConfig{
+		Name:            serverConf.Host,
+		Host:            serverConf.Host,
+		Username:        serverConf.Username,
+		Password:        serverConf.Password,
+		CACert:          serverConf.CACert,
+		TLS:             serverConf.TLS,
+		CleanSession:    true,
+		ProtocolVersion: serverConf.ProtocolVersion,
+	})
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		log.Warn().Msgf("Error Connecting to host: %v", token.Error())
 		return
@@ -71,16 +52,27 @@ func PublishMessage(publishConf PublishConfig, serverConf MQTTDestination) {
 }
 
 func PublishClientMessage(client MQTT.Client, topic string, messagedata string, strip bool) {
+	publishClientMessage(client, topic, messagedata, strip, byte(0), false, nil)
+}
+
+// publishClientMessage publishes with the properties when the client speaks MQTT 5
+func publishClientMessage(client MQTT.Client, topic string, messagedata string, strip bool, qos byte, retained bool, props *paho.PublishProperties) {
 	if strip {
 		log.Trace().Msg("Will strip the topic")
 		topic = strings.ReplaceAll(topic, " ", "")
 	}
 	log.Trace().Msgf("Will publish to topic: %v", topic)
 	log.Trace().Msgf("Will publish message: %v", messagedata)
-	token := client.Publish(topic, byte(0), false, messagedata)
+	var token MQTT.Token
+	if v5, ok := client.(*V5Client); ok && props != nil {
+		token = v5.PublishWithProperties(topic, qos, retained, messagedata, props)
+	} else {
+		token = client.Publish(topic, qos, retained, messagedata)
+	}
 	token.WaitTimeout(time.Duration(SharedSubscriptionConfig.PublishTimeout) * time.Millisecond)
 	err := token.Error()
 	if err != nil {
 		log.Warn().Msgf("Error publishing message: %v", err.Error())
+		countError(ErrorPublish)
 	}
 }
@@ -0,0 +1,399 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	RefrigDoorOpen        = "door-open"
+	RefrigDoorClosed      = "door-closed"
+	RefrigPulldownFailure = "pulldown-failure"
+	RefrigPulldownOK      = "pulldown-ok"
+	RefrigHighDuty        = "high-duty"
+	RefrigDutyOK          = "duty-ok"
+)
+
+const (
+	refrigMetricWindow = time.Hour
+	// Readings further apart than this are not used for the rate of rise
+	refrigMaxSampleGap = 10 * time.Minute
+)
+
+// RefrigEvent is reposted and written when something happens to a fridge or freezer
+type RefrigEvent struct {
+	Location  string    `json:"Location"`
+	Event     string    `json:"Event"`
+	TempF     float64   `json:"TempF"`
+	Detail    float64   `json:"Detail,omitempty"`
+	Timestamp time.Time `json:"Timestamp"`
+}
+
+// RefrigMetrics is the compressor summary for one metric window
+type RefrigMetrics struct {
+	Location      string    `json:"Location"`
+	Type          string    `json:"Type"`
+	DutyCyclePct  float64   `json:"DutyCyclePct"`
+	CyclesPerHour float64   `json:"CyclesPerHour"`
+	AvgOnMinutes  float64   `json:"AvgOnMinutes,omitempty"`
+	MinTempF      float64   `json:"MinTempF"`
+	MaxTempF      float64   `json:"MaxTempF"`
+	DoorOpenings  int       `json:"DoorOpenings"`
+	Timestamp     time.Time `json:"Timestamp"`
+}
+
+// RefrigStatus is the current state of a fridge or freezer
+type RefrigStatus struct {
+	Location        string         `json:"Location"`
+	Type            string         `json:"Type"`
+	TempF           float64        `json:"TempF"`
+	CompressorOn    bool           `json:"CompressorOn"`
+	DoorOpen        bool           `json:"DoorOpen"`
+	PulldownFailure bool           `json:"PulldownFailure"`
+	HighDuty        bool           `json:"HighDuty"`
+	LastMetrics     *RefrigMetrics `json:"LastMetrics,omitempty"`
+	Timestamp       time.Time      `json:"Timestamp"`
+}
+
+type refrigPeriod struct {
+	start time.Time
+	end   time.Time
+}
+
+// refrigUnit is the waveform state of a single fridge or freezer
+// The compressor is taken to be on while the temperature falls and off while it rises
+type refrigUnit struct {
+	conf         RefrigUnitConfig
+	location     string
+	lastTemp     float64
+	lastTime     time.Time
+	trend        int
+	extTemp      float64
+	extTime      time.Time
+	onStart      time.Time
+	onPeriods    []refrigPeriod
+	windowStart  time.Time
+	windowMin    float64
+	windowMax    float64
+	doorOpen     bool
+	doorOpenings int
+	aboveSince   time.Time
+	pulldownFail bool
+	highDuty     bool
+	lastMetrics  *RefrigMetrics
+}
+
+// RefrigerationMonitor analyses the temperature waveform of the fridges and freezers
+type RefrigerationMonitor struct {
+	mu    sync.Mutex
+	conf  RefrigerationConfig
+	units map[string]*refrigUnit
+}
+
+var SharedRefrigerationMonitor *RefrigerationMonitor
+
+func NewRefrigerationMonitor(conf RefrigerationConfig) *RefrigerationMonitor {
+	return &RefrigerationMonitor{
+		conf:  conf,
+		units: make(map[string]*refrigUnit),
+	}
+}
+
+// unitConfig finds the unit for a location, ignoring case since viper lowercases keys
+func (r *RefrigerationMonitor) unitConfig(location string) (RefrigUnitConfig, bool) {
+	for _, unit := range r.conf.Units {
+		if strings.EqualFold(unit.Name, location) {
+			return unit, true
+		}
+	}
+	return RefrigUnitConfig{}, false
+}
+
+// Update feeds a BLE reading from a fridge or freezer into its analysis
+func (r *RefrigerationMonitor) Update(client MQTT.Client, ble *BLETemperature) {
+	if ble.Location == "" || (ble.TempF == 0.0 && !ble.IsPresent("TempF")) {
+		return
+	}
+	unitConf, ok := r.unitConfig(ble.Location)
+	if !ok {
+		return
+	}
+	ts := ble.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	events, metrics := r.evaluate(unitConf, ble.Location, ble.TempF, ts)
+	for _, event := range events {
+		r.publishEvent(client, event)
+	}
+	if metrics != nil {
+		r.publishMetrics(client, *metrics)
+	}
+}
+
+func (r *RefrigerationMonitor) evaluate(unitConf RefrigUnitConfig, location string, temp float64, ts time.Time) ([]RefrigEvent, *RefrigMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unit, ok := r.units[unitConf.Name]
+	if !ok {
+		unit = &refrigUnit{
+			conf:        unitConf,
+			location:    location,
+			extTemp:     temp,
+			extTime:     ts,
+			windowStart: ts,
+			windowMin:   temp,
+			windowMax:   temp,
+		}
+		unit.lastTemp = temp
+		unit.lastTime = ts
+		r.units[unitConf.Name] = unit
+		r.checkPulldown(unit, temp, ts)
+		return nil, nil
+	}
+	if !ts.After(unit.lastTime) {
+		return nil, nil
+	}
+	var events []RefrigEvent
+	newEvent := func(name string, detail float64) {
+		events = append(events, RefrigEvent{Location: location, Event: name, TempF: temp, Detail: detail, Timestamp: ts})
+	}
+
+	// A door opening is a rise much faster than the compressor being off
+	gap := ts.Sub(unit.lastTime)
+	if gap <= refrigMaxSampleGap {
+		rate := (temp - unit.lastTemp) / gap.Minutes()
+		if rate >= r.conf.DoorRiseRate && !unit.doorOpen {
+			unit.doorOpen = true
+			unit.doorOpenings++
+			newEvent(RefrigDoorOpen, rate)
+		} else if rate < 0 && unit.doorOpen {
+			unit.doorOpen = false
+			newEvent(RefrigDoorClosed, 0.0)
+		}
+	}
+
+	r.trackCompressor(unit, temp, ts)
+	if event := r.checkPulldown(unit, temp, ts); event != "" {
+		newEvent(event, ts.Sub(unit.aboveSince).Minutes())
+	}
+	unit.windowMin = min(unit.windowMin, temp)
+	unit.windowMax = max(unit.windowMax, temp)
+	unit.lastTemp = temp
+	unit.lastTime = ts
+
+	if ts.Sub(unit.windowStart) < refrigMetricWindow {
+		return events, nil
+	}
+	metrics := r.windowMetrics(unit, ts)
+	unit.lastMetrics = &metrics
+	if r.conf.DutyWarnPct > 0 {
+		if metrics.DutyCyclePct >= r.conf.DutyWarnPct && !unit.highDuty {
+			unit.highDuty = true
+			newEvent(RefrigHighDuty, metrics.DutyCyclePct)
+		} else if metrics.DutyCyclePct < r.conf.DutyWarnPct && unit.highDuty {
+			unit.highDuty = false
+			newEvent(RefrigDutyOK, metrics.DutyCyclePct)
+		}
+	}
+	unit.windowStart = ts
+	unit.windowMin = temp
+	unit.windowMax = temp
+	unit.doorOpenings = 0
+	var kept []refrigPeriod
+	for _, period := range unit.onPeriods {
+		if period.end.After(ts) {
+			kept = append(kept, period)
+		}
+	}
+	unit.onPeriods = kept
+	return events, &metrics
+}
+
+// trackCompressor finds the turning points of the waveform
+// A turn only counts once the temperature has moved Hysteresis degrees back from the extreme
+func (r *RefrigerationMonitor) trackCompressor(unit *refrigUnit, temp float64, ts time.Time) {
+	switch {
+	case unit.trend < 0:
+		if temp < unit.extTemp {
+			unit.extTemp, unit.extTime = temp, ts
+		} else if temp-unit.extTemp >= r.conf.Hysteresis {
+			// The compressor stopped at the bottom of the curve
+			unit.onPeriods = append(unit.onPeriods, refrigPeriod{start: unit.onStart, end: unit.extTime})
+			unit.trend = 1
+			unit.extTemp, unit.extTime = temp, ts
+		}
+	case unit.trend > 0:
+		if temp > unit.extTemp {
+			unit.extTemp, unit.extTime = temp, ts
+		} else if unit.extTemp-temp >= r.conf.Hysteresis {
+			// The compressor started at the top of the curve
+			unit.onStart = unit.extTime
+			unit.trend = -1
+			unit.extTemp, unit.extTime = temp, ts
+		}
+	default:
+		if temp-unit.extTemp >= r.conf.Hysteresis {
+			unit.trend = 1
+			unit.extTemp, unit.extTime = temp, ts
+		} else if unit.extTemp-temp >= r.conf.Hysteresis {
+			unit.onStart = unit.extTime
+			unit.trend = -1
+			unit.extTemp, unit.extTime = temp, ts
+		}
+	}
+}
+
+// checkPulldown flags a unit that has been above its maximum temperature for too long
+func (r *RefrigerationMonitor) checkPulldown(unit *refrigUnit, temp float64, ts time.Time) string {
+	if temp <= unit.conf.MaxTempF {
+		unit.aboveSince = time.Time{}
+		if unit.pulldownFail {
+			unit.pulldownFail = false
+			return RefrigPulldownOK
+		}
+		return ""
+	}
+	if unit.aboveSince.IsZero() {
+		unit.aboveSince = ts
+	}
+	if !unit.pulldownFail && ts.Sub(unit.aboveSince) >= time.Duration(r.conf.PulldownMinutes)*time.Minute {
+		unit.pulldownFail = true
+		return RefrigPulldownFailure
+	}
+	return ""
+}
+
+// windowMetrics adds up the compressor on time since the window started
+func (r *RefrigerationMonitor) windowMetrics(unit *refrigUnit, ts time.Time) RefrigMetrics {
+	periods := unit.onPeriods
+	if unit.trend < 0 {
+		periods = append(periods, refrigPeriod{start: unit.onStart, end: ts})
+	}
+	var onTime time.Duration
+	cycles := 0
+	for _, period := range periods {
+		start := period.start
+		if start.Before(unit.windowStart) {
+			start = unit.windowStart
+		} else {
+			cycles++
+		}
+		if period.end.After(start) {
+			onTime += period.end.Sub(start)
+		}
+	}
+	window := ts.Sub(unit.windowStart)
+	metrics := RefrigMetrics{
+		Location:      unit.location,
+		Type:          unit.conf.Type,
+		DutyCyclePct:  100 * onTime.Seconds() / window.Seconds(),
+		CyclesPerHour: float64(cycles) / window.Hours(),
+		MinTempF:      unit.windowMin,
+		MaxTempF:      unit.windowMax,
+		DoorOpenings:  unit.doorOpenings,
+		Timestamp:     ts,
+	}
+	if cycles > 0 {
+		metrics.AvgOnMinutes = onTime.Minutes() / float64(cycles)
+	}
+	return metrics
+}
+
+func (r *RefrigerationMonitor) publishEvent(client MQTT.Client, event RefrigEvent) {
+	switch event.Event {
+	case RefrigPulldownFailure, RefrigHighDuty:
+		log.Warn().Msgf("Refrigeration %v %v at %.1fF", event.Location, event.Event, event.TempF)
+	default:
+		log.Info().Msgf("Refrigeration %v %v at %.1fF", event.Location, event.Event, event.TempF)
+	}
+	jsonData, err := json.Marshal(event)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "refrigeration/"+event.Location+"/event", string(jsonData))
+	WriteDerivedPoint(influxdb2.NewPoint("refrigerationEvent",
+		map[string]string{"Location": event.Location, "Event": event.Event},
+		map[string]interface{}{"TempF": event.TempF, "Detail": event.Detail}, event.Timestamp))
+}
+
+func (r *RefrigerationMonitor) publishMetrics(client MQTT.Client, metrics RefrigMetrics) {
+	log.Debug().Msgf("Refrigeration %v duty cycle %.0f%% with %.1f cycles an hour", metrics.Location,
+		metrics.DutyCyclePct, metrics.CyclesPerHour)
+	jsonData, err := json.Marshal(metrics)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+		return
+	}
+	PublishDerivedMessage(client, "refrigeration/"+metrics.Location+"/metrics", string(jsonData))
+	fields := map[string]interface{}{
+		"DutyCyclePct":  metrics.DutyCyclePct,
+		"CyclesPerHour": metrics.CyclesPerHour,
+		"MinTempF":      metrics.MinTempF,
+		"MaxTempF":      metrics.MaxTempF,
+		"DoorOpenings":  metrics.DoorOpenings,
+	}
+	if metrics.AvgOnMinutes != 0.0 {
+		fields["AvgOnMinutes"] = metrics.AvgOnMinutes
+	}
+	WriteDerivedPoint(influxdb2.NewPoint("refrigeration",
+		map[string]string{"Location": metrics.Location, "Type": metrics.Type}, fields, metrics.Timestamp))
+}
+
+// Statuses returns the current state of every unit that has reported
+func (r *RefrigerationMonitor) Statuses() []RefrigStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := []RefrigStatus{}
+	for _, unit := range r.units {
+		statuses = append(statuses, RefrigStatus{
+			Location:        unit.location,
+			Type:            unit.conf.Type,
+			TempF:           unit.lastTemp,
+			CompressorOn:    unit.trend < 0,
+			DoorOpen:        unit.doorOpen,
+			PulldownFailure: unit.pulldownFail,
+			HighDuty:        unit.highDuty,
+			LastMetrics:     unit.lastMetrics,
+			Timestamp:       unit.lastTime,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Location < statuses[j].Location
+	})
+	return statuses
+}
+
+// RegisterAPI adds the refrigeration endpoint to the API server
+func (r *RefrigerationMonitor) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/refrigeration", func(w http.ResponseWriter, req *http.Request) {
+		writeAPIJSON(w, http.StatusOK, r.Statuses())
+	})
+}
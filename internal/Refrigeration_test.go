@@ -0,0 +1,203 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testRefrigerationConfig() RefrigerationConfig {
+	return RefrigerationConfig{
+		Enabled:         true,
+		Hysteresis:      0.5,
+		DoorRiseRate:    2.0,
+		PulldownMinutes: 120,
+		DutyWarnPct:     70.0,
+		Units: []RefrigUnitConfig{
+			{Name: "fridge", Type: "fridge", MaxTempF: 40.0},
+		},
+	}
+}
+
+func fridgeAt(ts time.Time, tempF float64) *BLETemperature {
+	ble := &BLETemperature{MAC: "00:01:02:03:04:05", Location: "Fridge", TempF: tempF}
+	ble.Timestamp = ts
+	return ble
+}
+
+// cycleFridge feeds a sawtooth a minute at a time, falling for onMinutes and rising for offMinutes
+func cycleFridge(monitor *RefrigerationMonitor, start time.Time, minutes int, onMinutes int, offMinutes int) time.Time {
+	period := onMinutes + offMinutes
+	ts := start
+	for i := 0; i < minutes; i++ {
+		ts = start.Add(time.Duration(i) * time.Minute)
+		phase := i % period
+		temp := 38.0
+		if phase < onMinutes {
+			temp -= 6.0 * float64(phase) / float64(onMinutes)
+		} else {
+			temp += -6.0 + 6.0*float64(phase-onMinutes)/float64(offMinutes)
+		}
+		monitor.Update(nil, fridgeAt(ts, temp))
+	}
+	return ts
+}
+
+func refrigEvents(mockWriteAPI *MockInfluxWriteAPI) []string {
+	var events []string
+	for _, p := range pointsNamed(mockWriteAPI, "refrigerationEvent") {
+		events = append(events, pointTag(p, "Event"))
+	}
+	return events
+}
+
+func TestRefrigerationDutyCycle(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	monitor := NewRefrigerationMonitor(testRefrigerationConfig())
+	start := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	// On for 12 minutes out of every 30
+	cycleFridge(monitor, start, 3*60+1, 12, 18)
+
+	points := pointsNamed(mockWriteAPI, "refrigeration")
+	assert.Len(t, points, 3)
+	last := monitor.Statuses()[0].LastMetrics
+	assert.NotNil(t, last)
+	assert.Equal(t, "Fridge", last.Location)
+	assert.Equal(t, "fridge", last.Type)
+	assert.InDelta(t, 40.0, last.DutyCyclePct, 0.1)
+	assert.InDelta(t, 2.0, last.CyclesPerHour, 0.1)
+	assert.InDelta(t, 12.0, last.AvgOnMinutes, 0.1)
+	assert.InDelta(t, 32.0, last.MinTempF, 0.3)
+	assert.InDelta(t, 38.0, last.MaxTempF, 0.3)
+	assert.Equal(t, 0, last.DoorOpenings)
+	assert.Empty(t, pointsNamed(mockWriteAPI, "refrigerationEvent"))
+}
+
+func TestRefrigerationHighDuty(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	monitor := NewRefrigerationMonitor(testRefrigerationConfig())
+	start := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	// On for 24 minutes out of every 30
+	end := cycleFridge(monitor, start, 2*60+1, 24, 6)
+	status := monitor.Statuses()[0]
+	assert.True(t, status.HighDuty)
+	assert.InDelta(t, 80.0, status.LastMetrics.DutyCyclePct, 0.1)
+	events := pointsNamed(mockWriteAPI, "refrigerationEvent")
+	assert.Len(t, events, 1)
+	assert.Equal(t, RefrigHighDuty, pointTag(events[0], "Event"))
+
+	// Back to normal clears it
+	cycleFridge(monitor, end.Add(time.Minute), 2*60+1, 12, 18)
+	assert.False(t, monitor.Statuses()[0].HighDuty)
+	events = pointsNamed(mockWriteAPI, "refrigerationEvent")
+	assert.Equal(t, RefrigDutyOK, pointTag(events[len(events)-1], "Event"))
+}
+
+func TestRefrigerationDoorOpen(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	monitor := NewRefrigerationMonitor(testRefrigerationConfig())
+	start := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	monitor.Update(nil, fridgeAt(start, 36.0))
+	monitor.Update(nil, fridgeAt(start.Add(time.Minute), 36.2))
+	monitor.Update(nil, fridgeAt(start.Add(2*time.Minute), 39.5))
+	assert.True(t, monitor.Statuses()[0].DoorOpen)
+	monitor.Update(nil, fridgeAt(start.Add(3*time.Minute), 41.0))
+	monitor.Update(nil, fridgeAt(start.Add(4*time.Minute), 40.2))
+	assert.False(t, monitor.Statuses()[0].DoorOpen)
+
+	events := pointsNamed(mockWriteAPI, "refrigerationEvent")
+	assert.Len(t, events, 2)
+	assert.Equal(t, RefrigDoorOpen, pointTag(events[0], "Event"))
+	assert.Equal(t, "Fridge", pointTag(events[0], "Location"))
+	assert.Equal(t, RefrigDoorClosed, pointTag(events[1], "Event"))
+
+	// A long gap between readings is not a door opening
+	monitor.Update(nil, fridgeAt(start.Add(30*time.Minute), 44.0))
+	assert.False(t, monitor.Statuses()[0].DoorOpen)
+}
+
+func TestRefrigerationPulldownFailure(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	mockWriteAPI := NewMockInfluxWriteAPI()
+	SharedInfluxWriteAPI = mockWriteAPI
+	monitor := NewRefrigerationMonitor(testRefrigerationConfig())
+	start := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	// Warm fridge that barely cools with the compressor running flat out
+	for i := 0; i <= 120; i += 5 {
+		monitor.Update(nil, fridgeAt(start.Add(time.Duration(i)*time.Minute), 50.0-float64(i)/60))
+	}
+	status := monitor.Statuses()[0]
+	assert.True(t, status.PulldownFailure)
+	assert.True(t, status.HighDuty)
+	assert.Equal(t, []string{RefrigHighDuty, RefrigPulldownFailure}, refrigEvents(mockWriteAPI))
+
+	monitor.Update(nil, fridgeAt(start.Add(125*time.Minute), 39.0))
+	assert.False(t, monitor.Statuses()[0].PulldownFailure)
+	events := refrigEvents(mockWriteAPI)
+	assert.Equal(t, RefrigPulldownOK, events[len(events)-1])
+}
+
+func TestRefrigerationIgnoresOtherLocations(t *testing.T) {
+	monitor := NewRefrigerationMonitor(testRefrigerationConfig())
+	ble := fridgeAt(time.Now(), 70.0)
+	ble.Location = "Salon"
+	monitor.Update(nil, ble)
+	assert.Empty(t, monitor.Statuses())
+}
+
+func TestRefrigerationAPI(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	monitor := NewRefrigerationMonitor(testRefrigerationConfig())
+	monitor.Update(nil, fridgeAt(time.Now(), 36.0))
+	mux := http.NewServeMux()
+	monitor.RegisterAPI(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/refrigeration", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var statuses []RefrigStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "Fridge", statuses[0].Location)
+	assert.Equal(t, 36.0, statuses[0].TempF)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"reflect"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// Category is a kind of subscribed topic along with the handler for its messages
+// Name keys topic-overrides, verbose-topic-logging and SubscriptionConfig.Categories
+// TopicsKey is the subscription setting holding its topic list
+// Optional categories only log at debug level when they have no topics
+// NewData returns an empty value of its data type, which outlier filter rules are checked against
+// Mappings are the SignalK paths its handler parses and UpdateState feeds the derived features
+type Category struct {
+	Name        string
+	TopicsKey   string
+	Handler     MQTT.MessageHandler
+	Optional    bool
+	NewData     func() SensorData
+	Mappings    []PathMapping
+	UpdateState func(client MQTT.Client, measurement string, data SensorData)
+
+	measurement string
+	dataType    reflect.Type
+}
+
+var registeredCategories []Category
+
+// RegisterCategory adds a handler category
+// Each handler file registers itself from init so adding a category needs no other changes
+func RegisterCategory(category Category) {
+	for _, existing := range registeredCategories {
+		if existing.Name == category.Name {
+			log.Panic().Msgf("Category %v registered twice", category.Name)
+		}
+	}
+	if category.NewData != nil {
+		data := category.NewData()
+		category.measurement = data.GetMeasurementName()
+		category.dataType = reflect.TypeOf(data)
+	}
+	registeredCategories = append(registeredCategories, category)
+}
+
+// RegisteredCategories returns the categories in the order they registered
+func RegisteredCategories() []Category {
+	return append([]Category{}, registeredCategories...)
+}
+
+// DefaultPathMappings is what the built-in handlers parse, gathered from every category
+// Fields name the struct field of the measurement's data type
+func DefaultPathMappings() []PathMapping {
+	var mappings []PathMapping
+	for _, category := range registeredCategories {
+		mappings = append(mappings, category.Mappings...)
+	}
+	return mappings
+}
+
+// filterableTypes maps each measurement to its data type so rules can be checked against real fields
+func filterableTypes() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	for _, category := range registeredCategories {
+		if category.dataType != nil {
+			types[category.measurement] = category.dataType.Elem()
+		}
+	}
+	return types
+}
+
+// updateVesselState is called for every processed message before the empty check
+// so that legitimate zero readings such as SOG at anchor still reach the derived features
+func updateVesselState(client MQTT.Client, measurement string, data SensorData) {
+	dataType := reflect.TypeOf(data)
+	for _, category := range registeredCategories {
+		if category.UpdateState != nil && category.dataType == dataType {
+			category.UpdateState(client, measurement, data)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisteredCategories(t *testing.T) {
+	keys := make(map[string]string)
+	for _, category := range RegisteredCategories() {
+		assert.NotNil(t, category.Handler, category.Name)
+		keys[category.Name] = category.TopicsKey
+	}
+	assert.Equal(t, map[string]string{
+		"ble":        "bleTopics",
+		"phy":        "phyTopics",
+		"esp":        "espTopics",
+		"nav":        "navTopics",
+		"gnss":       "gnssTopics",
+		"steering":   "steeringTopics",
+		"wind":       "windTopics",
+		"water":      "waterTopics",
+		"outside":    "outsideTopics",
+		"propulsion": "propulsionTopics",
+		"tank":       "tankTopics",
+		"ais":        "aisTopics",
+		"mapped":     "mappedTopics",
+	}, keys)
+
+	assert.Panics(t, func() { RegisterCategory(Category{Name: "nav", TopicsKey: "navTopics"}) })
+	assert.Len(t, RegisteredCategories(), len(keys))
+}
+
+func TestCategoryTables(t *testing.T) {
+	// The filter, path mapping and vessel state tables are built from the categories
+	types := filterableTypes()
+	assert.Equal(t, reflect.TypeOf(Tank{}), types["tanks"])
+	assert.Equal(t, reflect.TypeOf(BLETemperature{}), types["bleTemperature"])
+	assert.NotContains(t, types, "mapped")
+	measurements := make(map[string]bool)
+	for _, mapping := range DefaultPathMappings() {
+		measurements[mapping.Measurement] = true
+	}
+	assert.Equal(t, map[string]bool{
+		"navigation": true, "gnss": true, "steering": true, "wind": true, "water": true,
+		"outside": true, "propulsion": true, "tanks": true, "ais": true,
+	}, measurements)
+
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	originalState := SharedVesselState
+	SharedVesselState = &VesselState{}
+	defer func() { SharedVesselState = originalState }()
+	updateVesselState(nil, "speedOverGround", &Navigation{SOG: 5.5})
+	assert.Equal(t, 5.5, SharedVesselState.Snapshot().SOG)
+}
+
+func TestLoadCategoryConfig(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+
+	viper.Set("subscription.topic-overrides", map[string]any{"wind": false, "bogus": true})
+	viper.Set("subscription.verbose-topic-logging", map[string]any{"water": true})
+	categories := LoadCategoryConfig()
+	assert.Len(t, categories, len(RegisteredCategories()))
+	assert.Equal(t, CategoryConfig{Topics: []string{"vessels/+/environment/wind/#"}}, categories["wind"])
+	assert.Equal(t, CategoryConfig{Topics: []string{"vessels/+/environment/water/#"}, Subscribed: true, Verbose: true}, categories["water"])
+	assert.Equal(t, CategoryConfig{Subscribed: true}, categories["mapped"])
+	_, ok := categories["bogus"]
+	assert.False(t, ok)
+}
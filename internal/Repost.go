@@ -0,0 +1,211 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/eclipse/paho.golang/paho"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultRepostTopic is the topic layout reposts have always used
+const DefaultRepostTopic = "{{.Root}}vessel/{{.Path}}"
+
+// DerivedCategory is the category of data computed by the daemon itself
+const DerivedCategory = "derived"
+
+// RepostTopic is what a repost topic template is executed with
+// Path is the default layout of Prefix/Source/Measurement or the subtopic for derived data
+// units are sent as MQTT 5 user properties and are not available to templates
+type RepostTopic struct {
+	Root        string
+	Category    string
+	Type        string
+	Prefix      string
+	Source      string
+	Measurement string
+	Path        string
+	units       map[string]string
+}
+
+// repostTarget is a destination ready to publish to
+// client is nil when publishing through a subscription broker
+type repostTarget struct {
+	conf       RepostDestination
+	topic      *template.Template
+	client     MQTT.Client
+	categories map[string]bool
+}
+
+// Reposter publishes to every configured repost destination
+type Reposter struct {
+	targets []*repostTarget
+}
+
+var SharedReposter *Reposter
+
+// defaultRepostTarget is used before a Reposter is set up and keeps the original behaviour
+var defaultRepostTarget = &repostTarget{
+	conf:  RepostDestination{Name: DefaultBrokerName, Topic: DefaultRepostTopic},
+	topic: template.Must(parseRepostTopic(DefaultBrokerName, DefaultRepostTopic)),
+}
+
+// parseRepostTopic parses a topic template and tries it once so unknown fields fail at load time
+func parseRepostTopic(name string, topic string) (*template.Template, error) {
+	tmpl, err := template.New(name).Parse(topic)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, RepostTopic{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func NewReposter(destinations []RepostDestination) (*Reposter, error) {
+	reposter := &Reposter{}
+	for _, dest := range destinations {
+		tmpl, err := parseRepostTopic(dest.Name, dest.Topic)
+		if err != nil {
+			return nil, err
+		}
+		target := &repostTarget{conf: dest, topic: tmpl}
+		if len(dest.Categories) > 0 {
+			target.categories = make(map[string]bool)
+			for _, category := range dest.Categories {
+				target.categories[category] = true
+			}
+		}
+		if dest.Host != "" {
+			target.client = newBrokerClient(BrokerConfig{
+				Name:            dest.Name,
+				Host:            dest.Host,
+				Username:        dest.Username,
+				Password:        dest.Password,
+				CACert:          dest.CACert,
+				TLS:             dest.TLS,
+				CleanSession:    true,
+				ProtocolVersion: dest.ProtocolVersion,
+			}, nil, nil)
+		}
+		reposter.targets = append(reposter.targets, target)
+	}
+	return reposter, nil
+}
+
+// Connect starts connecting the destinations that have their own server
+func (r *Reposter) Connect() {
+	for _, target := range r.targets {
+		if target.client == nil {
+			continue
+		}
+		log.Info().Msgf("Will repost to %v on server %v", target.conf.Name, target.conf.Host)
+		go func(target *repostTarget) {
+			if token := target.client.Connect(); token.Wait() && token.Error() != nil {
+				log.Warn().Msgf("Error Connecting to repost destination %v: %v", target.conf.Name, token.Error())
+			}
+		}(target)
+	}
+}
+
+// Publish sends a message to every destination that takes its category
+func (r *Reposter) Publish(client MQTT.Client, topic RepostTopic, messagedata string) {
+	for _, target := range r.targets {
+		target.publish(client, topic, messagedata)
+	}
+}
+
+func (t *repostTarget) publish(client MQTT.Client, topic RepostTopic, messagedata string) {
+	if t.categories != nil && !t.categories[topic.Category] {
+		return
+	}
+	var sb strings.Builder
+	if err := t.topic.Execute(&sb, topic); err != nil {
+		log.Warn().Msgf("Error building repost topic for %v: %v", t.conf.Name, err.Error())
+		return
+	}
+	publishClient := t.client
+	if publishClient == nil && t.conf.Broker != "" && SharedBrokerSet != nil {
+		publishClient = SharedBrokerSet.Client(t.conf.Broker)
+	}
+	if publishClient == nil {
+		publishClient = repostClient(client)
+	}
+	if publishClient == nil {
+		return
+	}
+	publishClientMessage(publishClient, sb.String(), messagedata, true, t.conf.QoS, t.conf.Retained, t.properties(topic))
+}
+
+// properties describes the repost for MQTT 5 brokers
+func (t *repostTarget) properties(topic RepostTopic) *paho.PublishProperties {
+	props := &paho.PublishProperties{ContentType: "application/json"}
+	props.User.Add("category", topic.Category)
+	if topic.Type != "" {
+		props.User.Add("type", topic.Type)
+	}
+	if topic.Source != "" {
+		props.User.Add("source", topic.Source)
+	}
+	if topic.Measurement != "" {
+		props.User.Add("measurement", topic.Measurement)
+	}
+	fields := make([]string, 0, len(topic.units))
+	for field := range topic.units {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		props.User.Add("unit:"+field, topic.units[field])
+	}
+	if t.conf.MessageExpiry > 0 {
+		expiry := t.conf.MessageExpiry
+		props.MessageExpiry = &expiry
+	}
+	return props
+}
+
+// repostMessage publishes to the repost destinations when reposting is enabled
+func repostMessage(client MQTT.Client, topic RepostTopic, messagedata string) {
+	if !SharedSubscriptionConfig.Repost {
+		return
+	}
+	topic.Root = SharedSubscriptionConfig.RepostRootTopic
+	if SharedReposter == nil {
+		defaultRepostTarget.publish(client, topic, messagedata)
+		return
+	}
+	SharedReposter.Publish(client, topic, messagedata)
+}
+
+// repostSensorData reposts parsed data under its measurement
+func repostSensorData(client MQTT.Client, measurement string, data SensorData) {
+	repostMessage(client, RepostTopic{
+		Category:    data.GetCategory(),
+		Type:        data.GetMeasurementName(),
+		Prefix:      data.GetTopicPrefix(),
+		Source:      data.GetSource(),
+		Measurement: measurement,
+		Path:        data.GetTopicPrefix() + "/" + data.GetSource() + "/" + measurement,
+		units:       fieldUnits(data.GetMeasurementName(), data.GetInfluxFields()),
+	}, data.ToJSON())
+}
@@ -0,0 +1,109 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReposterDestinations(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	set, clients := mockBrokerSet([]BrokerConfig{{Name: "cerbo"}, {Name: "cloud"}})
+	SharedBrokerSet = set
+	defer func() { SharedBrokerSet = nil }()
+	reposter, err := NewReposter([]RepostDestination{
+		{Name: "local", Broker: "cerbo", Topic: DefaultRepostTopic},
+		{Name: "cloud", Broker: "cloud", Topic: "boats/test/{{.Category}}/{{.Measurement}}/{{.Source}}", QoS: 1, Retained: true, Categories: []string{"wind"}},
+	})
+	require.NoError(t, err)
+	SharedReposter = reposter
+	defer func() { SharedReposter = nil }()
+
+	handleWindMessage(clients[0], NewMockMessage("vessels/self/environment/wind/speedApparent",
+		[]byte(`{"value": 5.0, "$source": "test-source", "timestamp": "2025-01-01T12:00:00.100Z"}`)))
+	assert.Len(t, clients[0].PublishedTo("test/vessel/environment/wind/mapped-source/speedApparent"), 1)
+	cloud := clients[1].PublishedTo("boats/test/wind/speedApparent/mapped-source")
+	require.Len(t, cloud, 1)
+	assert.Equal(t, byte(1), cloud[0].Qos)
+	assert.True(t, cloud[0].Retained)
+
+	// Derived data only goes where the derived category is allowed
+	PublishDerivedMessage(clients[0], "geofence/state", `{"Zone":"Marina"}`)
+	assert.Len(t, clients[0].PublishedTo("test/vessel/geofence/state"), 1)
+	assert.Len(t, clients[1].Published, 1)
+
+	// Nothing is reposted when reposting is off
+	SharedSubscriptionConfig.Repost = false
+	PublishDerivedMessage(clients[0], "geofence/state", `{"Zone":"Marina"}`)
+	assert.Len(t, clients[0].PublishedTo("test/vessel/geofence/state"), 1)
+}
+
+func TestDefaultRepostTarget(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	client := &MockMQTTClient{}
+
+	// Without a reposter the original layout is used on the receiving client
+	steer := &Steering{BaseSensorData: BaseSensorData{Source: "Autopilot"}}
+	repostSensorData(client, "autopilotState", steer)
+	published := client.PublishedTo("test/vessel/steering/Autopilot/autopilotState")
+	require.Len(t, published, 1)
+	assert.Equal(t, byte(0), published[0].Qos)
+	assert.False(t, published[0].Retained)
+}
+
+func TestParseRepostTopic(t *testing.T) {
+	_, err := parseRepostTopic("ok", "{{.Root}}{{.Category}}/{{.Prefix}}/{{.Source}}/{{.Measurement}}")
+	assert.NoError(t, err)
+	_, err = parseRepostTopic("bad", "{{.Root")
+	assert.Error(t, err)
+	_, err = parseRepostTopic("unknown", "{{.Device}}")
+	assert.Error(t, err)
+}
+
+func TestRepostProperties(t *testing.T) {
+	target := &repostTarget{conf: RepostDestination{Name: "cloud", MessageExpiry: 60}}
+	wind := &Wind{BaseSensorData: BaseSensorData{Source: "Mast"}, SpeedApp: 12.5, AngleApp: 40}
+	wind.MarkPresent("SpeedApp", "AngleApp")
+	props := target.properties(RepostTopic{
+		Category:    wind.GetCategory(),
+		Type:        wind.GetMeasurementName(),
+		Source:      wind.GetSource(),
+		Measurement: "speedApparent",
+		units:       fieldUnits(wind.GetMeasurementName(), wind.GetInfluxFields()),
+	})
+	assert.Equal(t, "application/json", props.ContentType)
+	require.NotNil(t, props.MessageExpiry)
+	assert.Equal(t, uint32(60), *props.MessageExpiry)
+	assert.Equal(t, "wind", props.User.Get("category"))
+	assert.Equal(t, "wind", props.User.Get("type"))
+	assert.Equal(t, "Mast", props.User.Get("source"))
+	assert.Equal(t, "speedApparent", props.User.Get("measurement"))
+	assert.Equal(t, "kn", props.User.Get("unit:SpeedApp"))
+	assert.Equal(t, "deg", props.User.Get("unit:AngleApp"))
+
+	// Derived data has no source or measurement and no expiry unless configured
+	props = (&repostTarget{}).properties(RepostTopic{Category: DerivedCategory, Prefix: "anchor/state", Path: "anchor/state"})
+	assert.Nil(t, props.MessageExpiry)
+	assert.Equal(t, "derived", props.User.Get("category"))
+	assert.Empty(t, props.User.Get("source"))
+	assert.Len(t, props.User, 1)
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// RedactedSecret is printed in place of a secret
+const RedactedSecret = "REDACTED"
+
+// Secret is a password or token that is redacted whenever it is logged or serialized
+// Value returns the secret itself for handing to a client
+type Secret string
+
+var secretEnvPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return RedactedSecret
+}
+
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// loadSecret loads the secret at key from its value or from the file named by key_file
+// ${NAME} in either is replaced from the environment so systemd credentials can be read from ${CREDENTIALS_DIRECTORY}
+func loadSecret(key string, value *string, file *string) (Secret, error) {
+	if file != nil {
+		if value != nil {
+			log.Warn().Msgf("Both %v and %v_file are set will use the file", key, key)
+		}
+		filename, err := expandSecretEnv(*file)
+		if err != nil {
+			return "", fmt.Errorf("%v_file: %v", key, err)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Error().Msgf("Error reading secret file for %v: %v", key, err.Error())
+			return "", fmt.Errorf("unable to read secret file for %v: %v", key, err)
+		}
+		log.Debug().Msgf("Loaded %v from %v", key, filename)
+		// Files written by editors and echo end in a newline that is not part of the secret
+		return Secret(strings.TrimRight(string(data), "\r\n")), nil
+	}
+	expanded, err := expandSecretEnv(configValue(value))
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", key, err)
+	}
+	return Secret(expanded), nil
+}
+
+// expandSecretEnv replaces ${NAME} with the environment variable
+// Only the braced form is expanded so a bare $ in a password is left alone
+func expandSecretEnv(value string) (string, error) {
+	var missing []string
+	expanded := secretEnvPattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := secretEnvPattern.FindStringSubmatch(match)[1]
+		env, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return env
+	})
+	if len(missing) > 0 {
+		log.Error().Msgf("Environment variables %v are not set", strings.Join(missing, ", "))
+		return "", fmt.Errorf("environment variables %v are not set", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
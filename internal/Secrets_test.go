@@ -0,0 +1,118 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecretRedaction(t *testing.T) {
+	secret := Secret("hunter2")
+	assert.Equal(t, "hunter2", secret.Value())
+	assert.Equal(t, RedactedSecret, fmt.Sprintf("%v", secret))
+	assert.Equal(t, RedactedSecret, fmt.Sprintf("%#v", secret))
+
+	// Secrets nested in the config are redacted when the config is logged
+	conf := SubscriptionConfig{
+		Brokers:     []BrokerConfig{{Name: "cerbo", Username: "boat", Password: secret}},
+		InfluxToken: Secret("influx-token"),
+	}
+	assert.NotContains(t, fmt.Sprintf("%+v", conf), "hunter2")
+	assert.NotContains(t, fmt.Sprintf("%+v", conf), "influx-token")
+	jsonData, err := json.Marshal(conf)
+	require.NoError(t, err)
+	assert.NotContains(t, string(jsonData), "hunter2")
+	assert.NotContains(t, string(jsonData), "influx-token")
+	assert.Contains(t, string(jsonData), `"Password":"REDACTED"`)
+	// An unset secret stays empty so it is clear nothing was configured
+	jsonData, err = json.Marshal(BrokerConfig{})
+	require.NoError(t, err)
+	assert.Contains(t, string(jsonData), `"Password":""`)
+}
+
+func TestLoadSecret(t *testing.T) {
+	dir := t.TempDir()
+	value := func(s string) *string { return &s }
+
+	secret, err := loadSecret("test.password", value("plain"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", secret.Value())
+
+	t.Setenv("MSH_TEST_PASSWORD", "from-env")
+	secret, err = loadSecret("test.password", value("${MSH_TEST_PASSWORD}"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", secret.Value())
+
+	// Only the braced form is expanded
+	secret, err = loadSecret("test.password", value("pa$word"), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "pa$word", secret.Value())
+
+	_, err = loadSecret("test.password", value("${MSH_TEST_UNSET}"), nil)
+	assert.ErrorContains(t, err, "MSH_TEST_UNSET")
+
+	// A file wins over the value and can be found through a systemd credentials directory
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "mqtt-password"), []byte("from-file\n"), 0600))
+	t.Setenv("CREDENTIALS_DIRECTORY", dir)
+	secret, err = loadSecret("test.password", value("plain"), value("${CREDENTIALS_DIRECTORY}/mqtt-password"))
+	require.NoError(t, err)
+	assert.Equal(t, "from-file", secret.Value())
+
+	_, err = loadSecret("test.password", nil, value(filepath.Join(dir, "missing")))
+	assert.ErrorContains(t, err, "unable to read secret file")
+
+	// Unset secrets are empty
+	secret, err = loadSecret("test.token", nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, secret)
+}
+
+func TestLoadConfigSecrets(t *testing.T) {
+	cleanup := setupTestConfig(t)
+	defer cleanup()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "influx-token"), []byte("token-from-file\n"), 0600))
+	t.Setenv("MSH_HUB_PASSWORD", "hub-secret")
+	t.Setenv("MSH_CLOUD_PASSWORD", "cloud-secret")
+
+	viper.Set("subscription.password_file", filepath.Join(dir, "missing"))
+	_, err := LoadSubscribeServerConfig()
+	assert.ErrorContains(t, err, "subscription.password")
+
+	viper.Set("subscription.password_file", filepath.Join(dir, "influx-token"))
+	viper.Set("subscription.influxdb.token_file", filepath.Join(dir, "influx-token"))
+	viper.Set("subscription.brokers.hub", map[string]any{"server": "tcp://hub.local:1883", "password": "${MSH_HUB_PASSWORD}"})
+	viper.Set("subscription.repost-destinations.cloud", map[string]any{"server": "ssl://cloud.local:8883", "password": "${MSH_CLOUD_PASSWORD}"})
+	subConf, err := LoadSubscribeServerConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "token-from-file", subConf.InfluxToken.Value())
+	assert.Equal(t, "token-from-file", subConf.Brokers[0].Password.Value())
+	assert.Equal(t, "hub-secret", subConf.Brokers[1].Password.Value())
+	assert.Equal(t, "cloud-secret", subConf.RepostTargets[0].Password.Value())
+
+	viper.Set("pubservers.ssl://localhost:8883.password", "${MSH_TEST_UNSET}")
+	_, err = LoadPublishServerConfig()
+	assert.ErrorContains(t, err, "MSH_TEST_UNSET")
+}
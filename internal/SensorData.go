@@ -17,7 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"context"
 	"encoding/json"
 	"strings"
 	"time"
@@ -51,16 +50,26 @@ type SensorData interface {
 	SetTimestamp(timestamp time.Time)
 	// GetLogEnabled returns whether logging is enabled for this data type
 	GetLogEnabled() bool
+	// GetCategory returns the handler category the data was received on
+	GetCategory() string
 	// GetMeasurementName returns the measurement name for InfluxDB
 	GetMeasurementName() string
 	// GetTopicPrefix returns the topic prefix for MQTT publishing
 	GetTopicPrefix() string
+	// MarkPresent records that fields were parsed from the message
+	MarkPresent(fields ...string)
+	// ClearPresent forgets that a field was parsed from the message
+	ClearPresent(field string)
+	// IsPresent returns whether a field was parsed from the message
+	IsPresent(field string) bool
 }
 
 // BaseSensorData contains common fields and methods for all sensor data types
+// present holds the struct field names that were parsed so that zero readings are kept
 type BaseSensorData struct {
 	Source    string    `json:"Source,omitempty"`
 	Timestamp time.Time `json:"Timestamp,omitempty"`
+	present   map[string]bool
 }
 
 // GetSource returns the source of the data
@@ -83,6 +92,31 @@ func (b *BaseSensorData) SetTimestamp(timestamp time.Time) {
 	b.Timestamp = timestamp
 }
 
+// MarkPresent records that fields were parsed from the message
+func (b *BaseSensorData) MarkPresent(fields ...string) {
+	if b.present == nil {
+		b.present = make(map[string]bool)
+	}
+	for _, field := range fields {
+		b.present[field] = true
+	}
+}
+
+// ClearPresent forgets that a field was parsed from the message
+func (b *BaseSensorData) ClearPresent(field string) {
+	delete(b.present, field)
+}
+
+// IsPresent returns whether a field was parsed from the message
+func (b BaseSensorData) IsPresent(field string) bool {
+	return b.present[field]
+}
+
+// HasPresent returns whether any field was parsed from the message
+func (b BaseSensorData) HasPresent() bool {
+	return len(b.present) > 0
+}
+
 // GetInfluxTags returns tags for InfluxDB
 func (b BaseSensorData) GetInfluxTags() map[string]string {
 	tagTmp := make(map[string]string)
@@ -123,11 +157,8 @@ func ParseCommonFields(rawData map[string]any, data SensorData) {
 	name, ok := SharedSubscriptionConfig.N2KtoName[strings.ToLower(data.GetSource())]
 	if ok {
 		data.SetSource(name)
-	} else {
-		// Skip Victron GPS data
-		if !strings.Contains(data.GetSource(), "venus.com.victronenergy.gps.") {
-			log.Warn().Msgf("Name not found for Source %v", data.GetSource())
-		}
+	} else if !isExcludedSource(data) {
+		log.Warn().Msgf("Name not found for Source %v", data.GetSource())
 	}
 }
 
@@ -150,15 +181,36 @@ func HandleSensorMessage(client MQTT.Client, message MQTT.Message, data SensorDa
 	err := json.Unmarshal(message.Payload(), &rawData)
 	if err != nil {
 		log.Warn().Msgf("Error unmarshalling JSON for topic: %v error: %v", message.Topic(), err.Error())
+		countError(ErrorParse)
 		return
 	}
 
 	// Parse common fields
 	ParseCommonFields(rawData, data)
+	if isExcludedSource(data) {
+		log.Trace().Msgf("Ignoring excluded source %v", data.GetSource())
+		return
+	}
 
 	// Call the specific handler for this data type
 	handler(rawData, measurement, data)
 
+	processSensorData(client, measurement, data)
+}
+
+// processSensorData filters, arbitrates and publishes parsed data
+func processSensorData(client MQTT.Client, measurement string, data SensorData) {
+	// Drop impossible values before anything else sees them
+	if !filterSensorData(data) {
+		return
+	}
+
+	// Only the believed source feeds the derived data features, before empty data is dropped
+	best, publishBest := selectSource(data, measurement)
+	if best {
+		updateVesselState(client, measurement, data)
+	}
+
 	// Skip empty data
 	if data.IsEmpty() {
 		return
@@ -167,17 +219,37 @@ func HandleSensorMessage(client MQTT.Client, message MQTT.Message, data SensorDa
 	// Log the data
 	data.LogJSON()
 
-	// Publish to MQTT if enabled
-	if SharedSubscriptionConfig.Repost {
-		PublishClientMessage(client,
-			SharedSubscriptionConfig.RepostRootTopic+"vessel/"+data.GetTopicPrefix()+"/"+data.GetSource()+"/"+measurement,
-			data.ToJSON(), true)
+	publishSensorData(client, measurement, data)
+	if best && publishBest {
+		// Republished under the best source name so consumers get one clean series
+		source := data.GetSource()
+		data.SetSource(SharedSubscriptionConfig.Sources.BestSource)
+		publishSensorData(client, measurement, data)
+		data.SetSource(source)
 	}
+}
+
+// publishSensorData reposts the data and writes it to InfluxDB when enabled
+func publishSensorData(client MQTT.Client, measurement string, data SensorData) {
+	logEnabled := data.GetLogEnabled()
+
+	// Readings that have not moved enough are held back from every sink
+	if !deadbandAllows(data) {
+		log.Trace().Msgf("Holding back unchanged %v from %v", measurement, data.GetSource())
+		return
+	}
+
+	// Publish to MQTT if enabled
+	repostSensorData(client, measurement, data)
 
 	// Write to InfluxDB if enabled
 	if SharedSubscriptionConfig.InfluxEnabled {
 		p := data.ToInfluxPoint()
-		err := SharedInfluxWriteAPI.WritePoint(context.Background(), p)
+		tagZone(p)
+		if !aggregatePoint(p) {
+			return
+		}
+		err := writeInfluxPoint(p)
 		if err != nil {
 			log.Warn().Msgf("Error writing to influx: %v", err.Error())
 		}
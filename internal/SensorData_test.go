@@ -93,6 +93,10 @@ func (m *MockSensorData) GetLogEnabled() bool {
 	return m.MockLogEnabled
 }
 
+func (m *MockSensorData) GetCategory() string {
+	return "mock"
+}
+
 func (m *MockSensorData) GetMeasurementName() string {
 	return m.MockMeasurementName
 }
@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SourceSelection is the source currently believed for one leaf of a measurement
+type SourceSelection struct {
+	Key       string               `json:"Key"`
+	Current   string               `json:"Current"`
+	Preferred []string             `json:"Preferred"`
+	LastSeen  map[string]time.Time `json:"LastSeen"`
+}
+
+// SourceArbiter picks one source per measurement leaf from the configured priorities
+// The preferred source that is still reporting wins and a stale source fails over to the next
+type SourceArbiter struct {
+	mu         sync.Mutex
+	conf       SourceConfig
+	selections map[string]*SourceSelection
+}
+
+var SharedSourceArbiter *SourceArbiter
+
+func NewSourceArbiter(conf SourceConfig) *SourceArbiter {
+	return &SourceArbiter{
+		conf:       conf,
+		selections: make(map[string]*SourceSelection),
+	}
+}
+
+// rule finds the priority for a leaf, falling back to the measurement's * rule
+func (a *SourceArbiter) rule(measurement string, field string) *SourcePriority {
+	var fallback *SourcePriority
+	for i := range a.conf.Priority {
+		rule := &a.conf.Priority[i]
+		if !strings.EqualFold(rule.Measurement, measurement) {
+			continue
+		}
+		if strings.EqualFold(rule.Field, field) {
+			return rule
+		}
+		if rule.Field == "*" {
+			fallback = rule
+		}
+	}
+	return fallback
+}
+
+// rank is the position of a source in the priority list with unlisted sources last
+func rank(rule *SourcePriority, source string) int {
+	for i, preferred := range rule.Sources {
+		if strings.EqualFold(preferred, source) {
+			return i
+		}
+	}
+	return len(rule.Sources)
+}
+
+// Select records a reading and returns whether its source is the one to believe
+// arbitrated is false when no priority covers the reading so every source is believed
+func (a *SourceArbiter) Select(data SensorData, field string) (best bool, arbitrated bool) {
+	rule := a.rule(data.GetMeasurementName(), field)
+	if rule == nil {
+		return true, false
+	}
+	source := data.GetSource()
+	ts := data.GetTimestamp()
+	stale := time.Duration(a.conf.StaleAfter) * time.Second
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := selectionKey(data, field)
+	sel, ok := a.selections[key]
+	if !ok {
+		sel = &SourceSelection{Key: key, Preferred: rule.Sources, LastSeen: make(map[string]time.Time)}
+		a.selections[key] = sel
+	}
+	sel.LastSeen[source] = ts
+	switch {
+	case sel.Current == "":
+		sel.Current = source
+	case sel.Current == source:
+	case ts.Sub(sel.LastSeen[sel.Current]) > stale:
+		log.Info().Msgf("Source %v for %v is stale, failing over to %v", sel.Current, key, source)
+		sel.Current = source
+	case rank(rule, source) < rank(rule, sel.Current):
+		log.Info().Msgf("Source %v for %v is back, switching from %v", source, key, sel.Current)
+		sel.Current = source
+	}
+	return sel.Current == source, true
+}
+
+// selectionKey names what a reading measures so each engine or tank is arbitrated on its own
+func selectionKey(data SensorData, field string) string {
+	tags := data.GetInfluxTags()
+	var parts []string
+	for k, v := range tags {
+		if k != "Source" {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	sort.Strings(parts)
+	parts = append([]string{data.GetMeasurementName()}, parts...)
+	return strings.Join(append(parts, field), "/")
+}
+
+// Selections returns a copy of every selection sorted by key
+func (a *SourceArbiter) Selections() []SourceSelection {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	selections := make([]SourceSelection, 0, len(a.selections))
+	for _, sel := range a.selections {
+		cp := *sel
+		cp.LastSeen = make(map[string]time.Time, len(sel.LastSeen))
+		for k, v := range sel.LastSeen {
+			cp.LastSeen[k] = v
+		}
+		selections = append(selections, cp)
+	}
+	sort.Slice(selections, func(i, j int) bool { return selections[i].Key < selections[j].Key })
+	return selections
+}
+
+func (a *SourceArbiter) RegisterAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/sources", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, a.Selections())
+	})
+}
+
+// isExcludedSource returns true for sources whose data is dropped for the measurement
+func isExcludedSource(data SensorData) bool {
+	for measurement, fragments := range SharedSubscriptionConfig.Sources.Exclude {
+		if !strings.EqualFold(measurement, data.GetMeasurementName()) {
+			continue
+		}
+		for _, fragment := range fragments {
+			if fragment != "" && strings.Contains(data.GetSource(), fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectSource returns whether the data comes from the source to believe
+// and whether a copy should be published under the best source name
+func selectSource(data SensorData, measurement string) (best bool, publishBest bool) {
+	if SharedSourceArbiter == nil {
+		return true, false
+	}
+	return SharedSourceArbiter.Select(data, measurement)
+}
@@ -0,0 +1,175 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func navFrom(source string, ts time.Time) *Navigation {
+	return &Navigation{BaseSensorData: BaseSensorData{Source: source, Timestamp: ts}}
+}
+
+func TestSourceArbiterFailover(t *testing.T) {
+	arbiter := NewSourceArbiter(SourceConfig{
+		StaleAfter: 10,
+		Priority: []SourcePriority{
+			{Measurement: "navigation", Field: "position", Sources: []string{"GPS", "Backup GPS"}},
+			{Measurement: "navigation", Field: "*", Sources: []string{"Compass"}},
+		},
+	})
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// The first source heard is used until a better one shows up
+	best, arbitrated := arbiter.Select(navFrom("Backup GPS", start), "position")
+	assert.True(t, best)
+	assert.True(t, arbitrated)
+	best, _ = arbiter.Select(navFrom("GPS", start.Add(time.Second)), "position")
+	assert.True(t, best)
+	best, _ = arbiter.Select(navFrom("Backup GPS", start.Add(2*time.Second)), "position")
+	assert.False(t, best)
+
+	// The preferred source goes quiet and the backup takes over
+	best, _ = arbiter.Select(navFrom("Backup GPS", start.Add(15*time.Second)), "position")
+	assert.True(t, best)
+	best, _ = arbiter.Select(navFrom("AIS", start.Add(16*time.Second)), "position")
+	assert.False(t, best)
+	best, _ = arbiter.Select(navFrom("GPS", start.Add(17*time.Second)), "position")
+	assert.True(t, best)
+
+	// Other leaves use the * rule and are tracked on their own
+	best, _ = arbiter.Select(navFrom("GPS", start), "headingMagnetic")
+	assert.True(t, best)
+	best, _ = arbiter.Select(navFrom("Compass", start.Add(time.Second)), "headingMagnetic")
+	assert.True(t, best)
+	best, _ = arbiter.Select(navFrom("GPS", start.Add(2*time.Second)), "headingMagnetic")
+	assert.False(t, best)
+
+	// Measurements without a rule are not arbitrated
+	best, arbitrated = arbiter.Select(&Wind{BaseSensorData: BaseSensorData{Source: "Mast", Timestamp: start}}, "speedApparent")
+	assert.True(t, best)
+	assert.False(t, arbitrated)
+
+	selections := arbiter.Selections()
+	require.Len(t, selections, 2)
+	assert.Equal(t, "navigation/headingMagnetic", selections[0].Key)
+	assert.Equal(t, "Compass", selections[0].Current)
+	assert.Equal(t, "navigation/position", selections[1].Key)
+	assert.Equal(t, "GPS", selections[1].Current)
+	assert.Len(t, selections[1].LastSeen, 3)
+}
+
+func TestSourceArbiterPerDevice(t *testing.T) {
+	arbiter := NewSourceArbiter(SourceConfig{
+		StaleAfter: 10,
+		Priority:   []SourcePriority{{Measurement: "propulsion", Field: "*", Sources: []string{"ECU"}}},
+	})
+	now := time.Now()
+	port := &Propulsion{BaseSensorData: BaseSensorData{Source: "Gauge", Timestamp: now}, Device: "port"}
+	starboard := &Propulsion{BaseSensorData: BaseSensorData{Source: "ECU", Timestamp: now}, Device: "starboard"}
+	best, _ := arbiter.Select(starboard, "revolutions")
+	assert.True(t, best)
+	// The starboard ECU does not outrank a gauge on the port engine
+	best, _ = arbiter.Select(port, "revolutions")
+	assert.True(t, best)
+	keys := []string{}
+	for _, sel := range arbiter.Selections() {
+		keys = append(keys, sel.Key)
+	}
+	assert.Equal(t, []string{"propulsion/Device=port/revolutions", "propulsion/Device=starboard/revolutions"}, keys)
+}
+
+func TestBestSourcePublishing(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+	originalState := SharedVesselState
+	SharedVesselState = &VesselState{}
+	defer func() { SharedVesselState = originalState }()
+
+	SharedSubscriptionConfig.N2KtoName = map[string]string{}
+	SharedSubscriptionConfig.Sources = SourceConfig{
+		StaleAfter: 10,
+		BestSource: "best",
+		Priority:   []SourcePriority{{Measurement: "navigation", Field: "position", Sources: []string{"gps.1"}}},
+	}
+	SharedSourceArbiter = NewSourceArbiter(SharedSubscriptionConfig.Sources)
+	defer func() { SharedSourceArbiter = nil }()
+	client := &MockMQTTClient{}
+
+	send := func(source string, lat float64, ts string) {
+		payload, _ := json.Marshal(map[string]any{
+			"$source":   source,
+			"timestamp": ts,
+			"value":     map[string]any{"latitude": lat, "longitude": -76.5},
+		})
+		HandleSensorMessage(client, NewMockMessage("vessels/self/navigation/position", payload),
+			&Navigation{}, processNavigationData)
+	}
+	send("gps.1", 38.1, "2025-01-01T12:00:00.000Z")
+	send("gps.2", 38.2, "2025-01-01T12:00:01.000Z")
+
+	// Both raw sources are written and only the preferred one is copied to best
+	points := pointsNamed(mockWriteAPI, "navigation")
+	require.Len(t, points, 3)
+	assert.Equal(t, "gps.1", pointTag(points[0], "Source"))
+	assert.Equal(t, "best", pointTag(points[1], "Source"))
+	assert.Equal(t, "gps.2", pointTag(points[2], "Source"))
+	assert.Equal(t, 38.1, SharedVesselState.Snapshot().Lat)
+
+	// The preferred source goes stale so the second takes over
+	send("gps.2", 38.3, "2025-01-01T12:00:20.000Z")
+	points = pointsNamed(mockWriteAPI, "navigation")
+	require.Len(t, points, 5)
+	assert.Equal(t, "best", pointTag(points[4], "Source"))
+	assert.Equal(t, 38.3, SharedVesselState.Snapshot().Lat)
+
+	mux := http.NewServeMux()
+	SharedSourceArbiter.RegisterAPI(mux)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/sources", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var selections []SourceSelection
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &selections))
+	require.Len(t, selections, 1)
+	assert.Equal(t, "gps.2", selections[0].Current)
+}
+
+func TestExcludedSource(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	mockWriteAPI := SharedInfluxWriteAPI.(*MockInfluxWriteAPI)
+	SharedSubscriptionConfig.Sources = SourceConfig{
+		Exclude: map[string][]string{"navigation": {"venus.com.victronenergy.gps."}},
+	}
+
+	assert.True(t, isExcludedSource(navFrom("venus.com.victronenergy.gps.123", time.Now())))
+	assert.False(t, isExcludedSource(navFrom("n2k-on-ve.can-socket.6", time.Now())))
+	assert.False(t, isExcludedSource(&Water{BaseSensorData: BaseSensorData{Source: "venus.com.victronenergy.gps.123"}}))
+
+	payload := []byte(`{"$source": "venus.com.victronenergy.gps.123", "timestamp": "2025-01-01T12:00:00.000Z", "value": {"latitude": 38.1, "longitude": -76.5}}`)
+	HandleSensorMessage(&MockMQTTClient{}, NewMockMessage("vessels/self/navigation/position", payload),
+		&Navigation{}, processNavigationData)
+	assert.Empty(t, mockWriteAPI.Points)
+}
@@ -17,7 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
 	"strings"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -34,9 +33,28 @@ type Steering struct {
 	TargetHeadingMag float64 `json:"TargetHeading,omitempty"`
 }
 
+// steeringPathMappings are the SignalK paths the steering handler parses
+var steeringPathMappings = []PathMapping{
+	{Path: "steering.rudderAngle", Measurement: "steering", Field: "RudderAngle", Conversion: "radians-to-degrees"},
+	{Path: "steering.autopilot", Measurement: "steering"},
+	{Path: "steering.autopilot.state", Measurement: "steering", Field: "AutopilotState"},
+	{Path: "steering.autopilot.target", Measurement: "steering"},
+	{Path: "steering.autopilot.target.headingMagnetic", Measurement: "steering", Field: "TargetHeadingMag", Conversion: "radians-to-degrees"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:      "steering",
+		TopicsKey: "steeringTopics",
+		Handler:   OnSteeringMessage,
+		NewData:   func() SensorData { return &Steering{} },
+		Mappings:  steeringPathMappings,
+	})
+}
+
 // OnSteeringMessage is called when a steering message is received
 func OnSteeringMessage(client MQTT.Client, message MQTT.Message) {
-	go handleSteeringMessage(client, message)
+	dispatchMessage(handleSteeringMessage, client, message)
 }
 
 // handleSteeringMessage processes steering messages
@@ -54,9 +72,7 @@ func handleSteeringMessage(client MQTT.Client, message MQTT.Message) {
 
 	// Special case for state measurement - rename to autopilotState for reposting
 	if SharedSubscriptionConfig.Repost && !steer.IsEmpty() && originalMeasurement == "state" {
-		PublishClientMessage(client,
-			SharedSubscriptionConfig.RepostRootTopic+"vessel/steering/"+steer.Source+"/autopilotState",
-			steer.ToJSON(), true)
+		repostSensorData(client, "autopilotState", steer)
 	}
 }
 
@@ -68,46 +84,14 @@ func processSteeringData(rawData map[string]any, measurement string, data Sensor
 		return
 	}
 
-	var err error
-	var floatTmp float64
-	var strtmp string
-
-	switch measurement {
-	case "rudderAngle":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			steer.RudderAngle = RadiansToDegrees(floatTmp)
-		}
-	case "autopilot":
-		// Just a container topic, no data to process
-		break
-	case "state":
-		strtmp, err = ParseString(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing string: %v", err.Error())
-		} else {
-			steer.AutopilotState = strtmp
-		}
-	case "target":
-		// Just a container topic, no data to process
-		break
-	case "headingMagnetic":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			steer.TargetHeadingMag = RadiansToDegrees(floatTmp)
-		}
-	default:
+	if !applyPathMappings(rawData, measurement, steer) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *Steering) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -118,13 +102,16 @@ func (meas *Steering) ToJSON() string {
 func (meas *Steering) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Steering: %v", json)
-	if SharedSubscriptionConfig.SteerLogEn {
+	if SharedSubscriptionConfig.Categories["steering"].Verbose {
 		log.Info().Msgf("Steering: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *Steering) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.RudderAngle == 0.0 && meas.AutopilotState == "" && meas.TargetHeadingMag == 0.0 {
 		return true
 	}
@@ -134,13 +121,13 @@ func (meas *Steering) IsEmpty() bool {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *Steering) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.RudderAngle != 0.0 {
+	if meas.RudderAngle != 0.0 || meas.IsPresent("RudderAngle") {
 		measTmp["RudderAngle"] = meas.RudderAngle
 	}
 	if meas.AutopilotState != "" {
 		measTmp["AutopilotState"] = meas.AutopilotState
 	}
-	if meas.TargetHeadingMag != 0.0 {
+	if meas.TargetHeadingMag != 0.0 || meas.IsPresent("TargetHeadingMag") {
 		measTmp["TargetHeading"] = meas.TargetHeadingMag
 	}
 	return measTmp
@@ -153,7 +140,12 @@ func (meas *Steering) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *Steering) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.SteerLogEn
+	return SharedSubscriptionConfig.Categories["steering"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Steering) GetCategory() string {
+	return "steering"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
@@ -68,7 +68,7 @@ func TestSteeringStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.SteerLogEn, steering.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["steering"].Verbose, steering.GetLogEnabled())
 
 	// Test ToInfluxPoint
 	point := steering.ToInfluxPoint()
@@ -22,6 +22,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -38,7 +39,11 @@ func HandleSubscriptions(subscribeconf SubscriptionConfig) {
 	SharedSubscriptionConfig = &subscribeconf
 	var influxClient influxdb2.Client
 	if SharedSubscriptionConfig.InfluxEnabled {
-		// Create HTTP client - for the future to allow TLS override
+		// Create HTTP client with the CA and client certificate for InfluxDB
+		influxTLSConfig := newTLSConfig(SharedSubscriptionConfig.InfluxCACert, SharedSubscriptionConfig.InfluxTLS)
+		if influxTLSConfig == nil {
+			influxTLSConfig = &tls.Config{}
+		}
 		influxHttpClient := &http.Client{
 			Timeout: time.Second * time.Duration(60),
 			Transport: &http.Transport{
@@ -46,9 +51,7 @@ func HandleSubscriptions(subscribeconf SubscriptionConfig) {
 					Timeout: 5 * time.Second,
 				}).DialContext,
 				TLSHandshakeTimeout: 5 * time.Second,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: false,
-				},
+				TLSClientConfig:     influxTLSConfig,
 				MaxIdleConns:        100,
 				MaxIdleConnsPerHost: 100,
 				IdleConnTimeout:     90 * time.Second,
@@ -56,133 +59,210 @@ func HandleSubscriptions(subscribeconf SubscriptionConfig) {
 		}
 		log.Info().Msgf("InfluxDB is enabled. URL: %v Org: %v Bucket:%v", SharedSubscriptionConfig.InfluxUrl,
 			SharedSubscriptionConfig.InfluxOrg, SharedSubscriptionConfig.InfluxBucket)
-		influxClient = influxdb2.NewClientWithOptions(SharedSubscriptionConfig.InfluxUrl, SharedSubscriptionConfig.InfluxToken, influxdb2.DefaultOptions().SetHTTPClient(influxHttpClient))
+		influxClient = influxdb2.NewClientWithOptions(SharedSubscriptionConfig.InfluxUrl, SharedSubscriptionConfig.InfluxToken.Value(), influxdb2.DefaultOptions().SetHTTPClient(influxHttpClient))
 		SharedInfluxWriteAPI = influxClient.WriteAPIBlocking(SharedSubscriptionConfig.InfluxOrg, SharedSubscriptionConfig.InfluxBucket)
 	}
-	log.Info().Msgf("Will subscribe on server %v", SharedSubscriptionConfig.Host)
-	mqttOpts := MQTT.NewClientOptions()
-	mqttOpts.AddBroker(SharedSubscriptionConfig.Host)
-	if SharedSubscriptionConfig.Username != "" {
-		mqttOpts.SetUsername(SharedSubscriptionConfig.Username)
-		log.Debug().Msgf("Using Username: %v", SharedSubscriptionConfig.Username)
+	if SharedSubscriptionConfig.Filter.Enabled {
+		log.Info().Msgf("Outlier filtering is enabled with %v rules", len(SharedSubscriptionConfig.Filter.Rules))
+		SharedSensorFilter = NewSensorFilter(SharedSubscriptionConfig.Filter)
+		SharedSensorFilter.RegisterAPI(SharedAPIMux)
 	}
-	if SharedSubscriptionConfig.Password != "" {
-		mqttOpts.SetPassword(SharedSubscriptionConfig.Password)
-		log.Trace().Msgf("Using Password: %v", SharedSubscriptionConfig.Password)
+	if SharedSubscriptionConfig.InfluxEnabled && len(SharedSubscriptionConfig.Aggregation.Policies) > 0 {
+		log.Info().Msgf("Aggregation is enabled for %v measurements", len(SharedSubscriptionConfig.Aggregation.Policies))
+		SharedAggregator = NewAggregator(SharedSubscriptionConfig.Aggregation)
+		go SharedAggregator.Run()
 	}
-	if len(SharedSubscriptionConfig.CACert) > 0 {
-		log.Debug().Msg("Constructing x509 Cert Pool")
-		rootCAs, err := x509.SystemCertPool()
-		if err != nil || rootCAs == nil {
-			log.Warn().Msg("Unable to get system cert pool")
-			rootCAs = x509.NewCertPool()
-		}
-		if ok := rootCAs.AppendCertsFromPEM(SharedSubscriptionConfig.CACert); !ok {
-			log.Warn().Msg("No certs appended, using system certs only")
-		}
-
-		tlsConfig := &tls.Config{
-			RootCAs: rootCAs,
+	if len(SharedSubscriptionConfig.Deadband.Policies) > 0 {
+		log.Info().Msgf("Deadband reporting is enabled for %v measurements", len(SharedSubscriptionConfig.Deadband.Policies))
+		SharedDeadband = NewDeadband(SharedSubscriptionConfig.Deadband)
+	}
+	if len(SharedSubscriptionConfig.Sources.Priority) > 0 {
+		log.Info().Msgf("Source arbitration is enabled with %v rules", len(SharedSubscriptionConfig.Sources.Priority))
+		SharedSourceArbiter = NewSourceArbiter(SharedSubscriptionConfig.Sources)
+		SharedSourceArbiter.RegisterAPI(SharedAPIMux)
+	}
+	if SharedSubscriptionConfig.Passage.Enabled {
+		log.Info().Msgf("Passage detection is enabled. Data Dir: %v", SharedSubscriptionConfig.DataDir)
+		SharedPassageTracker = NewPassageTracker(SharedSubscriptionConfig.Passage, SharedSubscriptionConfig.DataDir)
+	}
+	if SharedSubscriptionConfig.Fuel.Enabled {
+		log.Info().Msg("Fuel tracking is enabled")
+		SharedFuelTracker = NewFuelTracker(SharedSubscriptionConfig.Fuel, SharedSubscriptionConfig.DataDir)
+	}
+	if SharedSubscriptionConfig.Engine.Enabled {
+		log.Info().Msg("Engine run detection is enabled")
+		SharedEngineMonitor = NewEngineMonitor(SharedSubscriptionConfig.Engine)
+		go SharedEngineMonitor.Run()
+	}
+	if SharedSubscriptionConfig.Maintenance.Enabled {
+		log.Info().Msg("Maintenance scheduling is enabled")
+		SharedMaintenanceScheduler = NewMaintenanceScheduler(SharedSubscriptionConfig.Maintenance, SharedSubscriptionConfig.DataDir)
+		SharedMaintenanceScheduler.RegisterAPI(SharedAPIMux)
+	}
+	if SharedSubscriptionConfig.Anchor.Enabled {
+		log.Info().Msg("Anchor watch is enabled")
+		SharedAnchorWatch = NewAnchorWatch(SharedSubscriptionConfig.Anchor, SharedSubscriptionConfig.DataDir)
+		SharedAnchorWatch.RegisterAPI(SharedAPIMux)
+	}
+	if SharedSubscriptionConfig.Geofence.Enabled {
+		log.Info().Msgf("Geofencing is enabled with %v zones", len(SharedSubscriptionConfig.Geofence.Zones))
+		SharedGeofence = NewGeofence(SharedSubscriptionConfig.Geofence, SharedSubscriptionConfig.DataDir)
+	}
+	if brokerTopicsSubscribed("ais") {
+		log.Info().Msg("AIS target tracking is enabled")
+		SharedAISTracker = NewAISTracker(SharedSubscriptionConfig.AIS)
+		SharedAISTracker.RegisterAPI(SharedAPIMux)
+		go SharedAISTracker.Run()
+	}
+	if SharedSubscriptionConfig.Barometer.Enabled {
+		log.Info().Msg("Barometer tendency is enabled")
+		SharedBarometer = NewBarometer(SharedSubscriptionConfig.Barometer, SharedSubscriptionConfig.DataDir)
+		SharedBarometer.RegisterAPI(SharedAPIMux)
+	}
+	if SharedSubscriptionConfig.Comfort.Enabled {
+		log.Info().Msg("Cabin comfort monitoring is enabled")
+		SharedComfortMonitor = NewComfortMonitor(SharedSubscriptionConfig.Comfort)
+	}
+	if SharedSubscriptionConfig.Refrigeration.Enabled {
+		log.Info().Msgf("Refrigeration analysis is enabled for %v units", len(SharedSubscriptionConfig.Refrigeration.Units))
+		SharedRefrigerationMonitor = NewRefrigerationMonitor(SharedSubscriptionConfig.Refrigeration)
+		SharedRefrigerationMonitor.RegisterAPI(SharedAPIMux)
+	}
+	if SharedSubscriptionConfig.DaemonStatus.Enabled {
+		log.Info().Msg("Daemon status is enabled")
+		SharedDaemonStatus = NewDaemonStatus(SharedSubscriptionConfig.DaemonStatus, SharedSubscriptionConfig.RepostRootTopic, DaemonVersion)
+		SharedDaemonStatus.SetWill(SharedSubscriptionConfig.Brokers, SharedSubscriptionConfig.RepostBroker)
+		SharedDaemonStatus.RegisterAPI(SharedAPIMux)
+	}
+	if SharedSubscriptionConfig.API.Listen != "" {
+		StartAPIServer(SharedSubscriptionConfig.API)
+	}
+	SharedBrokerSet = NewBrokerSet(SharedSubscriptionConfig.Brokers, SharedSubscriptionConfig.RepostBroker)
+	SharedBrokerSet.RegisterAPI(SharedAPIMux)
+	SharedBrokerSet.Connect()
+	if SharedSubscriptionConfig.Repost {
+		reposter, err := NewReposter(SharedSubscriptionConfig.RepostTargets)
+		if err != nil {
+			log.Error().Msgf("Error setting up repost destinations: %v", err.Error())
+		} else {
+			SharedReposter = reposter
+			SharedReposter.Connect()
 		}
-		mqttOpts.SetTLSConfig(tlsConfig)
-		log.Debug().Msg("Configured TLS")
 	}
-	mqttOpts.SetAutoReconnect(true)
-	mqttOpts.SetConnectRetry(true)
-	mqttOpts.SetConnectionAttemptHandler(onConnectionAttempt)
-	mqttOpts.SetConnectionLostHandler(onConnectionLost)
-	mqttOpts.SetOnConnectHandler(onConnect)
-	mqttOpts.SetReconnectingHandler(onReconnect)
-	mqttClient := MQTT.NewClient(mqttOpts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		log.Warn().Msgf("Error Connecting to host: %v", token.Error())
-		return
+	mqttClient := SharedBrokerSet.RepostClient()
+	if SharedMaintenanceScheduler != nil {
+		go SharedMaintenanceScheduler.Run(mqttClient)
+	}
+	if SharedSensorFilter != nil {
+		go SharedSensorFilter.Run(mqttClient)
+	}
+	if SharedDaemonStatus != nil {
+		go SharedDaemonStatus.Run(mqttClient)
 	}
 	if SharedSubscriptionConfig.InfluxEnabled {
 		defer influxClient.Close()
 	}
 }
 
-func addSubscription(topic string, target MQTT.MessageHandler, mqttClient MQTT.Client) {
-	log.Info().Msgf("Subscribing to topic: %v", topic)
-	if token := mqttClient.Subscribe(topic, byte(0), target); token.Wait() && token.Error() != nil {
-		log.Warn().Msgf("Error subscribing to topic %v with error %v", topic, token.Error())
+// StopSubscriptions writes anything still held in memory before the daemon exits
+func StopSubscriptions() {
+	if SharedAggregator != nil {
+		log.Info().Msgf("Writing %v open aggregation windows", SharedAggregator.Pending())
+		SharedAggregator.FlushAll()
 	}
 }
 
-func onConnectionAttempt(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
-	log.Info().Msgf("Attempting connection to: %v", broker.String())
-	return tlsCfg
-}
-
-func onConnectionLost(client MQTT.Client, err error) {
-	log.Warn().Msgf("Connection Lost! %v", err.Error())
-}
-
-// This function gets called when a connection is successful
-// In the event of a reconnect scenario we can resubscribe to topics here
-func onConnect(client MQTT.Client) {
-	log.Info().Msg("Connected!")
-	subscribeToTopics(client)
-}
-
-func onReconnect(client MQTT.Client, opts *MQTT.ClientOptions) {
-	log.Warn().Msg("Attempting to reconnect")
-}
-
-func subscribeToTopics(mqttClient MQTT.Client) {
-	if SharedSubscriptionConfig.InfluxEnabled {
-		log.Info().Msgf("InfluxDB is enabled. URL: %v Org: %v Bucket:%v", SharedSubscriptionConfig.InfluxUrl,
-			SharedSubscriptionConfig.InfluxOrg, SharedSubscriptionConfig.InfluxBucket)
+// NewSubscriptionClientOptions builds the broker, credential and TLS options for a subscription broker
+func NewSubscriptionClientOptions(conf BrokerConfig) *MQTT.ClientOptions {
+	mqttOpts := MQTT.NewClientOptions()
+	mqttOpts.AddBroker(conf.Host)
+	if conf.ClientID != "" {
+		mqttOpts.SetClientID(conf.ClientID)
+		log.Debug().Msgf("Using Client ID: %v", conf.ClientID)
 	}
-	if SharedSubscriptionConfig.BLESubEn {
-		for _, topic := range SharedSubscriptionConfig.BLETopics {
-			addSubscription(topic, OnBLETemperatureMessage, mqttClient)
+	if !conf.CleanSession {
+		mqttOpts.SetCleanSession(false)
+		mqttOpts.SetResumeSubs(true)
+		if conf.StoreDir != "" {
+			// The paho file store panics when it cannot create its directory so it is made here first
+			err := os.MkdirAll(conf.StoreDir, 0750)
+			if err != nil {
+				log.Warn().Msgf("Error creating message store %v will keep messages in memory: %v", conf.StoreDir, err.Error())
+			} else {
+				mqttOpts.SetStore(MQTT.NewFileStore(conf.StoreDir))
+				log.Debug().Msgf("Using message store %v", conf.StoreDir)
+			}
 		}
 	}
-	if SharedSubscriptionConfig.PHYSubEn {
-		for _, topic := range SharedSubscriptionConfig.PHYTopics {
-			addSubscription(topic, OnPHYTemperatureMessage, mqttClient)
-		}
+	if conf.Username != "" {
+		mqttOpts.SetUsername(conf.Username)
+		log.Debug().Msgf("Using Username: %v", conf.Username)
 	}
-	if SharedSubscriptionConfig.ESPSubEn {
-		for _, topic := range SharedSubscriptionConfig.ESPTopics {
-			addSubscription(topic, OnESPStatusMessage, mqttClient)
-		}
+	if conf.Password != "" {
+		mqttOpts.SetPassword(conf.Password.Value())
+		log.Debug().Msg("Using Password")
 	}
-	if SharedSubscriptionConfig.NavSubEn {
-		for _, topic := range SharedSubscriptionConfig.NavTopics {
-			addSubscription(topic, OnNavigationMessage, mqttClient)
-		}
+	if tlsConfig := brokerTLSConfig(conf); tlsConfig != nil {
+		mqttOpts.SetTLSConfig(tlsConfig)
+		log.Debug().Msg("Configured TLS")
 	}
-	if SharedSubscriptionConfig.GNSSSubEn {
-		for _, topic := range SharedSubscriptionConfig.GNSSTopics {
-			addSubscription(topic, OnGNSSMessage, mqttClient)
-		}
+	if conf.WillTopic != "" {
+		mqttOpts.SetWill(conf.WillTopic, conf.WillPayload, byte(1), true)
+		log.Debug().Msgf("Using Last Will on topic: %v", conf.WillTopic)
 	}
-	if SharedSubscriptionConfig.SteerSubEn {
-		for _, topic := range SharedSubscriptionConfig.SteeringTopics {
-			addSubscription(topic, OnSteeringMessage, mqttClient)
-		}
+	if conf.ProtocolVersion == 3 || conf.ProtocolVersion == 4 {
+		mqttOpts.SetProtocolVersion(conf.ProtocolVersion)
 	}
-	if SharedSubscriptionConfig.WindSubEn {
-		for _, topic := range SharedSubscriptionConfig.WindTopics {
-			addSubscription(topic, OnWindMessage, mqttClient)
-		}
+	return mqttOpts
+}
+
+// brokerTLSConfig builds the TLS config for a broker or returns nil when it has no TLS settings
+func brokerTLSConfig(conf BrokerConfig) *tls.Config {
+	return newTLSConfig(conf.CACert, conf.TLS)
+}
+
+// newTLSConfig trusts the CA on top of the system certs and applies the TLS options
+// The client certificate is the one loaded with the config, so one that cannot be loaded never gets here
+// It returns nil when nothing is configured so the client defaults apply
+func newTLSConfig(caCert []byte, opts TLSOptions) *tls.Config {
+	if len(caCert) == 0 && opts == (TLSOptions{}) {
+		return nil
 	}
-	if SharedSubscriptionConfig.WaterSubEn {
-		for _, topic := range SharedSubscriptionConfig.WaterTopics {
-			addSubscription(topic, OnWaterMessage, mqttClient)
-		}
+	tlsConfig := &tls.Config{
+		ServerName:         opts.ServerName,
+		MinVersion:         opts.MinVersion,
+		InsecureSkipVerify: opts.Insecure,
 	}
-	if SharedSubscriptionConfig.OutsideSubEn {
-		for _, topic := range SharedSubscriptionConfig.OutsideTopics {
-			addSubscription(topic, OnOutsideMessage, mqttClient)
+	if len(caCert) > 0 {
+		log.Debug().Msg("Constructing x509 Cert Pool")
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			log.Warn().Msg("Unable to get system cert pool")
+			rootCAs = x509.NewCertPool()
 		}
-	}
-	if SharedSubscriptionConfig.PropSubEn {
-		for _, topic := range SharedSubscriptionConfig.PropulsionTopics {
-			addSubscription(topic, OnPropulsionMessage, mqttClient)
+		if ok := rootCAs.AppendCertsFromPEM(caCert); !ok {
+			log.Warn().Msg("No certs appended, using system certs only")
 		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if opts.certificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*opts.certificate}
+	}
+	return tlsConfig
+}
+
+func addSubscription(topic string, qos byte, target MQTT.MessageHandler, mqttClient MQTT.Client) {
+	log.Info().Msgf("Subscribing to topic: %v with QoS %v", topic, qos)
+	if token := mqttClient.Subscribe(topic, qos, target); token.Wait() && token.Error() != nil {
+		log.Warn().Msgf("Error subscribing to topic %v with error %v", topic, token.Error())
 	}
 }
+
+func onConnectionAttempt(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+	log.Info().Msgf("Attempting connection to: %v", broker.String())
+	return tlsCfg
+}
+
+func onReconnect(client MQTT.Client, opts *MQTT.ClientOptions) {
+	log.Warn().Msg("Attempting to reconnect")
+}
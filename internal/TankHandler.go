@@ -0,0 +1,187 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"strings"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/rs/zerolog/log"
+)
+
+// Tank represents tank level sensor data
+type Tank struct {
+	BaseSensorData
+	Type        string  `json:"Type,omitempty"`
+	Device      string  `json:"Device,omitempty"`
+	LevelPct    float64 `json:"LevelPct,omitempty"`
+	CapacityGal float64 `json:"CapacityGal,omitempty"`
+	VolumeGal   float64 `json:"VolumeGal,omitempty"`
+}
+
+// tankPathMappings are the SignalK paths the tank handler parses
+var tankPathMappings = []PathMapping{
+	{Path: "tanks.*.*.currentLevel", Measurement: "tanks", Field: "LevelPct", Conversion: "ratio-to-percent"},
+	{Path: "tanks.*.*.capacity", Measurement: "tanks", Field: "CapacityGal", Conversion: "m3-to-gallons"},
+	{Path: "tanks.*.*.currentVolume", Measurement: "tanks", Field: "VolumeGal", Conversion: "m3-to-gallons"},
+	{Path: "tanks.*.*.name", Measurement: "tanks"},
+	{Path: "tanks.*.*.type", Measurement: "tanks"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "tank",
+		TopicsKey:   "tankTopics",
+		Handler:     OnTankMessage,
+		NewData:     func() SensorData { return &Tank{} },
+		Mappings:    tankPathMappings,
+		UpdateState: updateTankState,
+	})
+}
+
+func updateTankState(client MQTT.Client, measurement string, data SensorData) {
+	if SharedFuelTracker != nil {
+		SharedFuelTracker.UpdateTank(data.(*Tank))
+	}
+}
+
+// OnTankMessage is called when a tank message is received
+func OnTankMessage(client MQTT.Client, message MQTT.Message) {
+	dispatchMessage(handleTankMessage, client, message)
+}
+
+// handleTankMessage processes tank messages
+func handleTankMessage(client MQTT.Client, message MQTT.Message) {
+	tank := &Tank{}
+	tank.Type, tank.Device = tankFromTopic(message.Topic())
+	HandleSensorMessage(client, message, tank, processTankData)
+}
+
+// tankFromTopic pulls the tank type and instance out of a topic like .../tanks/fuel/0/currentLevel
+func tankFromTopic(topic string) (string, string) {
+	idx := strings.LastIndex(topic, "/tanks/")
+	if idx < 0 {
+		return "", ""
+	}
+	parts := strings.Split(topic[idx+len("/tanks/"):], "/")
+	if len(parts) < 3 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+// processTankData processes specific tank data fields
+func processTankData(rawData map[string]any, measurement string, data SensorData) {
+	tank, ok := data.(*Tank)
+	if !ok {
+		log.Error().Msg("Failed to cast data to Tank type")
+		return
+	}
+
+	if !applyPathMappings(rawData, measurement, tank) {
+		log.Warn().Msgf("Unknown measurement %v", measurement)
+	}
+}
+
+// ToJSON serializes the data to JSON
+func (meas *Tank) ToJSON() string {
+	jsonData, err := MarshalSensorJSON(meas)
+	if err != nil {
+		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
+	}
+	return string(jsonData)
+}
+
+// LogJSON logs the JSON representation of the data
+func (meas *Tank) LogJSON() {
+	json := meas.ToJSON()
+	log.Trace().Msgf("Tank: %v", json)
+	if SharedSubscriptionConfig.Categories["tank"].Verbose {
+		log.Info().Msgf("Tank: %v", json)
+	}
+}
+
+// IsEmpty checks if the data has any meaningful values
+func (meas *Tank) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
+	if meas.LevelPct == 0.0 && meas.CapacityGal == 0.0 && meas.VolumeGal == 0.0 {
+		return true
+	}
+	return false
+}
+
+// GetInfluxTags returns tags for InfluxDB
+func (meas *Tank) GetInfluxTags() map[string]string {
+	tagTmp := make(map[string]string)
+	if meas.Source != "" {
+		tagTmp["Source"] = meas.Source
+	}
+	if meas.Type != "" {
+		tagTmp["Type"] = meas.Type
+	}
+	if meas.Device != "" {
+		tagTmp["Device"] = meas.Device
+	}
+	return tagTmp
+}
+
+// GetInfluxFields returns fields for InfluxDB
+func (meas *Tank) GetInfluxFields() map[string]interface{} {
+	measTmp := make(map[string]interface{})
+	if meas.LevelPct != 0.0 || meas.IsPresent("LevelPct") {
+		measTmp["LevelPct"] = meas.LevelPct
+	}
+	if meas.CapacityGal != 0.0 || meas.IsPresent("CapacityGal") {
+		measTmp["CapacityGal"] = meas.CapacityGal
+	}
+	if meas.VolumeGal != 0.0 || meas.IsPresent("VolumeGal") {
+		measTmp["VolumeGal"] = meas.VolumeGal
+	}
+	return measTmp
+}
+
+// ToInfluxPoint creates an InfluxDB point
+func (meas *Tank) ToInfluxPoint() *write.Point {
+	return influxdb2.NewPoint("tanks", meas.GetInfluxTags(), meas.GetInfluxFields(), meas.Timestamp)
+}
+
+// GetLogEnabled returns whether logging is enabled for this data type
+func (meas *Tank) GetLogEnabled() bool {
+	return SharedSubscriptionConfig.Categories["tank"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Tank) GetCategory() string {
+	return "tank"
+}
+
+// GetMeasurementName returns the measurement name for InfluxDB
+func (meas *Tank) GetMeasurementName() string {
+	return "tanks"
+}
+
+// GetTopicPrefix returns the topic prefix for MQTT publishing
+func (meas *Tank) GetTopicPrefix() string {
+	if meas.Type == "" {
+		return "tanks"
+	}
+	return "tanks/" + meas.Type + "/" + meas.Device
+}
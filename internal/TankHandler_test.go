@@ -0,0 +1,169 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTankStruct(t *testing.T) {
+	now := time.Now()
+	tank := Tank{
+		BaseSensorData: BaseSensorData{
+			Source:    "test-source",
+			Timestamp: now,
+		},
+		Type:        "fuel",
+		Device:      "0",
+		LevelPct:    75.0,
+		CapacityGal: 150.0,
+		VolumeGal:   112.5,
+	}
+
+	// Test ToJSON
+	jsonData := tank.ToJSON()
+	var parsedTank Tank
+	err := json.Unmarshal([]byte(jsonData), &parsedTank)
+	assert.NoError(t, err)
+	assert.Equal(t, tank.Type, parsedTank.Type)
+	assert.Equal(t, tank.Device, parsedTank.Device)
+	assert.Equal(t, tank.LevelPct, parsedTank.LevelPct)
+	assert.Equal(t, tank.CapacityGal, parsedTank.CapacityGal)
+	assert.Equal(t, tank.VolumeGal, parsedTank.VolumeGal)
+
+	// Test IsEmpty
+	assert.False(t, tank.IsEmpty())
+	emptyTank := Tank{Type: "fuel", Device: "0"}
+	assert.True(t, emptyTank.IsEmpty())
+
+	// Test GetInfluxTags
+	tags := tank.GetInfluxTags()
+	assert.Equal(t, "test-source", tags["Source"])
+	assert.Equal(t, "fuel", tags["Type"])
+	assert.Equal(t, "0", tags["Device"])
+
+	// Test GetInfluxFields
+	fields := tank.GetInfluxFields()
+	assert.Equal(t, tank.LevelPct, fields["LevelPct"])
+	assert.Equal(t, tank.CapacityGal, fields["CapacityGal"])
+	assert.Equal(t, tank.VolumeGal, fields["VolumeGal"])
+
+	assert.Equal(t, "tanks", tank.GetMeasurementName())
+	assert.Equal(t, "tanks/fuel/0", tank.GetTopicPrefix())
+	assert.Equal(t, "tanks", (&Tank{}).GetTopicPrefix())
+
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+	assert.Equal(t, SharedSubscriptionConfig.Categories["tank"].Verbose, tank.GetLogEnabled())
+	assert.NotNil(t, tank.ToInfluxPoint())
+}
+
+func TestTankFromTopic(t *testing.T) {
+	tests := []struct {
+		name           string
+		topic          string
+		expectedType   string
+		expectedDevice string
+	}{
+		{"fuel", "vessels/self/tanks/fuel/0/currentLevel", "fuel", "0"},
+		{"fresh_water", "vessels/self/tanks/freshWater/1/capacity", "freshWater", "1"},
+		{"too_short", "vessels/self/tanks/fuel", "", ""},
+		{"not_a_tank", "vessels/self/environment/wind/speedApparent", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tankType, device := tankFromTopic(tt.topic)
+			assert.Equal(t, tt.expectedType, tankType)
+			assert.Equal(t, tt.expectedDevice, device)
+		})
+	}
+}
+
+func TestProcessTankData(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	tests := []struct {
+		name        string
+		measurement string
+		rawData     map[string]any
+		expected    *Tank
+	}{
+		{
+			name:        "currentLevel measurement",
+			measurement: "currentLevel",
+			rawData:     map[string]any{"value": 0.5},
+			expected:    &Tank{LevelPct: 50.0},
+		},
+		{
+			name:        "capacity measurement",
+			measurement: "capacity",
+			rawData:     map[string]any{"value": 0.5},
+			expected:    &Tank{CapacityGal: 132.086028},
+		},
+		{
+			name:        "currentVolume measurement",
+			measurement: "currentVolume",
+			rawData:     map[string]any{"value": 0.25},
+			expected:    &Tank{VolumeGal: 66.043014},
+		},
+		{
+			name:        "invalid value",
+			measurement: "currentLevel",
+			rawData:     map[string]any{"value": "invalid"},
+			expected:    &Tank{},
+		},
+		{
+			name:        "unknown measurement",
+			measurement: "unknown",
+			rawData:     map[string]any{"value": 1.0},
+			expected:    &Tank{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tank := &Tank{}
+			processTankData(tt.rawData, tt.measurement, tank)
+			assert.InDelta(t, tt.expected.LevelPct, tank.LevelPct, 0.0001)
+			assert.InDelta(t, tt.expected.CapacityGal, tank.CapacityGal, 0.0001)
+			assert.InDelta(t, tt.expected.VolumeGal, tank.VolumeGal, 0.0001)
+		})
+	}
+}
+
+func TestHandleTankMessage(t *testing.T) {
+	cleanup := SetupTestEnvironment()
+	defer cleanup()
+
+	client := &MockMQTTClient{}
+	levelData := map[string]any{
+		"$source":   "test-source",
+		"timestamp": "2025-01-01T12:00:00.000Z",
+		"value":     0.75,
+	}
+	levelPayload, _ := json.Marshal(levelData)
+	handleTankMessage(client, NewMockMessage("vessels/test/tanks/fuel/0/currentLevel", levelPayload))
+
+	invalidMessage := NewMockMessage("vessels/test/tanks/fuel/0/currentLevel", []byte("invalid json"))
+	handleTankMessage(client, invalidMessage)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import "strings"
+
+// FieldUnits are the units of the fields the built-in handlers write, keyed by field name
+// Keys of measurement.Field take precedence for fields whose unit depends on the measurement
+var FieldUnits = map[string]string{
+	"TempF":                  "degF",
+	"DewPointF":              "degF",
+	"HeatIndexF":             "degF",
+	"OilTempF":               "degF",
+	"CoolantTempF":           "degF",
+	"TransOilTempF":          "degF",
+	"water.TempF":            "degC",
+	"BatteryPct":             "%",
+	"BatteryPercent":         "%",
+	"Humidity":               "%",
+	"AbsHumidity":            "g/m3",
+	"RSSI":                   "dBm",
+	"WiFiRSSI":               "dBm",
+	"FreeSRAM":               "bytes",
+	"FreeHeap":               "bytes",
+	"FreePSRAM":              "bytes",
+	"latitude":               "deg",
+	"longitude":              "deg",
+	"Lat":                    "deg",
+	"Lon":                    "deg",
+	"Alt":                    "ft",
+	"SOG":                    "kn",
+	"STW":                    "kn",
+	"SpeedApp":               "kn",
+	"ROT":                    "deg/s",
+	"COGTrue":                "deg",
+	"HeadingMag":             "deg",
+	"HeadingTrue":            "deg",
+	"MagVariation":           "deg",
+	"MagDeviation":           "deg",
+	"Yaw":                    "deg",
+	"Pitch":                  "deg",
+	"Roll":                   "deg",
+	"AngleApp":               "deg",
+	"DirectionTrue":          "deg",
+	"RudderAngle":            "deg",
+	"TargetHeadingMag":       "deg",
+	"AntennaAlt":             "m",
+	"GeoidalSep":             "m",
+	"DepthUnderTransducerFt": "ft",
+	"Pressure":               "hPa",
+	"PressureInHg":           "inHg",
+	"PressureChange1h":       "hPa",
+	"PressureChange3h":       "hPa",
+	"RPM":                    "rpm",
+	"BoostPSI":               "psi",
+	"OilPressure":            "psi",
+	"TransOilPressure":       "psi",
+	"RunTime":                "s",
+	"EngineLoad":             "%",
+	"EngineTorque":           "%",
+	"AltVoltage":             "V",
+	"FuelRate":               "gal/h",
+	"LevelPct":               "%",
+	"CapacityGal":            "gal",
+	"VolumeGal":              "gal",
+	"CPANM":                  "nmi",
+	"TCPAMinutes":            "min",
+}
+
+// fieldUnits returns the units of the fields being written for a measurement
+func fieldUnits(measurementName string, fields map[string]interface{}) map[string]string {
+	units := make(map[string]string)
+	for field := range fields {
+		if unit, ok := fieldUnit(measurementName, field); ok {
+			units[field] = unit
+		}
+	}
+	return units
+}
+
+func fieldUnit(measurementName string, field string) (string, bool) {
+	for key, unit := range FieldUnits {
+		if prefix, name, ok := strings.Cut(key, "."); ok && name == field && strings.EqualFold(prefix, measurementName) {
+			return unit, true
+		}
+	}
+	unit, ok := FieldUnits[field]
+	return unit, ok
+}
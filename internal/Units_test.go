@@ -0,0 +1,40 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldUnits(t *testing.T) {
+	unit, ok := fieldUnit("outside", "TempF")
+	assert.True(t, ok)
+	assert.Equal(t, "degF", unit)
+
+	// Water temperature is converted to Celsius
+	unit, ok = fieldUnit("water", "TempF")
+	assert.True(t, ok)
+	assert.Equal(t, "degC", unit)
+
+	_, ok = fieldUnit("espStatus", "MSHVersion")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]string{"latitude": "deg", "longitude": "deg", "SOG": "kn"},
+		fieldUnits("navigation", map[string]interface{}{"latitude": 1.0, "longitude": 2.0, "SOG": 3.0, "Unknown": 4.0}))
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// VesselSnapshot is a point in time copy of the latest known vessel values
+// SignalK sends every path as its own message so this is where they get stitched back together
+type VesselSnapshot struct {
+	Lat               float64
+	Lon               float64
+	PositionTime      time.Time
+	SOG               float64
+	SOGTime           time.Time
+	COGTrue           float64
+	COGTime           time.Time
+	WindSpeedApp      float64
+	WindAngleApp      float64
+	WindDirectionTrue float64
+	WindTime          time.Time
+	HozDilution       float64
+	HDOPTime          time.Time
+	Satellites        int64
+	SatellitesTime    time.Time
+	OutsideTempF      float64
+	OutsideTempTime   time.Time
+	WaterTempF        float64
+	WaterTempTime     time.Time
+}
+
+// VesselState tracks the latest values needed by the derived data features
+type VesselState struct {
+	mu    sync.RWMutex
+	state VesselSnapshot
+}
+
+var SharedVesselState = &VesselState{}
+
+// Snapshot returns a copy of the current vessel state
+func (s *VesselState) Snapshot() VesselSnapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// UpdateNavigation records the navigation values carried by a single SignalK measurement
+func (s *VesselState) UpdateNavigation(nav *Navigation, measurement string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch measurement {
+	case "position":
+		if nav.Lat == 0.0 && nav.Lon == 0.0 {
+			return
+		}
+		s.state.Lat = nav.Lat
+		s.state.Lon = nav.Lon
+		s.state.PositionTime = nav.Timestamp
+	case "speedOverGround":
+		s.state.SOG = nav.SOG
+		s.state.SOGTime = nav.Timestamp
+	case "courseOverGroundTrue":
+		s.state.COGTrue = nav.COGTrue
+		s.state.COGTime = nav.Timestamp
+	}
+}
+
+// UpdateWind records the wind values carried by a single SignalK measurement
+func (s *VesselState) UpdateWind(wind *Wind, measurement string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch measurement {
+	case "speedApparent":
+		s.state.WindSpeedApp = wind.SpeedApp
+	case "angleApparent":
+		s.state.WindAngleApp = wind.AngleApp
+	case "directionTrue":
+		s.state.WindDirectionTrue = wind.DirectionTrue
+	default:
+		return
+	}
+	s.state.WindTime = wind.Timestamp
+}
+
+// UpdateGNSS records the fix quality values carried by a single SignalK measurement
+func (s *VesselState) UpdateGNSS(gnss *GNSS, measurement string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch measurement {
+	case "horizontalDilution":
+		s.state.HozDilution = gnss.HozDilution
+		s.state.HDOPTime = gnss.Timestamp
+	case "satellites":
+		s.state.Satellites = gnss.Satellites
+		s.state.SatellitesTime = gnss.Timestamp
+	}
+}
+
+// UpdateTemperature records the outside air or water temperature
+func (s *VesselState) UpdateTemperature(data SensorData, measurement string) {
+	if measurement != "temperature" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch meas := data.(type) {
+	case *Outside:
+		s.state.OutsideTempF = meas.TempF
+		s.state.OutsideTempTime = meas.Timestamp
+	case *Water:
+		s.state.WaterTempF = meas.TempF
+		s.state.WaterTempTime = meas.Timestamp
+	}
+}
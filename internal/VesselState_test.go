@@ -0,0 +1,75 @@
+/*
+Copyright © 2025 Don P. McGarry
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program. If not, see <http://www.gnu.org/licenses/>.
+*/
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVesselStateUpdateNavigation(t *testing.T) {
+	state := &VesselState{}
+	now := time.Now()
+
+	nav := &Navigation{BaseSensorData: BaseSensorData{Timestamp: now}, Lat: 37.8, Lon: -122.4}
+	state.UpdateNavigation(nav, "position")
+	snap := state.Snapshot()
+	assert.Equal(t, 37.8, snap.Lat)
+	assert.Equal(t, -122.4, snap.Lon)
+	assert.Equal(t, now, snap.PositionTime)
+
+	// A zero SOG is a real reading at anchor and must replace the previous value
+	state.UpdateNavigation(&Navigation{BaseSensorData: BaseSensorData{Timestamp: now}, SOG: 6.0}, "speedOverGround")
+	state.UpdateNavigation(&Navigation{BaseSensorData: BaseSensorData{Timestamp: now}}, "speedOverGround")
+	assert.Equal(t, 0.0, state.Snapshot().SOG)
+	assert.Equal(t, now, state.Snapshot().SOGTime)
+
+	// A position without coordinates is ignored
+	state.UpdateNavigation(&Navigation{BaseSensorData: BaseSensorData{Timestamp: now}}, "position")
+	assert.Equal(t, 37.8, state.Snapshot().Lat)
+}
+
+func TestVesselStateUpdateWind(t *testing.T) {
+	state := &VesselState{}
+	now := time.Now()
+
+	state.UpdateWind(&Wind{BaseSensorData: BaseSensorData{Timestamp: now}, SpeedApp: 15.0}, "speedApparent")
+	state.UpdateWind(&Wind{BaseSensorData: BaseSensorData{Timestamp: now}, AngleApp: 45.0}, "angleApparent")
+	snap := state.Snapshot()
+	assert.Equal(t, 15.0, snap.WindSpeedApp)
+	assert.Equal(t, 45.0, snap.WindAngleApp)
+	assert.Equal(t, now, snap.WindTime)
+
+	// Unrelated measurements do not touch the wind time
+	state.UpdateWind(&Wind{BaseSensorData: BaseSensorData{Timestamp: now.Add(time.Hour)}}, "speedOverGround")
+	assert.Equal(t, now, state.Snapshot().WindTime)
+}
+
+func TestVesselStateUpdateGNSS(t *testing.T) {
+	state := &VesselState{}
+	now := time.Now()
+
+	state.UpdateGNSS(&GNSS{BaseSensorData: BaseSensorData{Timestamp: now}, HozDilution: 1.2}, "horizontalDilution")
+	state.UpdateGNSS(&GNSS{BaseSensorData: BaseSensorData{Timestamp: now.Add(time.Second)}, Satellites: 9}, "satellites")
+	snap := state.Snapshot()
+	assert.Equal(t, 1.2, snap.HozDilution)
+	assert.Equal(t, now, snap.HDOPTime)
+	assert.Equal(t, int64(9), snap.Satellites)
+	assert.Equal(t, now.Add(time.Second), snap.SatellitesTime)
+}
@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -32,9 +30,31 @@ type Water struct {
 	DepthUnderTransducerFt float64 `json:"DepthUnderTransducerFt,omitempty"`
 }
 
+// waterPathMappings are the SignalK paths the water handler parses
+var waterPathMappings = []PathMapping{
+	// My sensor reports in F but SK assumes it is C so converting from K to C actually gives F
+	{Path: "environment.water.temperature", Measurement: "water", Field: "TempF", Conversion: "kelvin-to-celsius"},
+	{Path: "environment.depth.belowTransducer", Measurement: "water", Field: "DepthUnderTransducerFt", Conversion: "meters-to-feet"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "water",
+		TopicsKey:   "waterTopics",
+		Handler:     OnWaterMessage,
+		NewData:     func() SensorData { return &Water{} },
+		Mappings:    waterPathMappings,
+		UpdateState: updateWaterState,
+	})
+}
+
+func updateWaterState(client MQTT.Client, measurement string, data SensorData) {
+	SharedVesselState.UpdateTemperature(data.(*Water), measurement)
+}
+
 // OnWaterMessage is called when a water message is received
 func OnWaterMessage(client MQTT.Client, message MQTT.Message) {
-	go handleWaterMessage(client, message)
+	dispatchMessage(handleWaterMessage, client, message)
 }
 
 // handleWaterMessage processes water messages
@@ -51,34 +71,14 @@ func processWaterData(rawData map[string]any, measurement string, data SensorDat
 		return
 	}
 
-	var err error
-	var floatTmp float64
-
-	switch measurement {
-	case "temperature":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			// My sensor reports in F but SK assumes it is C
-			// So Converting from K to C actually gives F
-			water.TempF = KelvinToCelsius(floatTmp)
-		}
-	case "belowTransducer":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			water.DepthUnderTransducerFt = MetersToFeet(floatTmp)
-		}
-	default:
+	if !applyPathMappings(rawData, measurement, water) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *Water) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -89,13 +89,16 @@ func (meas *Water) ToJSON() string {
 func (meas *Water) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Water: %v", json)
-	if SharedSubscriptionConfig.WaterLogEn {
+	if SharedSubscriptionConfig.Categories["water"].Verbose {
 		log.Info().Msgf("Water: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *Water) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.DepthUnderTransducerFt == 0.0 && meas.TempF == 0.0 {
 		return true
 	}
@@ -105,10 +108,10 @@ func (meas *Water) IsEmpty() bool {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *Water) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.TempF != 0.0 {
+	if meas.TempF != 0.0 || meas.IsPresent("TempF") {
 		measTmp["TempF"] = meas.TempF
 	}
-	if meas.DepthUnderTransducerFt != 0.0 {
+	if meas.DepthUnderTransducerFt != 0.0 || meas.IsPresent("DepthUnderTransducerFt") {
 		measTmp["DepthUnderTransducerFt"] = meas.DepthUnderTransducerFt
 	}
 	return measTmp
@@ -121,7 +124,12 @@ func (meas *Water) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *Water) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.WaterLogEn
+	return SharedSubscriptionConfig.Categories["water"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Water) GetCategory() string {
+	return "water"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
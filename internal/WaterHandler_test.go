@@ -65,7 +65,7 @@ func TestWaterStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.WaterLogEn, water.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["water"].Verbose, water.GetLogEnabled())
 }
 
 func TestProcessWaterData(t *testing.T) {
@@ -17,8 +17,6 @@ along with this program. If not, see <http://www.gnu.org/licenses/>.
 package internal
 
 import (
-	"encoding/json"
-
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
@@ -34,9 +32,32 @@ type Wind struct {
 	DirectionTrue float64 `json:"DirectionTrue,omitempty"`
 }
 
+// windPathMappings are the SignalK paths the wind handler parses
+var windPathMappings = []PathMapping{
+	{Path: "environment.wind.speedOverGround", Measurement: "wind", Field: "SOG", Conversion: "mps-to-knots"},
+	{Path: "environment.wind.directionTrue", Measurement: "wind", Field: "DirectionTrue", Conversion: "radians-to-degrees"},
+	{Path: "environment.wind.speedApparent", Measurement: "wind", Field: "SpeedApp", Conversion: "mps-to-knots"},
+	{Path: "environment.wind.angleApparent", Measurement: "wind", Field: "AngleApp", Conversion: "radians-to-degrees"},
+}
+
+func init() {
+	RegisterCategory(Category{
+		Name:        "wind",
+		TopicsKey:   "windTopics",
+		Handler:     OnWindMessage,
+		NewData:     func() SensorData { return &Wind{} },
+		Mappings:    windPathMappings,
+		UpdateState: updateWindState,
+	})
+}
+
+func updateWindState(client MQTT.Client, measurement string, data SensorData) {
+	SharedVesselState.UpdateWind(data.(*Wind), measurement)
+}
+
 // OnWindMessage is called when a wind message is received
 func OnWindMessage(client MQTT.Client, message MQTT.Message) {
-	go handleWindMessage(client, message)
+	dispatchMessage(handleWindMessage, client, message)
 }
 
 // handleWindMessage processes wind messages
@@ -53,46 +74,14 @@ func processWindData(rawData map[string]any, measurement string, data SensorData
 		return
 	}
 
-	var err error
-	var floatTmp float64
-
-	switch measurement {
-	case "speedOverGround":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			wind.SOG = MetersPerSecondToKnots(floatTmp)
-		}
-	case "directionTrue":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			wind.DirectionTrue = RadiansToDegrees(floatTmp)
-		}
-	case "speedApparent":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			wind.SpeedApp = MetersPerSecondToKnots(floatTmp)
-		}
-	case "angleApparent":
-		floatTmp, err = ParseFloat64(rawData["value"])
-		if err != nil {
-			log.Warn().Msgf("Error parsing float64: %v", err.Error())
-		} else {
-			wind.AngleApp = RadiansToDegrees(floatTmp)
-		}
-	default:
+	if !applyPathMappings(rawData, measurement, wind) {
 		log.Warn().Msgf("Unknown measurement %v", measurement)
 	}
 }
 
 // ToJSON serializes the data to JSON
 func (meas *Wind) ToJSON() string {
-	jsonData, err := json.Marshal(meas)
+	jsonData, err := MarshalSensorJSON(meas)
 	if err != nil {
 		log.Warn().Msgf("Error Serializing JSON: %v", err.Error())
 	}
@@ -103,13 +92,16 @@ func (meas *Wind) ToJSON() string {
 func (meas *Wind) LogJSON() {
 	json := meas.ToJSON()
 	log.Trace().Msgf("Wind: %v", json)
-	if SharedSubscriptionConfig.WindLogEn {
+	if SharedSubscriptionConfig.Categories["wind"].Verbose {
 		log.Info().Msgf("Wind: %v", json)
 	}
 }
 
 // IsEmpty checks if the data has any meaningful values
 func (meas *Wind) IsEmpty() bool {
+	if meas.HasPresent() {
+		return false
+	}
 	if meas.SpeedApp == 0.0 && meas.AngleApp == 0.0 && meas.SOG == 0.0 && meas.DirectionTrue == 0.0 {
 		return true
 	}
@@ -119,16 +111,16 @@ func (meas *Wind) IsEmpty() bool {
 // GetInfluxFields returns fields for InfluxDB
 func (meas *Wind) GetInfluxFields() map[string]interface{} {
 	measTmp := make(map[string]interface{})
-	if meas.SpeedApp != 0.0 {
+	if meas.SpeedApp != 0.0 || meas.IsPresent("SpeedApp") {
 		measTmp["SpeedApp"] = meas.SpeedApp
 	}
-	if meas.AngleApp != 0.0 {
+	if meas.AngleApp != 0.0 || meas.IsPresent("AngleApp") {
 		measTmp["AngleApp"] = meas.AngleApp
 	}
-	if meas.SOG != 0.0 {
+	if meas.SOG != 0.0 || meas.IsPresent("SOG") {
 		measTmp["SOG"] = meas.SOG
 	}
-	if meas.DirectionTrue != 0.0 {
+	if meas.DirectionTrue != 0.0 || meas.IsPresent("DirectionTrue") {
 		measTmp["DirectionTrue"] = meas.DirectionTrue
 	}
 	return measTmp
@@ -141,7 +133,12 @@ func (meas *Wind) ToInfluxPoint() *write.Point {
 
 // GetLogEnabled returns whether logging is enabled for this data type
 func (meas *Wind) GetLogEnabled() bool {
-	return SharedSubscriptionConfig.WindLogEn
+	return SharedSubscriptionConfig.Categories["wind"].Verbose
+}
+
+// GetCategory returns the handler category the data was received on
+func (meas *Wind) GetCategory() string {
+	return "wind"
 }
 
 // GetMeasurementName returns the measurement name for InfluxDB
@@ -71,7 +71,7 @@ func TestWindStruct(t *testing.T) {
 	// Test GetLogEnabled
 	cleanup := SetupTestEnvironment()
 	defer cleanup()
-	assert.Equal(t, SharedSubscriptionConfig.WindLogEn, wind.GetLogEnabled())
+	assert.Equal(t, SharedSubscriptionConfig.Categories["wind"].Verbose, wind.GetLogEnabled())
 }
 
 func TestProcessWindData(t *testing.T) {
@@ -18,6 +18,7 @@ package internal
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
@@ -27,7 +28,34 @@ import (
 // Mock implementations for testing
 
 // MockMQTTClient is a mock implementation of the MQTT.Client interface
-type MockMQTTClient struct{}
+// Subscriptions, SubscriptionQoS and Published record what was sent through it
+type MockMQTTClient struct {
+	mu              sync.Mutex
+	Subscriptions   []string
+	SubscriptionQoS map[string]byte
+	Published       []MockPublish
+}
+
+// MockPublish is one message published through a MockMQTTClient
+type MockPublish struct {
+	Topic    string
+	Qos      byte
+	Retained bool
+	Payload  interface{}
+}
+
+// PublishedTo returns the messages published to a topic
+func (m *MockMQTTClient) PublishedTo(topic string) []MockPublish {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var published []MockPublish
+	for _, pub := range m.Published {
+		if pub.Topic == topic {
+			published = append(published, pub)
+		}
+	}
+	return published
+}
 
 func (m *MockMQTTClient) Connect() MQTT.Token {
 	return &MockToken{}
@@ -36,10 +64,20 @@ func (m *MockMQTTClient) Connect() MQTT.Token {
 func (m *MockMQTTClient) Disconnect(quiesce uint) {}
 
 func (m *MockMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Published = append(m.Published, MockPublish{Topic: topic, Qos: qos, Retained: retained, Payload: payload})
 	return &MockToken{}
 }
 
 func (m *MockMQTTClient) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Subscriptions = append(m.Subscriptions, topic)
+	if m.SubscriptionQoS == nil {
+		m.SubscriptionQoS = make(map[string]byte)
+	}
+	m.SubscriptionQoS[topic] = qos
 	return &MockToken{}
 }
 
@@ -126,8 +164,10 @@ func (m *MockMessage) Payload() []byte {
 func (m *MockMessage) Ack() {}
 
 // MockInfluxWriteAPI is a mock implementation of the influxdb2 WriteAPIBlocking
+// Err is returned from WritePoint to simulate InfluxDB being down
 type MockInfluxWriteAPI struct {
 	Points []*write.Point
+	Err    error
 }
 
 func NewMockInfluxWriteAPI() *MockInfluxWriteAPI {
@@ -137,6 +177,9 @@ func NewMockInfluxWriteAPI() *MockInfluxWriteAPI {
 }
 
 func (m *MockInfluxWriteAPI) WritePoint(ctx context.Context, points ...*write.Point) error {
+	if m.Err != nil {
+		return m.Err
+	}
 	m.Points = append(m.Points, points...)
 	return nil
 }
@@ -158,22 +201,17 @@ func (m *MockInfluxWriteAPI) Flush(ctx context.Context) error {
 
 // TestConfig creates a test configuration for testing
 func TestConfig() *SubscriptionConfig {
+	categories := make(map[string]CategoryConfig)
+	for _, category := range RegisteredCategories() {
+		categories[category.Name] = CategoryConfig{Subscribed: true, Verbose: true}
+	}
 	return &SubscriptionConfig{
+		Categories:      categories,
 		Repost:          true,
 		RepostRootTopic: "test/",
 		InfluxEnabled:   true,
 		N2KtoName:       map[string]string{"test-source": "mapped-source"},
 		MACtoLocation:   map[string]string{"test-mac": "test-location"},
-		WaterLogEn:      true,
-		NavLogEn:        true,
-		WindLogEn:       true,
-		GNSSLogEn:       true,
-		OutsideLogEn:    true,
-		BLELogEn:        true,
-		SteerLogEn:      true,
-		PropLogEn:       true,
-		ESPLogEn:        true,
-		PHYLogEn:        true,
 		PublishTimeout:  1000,
 	}
 }
@@ -194,7 +232,9 @@ func SetupTestEnvironment() func() {
 	SharedInfluxWriteAPI = mockWriteAPI
 
 	// Return a function to restore original values
+	// Handlers still running would otherwise write into the next test's mocks
 	return func() {
+		waitForHandlers()
 		SharedSubscriptionConfig = originalConfig
 		SharedInfluxWriteAPI = originalInfluxWriteAPI
 	}